@@ -1,6 +1,13 @@
 package config
 
 import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+
 	"github.com/armosec/utils-k8s-go/armometadata"
 	"github.com/kubescape/backend/pkg/utils"
 )
@@ -13,14 +20,127 @@ type IConfig interface {
 	GatewayRestURL() string
 	EventReceiverWebsocketURL() string
 	ClusterConfig() *armometadata.ClusterConfig
+	NamespaceFilter() NamespaceFilter
+	ResourceSelectors() map[string]ResourceSelector
+	RedactionRules() []RedactionRule
+	RedactionSalt() string
+	Settings() Settings
+}
+
+// watched resources, used as keys of the resource selectors
+const (
+	ClusterRoleBindingsResource = "clusterrolebindings"
+	ClusterRolesResource        = "clusterroles"
+	CronJobsResource            = "cronjobs"
+	EventsResource              = "events"
+	GatewaysResource            = "gateways"
+	HTTPRoutesResource          = "httproutes"
+	IngressesResource           = "ingresses"
+	NamespacesResource          = "namespaces"
+	NetworkPoliciesResource     = "networkpolicies"
+	NodesResource               = "nodes"
+	PodsResource                = "pods"
+	RoleBindingsResource        = "rolebindings"
+	RolesResource               = "roles"
+	SecretsResource             = "secrets"
+	ServiceAccountsResource     = "serviceaccounts"
+	ServicesResource            = "services"
+)
+
+// WatchedResources lists the resources kollector watches
+var WatchedResources = []string{ClusterRoleBindingsResource, ClusterRolesResource, CronJobsResource, EventsResource, GatewaysResource,
+	HTTPRoutesResource, IngressesResource, NamespacesResource, NetworkPoliciesResource, NodesResource, PodsResource, RoleBindingsResource,
+	RolesResource, SecretsResource, ServiceAccountsResource, ServicesResource}
+
+// triggers, the cluster events the in-cluster components are notified of, used as keys of the trigger commands
+const (
+	NewImageTrigger           = "newImage"
+	NewNamespaceTrigger       = "newNamespace"
+	NewNodeTrigger            = "newNode"
+	WorkloadSpecChangeTrigger = "workloadSpecChange"
+)
+
+// Triggers lists the triggers
+var Triggers = []string{NewImageTrigger, NewNamespaceTrigger, NewNodeTrigger, WorkloadSpecChangeTrigger}
+
+// ResourceSelector holds the server side selectors of a watched resource
+type ResourceSelector struct {
+	// LabelSelector e.g. "app.kubernetes.io/part-of=payments"
+	LabelSelector string `json:"labelSelector,omitempty"`
+	// FieldSelector e.g. "status.phase!=Succeeded" for pods or "type!=helm.sh/release.v1" for secrets
+	FieldSelector string `json:"fieldSelector,omitempty"`
+}
+
+// NamespaceFilter defines which namespaces are watched and reported
+type NamespaceFilter struct {
+	// Include is a list of namespace globs to watch, empty means all namespaces
+	Include []string `json:"include,omitempty"`
+	// Exclude is a list of namespace globs to ignore, it takes precedence over Include
+	Exclude []string `json:"exclude,omitempty"`
+	// LabelSelector selects namespaces by their labels, e.g. "team=payments" or "kubernetes.io/metadata.name!=kube-system"
+	LabelSelector string `json:"labelSelector,omitempty"`
 }
 
-// KollectorConfig implements IConfig
+// redaction actions
+const (
+	RedactionActionDrop = "drop"
+	RedactionActionHash = "hash"
+)
+
+// RedactionRule drops or hashes fields of the reported objects before they are sent
+type RedactionRule struct {
+	// Kind is the report section the rule applies to: node, service, microservice, pod, secret, namespace, crash, event,
+	// image, exposure, networkPolicy, networkIsolation or permission
+	Kind string `json:"kind"`
+	// Path is a JSONPath-style path, e.g. "spec.containers[*].env[*].value" or "metadata.annotations['example.com/token']"
+	Path string `json:"path"`
+	// Action is either "drop" or "hash"
+	Action string `json:"action"`
+	// Match is an optional regular expression, when set only string values matching it are redacted
+	Match string `json:"match,omitempty"`
+}
+
+// RedactionPolicy is the content of the redaction policy file
+type RedactionPolicy struct {
+	// Salt keys the HMAC-SHA256 of the hashed values. Without it a random salt is used, so the hashes change when kollector restarts
+	Salt  string          `json:"salt,omitempty"`
+	Rules []RedactionRule `json:"rules"`
+}
+
+// LoadRedactionPolicy loads the redaction rules and the salt from a JSON policy file
+func LoadRedactionPolicy(path string) (*RedactionPolicy, error) {
+	policyBytes, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	policy := RedactionPolicy{}
+	if err := json.Unmarshal(policyBytes, &policy); err != nil {
+		return nil, fmt.Errorf("failed to parse redaction policy %s: %s", path, err.Error())
+	}
+	return &policy, nil
+}
+
+// splitList splits a comma separated list, dropping empty items
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// KollectorConfig implements IConfig. It is safe for concurrent use, since it may be reloaded while running
 type KollectorConfig struct {
+	mutex                     sync.RWMutex
 	accountID                 string
 	accessKey                 string
 	clusterConfig             *armometadata.ClusterConfig
 	eventReceiverWebsocketURL string
+	settings                  Settings
+	redactionRules            []RedactionRule
+	redactionSalt             string
 }
 
 func NewKollectorConfig(clusterConfig *armometadata.ClusterConfig, credentials utils.Credentials, eventReceiverWebsocketURL string) *KollectorConfig {
@@ -32,26 +152,117 @@ func NewKollectorConfig(clusterConfig *armometadata.ClusterConfig, credentials u
 	}
 }
 
+// SetSettings sets the settings of kollector itself
+func (k *KollectorConfig) SetSettings(settings Settings) *KollectorConfig {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+	k.settings = settings
+	return k
+}
+
+// SetRedactionRules sets the redaction rules applied to the reported objects
+func (k *KollectorConfig) SetRedactionRules(redactionRules []RedactionRule) *KollectorConfig {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+	k.redactionRules = redactionRules
+	return k
+}
+
+// SetRedactionSalt sets the salt of the hashed values
+func (k *KollectorConfig) SetRedactionSalt(redactionSalt string) *KollectorConfig {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+	k.redactionSalt = redactionSalt
+	return k
+}
+
+// update copies the values of a newly loaded config, returns true if any of them changed
+func (k *KollectorConfig) update(loaded *KollectorConfig) bool {
+	loaded.mutex.RLock()
+	defer loaded.mutex.RUnlock()
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+	if k.accountID == loaded.accountID &&
+		k.accessKey == loaded.accessKey &&
+		k.eventReceiverWebsocketURL == loaded.eventReceiverWebsocketURL &&
+		reflect.DeepEqual(k.clusterConfig, loaded.clusterConfig) &&
+		reflect.DeepEqual(k.settings, loaded.settings) &&
+		reflect.DeepEqual(k.redactionRules, loaded.redactionRules) &&
+		k.redactionSalt == loaded.redactionSalt {
+		return false
+	}
+	k.accountID = loaded.accountID
+	k.accessKey = loaded.accessKey
+	k.clusterConfig = loaded.clusterConfig
+	k.eventReceiverWebsocketURL = loaded.eventReceiverWebsocketURL
+	k.settings = loaded.settings
+	k.redactionRules = loaded.redactionRules
+	k.redactionSalt = loaded.redactionSalt
+	return true
+}
+
 func (k *KollectorConfig) EventReceiverWebsocketURL() string {
+	k.mutex.RLock()
+	defer k.mutex.RUnlock()
 	return k.eventReceiverWebsocketURL
 }
 
 func (k *KollectorConfig) ClusterName() string {
+	k.mutex.RLock()
+	defer k.mutex.RUnlock()
 	return k.clusterConfig.ClusterName
 }
 
 func (k *KollectorConfig) AccountID() string {
+	k.mutex.RLock()
+	defer k.mutex.RUnlock()
 	return k.accountID
 }
 
 func (k *KollectorConfig) AccessKey() string {
+	k.mutex.RLock()
+	defer k.mutex.RUnlock()
 	return k.accessKey
 }
 
 func (k *KollectorConfig) ClusterConfig() *armometadata.ClusterConfig {
+	k.mutex.RLock()
+	defer k.mutex.RUnlock()
 	return k.clusterConfig
 }
 
 func (k *KollectorConfig) GatewayRestURL() string {
+	k.mutex.RLock()
+	defer k.mutex.RUnlock()
 	return k.clusterConfig.GatewayRestURL
 }
+
+func (k *KollectorConfig) NamespaceFilter() NamespaceFilter {
+	k.mutex.RLock()
+	defer k.mutex.RUnlock()
+	return k.settings.NamespaceFilter
+}
+
+func (k *KollectorConfig) ResourceSelectors() map[string]ResourceSelector {
+	k.mutex.RLock()
+	defer k.mutex.RUnlock()
+	return k.settings.ResourceSelectors
+}
+
+func (k *KollectorConfig) RedactionRules() []RedactionRule {
+	k.mutex.RLock()
+	defer k.mutex.RUnlock()
+	return k.redactionRules
+}
+
+func (k *KollectorConfig) RedactionSalt() string {
+	k.mutex.RLock()
+	defer k.mutex.RUnlock()
+	return k.redactionSalt
+}
+
+func (k *KollectorConfig) Settings() Settings {
+	k.mutex.RLock()
+	defer k.mutex.RUnlock()
+	return k.settings
+}
@@ -0,0 +1,245 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/armosec/utils-k8s-go/armometadata"
+	"github.com/fsnotify/fsnotify"
+	"github.com/kubescape/backend/pkg/servicediscovery"
+	v2 "github.com/kubescape/backend/pkg/servicediscovery/v2"
+	"github.com/kubescape/backend/pkg/utils"
+	logger "github.com/kubescape/go-logger"
+	"github.com/kubescape/go-logger/helpers"
+)
+
+// DefaultReloadInterval is how often the configuration files are checked for changes
+const DefaultReloadInterval = 30 * time.Second
+
+// configChangeDelay is the delay before the changed configuration files are reloaded, the files of a change are
+// usually written together
+var configChangeDelay = time.Second
+
+// ConfigFiles are the files the configuration is loaded from
+type ConfigFiles struct {
+	ClusterConfig   string `json:"clusterConfig"`
+	Services        string `json:"services"`
+	Credentials     string `json:"credentials"`
+	RedactionPolicy string `json:"redactionPolicy,omitempty"`
+}
+
+// LoadKollectorConfig loads the configuration files listed in the settings, missing credentials are tolerated
+func LoadKollectorConfig(settings Settings) (*KollectorConfig, error) {
+	return loadKollectorConfig(settings, false)
+}
+
+// loadKollectorConfig loads the configuration files, on reload the credentials must be readable since empty ones would
+// replace the current ones, e.g. while they are rotated
+func loadKollectorConfig(settings Settings, reload bool) (*KollectorConfig, error) {
+	files := settings.Files
+	clusterConfig, err := armometadata.LoadConfig(files.ClusterConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config: %w", err)
+	}
+
+	services, err := servicediscovery.GetServices(v2.NewServiceDiscoveryFileV2(files.Services))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load services: %w", err)
+	}
+
+	credentials, err := utils.LoadCredentialsFromFile(files.Credentials)
+	if err != nil && reload {
+		return nil, fmt.Errorf("failed to load credentials: %w", err)
+	}
+	if err != nil {
+		logger.L().Error("failed to load credentials", helpers.Error(err))
+		credentials = &utils.Credentials{}
+	}
+
+	kollectorConfig := NewKollectorConfig(clusterConfig, *credentials, services.GetReportReceiverWebsocketUrl()).
+		SetSettings(settings)
+
+	if files.RedactionPolicy != "" {
+		redactionPolicy, err := LoadRedactionPolicy(files.RedactionPolicy)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load redaction policy: %w", err)
+		}
+		kollectorConfig.SetRedactionRules(redactionPolicy.Rules).SetRedactionSalt(redactionPolicy.Salt)
+	}
+	return kollectorConfig, nil
+}
+
+// LoadSnapshotConfig loads the configuration needed to collect a snapshot or for a dry run. The services and credentials are
+// not needed, and a missing cluster config is tolerated since snapshots may be taken from outside the cluster
+func LoadSnapshotConfig(settings Settings) (*KollectorConfig, error) {
+	clusterConfig, err := armometadata.LoadConfig(settings.Files.ClusterConfig)
+	if err != nil {
+		logger.L().Warning("failed to load config, the installation data will be empty", helpers.Error(err))
+		clusterConfig = &armometadata.ClusterConfig{}
+	}
+	kollectorConfig := NewKollectorConfig(clusterConfig, utils.Credentials{}, "").SetSettings(settings)
+
+	if settings.Files.RedactionPolicy != "" {
+		redactionPolicy, err := LoadRedactionPolicy(settings.Files.RedactionPolicy)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load redaction policy: %w", err)
+		}
+		kollectorConfig.SetRedactionRules(redactionPolicy.Rules).SetRedactionSalt(redactionPolicy.Salt)
+	}
+	return kollectorConfig, nil
+}
+
+// FileProvider provides a KollectorConfig backed by the settings and the configuration files. They are
+// reloaded periodically and the subscribers are notified whenever the configuration changed
+type FileProvider struct {
+	config *KollectorConfig
+	load   func(reload bool) (*KollectorConfig, error)
+	// files are the configuration files, their directories are watched
+	files       []string
+	subscribers []func()
+	mutex       sync.Mutex
+}
+
+// NewFileProvider loads the settings from the command line arguments and the environment, then the configuration files
+func NewFileProvider(args []string) (*FileProvider, error) {
+	provider := &FileProvider{load: func(reload bool) (*KollectorConfig, error) {
+		settings, err := LoadSettings(args)
+		if err != nil {
+			return nil, err
+		}
+		if settings.DryRun {
+			return LoadSnapshotConfig(settings)
+		}
+		return loadKollectorConfig(settings, reload)
+	}}
+	kollectorConfig, err := provider.load(false)
+	if err != nil {
+		return nil, err
+	}
+	provider.config = kollectorConfig
+	settings := kollectorConfig.Settings()
+	provider.files = []string{settings.SettingsFile, settings.Files.ClusterConfig, settings.Files.Services,
+		settings.Files.Credentials, settings.Files.RedactionPolicy}
+	return provider, nil
+}
+
+// Config returns the configuration, its values are updated in place on reload
+func (p *FileProvider) Config() *KollectorConfig {
+	return p.config
+}
+
+// Subscribe registers a callback called after the configuration changed
+func (p *FileProvider) Subscribe(callback func()) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.subscribers = append(p.subscribers, callback)
+}
+
+// Reload reloads the configuration files and notifies the subscribers if anything changed.
+// In case of an error the current configuration is kept
+func (p *FileProvider) Reload() (bool, error) {
+	loaded, err := p.load(true)
+	if err != nil {
+		return false, err
+	}
+	// a credentials file being rotated may be empty for a moment
+	if (p.config.AccountID() != "" && loaded.AccountID() == "") || (p.config.AccessKey() != "" && loaded.AccessKey() == "") {
+		return false, fmt.Errorf("the credentials are incomplete")
+	}
+	if !p.config.update(loaded) {
+		return false, nil
+	}
+	p.mutex.Lock()
+	subscribers := append([]func(){}, p.subscribers...)
+	p.mutex.Unlock()
+	for i := range subscribers {
+		subscribers[i]()
+	}
+	return true, nil
+}
+
+// Run reloads the configuration when its files change, and polls them every interval in case a change is missed,
+// until the context is done. A zero interval disables reloading
+func (p *FileProvider) Run(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	var events <-chan fsnotify.Event
+	var watchErrors <-chan error
+	if watcher, err := p.watch(); err != nil {
+		logger.L().Ctx(ctx).Warning("failed to watch the configuration files, they are polled", helpers.Error(err))
+	} else {
+		defer watcher.Close()
+		events, watchErrors = watcher.Events, watcher.Errors
+	}
+	// the events of a change, e.g. the symlinks swapped by a ConfigMap update, are reloaded once
+	var changed <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case _, ok := <-events:
+			if !ok {
+				events = nil
+				continue
+			}
+			if changed == nil {
+				changed = time.After(configChangeDelay)
+			}
+		case err, ok := <-watchErrors:
+			if !ok {
+				watchErrors = nil
+				continue
+			}
+			logger.L().Ctx(ctx).Warning("watching the configuration files", helpers.Error(err))
+		case <-changed:
+			changed = nil
+			p.reload(ctx)
+		case <-ticker.C:
+			p.reload(ctx)
+		}
+	}
+}
+
+func (p *FileProvider) reload(ctx context.Context) {
+	changed, err := p.Reload()
+	if err != nil {
+		logger.L().Ctx(ctx).Error("failed to reload config, keeping the current one", helpers.Error(err))
+	} else if changed {
+		logger.L().Info("config reloaded")
+	}
+}
+
+// watch watches the directories of the configuration files, a ConfigMap or a Secret volume is updated by replacing a
+// symlink in the directory of its files
+func (p *FileProvider) watch() (*fsnotify.Watcher, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	watched := map[string]bool{}
+	for _, file := range p.files {
+		if file == "" {
+			continue
+		}
+		dir := file
+		if info, err := os.Stat(file); err != nil || !info.IsDir() {
+			dir = filepath.Dir(file)
+		}
+		if watched[dir] {
+			continue
+		}
+		if err := watcher.Add(dir); err != nil {
+			watcher.Close()
+			return nil, fmt.Errorf("failed to watch %s: %w", dir, err)
+		}
+		watched[dir] = true
+	}
+	return watcher, nil
+}
@@ -0,0 +1,129 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/armosec/utils-k8s-go/armometadata"
+	"github.com/kubescape/backend/pkg/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileProviderReload(t *testing.T) {
+	clusterConfig := &armometadata.ClusterConfig{ClusterName: "cluster"}
+	loaded := NewKollectorConfig(clusterConfig, utils.Credentials{Account: "account", AccessKey: "key"}, "wss://er")
+	var loadErr error
+	provider := &FileProvider{
+		config: NewKollectorConfig(clusterConfig, utils.Credentials{Account: "account", AccessKey: "key"}, "wss://er"),
+		load:   func(bool) (*KollectorConfig, error) { return loaded, loadErr },
+	}
+	notified := 0
+	provider.Subscribe(func() { notified++ })
+
+	changed, err := provider.Reload()
+	assert.NoError(t, err)
+	assert.False(t, changed)
+	assert.Equal(t, 0, notified)
+
+	loaded = NewKollectorConfig(clusterConfig, utils.Credentials{Account: "account", AccessKey: "rotated"}, "wss://er").
+		SetSettings(Settings{NamespaceFilter: NamespaceFilter{Exclude: []string{"kube-system"}}})
+	changed, err = provider.Reload()
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	assert.Equal(t, 1, notified)
+	assert.Equal(t, "rotated", provider.Config().AccessKey())
+	assert.Equal(t, []string{"kube-system"}, provider.Config().NamespaceFilter().Exclude)
+
+	loadErr = errors.New("missing file")
+	changed, err = provider.Reload()
+	assert.Error(t, err)
+	assert.False(t, changed)
+	assert.Equal(t, "rotated", provider.Config().AccessKey())
+
+	loadErr = nil
+	loaded = NewKollectorConfig(clusterConfig, utils.Credentials{Account: "account"}, "wss://er")
+	changed, err = provider.Reload()
+	assert.Error(t, err, "the access key file is being rotated")
+	assert.False(t, changed)
+	assert.Equal(t, "rotated", provider.Config().AccessKey())
+}
+
+func TestLoadKollectorConfigCredentials(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "clusterData.json"), []byte(`{"clusterName":"cluster"}`), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "services.json"), []byte(`{"version":"v2","response":{"event-receiver-ws":"wss://er"}}`), 0o600))
+	settings := DefaultSettings()
+	settings.Files = ConfigFiles{ClusterConfig: filepath.Join(dir, "clusterData.json"), Services: filepath.Join(dir, "services.json"),
+		Credentials: filepath.Join(dir, "credentials")}
+
+	kollectorConfig, err := LoadKollectorConfig(settings)
+	require.NoError(t, err, "missing credentials are tolerated at startup")
+	assert.Empty(t, kollectorConfig.AccessKey())
+	_, err = loadKollectorConfig(settings, true)
+	assert.Error(t, err, "missing credentials are not reloaded")
+}
+
+func TestFileProviderWatchesFiles(t *testing.T) {
+	delay := configChangeDelay
+	configChangeDelay = 10 * time.Millisecond
+	t.Cleanup(func() { configChangeDelay = delay })
+	dir := t.TempDir()
+	file := filepath.Join(dir, "settings.json")
+	require.NoError(t, os.WriteFile(file, []byte("{}"), 0o600))
+	clusterConfig := &armometadata.ClusterConfig{ClusterName: "cluster"}
+	provider := &FileProvider{
+		config: NewKollectorConfig(clusterConfig, utils.Credentials{}, "wss://er"),
+		load: func(bool) (*KollectorConfig, error) {
+			return NewKollectorConfig(clusterConfig, utils.Credentials{}, "wss://rotated"), nil
+		},
+		files: []string{file},
+	}
+	notified := make(chan struct{}, 1)
+	provider.Subscribe(func() { notified <- struct{}{} })
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go provider.Run(ctx, time.Hour)
+
+	// the watch may not be established yet, the file is written until the change is seen
+	require.Eventually(t, func() bool {
+		require.NoError(t, os.WriteFile(file, []byte(`{"waitBeforeReport":"1s"}`), 0o600))
+		select {
+		case <-notified:
+			return true
+		default:
+			return false
+		}
+	}, 5*time.Second, 50*time.Millisecond)
+	assert.Equal(t, "wss://rotated", provider.Config().EventReceiverWebsocketURL())
+}
+
+func TestNewFileProviderDryRun(t *testing.T) {
+	dir := t.TempDir()
+	args := []string{"--config", filepath.Join(dir, "clusterData.json"), "--services-file", filepath.Join(dir, "services.json"), "--namespace", "kubescape"}
+
+	_, err := NewFileProvider(args)
+	assert.Error(t, err, "the services are needed to reach the event receiver")
+
+	provider, err := NewFileProvider(append(args, "--dry-run"))
+	assert.NoError(t, err, "a dry run needs neither the services nor the credentials")
+	assert.True(t, provider.Config().Settings().DryRun)
+}
+
+func TestLoadSnapshotConfigRedactionPolicy(t *testing.T) {
+	dir := t.TempDir()
+	policy := filepath.Join(dir, "policy.json")
+	require.NoError(t, os.WriteFile(policy, []byte(`{"salt":"installation","rules":[{"kind":"pod","path":"spec","action":"hash"}]}`), 0o600))
+	settings := DefaultSettings()
+	settings.Files.ClusterConfig = filepath.Join(dir, "clusterData.json")
+	settings.Files.RedactionPolicy = policy
+
+	kollectorConfig, err := LoadSnapshotConfig(settings)
+	require.NoError(t, err)
+	assert.Equal(t, "installation", kollectorConfig.RedactionSalt())
+	assert.Equal(t, []RedactionRule{{Kind: "pod", Path: "spec", Action: RedactionActionHash}}, kollectorConfig.RedactionRules())
+}
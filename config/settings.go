@@ -0,0 +1,590 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/armosec/utils-go/boolutils"
+	"github.com/armosec/utils-k8s-go/armometadata"
+	"github.com/kubescape/kollector/consts"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// Settings are the settings of kollector itself. They are layered: the defaults, then the settings file,
+// then the environment and finally the command line flags
+type Settings struct {
+	// SettingsFile is an optional JSON file with the settings, it is set by the environment or the flags
+	SettingsFile string      `json:"settingsFile,omitempty"`
+	Files        ConfigFiles `json:"files"`
+	// Namespace is the namespace kollector runs in, it is excluded when no namespaces are excluded explicitly
+	Namespace         string                      `json:"namespace,omitempty"`
+	NamespaceFilter   NamespaceFilter             `json:"namespaceFilter"`
+	ResourceSelectors map[string]ResourceSelector `json:"resourceSelectors,omitempty"`
+	WebSocket         WebSocketSettings           `json:"websocket"`
+	// CrashLogTailLines is the number of log lines reported from the end of the log of a crashed container
+	CrashLogTailLines int64 `json:"crashLogTailLines"`
+	// Crashes is the sampling policy of the crash reports
+	Crashes CrashReportSettings `json:"crashes"`
+	// ActivateScanOnNewImage notifies the in-cluster components when a new image runs in the cluster
+	ActivateScanOnNewImage bool `json:"activateScanOnNewImage"`
+	// ActivatePostureScanOnNewNamespace notifies the in-cluster components when a namespace is created
+	ActivatePostureScanOnNewNamespace bool `json:"activatePostureScanOnNewNamespace"`
+	// ActivateConfigScanOnWorkloadChange notifies the in-cluster components when a workload runs a new pod spec
+	ActivateConfigScanOnWorkloadChange bool `json:"activateConfigScanOnWorkloadChange"`
+	// ActivateScanOnNewNode notifies the in-cluster components when a node joins the cluster
+	ActivateScanOnNewNode bool `json:"activateScanOnNewNode"`
+	// TriggerCommands are the commands sent to the in-cluster components for each trigger, e.g. "newNamespace": ["kubescapeScan"]
+	TriggerCommands map[string][]string `json:"triggerCommands"`
+	// Notifier is the delivery policy of the scan notifications
+	Notifier NotifierSettings `json:"notifier"`
+	// OtelCollectorSvc enables otel when set, e.g. "otel-collector:4317"
+	OtelCollectorSvc string `json:"otelCollectorSvc,omitempty"`
+	// Release is the image version
+	Release string `json:"release,omitempty"`
+	// RecordEventsFile is an NDJSON file the watch events are appended to, they can be replayed with "kollector replay"
+	RecordEventsFile string `json:"recordEventsFile,omitempty"`
+	// ReloadInterval is how often the configuration files are polled besides being watched, 0 disables reloading
+	ReloadInterval Duration `json:"reloadInterval"`
+	// ClusterInfoRefreshInterval is how often the API server version is checked, a change is reported
+	ClusterInfoRefreshInterval Duration `json:"clusterInfoRefreshInterval"`
+	// ShutdownTimeout is how long the pending reports are flushed on shutdown before the connection is closed
+	ShutdownTimeout Duration `json:"shutdownTimeout"`
+	// DryRun writes the reports to DryRunOutput instead of sending them, no credentials or event receiver are needed
+	DryRun bool `json:"dryRun"`
+	// DryRunOutput is the file the dry run reports are appended to, one per line. By default they are pretty-printed to stdout
+	DryRunOutput string `json:"dryRunOutput,omitempty"`
+	// PrintConfig prints the effective settings and exits
+	PrintConfig bool `json:"-"`
+}
+
+// WebSocketSettings are the settings of the connection to the event receiver
+type WebSocketSettings struct {
+	// WaitBeforeReport is the delay before (re)connecting to the event receiver
+	WaitBeforeReport Duration `json:"waitBeforeReport"`
+	// ConnectRetries is the number of dial attempts before giving up
+	ConnectRetries int `json:"connectRetries"`
+	// PingInterval is the interval of the ping messages, the connection is closed after 3 missed pongs
+	PingInterval Duration `json:"pingInterval"`
+}
+
+// CrashReportSettings decide which restarts of a crash looping container are reported
+type CrashReportSettings struct {
+	// MaxRestartCount reports every crash up to this restart count
+	MaxRestartCount int32 `json:"maxRestartCount"`
+	// SampleEvery reports every Nth restart past MaxRestartCount, 0 reports none
+	SampleEvery int32 `json:"sampleEvery"`
+	// LogTailMaxBytes caps the reported log tail, the oldest lines are cut
+	LogTailMaxBytes int `json:"logTailMaxBytes"`
+}
+
+// NotifierSettings are the queue, retry and rate limit settings of the scan notifications
+type NotifierSettings struct {
+	// QueueSize is the number of pending notifications, a notification is dropped when the queue is full
+	QueueSize int `json:"queueSize"`
+	// MaxRetries is the number of retries of a failed notification, the backoff doubles from RetryBackoff
+	MaxRetries   int      `json:"maxRetries"`
+	RetryBackoff Duration `json:"retryBackoff"`
+	// DeduplicationWindow is how long a sent notification of a workload and images is not sent again
+	DeduplicationWindow Duration `json:"deduplicationWindow"`
+	// MinInterval is the minimal interval between two notifications
+	MinInterval Duration `json:"minInterval"`
+	// Timeout is the timeout of a notification request
+	Timeout Duration `json:"timeout"`
+}
+
+// Duration is a time.Duration written as a string, e.g. "30s", in the settings file
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return fmt.Errorf("duration should be a string like \"30s\": %s", err.Error())
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return err
+	}
+	*d = Duration(duration)
+	return nil
+}
+
+// DefaultSettings returns the settings used when nothing else is configured
+func DefaultSettings() Settings {
+	return Settings{
+		Files: ConfigFiles{
+			ClusterConfig: armometadata.DefaultConfigPath,
+			Services:      "/etc/config/services.json",
+			Credentials:   "/etc/credentials",
+		},
+		WebSocket: WebSocketSettings{
+			WaitBeforeReport: Duration(30 * time.Second),
+			ConnectRetries:   60,
+			PingInterval:     Duration(10 * time.Second),
+		},
+		CrashLogTailLines:          50,
+		ReloadInterval:             Duration(DefaultReloadInterval),
+		ShutdownTimeout:            Duration(10 * time.Second),
+		ClusterInfoRefreshInterval: Duration(5 * time.Minute),
+		Crashes: CrashReportSettings{
+			MaxRestartCount: 2,
+			LogTailMaxBytes: 8 * 1024,
+		},
+		TriggerCommands: map[string][]string{
+			NewImageTrigger:           {"scan"},
+			NewNamespaceTrigger:       {"kubescapeScan"},
+			NewNodeTrigger:            {"kubescapeScan"},
+			WorkloadSpecChangeTrigger: {"kubescapeScan"},
+		},
+		Notifier: NotifierSettings{
+			QueueSize:           100,
+			MaxRetries:          5,
+			RetryBackoff:        Duration(time.Second),
+			DeduplicationWindow: Duration(5 * time.Minute),
+			MinInterval:         Duration(time.Second),
+			Timeout:             Duration(10 * time.Second),
+		},
+	}
+}
+
+// LoadSettings layers the defaults, the settings file, the environment and the command line flags, and validates the result.
+// extraFlags registers flags that are not settings, e.g. the flags of a sub command
+func LoadSettings(args []string, extraFlags ...func(*flag.FlagSet)) (Settings, error) {
+	// the settings file may be set by a flag, so the flags are parsed once before the file is read
+	settingsFile := os.Getenv(consts.SettingsFileEnvironmentVariable)
+	preParsed := DefaultSettings()
+	preFlags := newFlagSet(&preParsed, io.Discard, extraFlags...)
+	if err := preFlags.Parse(args); err != nil {
+		return Settings{}, err
+	}
+	if preParsed.SettingsFile != "" {
+		settingsFile = preParsed.SettingsFile
+	}
+
+	settings := DefaultSettings()
+	if settingsFile != "" {
+		if err := settings.loadFile(settingsFile); err != nil {
+			return Settings{}, err
+		}
+		settings.SettingsFile = settingsFile
+	}
+	if err := settings.loadEnv(); err != nil {
+		return Settings{}, err
+	}
+	if err := newFlagSet(&settings, os.Stderr, extraFlags...).Parse(args); err != nil {
+		return Settings{}, err
+	}
+
+	if settings.NamespaceFilter.Exclude == nil && settings.Namespace != "" {
+		settings.NamespaceFilter.Exclude = []string{settings.Namespace}
+	}
+	if err := settings.Validate(); err != nil {
+		return Settings{}, fmt.Errorf("invalid settings: %w", err)
+	}
+	return settings, nil
+}
+
+func (s *Settings) loadFile(settingsFile string) error {
+	settingsBytes, err := os.ReadFile(settingsFile)
+	if err != nil {
+		return fmt.Errorf("failed to read settings file: %s", err.Error())
+	}
+	decoder := json.NewDecoder(bytes.NewReader(settingsBytes))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(s); err != nil {
+		return fmt.Errorf("failed to parse settings file %s: %s", settingsFile, err.Error())
+	}
+	return nil
+}
+
+func (s *Settings) loadEnv() error {
+	setString := func(envVar string, value *string) {
+		if envValue, present := os.LookupEnv(envVar); present {
+			*value = envValue
+		}
+	}
+	setString(consts.ConfigEnvironmentVariable, &s.Files.ClusterConfig)
+	setString(consts.ServicesFileEnvironmentVariable, &s.Files.Services)
+	setString(consts.CredentialsDirEnvironmentVariable, &s.Files.Credentials)
+	setString(consts.RedactionPolicyFileEnvironmentVariable, &s.Files.RedactionPolicy)
+	setString(consts.NamespaceEnvironmentVariable, &s.Namespace)
+	setString(consts.NamespaceLabelSelectorEnvironmentVariable, &s.NamespaceFilter.LabelSelector)
+	setString(consts.OtelCollectorSvcEnvironmentVariable, &s.OtelCollectorSvc)
+	setString(consts.ReleaseBuildTagEnvironmentVariable, &s.Release)
+	setString(consts.RecordEventsFileEnvironmentVariable, &s.RecordEventsFile)
+	setString(consts.DryRunOutputEnvironmentVariable, &s.DryRunOutput)
+
+	if include, present := os.LookupEnv(consts.IncludeNamespacesEnvironmentVariable); present {
+		s.NamespaceFilter.Include = splitList(include)
+	}
+	if exclude, present := os.LookupEnv(consts.ExcludeNamespacesEnvironmentVariable); present {
+		// an empty exclude list means no namespace is excluded, not even the component namespace
+		s.NamespaceFilter.Exclude = append([]string{}, splitList(exclude)...)
+	}
+	for _, resource := range selectableResources() {
+		(&selectorValue{settings: s, resource: resource}).setFromEnv(strings.ToUpper(resource) + consts.LabelSelectorEnvironmentVariableSuffix)
+		(&selectorValue{settings: s, resource: resource, field: true}).setFromEnv(strings.ToUpper(resource) + consts.FieldSelectorEnvironmentVariableSuffix)
+	}
+	setBool := func(envVar string, value *bool) {
+		if envValue, present := os.LookupEnv(envVar); present {
+			*value = boolutils.StringToBool(envValue)
+		}
+	}
+	setBool(consts.ActivateScanOnNewImageFeatureEnvironmentVariable, &s.ActivateScanOnNewImage)
+	setBool(consts.ActivatePostureScanOnNewNamespaceFeatureEnvironmentVariable, &s.ActivatePostureScanOnNewNamespace)
+	setBool(consts.ActivateConfigScanOnWorkloadChangeFeatureEnvironmentVariable, &s.ActivateConfigScanOnWorkloadChange)
+	setBool(consts.ActivateScanOnNewNodeFeatureEnvironmentVariable, &s.ActivateScanOnNewNode)
+	setBool(consts.DryRunEnvironmentVariable, &s.DryRun)
+
+	errs := []error{
+		setEnvDuration(consts.WaitBeforeReportEnvironmentVariable, &s.WebSocket.WaitBeforeReport),
+		setEnvDuration(consts.PingIntervalEnvironmentVariable, &s.WebSocket.PingInterval),
+		setEnvDuration(consts.ReloadIntervalEnvironmentVariable, &s.ReloadInterval),
+		setEnvDuration(consts.ShutdownTimeoutEnvironmentVariable, &s.ShutdownTimeout),
+		setEnvDuration(consts.ClusterInfoRefreshIntervalEnvironmentVariable, &s.ClusterInfoRefreshInterval),
+		setEnvDuration(consts.NotifierRetryBackoffEnvironmentVariable, &s.Notifier.RetryBackoff),
+		setEnvDuration(consts.NotifierDeduplicationWindowEnvironmentVariable, &s.Notifier.DeduplicationWindow),
+		setEnvDuration(consts.NotifierMinIntervalEnvironmentVariable, &s.Notifier.MinInterval),
+		setEnvDuration(consts.NotifierTimeoutEnvironmentVariable, &s.Notifier.Timeout),
+	}
+	errs = append(errs,
+		setEnvInt(consts.ConnectRetriesEnvironmentVariable, &s.WebSocket.ConnectRetries),
+		setEnvInt(consts.CrashLogTailLinesEnvironmentVariable, &s.CrashLogTailLines),
+		setEnvInt(consts.CrashMaxRestartCountEnvironmentVariable, &s.Crashes.MaxRestartCount),
+		setEnvInt(consts.CrashSampleEveryEnvironmentVariable, &s.Crashes.SampleEvery),
+		setEnvInt(consts.CrashLogTailMaxBytesEnvironmentVariable, &s.Crashes.LogTailMaxBytes),
+		setEnvInt(consts.NotifierQueueSizeEnvironmentVariable, &s.Notifier.QueueSize),
+		setEnvInt(consts.NotifierMaxRetriesEnvironmentVariable, &s.Notifier.MaxRetries),
+	)
+	return errors.Join(errs...)
+}
+
+func setEnvInt[T int | int32 | int64](envVar string, value *T) error {
+	envValue, present := os.LookupEnv(envVar)
+	if !present {
+		return nil
+	}
+	parsed, err := strconv.ParseInt(envValue, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid %s %q: %s", envVar, envValue, err.Error())
+	}
+	*value = T(parsed)
+	return nil
+}
+
+// setEnvDuration parses a duration like "30s", a plain number is read as seconds
+func setEnvDuration(envVar string, value *Duration) error {
+	envValue, present := os.LookupEnv(envVar)
+	if !present {
+		return nil
+	}
+	if seconds, err := strconv.Atoi(envValue); err == nil {
+		*value = Duration(time.Duration(seconds) * time.Second)
+		return nil
+	}
+	duration, err := time.ParseDuration(envValue)
+	if err != nil {
+		return fmt.Errorf("invalid %s %q: %s", envVar, envValue, err.Error())
+	}
+	*value = Duration(duration)
+	return nil
+}
+
+// newFlagSet binds the flags to the settings, the current values are the flag defaults.
+// The flags of the standard flag set (e.g. the glog flags) are accepted as well
+func newFlagSet(s *Settings, output io.Writer, extraFlags ...func(*flag.FlagSet)) *flag.FlagSet {
+	flags := flag.NewFlagSet("kollector", flag.ContinueOnError)
+	flags.SetOutput(output)
+	flag.CommandLine.VisitAll(func(f *flag.Flag) {
+		flags.Var(f.Value, f.Name, f.Usage)
+	})
+
+	flags.StringVar(&s.SettingsFile, "settings-file", s.SettingsFile, "JSON file with the kollector settings")
+	flags.StringVar(&s.Files.ClusterConfig, "config", s.Files.ClusterConfig, "cluster config file")
+	flags.StringVar(&s.Files.Services, "services-file", s.Files.Services, "service discovery file")
+	flags.StringVar(&s.Files.Credentials, "credentials-dir", s.Files.Credentials, "credentials directory")
+	flags.StringVar(&s.Files.RedactionPolicy, "redaction-policy-file", s.Files.RedactionPolicy, "redaction policy file")
+	flags.StringVar(&s.Namespace, "namespace", s.Namespace, "namespace kollector runs in")
+	flags.Var(&listValue{list: &s.NamespaceFilter.Include}, "include-namespaces", "comma separated namespace globs to watch")
+	flags.Var(&listValue{list: &s.NamespaceFilter.Exclude}, "exclude-namespaces", "comma separated namespace globs to ignore")
+	flags.StringVar(&s.NamespaceFilter.LabelSelector, "namespace-label-selector", s.NamespaceFilter.LabelSelector, "label selector of the watched namespaces")
+	for _, resource := range selectableResources() {
+		flags.Var(&selectorValue{settings: s, resource: resource}, resource+"-label-selector", "label selector of the watched "+resource)
+		flags.Var(&selectorValue{settings: s, resource: resource, field: true}, resource+"-field-selector", "field selector of the watched "+resource)
+	}
+	flags.DurationVar((*time.Duration)(&s.WebSocket.WaitBeforeReport), "wait-before-report", time.Duration(s.WebSocket.WaitBeforeReport), "delay before connecting to the event receiver")
+	flags.IntVar(&s.WebSocket.ConnectRetries, "websocket-connect-retries", s.WebSocket.ConnectRetries, "event receiver dial attempts before giving up")
+	flags.DurationVar((*time.Duration)(&s.WebSocket.PingInterval), "websocket-ping-interval", time.Duration(s.WebSocket.PingInterval), "event receiver ping interval")
+	flags.Int64Var(&s.CrashLogTailLines, "crash-log-tail-lines", s.CrashLogTailLines, "log lines reported for a crashed container")
+	flags.Var(&int32Value{value: &s.Crashes.MaxRestartCount}, "crash-max-restart-count", "crashes are reported up to this restart count")
+	flags.Var(&int32Value{value: &s.Crashes.SampleEvery}, "crash-sample-every", "report every Nth restart past the max restart count, 0 reports none")
+	flags.IntVar(&s.Crashes.LogTailMaxBytes, "crash-log-tail-max-bytes", s.Crashes.LogTailMaxBytes, "maximal size of the reported log tail of a crashed container")
+	flags.BoolVar(&s.ActivateScanOnNewImage, "activate-scan-on-new-image", s.ActivateScanOnNewImage, "notify the in-cluster components about new images")
+	flags.BoolVar(&s.ActivatePostureScanOnNewNamespace, "activate-posture-scan-on-new-namespace", s.ActivatePostureScanOnNewNamespace, "notify the in-cluster components about new namespaces")
+	flags.BoolVar(&s.ActivateConfigScanOnWorkloadChange, "activate-config-scan-on-workload-change", s.ActivateConfigScanOnWorkloadChange, "notify the in-cluster components about workload spec changes")
+	flags.BoolVar(&s.ActivateScanOnNewNode, "activate-scan-on-new-node", s.ActivateScanOnNewNode, "notify the in-cluster components about new nodes")
+	flags.IntVar(&s.Notifier.QueueSize, "notifier-queue-size", s.Notifier.QueueSize, "pending scan notifications before new ones are dropped")
+	flags.IntVar(&s.Notifier.MaxRetries, "notifier-max-retries", s.Notifier.MaxRetries, "retries of a failed scan notification")
+	flags.DurationVar((*time.Duration)(&s.Notifier.RetryBackoff), "notifier-retry-backoff", time.Duration(s.Notifier.RetryBackoff), "initial backoff of a failed scan notification")
+	flags.DurationVar((*time.Duration)(&s.Notifier.DeduplicationWindow), "notifier-deduplication-window", time.Duration(s.Notifier.DeduplicationWindow), "how long a sent scan notification is not sent again")
+	flags.DurationVar((*time.Duration)(&s.Notifier.MinInterval), "notifier-min-interval", time.Duration(s.Notifier.MinInterval), "minimal interval between two scan notifications")
+	flags.DurationVar((*time.Duration)(&s.Notifier.Timeout), "notifier-timeout", time.Duration(s.Notifier.Timeout), "timeout of a scan notification request")
+	flags.StringVar(&s.OtelCollectorSvc, "otel-collector-svc", s.OtelCollectorSvc, "otel collector address, e.g. otel-collector:4317")
+	flags.StringVar(&s.RecordEventsFile, "record-events-file", s.RecordEventsFile, "NDJSON file the watch events are appended to")
+	flags.DurationVar((*time.Duration)(&s.ReloadInterval), "reload-interval", time.Duration(s.ReloadInterval), "configuration files reload interval, 0 disables reloading")
+	flags.DurationVar((*time.Duration)(&s.ClusterInfoRefreshInterval), "cluster-info-refresh-interval", time.Duration(s.ClusterInfoRefreshInterval), "how often the API server version is checked")
+	flags.DurationVar((*time.Duration)(&s.ShutdownTimeout), "shutdown-timeout", time.Duration(s.ShutdownTimeout), "time to flush the pending reports on shutdown")
+	flags.BoolVar(&s.DryRun, "dry-run", s.DryRun, "write the reports instead of sending them to the event receiver")
+	flags.StringVar(&s.DryRunOutput, "dry-run-output", s.DryRunOutput, "file the dry run reports are appended to, by default they are printed")
+	flags.BoolVar(&s.PrintConfig, "print-config", s.PrintConfig, "print the effective settings and exit")
+	for i := range extraFlags {
+		extraFlags[i](flags)
+	}
+	return flags
+}
+
+// listValue is a comma separated list flag
+type listValue struct {
+	list *[]string
+}
+
+func (l *listValue) String() string {
+	if l.list == nil {
+		return ""
+	}
+	return strings.Join(*l.list, ",")
+}
+
+func (l *listValue) Set(value string) error {
+	*l.list = append([]string{}, splitList(value)...)
+	return nil
+}
+
+// int32Value is an int32 flag
+type int32Value struct {
+	value *int32
+}
+
+func (v *int32Value) String() string {
+	if v.value == nil {
+		return "0"
+	}
+	return strconv.FormatInt(int64(*v.value), 10)
+}
+
+func (v *int32Value) Set(value string) error {
+	parsed, err := strconv.ParseInt(value, 10, 32)
+	if err != nil {
+		return err
+	}
+	*v.value = int32(parsed)
+	return nil
+}
+
+// selectorValue is a label or field selector of a watched resource
+type selectorValue struct {
+	settings *Settings
+	resource string
+	field    bool
+}
+
+func (v *selectorValue) String() string {
+	if v.settings == nil {
+		return ""
+	}
+	if v.field {
+		return v.settings.ResourceSelectors[v.resource].FieldSelector
+	}
+	return v.settings.ResourceSelectors[v.resource].LabelSelector
+}
+
+func (v *selectorValue) Set(value string) error {
+	if v.settings.ResourceSelectors == nil {
+		v.settings.ResourceSelectors = map[string]ResourceSelector{}
+	}
+	selector := v.settings.ResourceSelectors[v.resource]
+	if v.field {
+		selector.FieldSelector = value
+	} else {
+		selector.LabelSelector = value
+	}
+	if selector.LabelSelector == "" && selector.FieldSelector == "" {
+		delete(v.settings.ResourceSelectors, v.resource)
+		return nil
+	}
+	v.settings.ResourceSelectors[v.resource] = selector
+	return nil
+}
+
+func (v *selectorValue) setFromEnv(envVar string) {
+	if value, present := os.LookupEnv(envVar); present {
+		v.Set(value)
+	}
+}
+
+// Validate returns all the problems of the settings
+func (s *Settings) Validate() error {
+	var errs []error
+	if path.Ext(s.Files.ClusterConfig) == "" {
+		errs = append(errs, fmt.Errorf("cluster config file %q should have an extension, e.g. .json", s.Files.ClusterConfig))
+	}
+	if s.Files.Services == "" {
+		errs = append(errs, fmt.Errorf("services file is not set"))
+	}
+	if s.Files.Credentials == "" {
+		errs = append(errs, fmt.Errorf("credentials directory is not set"))
+	}
+	if err := s.NamespaceFilter.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := ValidateResourceSelectors(s.ResourceSelectors); err != nil {
+		errs = append(errs, err)
+	}
+	if s.WebSocket.WaitBeforeReport < 0 {
+		errs = append(errs, fmt.Errorf("wait before report should not be negative"))
+	}
+	if s.WebSocket.ConnectRetries < 1 {
+		errs = append(errs, fmt.Errorf("websocket connect retries should be at least 1, got %d", s.WebSocket.ConnectRetries))
+	}
+	if s.WebSocket.PingInterval <= 0 {
+		errs = append(errs, fmt.Errorf("websocket ping interval should be positive"))
+	}
+	if s.CrashLogTailLines < 0 {
+		errs = append(errs, fmt.Errorf("crash log tail lines should not be negative, got %d", s.CrashLogTailLines))
+	}
+	if s.Crashes.MaxRestartCount < 0 {
+		errs = append(errs, fmt.Errorf("crash max restart count should not be negative, got %d", s.Crashes.MaxRestartCount))
+	}
+	if s.Crashes.SampleEvery < 0 {
+		errs = append(errs, fmt.Errorf("crash sample every should not be negative, got %d", s.Crashes.SampleEvery))
+	}
+	if s.Crashes.LogTailMaxBytes < 0 {
+		errs = append(errs, fmt.Errorf("crash log tail max bytes should not be negative, got %d", s.Crashes.LogTailMaxBytes))
+	}
+	if err := ValidateTriggerCommands(s.TriggerCommands); err != nil {
+		errs = append(errs, err)
+	}
+	if s.Notifier.QueueSize < 1 {
+		errs = append(errs, fmt.Errorf("notifier queue size should be at least 1, got %d", s.Notifier.QueueSize))
+	}
+	if s.Notifier.MaxRetries < 0 {
+		errs = append(errs, fmt.Errorf("notifier max retries should not be negative, got %d", s.Notifier.MaxRetries))
+	}
+	if s.Notifier.RetryBackoff <= 0 {
+		errs = append(errs, fmt.Errorf("notifier retry backoff should be positive"))
+	}
+	if s.Notifier.DeduplicationWindow < 0 || s.Notifier.MinInterval < 0 {
+		errs = append(errs, fmt.Errorf("notifier deduplication window and min interval should not be negative"))
+	}
+	if s.Notifier.Timeout <= 0 {
+		errs = append(errs, fmt.Errorf("notifier timeout should be positive"))
+	}
+	if s.ReloadInterval < 0 {
+		errs = append(errs, fmt.Errorf("reload interval should not be negative"))
+	}
+	if s.ClusterInfoRefreshInterval <= 0 {
+		errs = append(errs, fmt.Errorf("cluster info refresh interval should be positive"))
+	}
+	if s.ShutdownTimeout < 0 {
+		errs = append(errs, fmt.Errorf("shutdown timeout should not be negative"))
+	}
+	return errors.Join(errs...)
+}
+
+// TriggerEnabled returns true if the in-cluster components are notified of the trigger
+func (s *Settings) TriggerEnabled(trigger string) bool {
+	switch trigger {
+	case NewImageTrigger:
+		return s.ActivateScanOnNewImage
+	case NewNamespaceTrigger:
+		return s.ActivatePostureScanOnNewNamespace
+	case WorkloadSpecChangeTrigger:
+		return s.ActivateConfigScanOnWorkloadChange
+	case NewNodeTrigger:
+		return s.ActivateScanOnNewNode
+	}
+	return false
+}
+
+// ValidateTriggerCommands makes sure the triggers are known and each sends at least a command
+func ValidateTriggerCommands(triggerCommands map[string][]string) error {
+	for trigger, commands := range triggerCommands {
+		known := false
+		for i := range Triggers {
+			known = known || Triggers[i] == trigger
+		}
+		if !known {
+			return fmt.Errorf("unknown trigger %q, expected one of %s", trigger, strings.Join(Triggers, ", "))
+		}
+		if len(commands) == 0 {
+			return fmt.Errorf("trigger %q should have commands", trigger)
+		}
+	}
+	return nil
+}
+
+// Validate makes sure the namespace globs and the label selector are parsable
+func (f NamespaceFilter) Validate() error {
+	for _, pattern := range append(append([]string{}, f.Include...), f.Exclude...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid namespace pattern %q: %s", pattern, err.Error())
+		}
+	}
+	if _, err := labels.Parse(f.LabelSelector); err != nil {
+		return fmt.Errorf("invalid namespace label selector %q: %s", f.LabelSelector, err.Error())
+	}
+	return nil
+}
+
+// ValidateResourceSelectors makes sure the selectors are parsable before they are sent to the API server
+func ValidateResourceSelectors(selectors map[string]ResourceSelector) error {
+	for resource, selector := range selectors {
+		if resource == NamespacesResource {
+			return fmt.Errorf("the %s resource has no selectors, the watched namespaces are set by the namespace filter", resource)
+		}
+		if !isWatchedResource(resource) {
+			return fmt.Errorf("unknown resource %q, expected one of %s", resource, strings.Join(selectableResources(), ", "))
+		}
+		if _, err := labels.Parse(selector.LabelSelector); err != nil {
+			return fmt.Errorf("invalid %s label selector %q: %s", resource, selector.LabelSelector, err.Error())
+		}
+		if _, err := fields.ParseSelector(selector.FieldSelector); err != nil {
+			return fmt.Errorf("invalid %s field selector %q: %s", resource, selector.FieldSelector, err.Error())
+		}
+	}
+	return nil
+}
+
+// selectableResources are the watched resources that have selectors. The namespaces are selected by the namespace filter
+// only, so that a namespace selector does not combine silently with the namespace label selector
+func selectableResources() []string {
+	resources := []string{}
+	for i := range WatchedResources {
+		if WatchedResources[i] != NamespacesResource {
+			resources = append(resources, WatchedResources[i])
+		}
+	}
+	return resources
+}
+
+func isWatchedResource(resource string) bool {
+	for i := range WatchedResources {
+		if WatchedResources[i] == resource {
+			return true
+		}
+	}
+	return false
+}
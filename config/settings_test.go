@@ -0,0 +1,125 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kubescape/kollector/consts"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadSettingsDefaults(t *testing.T) {
+	t.Setenv(consts.NamespaceEnvironmentVariable, "kubescape")
+	settings, err := LoadSettings(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "/etc/config/services.json", settings.Files.Services)
+	assert.Equal(t, Duration(30*time.Second), settings.WebSocket.WaitBeforeReport)
+	assert.Equal(t, 60, settings.WebSocket.ConnectRetries)
+	assert.Equal(t, int64(50), settings.CrashLogTailLines)
+	assert.Equal(t, Duration(10*time.Second), settings.ShutdownTimeout)
+	assert.Equal(t, Duration(5*time.Minute), settings.ClusterInfoRefreshInterval)
+	assert.Equal(t, CrashReportSettings{MaxRestartCount: 2, LogTailMaxBytes: 8 * 1024}, settings.Crashes)
+	assert.Equal(t, 100, settings.Notifier.QueueSize)
+	assert.Equal(t, []string{"kubescapeScan"}, settings.TriggerCommands[NewNamespaceTrigger])
+	assert.False(t, settings.TriggerEnabled(NewNamespaceTrigger))
+	assert.Equal(t, Duration(5*time.Minute), settings.Notifier.DeduplicationWindow)
+	assert.Equal(t, []string{"kubescape"}, settings.NamespaceFilter.Exclude, "the component namespace is excluded by default")
+
+	t.Setenv(consts.ExcludeNamespacesEnvironmentVariable, "")
+	settings, err = LoadSettings(nil)
+	assert.NoError(t, err)
+	assert.Empty(t, settings.NamespaceFilter.Exclude)
+}
+
+func TestLoadSettingsLayers(t *testing.T) {
+	settingsFile := filepath.Join(t.TempDir(), "settings.json")
+	assert.NoError(t, os.WriteFile(settingsFile, []byte(`{
+		"files": {"services": "/file/services.json", "credentials": "/file/credentials"},
+		"namespaceFilter": {"exclude": ["kube-*"]},
+		"resourceSelectors": {"pods": {"fieldSelector": "status.phase!=Succeeded"}},
+		"websocket": {"waitBeforeReport": "5s", "connectRetries": 3},
+		"crashLogTailLines": 10,
+		"crashes": {"maxRestartCount": 5, "logTailMaxBytes": 1024},
+		"triggerCommands": {"newNode": ["kubescapeScan", "scan"]}
+	}`), 0644))
+
+	t.Setenv(consts.SettingsFileEnvironmentVariable, settingsFile)
+	t.Setenv(consts.WaitBeforeReportEnvironmentVariable, "7")
+	t.Setenv(consts.ServicesFileEnvironmentVariable, "/env/services.json")
+	t.Setenv("PODS_LABEL_SELECTOR", "app=payments")
+	t.Setenv(consts.CrashSampleEveryEnvironmentVariable, "10")
+	t.Setenv(consts.NotifierRetryBackoffEnvironmentVariable, "2s")
+	t.Setenv(consts.ActivateScanOnNewNodeFeatureEnvironmentVariable, "true")
+
+	settings, err := LoadSettings([]string{"--services-file", "/flag/services.json", "--crash-log-tail-lines=20", "--crash-max-restart-count=3", "--notifier-max-retries=0", "--pods-field-selector=", "--print-config"})
+	assert.NoError(t, err)
+	assert.Equal(t, "/flag/services.json", settings.Files.Services, "flags override the environment")
+	assert.Equal(t, "/file/credentials", settings.Files.Credentials, "the file overrides the defaults")
+	assert.Equal(t, Duration(7*time.Second), settings.WebSocket.WaitBeforeReport, "the environment overrides the file")
+	assert.Equal(t, 3, settings.WebSocket.ConnectRetries)
+	assert.Equal(t, int64(20), settings.CrashLogTailLines)
+	assert.Equal(t, CrashReportSettings{MaxRestartCount: 3, SampleEvery: 10, LogTailMaxBytes: 1024}, settings.Crashes)
+	assert.Equal(t, 0, settings.Notifier.MaxRetries)
+	assert.True(t, settings.TriggerEnabled(NewNodeTrigger))
+	assert.Equal(t, []string{"kubescapeScan", "scan"}, settings.TriggerCommands[NewNodeTrigger])
+	assert.Equal(t, []string{"scan"}, settings.TriggerCommands[NewImageTrigger], "the other triggers keep their default commands")
+	assert.Equal(t, Duration(2*time.Second), settings.Notifier.RetryBackoff)
+	assert.Equal(t, []string{"kube-*"}, settings.NamespaceFilter.Exclude)
+	assert.Equal(t, map[string]ResourceSelector{PodsResource: {LabelSelector: "app=payments"}}, settings.ResourceSelectors)
+	assert.True(t, settings.PrintConfig)
+}
+
+func TestLoadSettingsErrors(t *testing.T) {
+	_, err := LoadSettings([]string{"--websocket-connect-retries=0", "--exclude-namespaces=[kube", "--nodes-label-selector=role in (", "--notifier-queue-size=0"})
+	assert.ErrorContains(t, err, "websocket connect retries")
+	assert.ErrorContains(t, err, "invalid namespace pattern")
+	assert.ErrorContains(t, err, "invalid nodes label selector")
+	assert.ErrorContains(t, err, "notifier queue size")
+
+	assert.ErrorContains(t, ValidateTriggerCommands(map[string][]string{"newPod": {"scan"}}), "unknown trigger")
+	assert.ErrorContains(t, ValidateTriggerCommands(map[string][]string{NewNodeTrigger: {}}), "should have commands")
+
+	_, err = LoadSettings([]string{"--unknown"})
+	assert.Error(t, err)
+
+	t.Setenv(consts.PingIntervalEnvironmentVariable, "often")
+	_, err = LoadSettings(nil)
+	assert.ErrorContains(t, err, consts.PingIntervalEnvironmentVariable)
+
+	t.Setenv(consts.CrashSampleEveryEnvironmentVariable, "sometimes")
+	_, err = LoadSettings(nil)
+	assert.ErrorContains(t, err, consts.CrashSampleEveryEnvironmentVariable)
+
+	settingsFile := filepath.Join(t.TempDir(), "settings.json")
+	assert.NoError(t, os.WriteFile(settingsFile, []byte(`{"websockets": {}}`), 0644))
+	_, err = LoadSettings([]string{"--settings-file", settingsFile})
+	assert.ErrorContains(t, err, "unknown field")
+}
+
+func TestValidateResourceSelectors(t *testing.T) {
+	assert.NoError(t, ValidateResourceSelectors(nil))
+	assert.Error(t, ValidateResourceSelectors(map[string]ResourceSelector{"deployments": {}}))
+	assert.Error(t, ValidateResourceSelectors(map[string]ResourceSelector{PodsResource: {LabelSelector: "app in ("}}))
+	assert.Error(t, ValidateResourceSelectors(map[string]ResourceSelector{PodsResource: {FieldSelector: "status.phase"}}))
+	assert.Error(t, ValidateResourceSelectors(map[string]ResourceSelector{NamespacesResource: {LabelSelector: "team=payments"}}),
+		"the namespaces are selected by the namespace filter")
+}
+
+func TestNamespacesHaveNoSelectors(t *testing.T) {
+	t.Setenv(strings.ToUpper(NamespacesResource)+consts.LabelSelectorEnvironmentVariableSuffix, "team=payments")
+	settings, err := LoadSettings(nil)
+	require.NoError(t, err)
+	assert.NotContains(t, settings.ResourceSelectors, NamespacesResource, "the NAMESPACES_ selectors are not read")
+
+	_, err = LoadSettings([]string{"--namespaces-label-selector", "team=payments"})
+	assert.Error(t, err, "there is no namespaces selector flag")
+
+	settingsFile := filepath.Join(t.TempDir(), "settings.json")
+	require.NoError(t, os.WriteFile(settingsFile, []byte(`{"resourceSelectors": {"namespaces": {"labelSelector": "team=payments"}}}`), 0644))
+	_, err = LoadSettings([]string{"--settings-file", settingsFile})
+	assert.ErrorContains(t, err, "namespace filter")
+}
@@ -1,9 +1,40 @@
 package consts
 
 const (
-	ActivateScanOnNewImageFeatureEnvironmentVariable = "ACTIVATE_CVE_SCAN_ON_NEW_IMAGE_FEATURE"
-	ConfigEnvironmentVariable                        = "CONFIG"
-	NamespaceEnvironmentVariable                     = "NAMESPACE"
-	OtelCollectorSvcEnvironmentVariable              = "OTEL_COLLECTOR_SVC"
-	ReleaseBuildTagEnvironmentVariable               = "RELEASE"
+	ActivateConfigScanOnWorkloadChangeFeatureEnvironmentVariable = "ACTIVATE_CONFIG_SCAN_ON_WORKLOAD_CHANGE_FEATURE"
+	ActivatePostureScanOnNewNamespaceFeatureEnvironmentVariable  = "ACTIVATE_POSTURE_SCAN_ON_NEW_NAMESPACE_FEATURE"
+	ActivateScanOnNewImageFeatureEnvironmentVariable             = "ACTIVATE_CVE_SCAN_ON_NEW_IMAGE_FEATURE"
+	ActivateScanOnNewNodeFeatureEnvironmentVariable              = "ACTIVATE_SCAN_ON_NEW_NODE_FEATURE"
+	ClusterInfoRefreshIntervalEnvironmentVariable                = "CLUSTER_INFO_REFRESH_INTERVAL"
+	ConfigEnvironmentVariable                                    = "CONFIG"
+	ConnectRetriesEnvironmentVariable                            = "WEBSOCKET_CONNECT_RETRIES"
+	CrashLogTailLinesEnvironmentVariable                         = "CRASH_LOG_TAIL_LINES"
+	CrashLogTailMaxBytesEnvironmentVariable                      = "CRASH_LOG_TAIL_MAX_BYTES"
+	CrashMaxRestartCountEnvironmentVariable                      = "CRASH_MAX_RESTART_COUNT"
+	CrashSampleEveryEnvironmentVariable                          = "CRASH_SAMPLE_EVERY"
+	CredentialsDirEnvironmentVariable                            = "CREDENTIALS_DIR"
+	DryRunEnvironmentVariable                                    = "DRY_RUN"
+	DryRunOutputEnvironmentVariable                              = "DRY_RUN_OUTPUT"
+	ExcludeNamespacesEnvironmentVariable                         = "EXCLUDE_NAMESPACES"
+	FieldSelectorEnvironmentVariableSuffix                       = "_FIELD_SELECTOR"
+	IncludeNamespacesEnvironmentVariable                         = "INCLUDE_NAMESPACES"
+	LabelSelectorEnvironmentVariableSuffix                       = "_LABEL_SELECTOR"
+	NamespaceEnvironmentVariable                                 = "NAMESPACE"
+	NamespaceLabelSelectorEnvironmentVariable                    = "NAMESPACE_LABEL_SELECTOR"
+	NotifierDeduplicationWindowEnvironmentVariable               = "NOTIFIER_DEDUPLICATION_WINDOW"
+	NotifierMaxRetriesEnvironmentVariable                        = "NOTIFIER_MAX_RETRIES"
+	NotifierMinIntervalEnvironmentVariable                       = "NOTIFIER_MIN_INTERVAL"
+	NotifierQueueSizeEnvironmentVariable                         = "NOTIFIER_QUEUE_SIZE"
+	NotifierRetryBackoffEnvironmentVariable                      = "NOTIFIER_RETRY_BACKOFF"
+	NotifierTimeoutEnvironmentVariable                           = "NOTIFIER_TIMEOUT"
+	OtelCollectorSvcEnvironmentVariable                          = "OTEL_COLLECTOR_SVC"
+	PingIntervalEnvironmentVariable                              = "WEBSOCKET_PING_INTERVAL"
+	RecordEventsFileEnvironmentVariable                          = "RECORD_EVENTS_FILE"
+	RedactionPolicyFileEnvironmentVariable                       = "REDACTION_POLICY_FILE"
+	ReleaseBuildTagEnvironmentVariable                           = "RELEASE"
+	ReloadIntervalEnvironmentVariable                            = "CONFIG_RELOAD_INTERVAL"
+	ServicesFileEnvironmentVariable                              = "SERVICES_FILE"
+	SettingsFileEnvironmentVariable                              = "SETTINGS_FILE"
+	ShutdownTimeoutEnvironmentVariable                           = "SHUTDOWN_TIMEOUT"
+	WaitBeforeReportEnvironmentVariable                          = "WAIT_BEFORE_REPORT"
 )
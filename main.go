@@ -1,63 +1,71 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"net/url"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
-	"github.com/kubescape/backend/pkg/servicediscovery"
-	v2 "github.com/kubescape/backend/pkg/servicediscovery/v2"
-	"github.com/kubescape/backend/pkg/utils"
 	logger "github.com/kubescape/go-logger"
 	"github.com/kubescape/go-logger/helpers"
 
 	"github.com/kubescape/kollector/config"
-	"github.com/kubescape/kollector/consts"
 	"github.com/kubescape/kollector/watch"
 
-	"github.com/armosec/utils-k8s-go/armometadata"
 	"github.com/armosec/utils-k8s-go/probes"
 )
 
 func main() {
 	ctx := context.Background()
 
-	isServerReady := false
-	go probes.InitReadinessV1(&isServerReady)
-	displayBuildTag()
-
-	clusterConfig, err := armometadata.LoadConfig(os.Getenv(consts.ConfigEnvironmentVariable))
-	if err != nil {
-		logger.L().Ctx(ctx).Fatal("failed to load config", helpers.Error(err))
+	if len(os.Args) > 1 && os.Args[1] == "snapshot" {
+		runSnapshot(ctx, os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "replay" {
+		runReplay(ctx, os.Args[2:])
+		return
 	}
 
-	services, err := servicediscovery.GetServices(
-		v2.NewServiceDiscoveryFileV2("/etc/config/services.json"),
-	)
+	settings, err := config.LoadSettings(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
 	if err != nil {
-		logger.L().Ctx(ctx).Fatal("failed to load services", helpers.Error(err))
+		logger.L().Ctx(ctx).Fatal("failed to load settings", helpers.Error(err))
+	}
+	if settings.PrintConfig {
+		printSettings(settings)
+		return
 	}
 
-	logger.L().Info("loaded event receiver websocket url (service discovery)", helpers.String("url", services.GetReportReceiverWebsocketUrl()))
+	isServerReady := false
+	go probes.InitReadinessV1(&isServerReady)
+	displayBuildTag(settings)
 
-	var credentials *utils.Credentials
-	if credentials, err = utils.LoadCredentialsFromFile("/etc/credentials"); err != nil {
-		logger.L().Ctx(ctx).Error("failed to load credentials", helpers.Error(err))
-		credentials = &utils.Credentials{}
-	} else {
-		logger.L().Info("credentials loaded",
-			helpers.Int("accessKeyLength", len(credentials.AccessKey)),
-			helpers.Int("accountLength", len(credentials.Account)))
+	configProvider, err := config.NewFileProvider(os.Args[1:])
+	if err != nil {
+		logger.L().Ctx(ctx).Fatal("failed to load config", helpers.Error(err))
 	}
+	kollectorConfig := configProvider.Config()
 
-	kollectorConfig := config.NewKollectorConfig(clusterConfig, *credentials, services.GetReportReceiverWebsocketUrl())
+	logger.L().Info("loaded event receiver websocket url (service discovery)", helpers.String("url", kollectorConfig.EventReceiverWebsocketURL()))
+	logger.L().Info("credentials loaded",
+		helpers.Int("accessKeyLength", len(kollectorConfig.AccessKey())),
+		helpers.Int("accountLength", len(kollectorConfig.AccountID())))
+	logger.L().Info("redaction policy loaded", helpers.Int("rules", len(kollectorConfig.RedactionRules())))
 
 	// to enable otel, set OTEL_COLLECTOR_SVC=otel-collector:4317
-	if otelHost, present := os.LookupEnv(consts.OtelCollectorSvcEnvironmentVariable); present {
+	if otelHost := settings.OtelCollectorSvc; otelHost != "" {
 		ctx = logger.InitOtel("kollector",
-			os.Getenv(consts.ReleaseBuildTagEnvironmentVariable),
+			settings.Release,
 			kollectorConfig.AccountID(),
 			kollectorConfig.ClusterName(),
 			url.URL{Host: otelHost})
@@ -69,50 +77,105 @@ func main() {
 		logger.L().Ctx(ctx).Fatal("failed to initialize the WatchHandler", helpers.Error(err))
 	}
 
-	go func() {
-		for {
-			wh.ListenerAndSender(ctx)
-		}
-	}()
-
-	go func() {
-		for {
-			wh.NodeWatch(ctx)
-		}
-	}()
-
-	go func() {
-		for {
-			wh.PodWatch(ctx)
-		}
-	}()
-
-	go func() {
-		for {
-			wh.ServiceWatch(ctx)
-		}
-	}()
-
-	go func() {
-		for {
-			wh.SecretWatch(ctx)
-		}
-	}()
-	go func() {
-		for {
-			wh.NamespaceWatch(ctx)
-		}
-	}()
-	go func() {
-		for {
-			wh.CronJobWatch(ctx)
-		}
-	}()
-	logger.L().Ctx(ctx).Fatal(wh.WebSocketHandle.SendReportRoutine(ctx, &isServerReady, wh.SetFirstReportFlag).Error())
+	// the watchers stop on SIGTERM, the pending reports are flushed and the connection is closed
+	ctx, stop := signal.NotifyContext(ctx, syscall.SIGTERM, os.Interrupt)
+	defer stop()
 
+	// reload the config and credentials files, the changes are applied without restarting
+	configProvider.Subscribe(func() { wh.Reconfigure(ctx) })
+	go configProvider.Run(ctx, time.Duration(settings.ReloadInterval))
+
+	wh.Run(ctx, &isServerReady)
+}
+
+func displayBuildTag(settings config.Settings) {
+	logger.L().Info(fmt.Sprintf("Image version: %s", settings.Release))
+}
+
+// printSettings prints the effective settings, the credentials are not part of them
+func printSettings(settings config.Settings) {
+	settingsBytes, err := json.MarshalIndent(settings, "", "  ")
+	if err != nil {
+		logger.L().Fatal("failed to marshal settings", helpers.Error(err))
+	}
+	fmt.Println(string(settingsBytes))
+}
+
+// runSnapshot writes the cluster inventory as a first report, e.g. "kollector snapshot -o inventory.json"
+func runSnapshot(ctx context.Context, args []string) {
+	output := "-"
+	settings, err := config.LoadSettings(args, func(flags *flag.FlagSet) {
+		flags.StringVar(&output, "o", output, "output file, - for stdout")
+		flags.StringVar(&output, "output", output, "output file, - for stdout")
+	})
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		logger.L().Ctx(ctx).Fatal("failed to load settings", helpers.Error(err))
+	}
+	kollectorConfig, err := config.LoadSnapshotConfig(settings)
+	if err != nil {
+		logger.L().Ctx(ctx).Fatal("failed to load config", helpers.Error(err))
+	}
+	report, err := watch.Snapshot(ctx, kollectorConfig)
+	if err != nil {
+		logger.L().Ctx(ctx).Fatal("failed to collect the snapshot", helpers.Error(err))
+	}
+	if output == "-" {
+		_, err = os.Stdout.Write(report)
+	} else {
+		err = os.WriteFile(output, report, 0600)
+	}
+	if err != nil {
+		logger.L().Ctx(ctx).Fatal("failed to write the snapshot", helpers.Error(err))
+	}
 }
 
-func displayBuildTag() {
-	flag.Parse()
-	logger.L().Info(fmt.Sprintf("Image version: %s", os.Getenv(consts.ReleaseBuildTagEnvironmentVariable)))
+// runReplay pushes a recorded events file through the watch handlers and writes a report per line,
+// e.g. "kollector replay -i events.ndjson -o reports.ndjson"
+func runReplay(ctx context.Context, args []string) {
+	input, output := "", "-"
+	settings, err := config.LoadSettings(args, func(flags *flag.FlagSet) {
+		flags.StringVar(&input, "i", input, "recorded events file")
+		flags.StringVar(&input, "input", input, "recorded events file")
+		flags.StringVar(&output, "o", output, "output file, - for stdout")
+		flags.StringVar(&output, "output", output, "output file, - for stdout")
+	})
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		logger.L().Ctx(ctx).Fatal("failed to load settings", helpers.Error(err))
+	}
+	if input == "" {
+		logger.L().Ctx(ctx).Fatal("missing the recorded events file, set it with -i")
+	}
+	kollectorConfig, err := config.LoadSnapshotConfig(settings)
+	if err != nil {
+		logger.L().Ctx(ctx).Fatal("failed to load config", helpers.Error(err))
+	}
+	recording, err := os.Open(input)
+	if err != nil {
+		logger.L().Ctx(ctx).Fatal("failed to open the recorded events", helpers.Error(err))
+	}
+	defer recording.Close()
+	reports, err := watch.Replay(ctx, kollectorConfig, recording)
+	if err != nil {
+		logger.L().Ctx(ctx).Fatal("failed to replay the recorded events", helpers.Error(err))
+	}
+	var result bytes.Buffer
+	for i := range reports {
+		result.Write(reports[i])
+		result.WriteByte('\n')
+	}
+	if output == "-" {
+		_, err = os.Stdout.Write(result.Bytes())
+	} else {
+		err = os.WriteFile(output, result.Bytes(), 0600)
+	}
+	if err != nil {
+		logger.L().Ctx(ctx).Fatal("failed to write the reports", helpers.Error(err))
+	}
+	logger.L().Info("recorded events replayed", helpers.Int("reports", len(reports)))
 }
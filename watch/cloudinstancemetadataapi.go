@@ -1,90 +1,318 @@
 package watch
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"strings"
 	"time"
-)
 
-var (
-	httpClient = http.Client{Timeout: 5 * time.Second}
+	corev1 "k8s.io/api/core/v1"
 )
 
 const (
-	awsInstanceMetadataUrl   = "http://169.254.169.254/latest/meta-data/local-hostname"
-	gcpInstanceMetadataUrl   = "http://169.254.169.254/computeMetadata/v1/?alt=json&recursive=true"
-	azureInstanceMetadataUrl = "http://169.254.169.254/metadata/instance?api-version=2020-09-01"
+	instanceMetadataTimeout = 5 * time.Second
+	instanceMetadataBaseURL = "http://169.254.169.254"
+
+	awsTokenPath       = "/latest/api/token"
+	awsTokenTTLSeconds = "21600"
+	awsIdentityPath    = "/latest/dynamic/instance-identity/document"
+	// the instance tags are readable only when they are enabled in the instance metadata options
+	awsClusterNamePath = "/latest/meta-data/tags/instance/eks:cluster-name"
+	gcpMetadataPath    = "/computeMetadata/v1/?alt=json&recursive=true"
+	azureMetadataPath  = "/metadata/instance?api-version=2021-02-01"
 
 	awsVendorName   = "AWS"
 	gcpVendorName   = "GCP"
 	azureVendorName = "Azure"
+
+	eksClusterType = "EKS"
+	gkeClusterType = "GKE"
+	aksClusterType = "AKS"
 )
 
-func getAWSInstanceMetadata() (string, error) {
-	resp, err := httpClient.Get(awsInstanceMetadataUrl)
+// CloudMetadata is the info of the node kollector runs on, read from the instance metadata API of its cloud vendor
+type CloudMetadata struct {
+	Vendor string `json:"vendor"`
+	Region string `json:"region,omitempty"`
+	Zone   string `json:"zone,omitempty"`
+	// AccountID is the AWS account, the GCP project or the Azure subscription
+	AccountID    string `json:"accountID,omitempty"`
+	InstanceType string `json:"instanceType,omitempty"`
+	// ManagedCluster is EKS, GKE or AKS when the node belongs to a managed cluster, ClusterName is its name
+	ManagedCluster string `json:"managedCluster,omitempty"`
+	ClusterName    string `json:"clusterName,omitempty"`
+}
+
+func (m *CloudMetadata) vendor() string {
+	if m == nil {
+		return ""
+	}
+	return m.Vendor
+}
+
+// cloudMetadataProvider reads the instance metadata API of a cloud vendor
+type cloudMetadataProvider interface {
+	getMetadata(httpClient *http.Client) (*CloudMetadata, error)
+	vendor() string
+}
+
+// newCloudMetadataProviders returns the providers of the vendor, or of every vendor when it is empty. baseURL is the
+// instance metadata API
+func newCloudMetadataProviders(baseURL, vendor string) []cloudMetadataProvider {
+	providers := []cloudMetadataProvider{
+		&azureMetadataProvider{baseURL: baseURL},
+		&gcpMetadataProvider{baseURL: baseURL},
+		&awsMetadataProvider{baseURL: baseURL},
+	}
+	if vendor == "" {
+		return providers
+	}
+	for i := range providers {
+		if providers[i].vendor() == vendor {
+			return providers[i : i+1]
+		}
+	}
+	return nil
+}
+
+// getCloudMetadata queries the providers concurrently and returns the metadata of the first that answers, or nil when
+// none does
+func getCloudMetadata(httpClient *http.Client, providers []cloudMetadataProvider) (*CloudMetadata, error) {
+	// buffered, so the providers answering after the first one do not block
+	answers := make(chan *CloudMetadata, len(providers))
+	for i := range providers {
+		go func(provider cloudMetadataProvider) {
+			metadata, err := provider.getMetadata(httpClient)
+			if err != nil {
+				metadata = nil
+			}
+			answers <- metadata
+		}(providers[i])
+	}
+	for range providers {
+		if metadata := <-answers; metadata != nil {
+			return metadata, nil
+		}
+	}
+	return nil, nil
+}
+
+// defaultInstanceMetadata queries the instance metadata API of the vendor, or of every vendor when it is not known
+func defaultInstanceMetadata(vendor string) (*CloudMetadata, error) {
+	return getCloudMetadata(&http.Client{Timeout: instanceMetadataTimeout}, newCloudMetadataProviders(instanceMetadataBaseURL, vendor))
+}
+
+// providerIDVendors are the cloud vendors of the node providerID schemes
+var providerIDVendors = map[string]string{
+	"aws":   awsVendorName,
+	"gce":   gcpVendorName,
+	"azure": azureVendorName,
+}
+
+// providerIDVendor returns the cloud vendor of the nodes providerID, e.g. AWS for aws:///us-east-1a/i-1, or an empty
+// string when it is not a cloud vendor
+func providerIDVendor(nodes []corev1.Node) string {
+	for i := range nodes {
+		if scheme, _, ok := strings.Cut(nodes[i].Spec.ProviderID, "://"); ok {
+			if vendor, ok := providerIDVendors[scheme]; ok {
+				return vendor
+			}
+		}
+	}
+	return ""
+}
+
+// getMetadataResponse returns the body of a successful response
+func getMetadataResponse(httpClient *http.Client, req *http.Request) ([]byte, error) {
+	resp, err := httpClient.Do(req)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	if resp.Body != nil {
-		defer resp.Body.Close()
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
 	}
-	io.Copy(io.Discard, resp.Body)
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		return "", fmt.Errorf("http error: %s", resp.Status)
+		return nil, fmt.Errorf("http error: %s", resp.Status)
 	}
-	return awsVendorName, nil
+	return body, nil
+}
+
+type awsMetadataProvider struct {
+	baseURL string
 }
 
-func getGCPInstanceMetadata() (string, error) {
-	req, err := http.NewRequest(http.MethodGet, gcpInstanceMetadataUrl, nil)
+// getToken returns an IMDSv2 session token, or an empty token when only IMDSv1 is available
+func (p *awsMetadataProvider) getToken(httpClient *http.Client) (string, error) {
+	req, err := http.NewRequest(http.MethodPut, p.baseURL+awsTokenPath, nil)
 	if err != nil {
 		return "", err
 	}
-	req.Header.Add("Metadata-Flavor", "Google")
+	req.Header.Add("X-aws-ec2-metadata-token-ttl-seconds", awsTokenTTLSeconds)
 	resp, err := httpClient.Do(req)
 	if err != nil {
 		return "", err
 	}
-	if resp.Body != nil {
-		defer resp.Body.Close()
+	defer resp.Body.Close()
+	token, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
 	}
-	io.Copy(io.Discard, resp.Body)
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		return "", fmt.Errorf("http error: %s", resp.Status)
+		return "", nil
 	}
-	return gcpVendorName, nil
+	return string(token), nil
 }
 
-func getAzureInstanceMetadata() (string, error) {
-	req, err := http.NewRequest(http.MethodGet, azureInstanceMetadataUrl, nil)
+func (p *awsMetadataProvider) get(httpClient *http.Client, path, token string) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodGet, p.baseURL+path, nil)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	req.Header.Add("Metadata", "true")
-	resp, err := httpClient.Do(req)
+	if token != "" {
+		req.Header.Add("X-aws-ec2-metadata-token", token)
+	}
+	return getMetadataResponse(httpClient, req)
+}
+
+func (p *awsMetadataProvider) getMetadata(httpClient *http.Client) (*CloudMetadata, error) {
+	token, err := p.getToken(httpClient)
 	if err != nil {
-		return "", err
+		// the token request does not reach a pod when the hop limit of the instance is 1, IMDSv1 may still answer
+		token = ""
 	}
-	if resp.Body != nil {
-		defer resp.Body.Close()
+	body, err := p.get(httpClient, awsIdentityPath, token)
+	if err != nil {
+		return nil, err
 	}
-	io.Copy(io.Discard, resp.Body)
-	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		return "", fmt.Errorf("http error: %s", resp.Status)
+	identity := struct {
+		AccountID        string `json:"accountId"`
+		Region           string `json:"region"`
+		AvailabilityZone string `json:"availabilityZone"`
+		InstanceType     string `json:"instanceType"`
+	}{}
+	if err := json.Unmarshal(body, &identity); err != nil {
+		return nil, fmt.Errorf("invalid instance identity document: %s", err.Error())
+	}
+	metadata := &CloudMetadata{
+		Vendor:       awsVendorName,
+		Region:       identity.Region,
+		Zone:         identity.AvailabilityZone,
+		AccountID:    identity.AccountID,
+		InstanceType: identity.InstanceType,
+	}
+	if clusterName, err := p.get(httpClient, awsClusterNamePath, token); err == nil && len(clusterName) > 0 {
+		metadata.ManagedCluster = eksClusterType
+		metadata.ClusterName = strings.TrimSpace(string(clusterName))
+	}
+	return metadata, nil
+}
+
+func (p *awsMetadataProvider) vendor() string {
+	return awsVendorName
+}
+
+type gcpMetadataProvider struct {
+	baseURL string
+}
+
+func (p *gcpMetadataProvider) getMetadata(httpClient *http.Client) (*CloudMetadata, error) {
+	req, err := http.NewRequest(http.MethodGet, p.baseURL+gcpMetadataPath, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Add("Metadata-Flavor", "Google")
+	body, err := getMetadataResponse(httpClient, req)
+	if err != nil {
+		return nil, err
+	}
+	response := struct {
+		Instance struct {
+			// Zone and MachineType are paths, e.g. "projects/123/zones/us-central1-a"
+			Zone        string            `json:"zone"`
+			MachineType string            `json:"machineType"`
+			Attributes  map[string]string `json:"attributes"`
+		} `json:"instance"`
+		Project struct {
+			ProjectID string `json:"projectId"`
+		} `json:"project"`
+	}{}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, fmt.Errorf("invalid GCP metadata: %s", err.Error())
+	}
+	metadata := &CloudMetadata{
+		Vendor:       gcpVendorName,
+		Zone:         lastPathElement(response.Instance.Zone),
+		AccountID:    response.Project.ProjectID,
+		InstanceType: lastPathElement(response.Instance.MachineType),
+	}
+	// the region is the zone without its suffix, e.g. us-central1 for us-central1-a
+	if i := strings.LastIndex(metadata.Zone, "-"); i > 0 {
+		metadata.Region = metadata.Zone[:i]
+	}
+	if clusterName := response.Instance.Attributes["cluster-name"]; clusterName != "" {
+		metadata.ManagedCluster = gkeClusterType
+		metadata.ClusterName = clusterName
 	}
-	return azureVendorName, nil
+	return metadata, nil
+}
+
+func (p *gcpMetadataProvider) vendor() string {
+	return gcpVendorName
+}
+
+type azureMetadataProvider struct {
+	baseURL string
 }
 
-func getInstanceMetadata() (string, error) {
-	if resp, err := getAzureInstanceMetadata(); err == nil {
-		return resp, nil
+func (p *azureMetadataProvider) getMetadata(httpClient *http.Client) (*CloudMetadata, error) {
+	req, err := http.NewRequest(http.MethodGet, p.baseURL+azureMetadataPath, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Add("Metadata", "true")
+	body, err := getMetadataResponse(httpClient, req)
+	if err != nil {
+		return nil, err
+	}
+	response := struct {
+		Compute struct {
+			Location       string `json:"location"`
+			Zone           string `json:"zone"`
+			SubscriptionID string `json:"subscriptionId"`
+			VMSize         string `json:"vmSize"`
+			TagsList       []struct {
+				Name  string `json:"name"`
+				Value string `json:"value"`
+			} `json:"tagsList"`
+		} `json:"compute"`
+	}{}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, fmt.Errorf("invalid Azure metadata: %s", err.Error())
 	}
-	if resp, err := getGCPInstanceMetadata(); err == nil {
-		return resp, nil
+	metadata := &CloudMetadata{
+		Vendor:       azureVendorName,
+		Region:       response.Compute.Location,
+		Zone:         response.Compute.Zone,
+		AccountID:    response.Compute.SubscriptionID,
+		InstanceType: response.Compute.VMSize,
 	}
-	if resp, err := getAWSInstanceMetadata(); err == nil {
-		return resp, nil
+	for _, tag := range response.Compute.TagsList {
+		if tag.Name == "aks-managed-cluster-name" && tag.Value != "" {
+			metadata.ManagedCluster = aksClusterType
+			metadata.ClusterName = tag.Value
+		}
 	}
-	return "", nil
+	return metadata, nil
+}
+
+func (p *azureMetadataProvider) vendor() string {
+	return azureVendorName
+}
+
+func lastPathElement(path string) string {
+	return path[strings.LastIndex(path, "/")+1:]
 }
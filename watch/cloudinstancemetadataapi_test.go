@@ -0,0 +1,178 @@
+package watch
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newIMDS is an instance metadata API stand-in, the handlers are keyed by the request URI
+func newIMDS(t *testing.T, handlers map[string]http.HandlerFunc) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if handler, ok := handlers[r.Method+" "+r.RequestURI]; ok {
+			handler(w, r)
+			return
+		}
+		http.NotFound(w, r)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestAWSMetadataIMDSv2(t *testing.T) {
+	authorized := func(handler http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("X-aws-ec2-metadata-token") != "token" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			handler(w, r)
+		}
+	}
+	imds := newIMDS(t, map[string]http.HandlerFunc{
+		"PUT " + awsTokenPath: func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, awsTokenTTLSeconds, r.Header.Get("X-aws-ec2-metadata-token-ttl-seconds"))
+			w.Write([]byte("token"))
+		},
+		"GET " + awsIdentityPath: authorized(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`{"accountId":"123456789012","region":"eu-west-1","availabilityZone":"eu-west-1b","instanceType":"m5.large","instanceId":"i-1"}`))
+		}),
+		"GET " + awsClusterNamePath: authorized(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("payments"))
+		}),
+	})
+
+	metadata, err := getCloudMetadata(imds.Client(), newCloudMetadataProviders(imds.URL, ""))
+	require.NoError(t, err)
+	assert.Equal(t, &CloudMetadata{Vendor: awsVendorName, Region: "eu-west-1", Zone: "eu-west-1b", AccountID: "123456789012",
+		InstanceType: "m5.large", ManagedCluster: eksClusterType, ClusterName: "payments"}, metadata)
+}
+
+func TestAWSMetadataIMDSv1(t *testing.T) {
+	imds := newIMDS(t, map[string]http.HandlerFunc{
+		"PUT " + awsTokenPath: func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusForbidden)
+		},
+		"GET " + awsIdentityPath: func(w http.ResponseWriter, r *http.Request) {
+			assert.Empty(t, r.Header.Get("X-aws-ec2-metadata-token"))
+			w.Write([]byte(`{"accountId":"123456789012","region":"eu-west-1","availabilityZone":"eu-west-1b","instanceType":"m5.large"}`))
+		},
+	})
+
+	metadata, err := (&awsMetadataProvider{baseURL: imds.URL}).getMetadata(imds.Client())
+	require.NoError(t, err)
+	assert.Equal(t, "eu-west-1", metadata.Region)
+	assert.Empty(t, metadata.ManagedCluster, "the instance tags are not enabled")
+}
+
+func TestAWSMetadataTokenTimeout(t *testing.T) {
+	imds := newIMDS(t, map[string]http.HandlerFunc{
+		// the token response is dropped, e.g. by the hop limit
+		"PUT " + awsTokenPath: func(w http.ResponseWriter, r *http.Request) {
+			<-r.Context().Done()
+		},
+		"GET " + awsIdentityPath: func(w http.ResponseWriter, r *http.Request) {
+			assert.Empty(t, r.Header.Get("X-aws-ec2-metadata-token"))
+			w.Write([]byte(`{"accountId":"123456789012","region":"eu-west-1","availabilityZone":"eu-west-1b","instanceType":"m5.large"}`))
+		},
+	})
+
+	httpClient := imds.Client()
+	httpClient.Timeout = 100 * time.Millisecond
+	metadata, err := (&awsMetadataProvider{baseURL: imds.URL}).getMetadata(httpClient)
+	require.NoError(t, err, "IMDSv1 is used when the token request fails")
+	assert.Equal(t, "eu-west-1", metadata.Region)
+}
+
+func TestGCPMetadata(t *testing.T) {
+	imds := newIMDS(t, map[string]http.HandlerFunc{
+		"GET " + gcpMetadataPath: func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Metadata-Flavor") != "Google" {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			w.Write([]byte(`{"instance":{"zone":"projects/123/zones/us-central1-a","machineType":"projects/123/machineTypes/e2-medium",
+				"attributes":{"cluster-name":"payments","cluster-location":"us-central1"}},"project":{"projectId":"my-project","numericProjectId":123}}`))
+		},
+	})
+
+	metadata, err := getCloudMetadata(imds.Client(), newCloudMetadataProviders(imds.URL, ""))
+	require.NoError(t, err)
+	assert.Equal(t, &CloudMetadata{Vendor: gcpVendorName, Region: "us-central1", Zone: "us-central1-a", AccountID: "my-project",
+		InstanceType: "e2-medium", ManagedCluster: gkeClusterType, ClusterName: "payments"}, metadata)
+}
+
+func TestAzureMetadata(t *testing.T) {
+	imds := newIMDS(t, map[string]http.HandlerFunc{
+		"GET " + azureMetadataPath: func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Metadata") != "true" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			w.Write([]byte(`{"compute":{"location":"westeurope","zone":"2","subscriptionId":"sub","vmSize":"Standard_D2s_v3",
+				"tagsList":[{"name":"aks-managed-poolName","value":"nodepool1"},{"name":"aks-managed-cluster-name","value":"payments"}]}}`))
+		},
+	})
+
+	metadata, err := getCloudMetadata(imds.Client(), newCloudMetadataProviders(imds.URL, ""))
+	require.NoError(t, err)
+	assert.Equal(t, &CloudMetadata{Vendor: azureVendorName, Region: "westeurope", Zone: "2", AccountID: "sub",
+		InstanceType: "Standard_D2s_v3", ManagedCluster: aksClusterType, ClusterName: "payments"}, metadata)
+}
+
+func TestNoCloudMetadata(t *testing.T) {
+	imds := newIMDS(t, nil)
+	metadata, err := getCloudMetadata(imds.Client(), newCloudMetadataProviders(imds.URL, ""))
+	assert.NoError(t, err)
+	assert.Nil(t, metadata)
+	assert.Equal(t, "", metadata.vendor())
+}
+
+// slowProvider answers after a delay, or fails
+type slowProvider struct {
+	delay    time.Duration
+	metadata *CloudMetadata
+}
+
+func (p *slowProvider) getMetadata(*http.Client) (*CloudMetadata, error) {
+	time.Sleep(p.delay)
+	if p.metadata == nil {
+		return nil, errors.New("timeout")
+	}
+	return p.metadata, nil
+}
+
+func (p *slowProvider) vendor() string {
+	return p.metadata.vendor()
+}
+
+func TestCloudMetadataProvidersAreQueriedConcurrently(t *testing.T) {
+	providers := []cloudMetadataProvider{
+		&slowProvider{delay: time.Second},
+		&slowProvider{delay: time.Second},
+		&slowProvider{delay: 10 * time.Millisecond, metadata: &CloudMetadata{Vendor: awsVendorName}},
+	}
+	start := time.Now()
+	metadata, err := getCloudMetadata(http.DefaultClient, providers)
+	require.NoError(t, err)
+	assert.Equal(t, &CloudMetadata{Vendor: awsVendorName}, metadata)
+	assert.Less(t, time.Since(start), time.Second, "the first answer is taken")
+
+	start = time.Now()
+	metadata, err = getCloudMetadata(http.DefaultClient, providers[:2])
+	require.NoError(t, err)
+	assert.Nil(t, metadata)
+	assert.Less(t, time.Since(start), 2*time.Second, "the failing providers are waited for concurrently")
+}
+
+func TestCloudMetadataProvidersOfVendor(t *testing.T) {
+	assert.Len(t, newCloudMetadataProviders("http://imds", ""), 3)
+	providers := newCloudMetadataProviders("http://imds", gcpVendorName)
+	require.Len(t, providers, 1)
+	assert.Equal(t, gcpVendorName, providers[0].vendor())
+}
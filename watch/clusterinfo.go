@@ -0,0 +1,151 @@
+package watch
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	logger "github.com/kubescape/go-logger"
+	"github.com/kubescape/go-logger/helpers"
+	"k8s.io/apimachinery/pkg/version"
+	"k8s.io/client-go/kubernetes"
+)
+
+// ClusterIdentity identifies the cluster in the reports
+type ClusterIdentity struct {
+	Version *version.Info
+	// Distribution is the Kubernetes distribution, e.g. eks or openshift
+	Distribution string
+	// CloudMetadata is nil when kollector does not run in a known cloud
+	CloudMetadata *CloudMetadata
+}
+
+func (id *ClusterIdentity) cloudVendor() string {
+	return id.CloudMetadata.vendor()
+}
+
+// reportedVersion returns a copy of the version with the cloud vendor appended, e.g. "v1.29.1;AWS", as the event receiver expects it
+func (id *ClusterIdentity) reportedVersion() *version.Info {
+	if id.Version == nil {
+		return nil
+	}
+	reported := *id.Version
+	if vendor := id.cloudVendor(); vendor != "" {
+		reported.GitVersion += ";" + vendor
+	}
+	return &reported
+}
+
+// ClusterInfoChange is reported when the cluster identity changed, the versions are reported like in the first report
+type ClusterInfoChange struct {
+	PreviousVersion *version.Info `json:"previousVersion"`
+	Version         *version.Info `json:"version"`
+}
+
+// ClusterInfo caches the cluster identity. The API server version is refreshed periodically, the distribution and the
+// instance metadata are read once
+type ClusterInfo struct {
+	client kubernetes.Interface
+	// instanceMetadata reads the metadata of the node from the instance metadata API, it is not queried when nil. The
+	// vendor is known from the node providerIDs, only its API is queried then
+	instanceMetadata func(vendor string) (*CloudMetadata, error)
+
+	mutex sync.RWMutex
+	// identity is nil until the first refresh
+	identity    *ClusterIdentity
+	subscribers []func(previous, current ClusterIdentity)
+}
+
+func newClusterInfo(client kubernetes.Interface, instanceMetadata func(vendor string) (*CloudMetadata, error)) *ClusterInfo {
+	return &ClusterInfo{client: client, instanceMetadata: instanceMetadata}
+}
+
+// Get returns the cluster identity, false until the first refresh
+func (ci *ClusterInfo) Get() (ClusterIdentity, bool) {
+	if ci == nil {
+		return ClusterIdentity{}, false
+	}
+	ci.mutex.RLock()
+	defer ci.mutex.RUnlock()
+	if ci.identity == nil {
+		return ClusterIdentity{}, false
+	}
+	return *ci.identity, true
+}
+
+// Subscribe calls onChange after a refresh changed the identity, e.g. after an API server upgrade
+func (ci *ClusterInfo) Subscribe(onChange func(previous, current ClusterIdentity)) {
+	ci.mutex.Lock()
+	defer ci.mutex.Unlock()
+	ci.subscribers = append(ci.subscribers, onChange)
+}
+
+// Refresh reads the API server version, the first refresh reads the distribution and the instance metadata as well.
+// Returns true if the identity changed since the previous refresh
+func (ci *ClusterInfo) Refresh(ctx context.Context) (bool, error) {
+	previous, loaded := ci.Get()
+	current := previous
+	if !loaded {
+		distribution, vendor, err := getDistribution(ctx, ci.client)
+		if err != nil {
+			logger.L().Ctx(ctx).Error("failed to detect the distribution", helpers.Error(err))
+		}
+		current.Distribution = distribution
+		if ci.instanceMetadata != nil {
+			if current.CloudMetadata, err = ci.instanceMetadata(vendor); err != nil {
+				logger.L().Ctx(ctx).Warning("failed to read the instance metadata", helpers.Error(err))
+			}
+			if current.CloudMetadata == nil && vendor != "" {
+				current.CloudMetadata = &CloudMetadata{Vendor: vendor}
+			}
+		}
+		logger.L().Info("cluster info loaded", helpers.String("distribution", current.Distribution), helpers.String("cloudVendor", current.cloudVendor()))
+	}
+
+	serverVersion, err := ci.client.Discovery().ServerVersion()
+	if err != nil {
+		if loaded {
+			// the cached version is kept
+			return false, err
+		}
+		serverVersion = &version.Info{GitVersion: "Unknown"}
+	}
+	current.Version = serverVersion
+
+	ci.mutex.Lock()
+	ci.identity = &current
+	subscribers := append([]func(previous, current ClusterIdentity){}, ci.subscribers...)
+	ci.mutex.Unlock()
+
+	if !loaded {
+		logger.L().Info("K8s API version", helpers.Interface("version", serverVersion))
+		return true, err
+	}
+	if *previous.Version == *current.Version {
+		return false, nil
+	}
+	logger.L().Info("K8s API version changed", helpers.String("previous", previous.Version.GitVersion), helpers.String("current", current.Version.GitVersion))
+	for i := range subscribers {
+		subscribers[i](previous, current)
+	}
+	return true, nil
+}
+
+// Run refreshes the identity until the context is done
+func (ci *ClusterInfo) Run(ctx context.Context, interval time.Duration) {
+	if _, err := ci.Refresh(ctx); err != nil {
+		logger.L().Ctx(ctx).Error("failed to get the K8s API version", helpers.Error(err))
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := ci.Refresh(ctx); err != nil {
+				logger.L().Ctx(ctx).Warning("failed to refresh the K8s API version", helpers.Error(err))
+			}
+		}
+	}
+}
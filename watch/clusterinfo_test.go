@@ -0,0 +1,84 @@
+package watch
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/armosec/utils-k8s-go/armometadata"
+	"github.com/kubescape/backend/pkg/utils"
+	"github.com/kubescape/kollector/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/version"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestClusterInfoRefresh(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	discovery := client.Discovery().(*fakediscovery.FakeDiscovery)
+	discovery.FakedServerVersion = &version.Info{GitVersion: "v1.29.1-eks-508b6b3"}
+	metadataReads := 0
+	clusterInfo := newClusterInfo(client, func(string) (*CloudMetadata, error) {
+		metadataReads++
+		return &CloudMetadata{Vendor: awsVendorName}, nil
+	})
+	changes := []ClusterInfoChange{}
+	clusterInfo.Subscribe(func(previous, current ClusterIdentity) {
+		changes = append(changes, ClusterInfoChange{PreviousVersion: previous.reportedVersion(), Version: current.reportedVersion()})
+	})
+
+	_, loaded := clusterInfo.Get()
+	assert.False(t, loaded)
+	changed, err := clusterInfo.Refresh(context.Background())
+	require.NoError(t, err)
+	assert.True(t, changed)
+	identity, loaded := clusterInfo.Get()
+	assert.True(t, loaded)
+	assert.Equal(t, distributionEKS, identity.Distribution)
+	assert.Equal(t, "v1.29.1-eks-508b6b3;AWS", identity.reportedVersion().GitVersion)
+	assert.Equal(t, "v1.29.1-eks-508b6b3;AWS", identity.reportedVersion().GitVersion, "the cached version is not changed")
+
+	changed, err = clusterInfo.Refresh(context.Background())
+	require.NoError(t, err)
+	assert.False(t, changed)
+	assert.Empty(t, changes, "the subscribers are notified of changes only")
+
+	discovery.FakedServerVersion = &version.Info{GitVersion: "v1.30.0-eks-036c24b"}
+	changed, err = clusterInfo.Refresh(context.Background())
+	require.NoError(t, err)
+	assert.True(t, changed)
+	assert.Equal(t, []ClusterInfoChange{{PreviousVersion: &version.Info{GitVersion: "v1.29.1-eks-508b6b3;AWS"}, Version: &version.Info{GitVersion: "v1.30.0-eks-036c24b;AWS"}}}, changes)
+	assert.Equal(t, 1, metadataReads, "the instance metadata is read once")
+}
+
+func TestClusterInfoChangeIsReported(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	discovery := client.Discovery().(*fakediscovery.FakeDiscovery)
+	discovery.FakedServerVersion = &version.Info{GitVersion: "v1.29.1"}
+	wh, err := newWatchHandlerWithClients(config.NewKollectorConfig(&armometadata.ClusterConfig{ClusterName: "test"}, utils.Credentials{}, ""),
+		Clients{KubernetesClient: client})
+	require.NoError(t, err)
+	wh.clusterInfo.instanceMetadata = nil
+	wh.aggregateFirstDataFlag = false
+
+	_, err = wh.clusterInfo.Refresh(context.Background())
+	require.NoError(t, err)
+	assert.False(t, wh.hasReportData())
+
+	// the change is added to the report by the listener
+	listened := make(chan bool)
+	go func() { listened <- WaitTillNewDataArrived(context.Background(), wh) }()
+	discovery.FakedServerVersion = &version.Info{GitVersion: "v1.30.0"}
+	_, err = wh.clusterInfo.Refresh(context.Background())
+	require.NoError(t, err)
+	assert.True(t, <-listened)
+	assert.True(t, wh.hasReportData())
+
+	report := map[string]interface{}{}
+	require.NoError(t, json.Unmarshal(prepareDataToSend(context.Background(), wh), &report))
+	assert.Equal(t, "v1.30.0", report["clusterAPIServerVersion"].(map[string]interface{})["gitVersion"])
+	assert.Equal(t, "v1.29.1", report["clusterInfoChange"].(map[string]interface{})["previousVersion"].(map[string]interface{})["gitVersion"])
+	assert.False(t, wh.hasReportData(), "the change is reported once")
+}
@@ -0,0 +1,188 @@
+package watch
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"regexp"
+	"sync"
+	"time"
+
+	logger "github.com/kubescape/go-logger"
+	"github.com/kubescape/go-logger/helpers"
+	"github.com/kubescape/kollector/config"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const crashLoopBackOffReason = "CrashLoopBackOff"
+
+// CrashData is a crash of a container in a crash loop, it is reported once per restart
+type CrashData struct {
+	PodName       string                  `json:"podName"`
+	Namespace     string                  `json:"namespace,omitempty"`
+	NodeName      string                  `json:"nodeName"`
+	Owner         OwnerDetNameAndKindOnly `json:"uptreeOwner"`
+	ContainerName string                  `json:"containerName"`
+	InitContainer bool                    `json:"initContainer,omitempty"`
+	RestartCount  int32                   `json:"restartCount"`
+	ExitCode      int32                   `json:"exitCode"`
+	Signal        int32                   `json:"signal,omitempty"`
+	// Reason is the termination reason, e.g. Error or OOMKilled
+	Reason     string `json:"reason,omitempty"`
+	Message    string `json:"message,omitempty"`
+	StartedAt  string `json:"startedAt,omitempty"`
+	FinishedAt string `json:"finishedAt,omitempty"`
+	// LogTail is the end of the log of the crashed container, with the credentials redacted
+	LogTail string `json:"logTail,omitempty"`
+	// LogTailTruncated is true when the oldest lines were cut to fit the size limit
+	LogTailTruncated bool `json:"logTailTruncated,omitempty"`
+}
+
+// crashTracker remembers the last reported restart of each container, so a crash is reported once
+type crashTracker struct {
+	// reported is pod uid -> container name -> restart count
+	reported map[types.UID]map[string]int32
+	mutex    sync.Mutex
+}
+
+func newCrashTracker() *crashTracker {
+	return &crashTracker{reported: make(map[types.UID]map[string]int32)}
+}
+
+// shouldReport returns true if the restart was not reported yet and the policy samples it, the restart is marked as reported
+func (t *crashTracker) shouldReport(policy config.CrashReportSettings, uid types.UID, container string, restartCount int32) bool {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if last, ok := t.reported[uid][container]; ok && last == restartCount {
+		return false
+	}
+	if !isCrashSampled(policy, restartCount) {
+		return false
+	}
+	if t.reported[uid] == nil {
+		t.reported[uid] = make(map[string]int32)
+	}
+	t.reported[uid][container] = restartCount
+	return true
+}
+
+// forget drops the restarts of a deleted pod
+func (t *crashTracker) forget(uid types.UID) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	delete(t.reported, uid)
+}
+
+// isCrashSampled reports the first restarts, then every SampleEvery restart
+func isCrashSampled(policy config.CrashReportSettings, restartCount int32) bool {
+	if restartCount <= policy.MaxRestartCount {
+		return true
+	}
+	return policy.SampleEvery > 0 && restartCount%policy.SampleEvery == 0
+}
+
+// reportCrashes adds the containers of the pod that are in a crash loop to the report
+func (wh *WatchHandler) reportCrashes(ctx context.Context, pod *core.Pod, od *OwnerDet) {
+	ctx, span := otel.Tracer("").Start(ctx, "reportCrashes", trace.WithAttributes(attribute.String("pod", pod.Name)))
+	defer span.End()
+
+	settings := wh.config.Settings()
+	containers := make([]core.ContainerStatus, 0, len(pod.Status.ContainerStatuses)+len(pod.Status.InitContainerStatuses))
+	containers = append(containers, pod.Status.ContainerStatuses...)
+	containers = append(containers, pod.Status.InitContainerStatuses...)
+	for i := range containers {
+		status := &containers[i]
+		if status.State.Waiting == nil || status.State.Waiting.Reason != crashLoopBackOffReason {
+			continue
+		}
+		if !wh.crashes.shouldReport(settings.Crashes, pod.UID, status.Name, status.RestartCount) {
+			logger.L().Debug("crash not reported", helpers.String("pod", pod.Name), helpers.String("containerName", status.Name), helpers.Int("restartCount", int(status.RestartCount)))
+			continue
+		}
+		crash := newCrashData(pod, od, status, i >= len(pod.Status.ContainerStatuses))
+		span.AddEvent("getting previous container logs", trace.WithAttributes(attribute.String("containerName", status.Name)))
+		if logs, err := wh.getPreviousLogs(ctx, pod, status.Name, settings.CrashLogTailLines); err != nil {
+			logger.L().Ctx(ctx).Warning("failed to get the logs of a crashed container", helpers.String("pod", pod.Name), helpers.String("containerName", status.Name), helpers.Error(err))
+		} else {
+			crash.LogTail, crash.LogTailTruncated = redactLogTail(logs, settings.Crashes.LogTailMaxBytes)
+		}
+		logger.L().Info("container in crash loop", helpers.String("pod", pod.Name), helpers.String("namespace", pod.Namespace), helpers.String("containerName", status.Name),
+			helpers.Int("restartCount", int(status.RestartCount)), helpers.Int("exitCode", int(crash.ExitCode)), helpers.String("reason", crash.Reason))
+		wh.jsonReport.AddToJsonFormat(crash, CRASHES, CREATED)
+	}
+}
+
+func newCrashData(pod *core.Pod, od *OwnerDet, status *core.ContainerStatus, initContainer bool) CrashData {
+	crash := CrashData{
+		PodName:       pod.Name,
+		Namespace:     pod.Namespace,
+		NodeName:      pod.Spec.NodeName,
+		Owner:         OwnerDetNameAndKindOnly{Name: od.Name, Kind: od.Kind},
+		ContainerName: status.Name,
+		InitContainer: initContainer,
+		RestartCount:  status.RestartCount,
+	}
+	if terminated := status.LastTerminationState.Terminated; terminated != nil {
+		crash.ExitCode = terminated.ExitCode
+		crash.Signal = terminated.Signal
+		crash.Reason = terminated.Reason
+		crash.Message = terminated.Message
+		if !terminated.StartedAt.IsZero() {
+			crash.StartedAt = terminated.StartedAt.UTC().Format(time.RFC3339)
+		}
+		if !terminated.FinishedAt.IsZero() {
+			crash.FinishedAt = terminated.FinishedAt.UTC().Format(time.RFC3339)
+		}
+	}
+	return crash
+}
+
+// getPreviousLogs returns the last lines of the log of the previous, i.e. crashed, instance of the container
+func (wh *WatchHandler) getPreviousLogs(ctx context.Context, pod *core.Pod, container string, tailLines int64) ([]byte, error) {
+	if tailLines == 0 {
+		return nil, nil
+	}
+	podLogOpts := core.PodLogOptions{Previous: true, Timestamps: true, Container: container, TailLines: &tailLines}
+	reader, err := wh.RestAPIClient.CoreV1().Pods(pod.Namespace).GetLogs(pod.Name, &podLogOpts).Stream(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return io.ReadAll(reader)
+}
+
+// logCredentialPatterns match the credentials commonly printed in logs, the first group is kept
+var logCredentialPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`(?i)(\bbearer\s+)[a-z0-9\-._~+/]+=*`),
+	regexp.MustCompile(`(?i)((?:password|passwd|pwd|secret|token|api[_-]?key|access[_-]?key|authorization)["']?\s*[:=]\s*["']?)[^\s"',;&]+`),
+	regexp.MustCompile(`(://[^/\s:@]+:)[^/\s@]+(@)`),
+}
+
+// redactLogTail redacts the credentials of the log and keeps the last lines that fit maxBytes, 0 means no limit.
+// Returns true if lines were cut
+func redactLogTail(logs []byte, maxBytes int) (string, bool) {
+	for _, pattern := range logCredentialPatterns {
+		if pattern.NumSubexp() == 2 {
+			logs = pattern.ReplaceAll(logs, []byte("${1}[REDACTED]${2}"))
+		} else {
+			logs = pattern.ReplaceAll(logs, []byte("${1}[REDACTED]"))
+		}
+	}
+	if maxBytes == 0 || len(logs) <= maxBytes {
+		return string(logs), false
+	}
+	cut := len(logs) - maxBytes
+	// the first kept line is partial unless the cut is right after a new line
+	if logs[cut-1] != '\n' {
+		if i := bytes.IndexByte(logs[cut:], '\n'); i >= 0 {
+			cut += i + 1
+		} else {
+			cut = len(logs)
+		}
+	}
+	return string(logs[cut:]), true
+}
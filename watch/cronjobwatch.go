@@ -7,6 +7,7 @@ import (
 
 	logger "github.com/kubescape/go-logger"
 	"github.com/kubescape/go-logger/helpers"
+	"github.com/kubescape/kollector/config"
 	"golang.org/x/net/context"
 	batchv1 "k8s.io/api/batch/v1"
 	v1 "k8s.io/api/core/v1"
@@ -22,16 +23,17 @@ func (wh *WatchHandler) CronJobWatch(ctx context.Context) {
 		}
 	}()
 	var lastWatchEventCreationTime time.Time
-	newStateChan := make(chan bool)
-	wh.newStateReportChans = append(wh.newStateReportChans, newStateChan)
-	for {
+	newStateChan, unsubscribe := wh.subscribeNewState()
+	defer unsubscribe()
+	for ctx.Err() == nil {
 		logger.L().Info("Watching over cronjobs starting")
-		cronjobWatcher, err := wh.RestAPIClient.BatchV1().CronJobs("").Watch(globalHTTPContext, metav1.ListOptions{Watch: true})
+		cronjobWatcher, err := wh.RestAPIClient.BatchV1().CronJobs(wh.namespaceFilter.watchNamespace()).Watch(ctx, wh.listOptions(config.CronJobsResource))
 		if err != nil {
 			logger.L().Ctx(ctx).Error("Cannot watch over cronjobs", helpers.Error(err))
 			time.Sleep(3 * time.Second)
 			continue
 		}
+		cronjobWatcher = wh.recorder.watch(config.CronJobsResource, cronjobWatcher)
 		wh.handleCronJobWatch(ctx, cronjobWatcher, newStateChan, &lastWatchEventCreationTime)
 
 		logger.L().Info("Watching over cronjobs ended - since we got timeout")
@@ -40,12 +42,14 @@ func (wh *WatchHandler) CronJobWatch(ctx context.Context) {
 
 func (wh *WatchHandler) handleCronJobWatch(ctx context.Context, cronjobWatcher watch.Interface, newStateChan <-chan bool, lastWatchEventCreationTime *time.Time) {
 	cronjobChan := cronjobWatcher.ResultChan()
-	cronJobIDs := make(map[string]int)
 	logger.L().Info("Watching over cronjobs started")
 	for {
 		var event watch.Event
 		select {
 		case event = <-cronjobChan:
+		case <-ctx.Done():
+			cronjobWatcher.Stop()
+			return
 		case <-newStateChan:
 			cronjobWatcher.Stop()
 			*lastWatchEventCreationTime = time.Now()
@@ -72,7 +76,7 @@ func (wh *WatchHandler) handleCronJobWatch(ctx context.Context, cronjobWatcher w
 					logger.L().Info("cronjob already exist, will not be reported", helpers.String("name", cronjob.Name))
 					continue
 				}
-				id := CreateID()
+				id := wh.ids.CreateID()
 				od := OwnerDet{
 					Name:      cronjob.Name,
 					Kind:      cronjob.Kind,
@@ -82,7 +86,8 @@ func (wh *WatchHandler) handleCronJobWatch(ctx context.Context, cronjobWatcher w
 				nms := MicroServiceData{Pod: &v1.Pod{Spec: cronjob.Spec.JobTemplate.Spec.Template.Spec, TypeMeta: cronjob.TypeMeta, ObjectMeta: cronjob.ObjectMeta},
 					Owner: od, PodSpecId: id}
 				wh.jsonReport.AddToJsonFormat(nms, MICROSERVICES, CREATED)
-				cronJobIDs[string(cronjob.GetUID())] = id
+				wh.cronJobIDs[string(cronjob.GetUID())] = id
+				wh.objects.set("CronJob", cronjob.Namespace, cronjob.Name, id)
 				informNewDataArrive(wh)
 			case watch.Modified:
 				od := OwnerDet{
@@ -91,18 +96,19 @@ func (wh *WatchHandler) handleCronJobWatch(ctx context.Context, cronjobWatcher w
 					OwnerData: cronjob,
 				}
 				nms := MicroServiceData{Pod: &v1.Pod{Spec: cronjob.Spec.JobTemplate.Spec.Template.Spec, TypeMeta: cronjob.TypeMeta, ObjectMeta: cronjob.ObjectMeta},
-					Owner: od, PodSpecId: cronJobIDs[string(cronjob.GetUID())]}
+					Owner: od, PodSpecId: wh.cronJobIDs[string(cronjob.GetUID())]}
 				wh.jsonReport.AddToJsonFormat(nms, MICROSERVICES, UPDATED)
 				informNewDataArrive(wh)
 			case watch.Deleted:
-				delete(cronJobIDs, string(cronjob.GetUID()))
+				wh.objects.remove("CronJob", cronjob.Namespace, cronjob.Name, wh.cronJobIDs[string(cronjob.GetUID())])
+				delete(wh.cronJobIDs, string(cronjob.GetUID()))
 				od := OwnerDet{
 					Name:      cronjob.Name,
 					Kind:      cronjob.Kind,
 					OwnerData: cronjob,
 				}
 				nms := MicroServiceData{Pod: &v1.Pod{Spec: cronjob.Spec.JobTemplate.Spec.Template.Spec, TypeMeta: cronjob.TypeMeta, ObjectMeta: cronjob.ObjectMeta},
-					Owner: od, PodSpecId: cronJobIDs[string(cronjob.GetUID())]}
+					Owner: od, PodSpecId: wh.cronJobIDs[string(cronjob.GetUID())]}
 				wh.jsonReport.AddToJsonFormat(nms, MICROSERVICES, DELETED)
 				informNewDataArrive(wh)
 			case watch.Bookmark: //only the resource version is changed but it's the same workload
@@ -0,0 +1,114 @@
+package watch
+
+import (
+	"context"
+	"strings"
+
+	logger "github.com/kubescape/go-logger"
+	"github.com/kubescape/go-logger/helpers"
+	cloudsupportv1 "github.com/kubescape/k8s-interface/cloudsupport/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	distributionEKS       = "eks"
+	distributionGKE       = "gke"
+	distributionAKS       = "aks"
+	distributionOpenShift = "openshift"
+	distributionK3s       = "k3s"
+	distributionKind      = "kind"
+	distributionRKE2      = "rke2"
+	distributionRancher   = "rancher"
+)
+
+// distributionSignals are the cluster facts the distribution is detected from, no instance metadata API is queried
+type distributionSignals struct {
+	nodes []corev1.Node
+	// gitVersion is the API server version, e.g. v1.29.1+k3s2
+	gitVersion string
+	namespaces map[string]bool
+}
+
+// distributionRule detects a distribution, the rules are checked in order
+type distributionRule struct {
+	distribution string
+	// versionMarker is a substring of the API server version
+	versionMarker string
+	// providerIDScheme is the scheme of the node providerID, e.g. aws for aws:///us-east-1a/i-1
+	providerIDScheme string
+	// nodeLabels are labels one of the nodes has
+	nodeLabels []string
+	// namespaces are well-known namespaces of the distribution
+	namespaces []string
+}
+
+// distributionRules checks the distributions built on top of others first, e.g. OpenShift runs on AWS as well.
+// Rancher manages clusters of the other distributions, so it is checked last
+var distributionRules = []distributionRule{
+	{distribution: distributionOpenShift, nodeLabels: []string{"node.openshift.io/os_id"}, namespaces: []string{"openshift-apiserver", "openshift-kube-apiserver"}},
+	{distribution: distributionK3s, versionMarker: "+k3s", providerIDScheme: "k3s"},
+	{distribution: distributionRKE2, versionMarker: "+rke2", providerIDScheme: "rke2"},
+	{distribution: distributionKind, providerIDScheme: "kind"},
+	{distribution: distributionEKS, versionMarker: "-eks-", providerIDScheme: "aws", nodeLabels: []string{"eks.amazonaws.com/nodegroup", "alpha.eksctl.io/cluster-name"}},
+	{distribution: distributionGKE, versionMarker: "-gke.", providerIDScheme: "gce", nodeLabels: []string{"cloud.google.com/gke-nodepool"}},
+	{distribution: distributionAKS, providerIDScheme: "azure", nodeLabels: []string{"kubernetes.azure.com/cluster"}},
+	{distribution: distributionRancher, namespaces: []string{"cattle-system"}},
+}
+
+func (rule *distributionRule) matches(signals *distributionSignals) bool {
+	if rule.versionMarker != "" && strings.Contains(signals.gitVersion, rule.versionMarker) {
+		return true
+	}
+	for i := range rule.namespaces {
+		if signals.namespaces[rule.namespaces[i]] {
+			return true
+		}
+	}
+	for i := range signals.nodes {
+		node := &signals.nodes[i]
+		if rule.providerIDScheme != "" && strings.HasPrefix(node.Spec.ProviderID, rule.providerIDScheme+"://") {
+			return true
+		}
+		for _, label := range rule.nodeLabels {
+			if _, ok := node.Labels[label]; ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// detectDistribution returns the Kubernetes distribution, or the cloud provider of the nodes when no distribution is detected
+func detectDistribution(signals *distributionSignals) string {
+	for i := range distributionRules {
+		if distributionRules[i].matches(signals) {
+			return distributionRules[i].distribution
+		}
+	}
+	return cloudsupportv1.GetCloudProvider(&corev1.NodeList{Items: signals.nodes})
+}
+
+// getDistribution collects the signals from the API server and detects the distribution, only the nodes are required.
+// It returns the cloud vendor of the node providerIDs as well, it is empty when unknown
+func getDistribution(ctx context.Context, client kubernetes.Interface) (string, string, error) {
+	nodeList, err := client.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return "", "", err
+	}
+	signals := &distributionSignals{nodes: nodeList.Items, namespaces: map[string]bool{}}
+	if serverVersion, err := client.Discovery().ServerVersion(); err == nil {
+		signals.gitVersion = serverVersion.GitVersion
+	} else {
+		logger.L().Ctx(ctx).Warning("failed to get the API server version for the distribution detection", helpers.Error(err))
+	}
+	if namespaceList, err := client.CoreV1().Namespaces().List(ctx, metav1.ListOptions{}); err == nil {
+		for i := range namespaceList.Items {
+			signals.namespaces[namespaceList.Items[i].Name] = true
+		}
+	} else {
+		logger.L().Ctx(ctx).Warning("failed to list the namespaces for the distribution detection", helpers.Error(err))
+	}
+	return detectDistribution(signals), providerIDVendor(nodeList.Items), nil
+}
@@ -0,0 +1,66 @@
+package watch
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/version"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestDetectDistribution(t *testing.T) {
+	node := func(providerID string, labels map[string]string) corev1.Node {
+		return corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node", Labels: labels}, Spec: corev1.NodeSpec{ProviderID: providerID}}
+	}
+	tests := []struct {
+		name     string
+		signals  distributionSignals
+		expected string
+	}{
+		{name: "eks version", signals: distributionSignals{gitVersion: "v1.29.1-eks-508b6b3"}, expected: distributionEKS},
+		{name: "eks provider id", signals: distributionSignals{nodes: []corev1.Node{node("aws:///us-east-1a/i-1", nil)}}, expected: distributionEKS},
+		{name: "gke label", signals: distributionSignals{nodes: []corev1.Node{node("", map[string]string{"cloud.google.com/gke-nodepool": "pool"})}}, expected: distributionGKE},
+		{name: "gke version", signals: distributionSignals{gitVersion: "v1.28.3-gke.1286000"}, expected: distributionGKE},
+		{name: "aks", signals: distributionSignals{nodes: []corev1.Node{node("azure:///subscriptions/s/vm", nil)}}, expected: distributionAKS},
+		{name: "openshift on aws", signals: distributionSignals{nodes: []corev1.Node{node("aws:///us-east-1a/i-1", map[string]string{"node.openshift.io/os_id": "rhcos"})}}, expected: distributionOpenShift},
+		{name: "openshift namespace", signals: distributionSignals{namespaces: map[string]bool{"openshift-apiserver": true}}, expected: distributionOpenShift},
+		{name: "k3s", signals: distributionSignals{gitVersion: "v1.29.1+k3s2"}, expected: distributionK3s},
+		{name: "rke2", signals: distributionSignals{gitVersion: "v1.28.5+rke2r1"}, expected: distributionRKE2},
+		{name: "kind", signals: distributionSignals{nodes: []corev1.Node{node("kind://docker/kind/kind-control-plane", nil)}}, expected: distributionKind},
+		{name: "rancher managed eks", signals: distributionSignals{gitVersion: "v1.29.1-eks-508b6b3", namespaces: map[string]bool{"cattle-system": true}}, expected: distributionEKS},
+		{name: "rancher", signals: distributionSignals{gitVersion: "v1.29.1", namespaces: map[string]bool{"cattle-system": true}}, expected: distributionRancher},
+		{name: "cloud provider fallback", signals: distributionSignals{nodes: []corev1.Node{node("digitalocean://1", nil)}}, expected: "digitalocean"},
+		{name: "unknown", signals: distributionSignals{gitVersion: "v1.29.1"}, expected: ""},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, detectDistribution(&tc.signals))
+		})
+	}
+}
+
+func TestGetDistribution(t *testing.T) {
+	client := fake.NewSimpleClientset(
+		&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node"}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "kube-system"}})
+	client.Discovery().(*fakediscovery.FakeDiscovery).FakedServerVersion = &version.Info{GitVersion: "v1.29.1+k3s2"}
+
+	distribution, vendor, err := getDistribution(context.Background(), client)
+	require.NoError(t, err)
+	assert.Equal(t, distributionK3s, distribution)
+	assert.Equal(t, "", vendor)
+}
+
+func TestProviderIDVendor(t *testing.T) {
+	node := func(providerID string) corev1.Node { return corev1.Node{Spec: corev1.NodeSpec{ProviderID: providerID}} }
+	assert.Equal(t, awsVendorName, providerIDVendor([]corev1.Node{node("aws:///us-east-1a/i-1")}))
+	assert.Equal(t, gcpVendorName, providerIDVendor([]corev1.Node{node(""), node("gce://project/us-central1-a/node")}))
+	assert.Equal(t, azureVendorName, providerIDVendor([]corev1.Node{node("azure:///subscriptions/sub/resourceGroups/rg/providers/Microsoft.Compute/virtualMachines/vm")}))
+	assert.Equal(t, "", providerIDVendor([]corev1.Node{node("k3s://node")}), "not a cloud vendor")
+	assert.Equal(t, "", providerIDVendor(nil))
+}
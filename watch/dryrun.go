@@ -0,0 +1,120 @@
+package watch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+
+	logger "github.com/kubescape/go-logger"
+	"github.com/kubescape/go-logger/helpers"
+)
+
+// reportSectionNames are the JSON names of the object sections of a report
+var reportSectionNames = []string{"node", "pod", "service", "microservice", "secret", "namespace", "crash", "event", "image", "exposure", "networkPolicy", "networkIsolation", "permission"}
+
+// dryRunSender is the report sink of the dry run mode. The reports are pretty-printed to stdout, or appended
+// to a file one per line, and their sizes are logged
+type dryRunSender struct {
+	reports chan []byte
+	output  io.Writer
+	pretty  bool
+	// count and totalBytes are the number and the size of the reports written so far
+	count      int
+	totalBytes int
+}
+
+// newDryRunSender returns a sink writing to the output file, or to stdout when the file is not set
+func newDryRunSender(outputFile string) (*dryRunSender, error) {
+	if outputFile == "" {
+		return &dryRunSender{reports: make(chan []byte), output: os.Stdout, pretty: true}, nil
+	}
+	f, err := os.OpenFile(outputFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open dry run output: %s", err.Error())
+	}
+	return &dryRunSender{reports: make(chan []byte), output: f}, nil
+}
+
+// SendReportRoutine writes the reports until the context is done
+func (s *dryRunSender) SendReportRoutine(ctx context.Context, isServerReady *bool, _ func(bool)) error {
+	logger.L().Ctx(ctx).Info("dry run, the reports are not sent to the event receiver")
+	*isServerReady = true
+	for {
+		select {
+		case report := <-s.reports:
+			if err := s.write(ctx, report); err != nil {
+				return err
+			}
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+func (s *dryRunSender) send(ctx context.Context, report []byte) error {
+	select {
+	case s.reports <- report:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *dryRunSender) reconfigure(*url.URL, string) bool {
+	return false
+}
+
+func (s *dryRunSender) write(ctx context.Context, report []byte) error {
+	s.count++
+	s.totalBytes += len(report)
+	fields := []helpers.IDetails{
+		helpers.Int("bytes", len(report)),
+		helpers.Int("reports", s.count),
+		helpers.Int("totalBytes", s.totalBytes),
+	}
+	if sections, err := reportSections(report); err == nil {
+		for _, name := range reportSectionNames {
+			if count, ok := sections[name]; ok {
+				fields = append(fields, helpers.Int(name, count))
+			}
+		}
+	}
+	logger.L().Ctx(ctx).Info("dry run report", fields...)
+
+	var output bytes.Buffer
+	if s.pretty {
+		if err := json.Indent(&output, report, "", "  "); err != nil {
+			return fmt.Errorf("failed to format report: %s", err.Error())
+		}
+	} else {
+		output.Write(report)
+	}
+	output.WriteByte('\n')
+	if _, err := s.output.Write(output.Bytes()); err != nil {
+		return fmt.Errorf("failed to write report: %s", err.Error())
+	}
+	return nil
+}
+
+// reportSections returns the number of created, updated and deleted objects of each section of the report
+func reportSections(report []byte) (map[string]int, error) {
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(report, &fields); err != nil {
+		return nil, err
+	}
+	result := map[string]int{}
+	for _, name := range reportSectionNames {
+		if field, ok := fields[name]; ok {
+			data := ObjectData{}
+			if err := json.Unmarshal(field, &data); err != nil {
+				return nil, fmt.Errorf("invalid %s section: %s", name, err.Error())
+			}
+			result[name] = data.Len()
+		}
+	}
+	return result, nil
+}
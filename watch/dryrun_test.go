@@ -0,0 +1,37 @@
+package watch
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDryRunSender(t *testing.T) {
+	report := []byte(`{"firstReport":true,"pod":{"create":[{"podName":"a"},{"podName":"b"}],"delete":[{"podName":"c"}]},"node":{"update":[{}]},"installationData":{"clusterName":"test"}}`)
+
+	var output bytes.Buffer
+	sender := &dryRunSender{output: &output}
+	assert.NoError(t, sender.write(context.Background(), report))
+	assert.NoError(t, sender.write(context.Background(), report))
+	assert.Equal(t, string(report)+"\n"+string(report)+"\n", output.String(), "one report per line")
+	assert.Equal(t, 2, sender.count)
+	assert.Equal(t, 2*len(report), sender.totalBytes)
+
+	output.Reset()
+	sender = &dryRunSender{output: &output, pretty: true}
+	assert.NoError(t, sender.write(context.Background(), report))
+	assert.True(t, strings.HasPrefix(output.String(), "{\n  \"firstReport\": true,"))
+	assert.Error(t, sender.write(context.Background(), []byte("{")))
+}
+
+func TestReportSections(t *testing.T) {
+	sections, err := reportSections([]byte(`{"firstReport":true,"pod":{"create":[{},{}],"delete":[{}]},"node":{"update":[{}]},"installationData":{}}`))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int{"pod": 3, "node": 1}, sections)
+
+	_, err = reportSections([]byte(`{"pod":[]}`))
+	assert.Error(t, err)
+}
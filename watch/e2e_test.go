@@ -0,0 +1,445 @@
+package watch
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/armosec/utils-k8s-go/armometadata"
+	"github.com/gorilla/websocket"
+	"github.com/kubescape/backend/pkg/utils"
+	"github.com/kubescape/kollector/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	eventsv1 "k8s.io/api/events/v1"
+	apixfake "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset/fake"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+	metadatafake "k8s.io/client-go/metadata/fake"
+)
+
+// e2eHarness runs a WatchHandler against a fake clientset and a mock event receiver, the reports are read as the receiver gets them
+type e2eHarness struct {
+	t         *testing.T
+	ctx       context.Context
+	cancel    context.CancelFunc
+	clientset *fake.Clientset
+	wh        *WatchHandler
+	reports   chan receivedReport
+	// closed gets the close frames of the receiver connections
+	closed chan *websocket.CloseError
+	// done is closed when the WatchHandler stopped
+	done   chan struct{}
+	config *e2eConfig
+}
+
+// receivedReport is a report and the URL of the event receiver it was sent to
+type receivedReport struct {
+	receiver string
+	message  []byte
+}
+
+// e2eConfig is a config whose event receiver URL can be changed, like a reloaded config
+type e2eConfig struct {
+	*config.KollectorConfig
+	url atomic.Value
+}
+
+func (c *e2eConfig) EventReceiverWebsocketURL() string {
+	return c.url.Load().(string)
+}
+
+// newReceiver starts a mock event receiver and returns its URL
+func (h *e2eHarness) newReceiver() string {
+	upgrader := websocket.Upgrader{}
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			messageType, message, err := conn.ReadMessage()
+			if closeErr, ok := err.(*websocket.CloseError); ok {
+				h.closed <- closeErr
+			}
+			if err != nil {
+				return
+			}
+			if messageType == websocket.TextMessage {
+				h.reports <- receivedReport{receiver: "ws://" + r.Host, message: message}
+			}
+		}
+	}))
+	h.t.Cleanup(receiver.Close)
+	return "ws://" + receiver.Listener.Addr().String()
+}
+
+// newE2EHarness starts a mock event receiver, the settings can be changed by configure
+func newE2EHarness(t *testing.T, configure ...func(*config.Settings)) *e2eHarness {
+	h := &e2eHarness{t: t, clientset: fake.NewSimpleClientset(), reports: make(chan receivedReport, 100), closed: make(chan *websocket.CloseError, 10), done: make(chan struct{})}
+	h.ctx, h.cancel = context.WithCancel(context.Background())
+
+	receiver := h.newReceiver()
+
+	settings := config.DefaultSettings()
+	settings.WebSocket.ConnectRetries = 5
+	settings.WebSocket.WaitBeforeReport = 0
+	settings.WebSocket.PingInterval = config.Duration(time.Second)
+	for _, f := range configure {
+		f(&settings)
+	}
+	kollectorConfig := &e2eConfig{KollectorConfig: config.NewKollectorConfig(&armometadata.ClusterConfig{ClusterName: "e2e"},
+		utils.Credentials{Account: "account", AccessKey: "key"}, "").SetSettings(settings)}
+	kollectorConfig.url.Store(receiver)
+	h.config = kollectorConfig
+
+	wh, err := CreateWatchHandler(kollectorConfig,
+		WithClients(Clients{
+			KubernetesClient: h.clientset,
+			MetadataClient:   metadatafake.NewSimpleMetadataClient(metadatafake.NewTestScheme()),
+			ExtensionsClient: apixfake.NewSimpleClientset().ApiextensionsV1beta1(),
+			DynamicClient:    dynamicfake.NewSimpleDynamicClient(runtime.NewScheme()),
+		}),
+		WithInstanceMetadata(func(string) (*CloudMetadata, error) {
+			return &CloudMetadata{Vendor: awsVendorName, Region: "eu-west-1"}, nil
+		}))
+	require.NoError(t, err)
+	h.wh = wh
+	t.Cleanup(h.stop)
+	return h
+}
+
+// start runs the WatchHandler like main does, and waits for the first report
+func (h *e2eHarness) start() map[string]interface{} {
+	ready := false
+	go func() {
+		defer close(h.done)
+		h.wh.Run(h.ctx, &ready)
+	}()
+
+	// the fake clientset does not replay the existing objects, so nothing is created before the watches are established
+	require.Eventually(h.t, func() bool {
+		watched := map[string]bool{}
+		for _, action := range h.clientset.Actions() {
+			if action.GetVerb() == "watch" {
+				watched[action.GetResource().Resource] = true
+			}
+		}
+		return watched[config.PodsResource] && watched[config.NodesResource] && watched[config.ServicesResource] &&
+			watched[config.NamespacesResource] && watched[config.CronJobsResource] && watched[config.EventsResource]
+	}, 5*time.Second, 10*time.Millisecond)
+	return h.nextReport()
+}
+
+// stop shuts the WatchHandler down like SIGTERM does
+func (h *e2eHarness) stop() {
+	h.cancel()
+	select {
+	case <-h.done:
+	case <-time.After(10 * time.Second):
+		assert.Fail(h.t, "the WatchHandler did not stop")
+	}
+}
+
+func (h *e2eHarness) nextReport() map[string]interface{} {
+	_, report := h.nextReportWithReceiver()
+	return report
+}
+
+// nextReportWithReceiver returns the next report and the URL of the event receiver it was sent to
+func (h *e2eHarness) nextReportWithReceiver() (string, map[string]interface{}) {
+	select {
+	case received := <-h.reports:
+		report := map[string]interface{}{}
+		require.NoError(h.t, json.Unmarshal(received.message, &report))
+		return received.receiver, report
+	case <-time.After(10 * time.Second):
+		require.FailNow(h.t, "no report received")
+		return "", nil
+	}
+}
+
+// assertNoReport fails if a report is received in the next moment
+func (h *e2eHarness) assertNoReport() {
+	select {
+	case received := <-h.reports:
+		assert.Failf(h.t, "unexpected report", "%s", received.message)
+	case <-time.After(300 * time.Millisecond):
+	}
+}
+
+// assertNoObjects fails if objects are reported in the next moment, the reports emptied by a previous one are ignored
+func (h *e2eHarness) assertNoObjects() {
+	deadline := time.After(300 * time.Millisecond)
+	for {
+		select {
+		case received := <-h.reports:
+			report := map[string]interface{}{}
+			require.NoError(h.t, json.Unmarshal(received.message, &report))
+			assert.Empty(h.t, summarize(report))
+		case <-deadline:
+			return
+		}
+	}
+}
+
+func (h *e2eHarness) create(object runtime.Object) {
+	require.NoError(h.t, h.clientset.Tracker().Add(object))
+}
+
+func (h *e2eHarness) update(object runtime.Object) {
+	require.NoError(h.t, h.clientset.Tracker().Update(appsv1.SchemeGroupVersion.WithResource("deployments"), object, "payments"))
+}
+
+func (h *e2eHarness) deletePod(name string) {
+	require.NoError(h.t, h.clientset.CoreV1().Pods("payments").Delete(h.ctx, name, metav1.DeleteOptions{}))
+}
+
+// summarize lists the objects of each section of the report, e.g. "pod create api-1-a"
+func summarize(report map[string]interface{}) []string {
+	result := []string{}
+	for _, section := range reportSectionNames {
+		data, ok := report[section].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		for operation, objects := range data {
+			for _, object := range objects.([]interface{}) {
+				var name string
+				switch section {
+				case "pod":
+					name = object.(map[string]interface{})["podName"].(string)
+				case "microservice":
+					owner := object.(map[string]interface{})["uptreeOwner"].(map[string]interface{})
+					name = fmt.Sprintf("%s/%s", owner["kind"], owner["name"])
+				case "namespace", "service":
+					name = object.(map[string]interface{})["metadata"].(map[string]interface{})["name"].(string)
+				case "networkIsolation", "permission":
+					name = fmt.Sprintf("%s/%s", object.(map[string]interface{})["kind"], object.(map[string]interface{})["name"])
+				case "event":
+					regarding := object.(map[string]interface{})["regarding"].(map[string]interface{})
+					name = fmt.Sprintf("%s/%s %s", regarding["kind"], regarding["name"], object.(map[string]interface{})["reason"])
+				default:
+					name = fmt.Sprintf("%v", object)
+				}
+				result = append(result, strings.Join([]string{section, operation, name}, " "))
+			}
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+func newDeployment(name, image string) *appsv1.Deployment {
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "payments", CreationTimestamp: metav1.Now()},
+		Spec: appsv1.DeploymentSpec{Template: corev1.PodTemplateSpec{
+			Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "api", Image: image}}},
+		}},
+	}
+}
+
+func newReplicaSet(name, deployment string) *appsv1.ReplicaSet {
+	return &appsv1.ReplicaSet{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "payments", CreationTimestamp: metav1.Now(),
+		OwnerReferences: []metav1.OwnerReference{{Kind: "Deployment", Name: deployment, APIVersion: "apps/v1"}}}}
+}
+
+func newPod(name, replicaSet, image string) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "payments", UID: types.UID("uid-" + name), CreationTimestamp: metav1.Now(),
+			OwnerReferences: []metav1.OwnerReference{{Kind: "ReplicaSet", Name: replicaSet, APIVersion: "apps/v1"}}},
+		Spec:   corev1.PodSpec{Containers: []corev1.Container{{Name: "api", Image: image}}},
+		Status: corev1.PodStatus{Phase: corev1.PodRunning},
+	}
+}
+
+func TestE2EDeployScaleRolloutDelete(t *testing.T) {
+	h := newE2EHarness(t)
+
+	first := h.start()
+	assert.Equal(t, true, first["firstReport"])
+	assert.NotNil(t, first["clusterAPIServerVersion"])
+	assert.Equal(t, "e2e", first["installationData"].(map[string]interface{})["clusterName"])
+	assert.Equal(t, map[string]interface{}{"vendor": awsVendorName, "region": "eu-west-1"}, first["cloudMetadata"])
+	assert.Empty(t, summarize(first))
+
+	// deploy
+	h.create(newDeployment("api", "api:v1"))
+	h.create(newReplicaSet("api-1", "api"))
+	h.create(newPod("api-1-a", "api-1", "api:v1"))
+	assert.Equal(t, []string{"microservice create Deployment/api", "networkIsolation create Deployment/api", "permission create Deployment/api", "pod create api-1-a"}, summarize(h.nextReport()))
+
+	// scale, the pod spec is already reported
+	h.create(newPod("api-1-b", "api-1", "api:v1"))
+	assert.Equal(t, []string{"pod create api-1-b"}, summarize(h.nextReport()))
+
+	// rollout, the new pod spec is a new microservice. The deployment still exists, so it is not removed with the old pods
+	h.update(newDeployment("api", "api:v2"))
+	h.create(newReplicaSet("api-2", "api"))
+	h.create(newPod("api-2-a", "api-2", "api:v2"))
+	assert.Equal(t, []string{"microservice create Deployment/api", "networkIsolation create Deployment/api", "permission create Deployment/api", "pod create api-2-a"}, summarize(h.nextReport()))
+	h.deletePod("api-1-a")
+	assert.Equal(t, []string{"pod delete api-1-a"}, summarize(h.nextReport()))
+	h.deletePod("api-1-b")
+	assert.Equal(t, []string{"pod delete api-1-b"}, summarize(h.nextReport()))
+
+	// delete, the microservice is removed with the last pod once the deployment is gone
+	require.NoError(t, h.clientset.AppsV1().Deployments("payments").Delete(h.ctx, "api", metav1.DeleteOptions{}))
+	h.deletePod("api-2-a")
+	assert.Equal(t, []string{"microservice delete Deployment/api", "networkIsolation delete Deployment/api", "permission delete Deployment/api", "pod delete api-2-a"}, summarize(h.nextReport()))
+
+	h.assertNoReport()
+}
+
+func TestE2EShutdown(t *testing.T) {
+	h := newE2EHarness(t)
+	h.start()
+
+	h.create(newDeployment("api", "api:v1"))
+	h.create(newReplicaSet("api-1", "api"))
+	h.create(newPod("api-1-a", "api-1", "api:v1"))
+	assert.Equal(t, []string{"microservice create Deployment/api", "networkIsolation create Deployment/api", "permission create Deployment/api", "pod create api-1-a"}, summarize(h.nextReport()))
+
+	// an object collected but not reported yet is flushed on shutdown
+	h.wh.jsonReport.AddToJsonFormat(&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "pending"}}, NAMESPACES, CREATED)
+	h.stop()
+	assert.Equal(t, []string{"namespace create pending"}, summarize(h.nextReport()))
+	select {
+	case closeErr := <-h.closed:
+		assert.Equal(t, websocket.CloseNormalClosure, closeErr.Code)
+	case <-time.After(5 * time.Second):
+		assert.Fail(t, "the connection was not closed")
+	}
+	h.wh.newStateReportChansMutex.Lock()
+	assert.Empty(t, h.wh.newStateReportChans, "the watchers stopped")
+	h.wh.newStateReportChansMutex.Unlock()
+	h.assertNoReport()
+}
+
+func TestE2EEventReceiverChange(t *testing.T) {
+	h := newE2EHarness(t)
+	h.start()
+
+	h.create(newDeployment("api", "api:v1"))
+	h.create(newReplicaSet("api-1", "api"))
+	h.create(newPod("api-1-a", "api-1", "api:v1"))
+	assert.Equal(t, []string{"microservice create Deployment/api", "networkIsolation create Deployment/api", "permission create Deployment/api", "pod create api-1-a"}, summarize(h.nextReport()))
+
+	// a reloaded config moves kollector to another event receiver, which gets a first report
+	receiver := h.newReceiver()
+	h.config.url.Store(receiver)
+	h.wh.Reconfigure(h.ctx)
+	select {
+	case closeErr := <-h.closed:
+		assert.Equal(t, websocket.CloseNormalClosure, closeErr.Code)
+	case <-time.After(5 * time.Second):
+		assert.Fail(t, "the previous connection was not closed")
+	}
+	reportReceiver, report := h.nextReportWithReceiver()
+	assert.Equal(t, receiver, reportReceiver)
+	assert.Equal(t, true, report["firstReport"])
+	assert.Equal(t, "e2e", report["installationData"].(map[string]interface{})["clusterName"])
+	assert.NotNil(t, report["clusterAPIServerVersion"])
+
+	// the deltas follow the first report
+	h.create(newPod("api-1-b", "api-1", "api:v1"))
+	reportReceiver, report = h.nextReportWithReceiver()
+	assert.Equal(t, receiver, reportReceiver)
+	assert.NotEqual(t, true, report["firstReport"])
+	assert.Contains(t, summarize(report), "pod create api-1-b")
+}
+
+func newWarningEvent(name, kind, regarding, reason string) *eventsv1.Event {
+	return &eventsv1.Event{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "payments"},
+		Type:       corev1.EventTypeWarning,
+		Regarding:  corev1.ObjectReference{Kind: kind, Namespace: "payments", Name: regarding},
+		Reason:     reason,
+		Note:       reason + " note",
+		EventTime:  metav1.NewMicroTime(time.Now()),
+	}
+}
+
+// nextReports returns the objects of the next reports, until all the expected objects are reported
+func (h *e2eHarness) nextReports(expected int) []string {
+	result := []string{}
+	for len(result) < expected {
+		result = append(result, summarize(h.nextReport())...)
+	}
+	sort.Strings(result)
+	return result
+}
+
+func TestE2ENamespaceLabelSelector(t *testing.T) {
+	h := newE2EHarness(t, func(settings *config.Settings) {
+		settings.NamespaceFilter.LabelSelector = "team=payments"
+	})
+	h.start()
+
+	namespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "payments", CreationTimestamp: metav1.Now()}}
+	h.create(namespace)
+	h.create(newDeployment("api", "api:v1"))
+	h.create(newReplicaSet("api-1", "api"))
+	h.create(newPod("api-1-a", "api-1", "api:v1"))
+	h.create(&corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: "api", Namespace: "payments", CreationTimestamp: metav1.Now()}})
+	h.assertNoReport()
+
+	// the labels move the namespace into the selector, it is reported with the pods and services it already has
+	namespace = namespace.DeepCopy()
+	namespace.Labels = map[string]string{"team": "payments"}
+	_, err := h.clientset.CoreV1().Namespaces().Update(h.ctx, namespace, metav1.UpdateOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"microservice create Deployment/api", "namespace create payments", "networkIsolation create Deployment/api",
+		"permission create Deployment/api", "pod create api-1-a", "service create api"}, h.nextReports(6))
+
+	// the labels move the namespace out of the selector, it is removed with its pods and services
+	namespace = namespace.DeepCopy()
+	namespace.Labels = map[string]string{"team": "finance"}
+	_, err = h.clientset.CoreV1().Namespaces().Update(h.ctx, namespace, metav1.UpdateOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"microservice delete Deployment/api", "namespace delete payments", "networkIsolation delete Deployment/api",
+		"permission delete Deployment/api", "pod delete api-1-a", "service delete api"}, h.nextReports(6))
+
+	h.create(newPod("api-1-b", "api-1", "api:v1"))
+	h.assertNoObjects()
+}
+
+func TestE2EWarningEvents(t *testing.T) {
+	h := newE2EHarness(t)
+	h.start()
+
+	h.create(newDeployment("api", "api:v1"))
+	h.create(newReplicaSet("api-1", "api"))
+	h.create(newPod("api-1-a", "api-1", "api:v1"))
+	created := h.nextReport()
+	assert.Equal(t, []string{"microservice create Deployment/api", "networkIsolation create Deployment/api", "permission create Deployment/api", "pod create api-1-a"}, summarize(created))
+	podSpecID := created["microservice"].(map[string]interface{})["create"].([]interface{})[0].(map[string]interface{})["podSpecId"]
+
+	normal := newWarningEvent("api-1-a.1", "Pod", "api-1-a", "Scheduled")
+	normal.Type = corev1.EventTypeNormal
+	h.create(normal)
+	h.create(newWarningEvent("other.1", "Pod", "other", "BackOff"))
+	h.create(newWarningEvent("api-1-a.2", "Pod", "api-1-a", "BackOff"))
+	report := h.nextReport()
+	assert.Equal(t, []string{"event create Pod/api-1-a BackOff"}, summarize(report), "only the warnings of the tracked objects are reported")
+	event := report["event"].(map[string]interface{})["create"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, podSpecID, event["podSpecId"])
+	assert.Equal(t, "BackOff note", event["message"])
+
+	h.create(newWarningEvent("api-1-a.3", "Pod", "api-1-a", "BackOff"))
+	h.create(newWarningEvent("api-1.1", "ReplicaSet", "api-1", "FailedCreate"))
+	assert.Equal(t, []string{"event create ReplicaSet/api-1 FailedCreate"}, summarize(h.nextReport()), "the same reason and count is reported once")
+}
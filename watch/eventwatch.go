@@ -0,0 +1,263 @@
+package watch
+
+import (
+	"context"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	logger "github.com/kubescape/go-logger"
+	"github.com/kubescape/go-logger/helpers"
+	"github.com/kubescape/kollector/config"
+	core "k8s.io/api/core/v1"
+	eventsv1 "k8s.io/api/events/v1"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+const (
+	// eventDeduplicationTTL is how long a reported event is remembered, it is the default TTL of the events
+	eventDeduplicationTTL = time.Hour
+	// noPodSpecID is the index value of the objects that are not part of a microservice, e.g. nodes
+	noPodSpecID = -1
+)
+
+// WarningEventData is a warning event regarding an object kollector tracks
+type WarningEventData struct {
+	Name      string             `json:"name"`
+	Namespace string             `json:"namespace,omitempty"`
+	Regarding EventRegardingData `json:"regarding"`
+	// PodSpecId links the event to its microservice, it is not set for nodes and namespaces
+	PodSpecId           *int   `json:"podSpecId,omitempty"`
+	Reason              string `json:"reason"`
+	Message             string `json:"message,omitempty"`
+	Count               int32  `json:"count"`
+	FirstSeen           string `json:"firstSeen,omitempty"`
+	LastSeen            string `json:"lastSeen,omitempty"`
+	ReportingController string `json:"reportingController,omitempty"`
+}
+
+// EventRegardingData is the object an event is about
+type EventRegardingData struct {
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name"`
+}
+
+// objectIndex maps the objects kollector tracks to the id of their microservice. The watchers maintain it, so the
+// events watcher does not read their state
+type objectIndex struct {
+	objects map[string]int
+	mutex   sync.RWMutex
+}
+
+func newObjectIndex() *objectIndex {
+	return &objectIndex{objects: make(map[string]int)}
+}
+
+func objectKey(kind, namespace, name string) string {
+	return kind + "/" + namespace + "/" + name
+}
+
+func (i *objectIndex) set(kind, namespace, name string, podSpecID int) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	i.objects[objectKey(kind, namespace, name)] = podSpecID
+}
+
+// remove drops the object if it is still indexed with the id, e.g. a deployment is indexed with its latest microservice
+func (i *objectIndex) remove(kind, namespace, name string, podSpecID int) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	key := objectKey(kind, namespace, name)
+	if id, ok := i.objects[key]; ok && id == podSpecID {
+		delete(i.objects, key)
+	}
+}
+
+func (i *objectIndex) get(kind, namespace, name string) (int, bool) {
+	i.mutex.RLock()
+	defer i.mutex.RUnlock()
+	id, ok := i.objects[objectKey(kind, namespace, name)]
+	return id, ok
+}
+
+func (i *objectIndex) reset() {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	i.objects = make(map[string]int)
+}
+
+// indexPod indexes the pod, its direct owners (e.g. the replicaset) and its workload with the microservice id
+func (wh *WatchHandler) indexPod(pod *core.Pod, podName string, od *OwnerDet, podSpecID int) {
+	wh.objects.set("Pod", pod.Namespace, podName, podSpecID)
+	wh.objects.set(od.Kind, pod.Namespace, od.Name, podSpecID)
+	for _, owner := range pod.OwnerReferences {
+		wh.objects.set(owner.Kind, pod.Namespace, owner.Name, podSpecID)
+	}
+}
+
+// unindexPod removes the pod, and its owners when its microservice is removed
+func (wh *WatchHandler) unindexPod(pod *core.Pod, podName string, od *OwnerDet, podSpecID int, microServiceRemoved bool) {
+	wh.objects.remove("Pod", pod.Namespace, podName, podSpecID)
+	if !microServiceRemoved {
+		return
+	}
+	wh.objects.remove(od.Kind, pod.Namespace, od.Name, podSpecID)
+	for _, owner := range pod.OwnerReferences {
+		wh.objects.remove(owner.Kind, pod.Namespace, owner.Name, podSpecID)
+	}
+}
+
+// eventDeduplicator remembers the reported events by object, reason and count
+type eventDeduplicator struct {
+	// seen is the event key -> when it was reported
+	seen      map[eventKey]time.Time
+	lastPrune time.Time
+	mutex     sync.Mutex
+}
+
+type eventKey struct {
+	regarding EventRegardingData
+	reason    string
+	count     int32
+}
+
+func newEventDeduplicator() *eventDeduplicator {
+	return &eventDeduplicator{seen: make(map[eventKey]time.Time)}
+}
+
+// isNew returns true the first time the event is seen with this count, the entries older than the TTL are dropped
+func (d *eventDeduplicator) isNew(regarding EventRegardingData, reason string, count int32, now time.Time) bool {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if now.Sub(d.lastPrune) > eventDeduplicationTTL/4 {
+		for key, seen := range d.seen {
+			if now.Sub(seen) > eventDeduplicationTTL {
+				delete(d.seen, key)
+			}
+		}
+		d.lastPrune = now
+	}
+	key := eventKey{regarding: regarding, reason: reason, count: count}
+	if _, ok := d.seen[key]; ok {
+		return false
+	}
+	d.seen[key] = now
+	return true
+}
+
+// EventWatch watches the warning events and reports those regarding the objects kollector tracks
+func (wh *WatchHandler) EventWatch(ctx context.Context) {
+	defer func() {
+		if err := recover(); err != nil {
+			logger.L().Ctx(ctx).Error("RECOVER EventWatch", helpers.Interface("error", err), helpers.String("stack", string(debug.Stack())))
+		}
+	}()
+	newStateChan, unsubscribe := wh.subscribeNewState()
+	defer unsubscribe()
+	for ctx.Err() == nil {
+		logger.L().Info("Watching over events starting")
+		eventsWatcher, err := wh.RestAPIClient.EventsV1().Events(wh.namespaceFilter.watchNamespace()).Watch(ctx, wh.listOptions(config.EventsResource))
+		if err != nil {
+			logger.L().Ctx(ctx).Warning("Failed watching over events", helpers.Error(err))
+			time.Sleep(1 * time.Second)
+			continue
+		}
+		eventsWatcher = wh.recorder.watch(config.EventsResource, eventsWatcher)
+		wh.handleEventWatch(ctx, eventsWatcher, newStateChan)
+	}
+}
+
+func (wh *WatchHandler) handleEventWatch(ctx context.Context, eventsWatcher watch.Interface, newStateChan <-chan bool) {
+	eventsChan := eventsWatcher.ResultChan()
+	for {
+		var event watch.Event
+		var chanActive bool
+		select {
+		case event, chanActive = <-eventsChan:
+			if !chanActive {
+				eventsWatcher.Stop()
+				return
+			}
+		case <-ctx.Done():
+			eventsWatcher.Stop()
+			return
+		case <-newStateChan:
+			eventsWatcher.Stop()
+			return
+		}
+		if event.Type == watch.Error {
+			logger.L().Ctx(ctx).Error("events watch chan loop", helpers.Interface("error", event.Object))
+			eventsWatcher.Stop()
+			return
+		}
+		if event.Type != watch.Added && event.Type != watch.Modified {
+			continue
+		}
+		k8sEvent, ok := event.Object.(*eventsv1.Event)
+		if !ok {
+			logger.L().Ctx(ctx).Error("Watch error: cannot convert to events.Event", helpers.Interface("error", event))
+			continue
+		}
+		if wh.addWarningEvent(k8sEvent, time.Now()) {
+			informNewDataArrive(wh)
+		}
+	}
+}
+
+// addWarningEvent adds the event to the report if it is a new warning regarding a tracked object, returns true if it was added
+func (wh *WatchHandler) addWarningEvent(k8sEvent *eventsv1.Event, now time.Time) bool {
+	if k8sEvent.Type != core.EventTypeWarning {
+		return false
+	}
+	regarding := EventRegardingData{Kind: k8sEvent.Regarding.Kind, Namespace: k8sEvent.Regarding.Namespace, Name: k8sEvent.Regarding.Name}
+	watchedNamespace := regarding.Namespace
+	if regarding.Kind == "Namespace" {
+		watchedNamespace = regarding.Name
+	}
+	if watchedNamespace != "" && !wh.isNamespaceWatched(watchedNamespace) {
+		return false
+	}
+	podSpecID, tracked := wh.objects.get(regarding.Kind, regarding.Namespace, regarding.Name)
+	if !tracked {
+		return false
+	}
+
+	data := WarningEventData{
+		Name:                k8sEvent.Name,
+		Namespace:           k8sEvent.Namespace,
+		Regarding:           regarding,
+		Reason:              k8sEvent.Reason,
+		Message:             k8sEvent.Note,
+		Count:               1,
+		ReportingController: k8sEvent.ReportingController,
+	}
+	if podSpecID != noPodSpecID {
+		data.PodSpecId = &podSpecID
+	}
+	switch {
+	case k8sEvent.Series != nil:
+		data.Count = k8sEvent.Series.Count
+	case k8sEvent.DeprecatedCount > 0:
+		data.Count = k8sEvent.DeprecatedCount
+	}
+	if !wh.events.isNew(regarding, data.Reason, data.Count, now) {
+		return false
+	}
+
+	if !k8sEvent.EventTime.IsZero() {
+		data.FirstSeen = k8sEvent.EventTime.UTC().Format(time.RFC3339)
+	} else if !k8sEvent.DeprecatedFirstTimestamp.IsZero() {
+		data.FirstSeen = k8sEvent.DeprecatedFirstTimestamp.UTC().Format(time.RFC3339)
+	}
+	switch {
+	case k8sEvent.Series != nil:
+		data.LastSeen = k8sEvent.Series.LastObservedTime.UTC().Format(time.RFC3339)
+	case !k8sEvent.DeprecatedLastTimestamp.IsZero():
+		data.LastSeen = k8sEvent.DeprecatedLastTimestamp.UTC().Format(time.RFC3339)
+	default:
+		data.LastSeen = data.FirstSeen
+	}
+	wh.jsonReport.AddToJsonFormat(data, EVENTS, CREATED)
+	return true
+}
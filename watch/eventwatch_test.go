@@ -0,0 +1,71 @@
+package watch
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/armosec/utils-k8s-go/armometadata"
+	"github.com/kubescape/backend/pkg/utils"
+	"github.com/kubescape/kollector/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	batchv1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestObjectIndexRemove(t *testing.T) {
+	index := newObjectIndex()
+	index.set("Deployment", "payments", "api", 1)
+	index.set("Deployment", "payments", "api", 2)
+	index.remove("Deployment", "payments", "api", 1)
+	id, ok := index.get("Deployment", "payments", "api")
+	assert.True(t, ok, "the deployment is indexed with its latest microservice")
+	assert.Equal(t, 2, id)
+
+	index.remove("Deployment", "payments", "api", 2)
+	_, ok = index.get("Deployment", "payments", "api")
+	assert.False(t, ok)
+}
+
+func TestEventDeduplicator(t *testing.T) {
+	deduplicator := newEventDeduplicator()
+	pod := EventRegardingData{Kind: "Pod", Namespace: "payments", Name: "api-1"}
+	now := time.Now()
+	assert.True(t, deduplicator.isNew(pod, "BackOff", 1, now))
+	assert.False(t, deduplicator.isNew(pod, "BackOff", 1, now))
+	assert.True(t, deduplicator.isNew(pod, "BackOff", 2, now), "the count increased")
+	assert.True(t, deduplicator.isNew(pod, "Unhealthy", 1, now))
+	assert.True(t, deduplicator.isNew(pod, "BackOff", 1, now.Add(eventDeduplicationTTL+time.Minute)), "the event is forgotten after the TTL")
+}
+
+func TestCronJobWarningEvent(t *testing.T) {
+	kollectorConfig := config.NewKollectorConfig(&armometadata.ClusterConfig{ClusterName: "test"}, utils.Credentials{}, "")
+	wh, err := newWatchHandlerWithClients(kollectorConfig, Clients{KubernetesClient: fake.NewSimpleClientset()})
+	require.NoError(t, err)
+	// the first report is aggregated, so the watcher does not wait for the listener
+	wh.aggregateFirstDataFlag = true
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	cronjobs := watch.NewFake()
+	go wh.handleCronJobWatch(ctx, cronjobs, make(chan bool), &time.Time{})
+
+	// the typed watch objects have an empty TypeMeta
+	cronjob := &batchv1.CronJob{ObjectMeta: metav1.ObjectMeta{Name: "backup", Namespace: "payments", UID: "backup-uid", CreationTimestamp: metav1.Now()}}
+	cronjobs.Add(cronjob.DeepCopy())
+	require.Eventually(t, func() bool {
+		_, tracked := wh.objects.get("CronJob", "payments", "backup")
+		return tracked
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.True(t, wh.addWarningEvent(newWarningEvent("backup.1", "CronJob", "backup", "FailedNeedsStart"), time.Now()))
+
+	cronjobs.Delete(cronjob.DeepCopy())
+	require.Eventually(t, func() bool {
+		_, tracked := wh.objects.get("CronJob", "payments", "backup")
+		return !tracked
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.False(t, wh.addWarningEvent(newWarningEvent("backup.2", "CronJob", "backup", "FailedNeedsStart"), time.Now()), "the deleted cronjob is not tracked")
+}
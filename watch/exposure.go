@@ -0,0 +1,386 @@
+package watch
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	ingressKind   = "Ingress"
+	httpRouteKind = "HTTPRoute"
+	serviceKind   = "Service"
+)
+
+// ExposureData is an entrypoint of the cluster, an ingress, an HTTP route or a service exposed outside the cluster,
+// and the graph of what it exposes: host/path -> service -> workloads
+type ExposureData struct {
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	// ServiceType is the type of an exposed service, e.g. LoadBalancer or NodePort
+	ServiceType string `json:"serviceType,omitempty"`
+	// Addresses are the external IPs and hostnames of the entrypoint, e.g. of its load balancer or gateways
+	Addresses []string `json:"addresses,omitempty"`
+	// Gateways are the parent gateways of an HTTP route, namespace/name
+	Gateways []string        `json:"gateways,omitempty"`
+	Routes   []ExposureRoute `json:"routes,omitempty"`
+}
+
+// ExposureRoute is a host and path routed to a service, and the workloads behind the service
+type ExposureRoute struct {
+	Host string `json:"host,omitempty"`
+	Path string `json:"path,omitempty"`
+	// Service is not set when the backend is not a service, e.g. an ingress resource backend
+	Service   *ExposedService   `json:"service,omitempty"`
+	Workloads []ExposedWorkload `json:"workloads,omitempty"`
+}
+
+// ExposedService is the backend service of a route
+type ExposedService struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	// Port is the backend port, a number or a name
+	Port      string  `json:"port,omitempty"`
+	NodePorts []int32 `json:"nodePorts,omitempty"`
+}
+
+// ExposedWorkload is a workload selected by an exposed service
+type ExposedWorkload struct {
+	Namespace string `json:"namespace"`
+	Kind      string `json:"kind"`
+	Name      string `json:"name"`
+}
+
+// exposureBackend is a route of an entrypoint before its service is resolved
+type exposureBackend struct {
+	host string
+	path string
+	// service is the namespace/name of the backend service, it is empty when the backend is not a service
+	service string
+	port    string
+}
+
+// exposureSource is an entrypoint as it was watched
+type exposureSource struct {
+	kind        string
+	namespace   string
+	name        string
+	serviceType string
+	addresses   []string
+	gateways    []string
+	backends    []exposureBackend
+}
+
+type exposureService struct {
+	selector  map[string]string
+	nodePorts []int32
+}
+
+type exposurePod struct {
+	labels   map[string]string
+	workload ExposedWorkload
+}
+
+type exposureGateway struct {
+	addresses []string
+	hostnames []string
+}
+
+// exposureChange is an entrypoint to report
+type exposureChange struct {
+	data  ExposureData
+	stype StateType
+}
+
+// exposureGraph resolves the entrypoints to the services and workloads they expose. It is fed by the services, pods,
+// ingresses and Gateway API watches, and returns the entrypoints whose graph changed
+type exposureGraph struct {
+	// sources is the entrypoint key -> entrypoint
+	sources map[string]*exposureSource
+	// services and gateways are keyed by namespace/name
+	services map[string]*exposureService
+	gateways map[string]*exposureGateway
+	// pods is the namespace -> pod uid -> pod
+	pods map[string]map[types.UID]exposurePod
+	// reported is the entrypoint key -> its last reported graph
+	reported map[string]ExposureData
+	mutex    sync.Mutex
+}
+
+func newExposureGraph() *exposureGraph {
+	return &exposureGraph{
+		sources:  make(map[string]*exposureSource),
+		services: make(map[string]*exposureService),
+		gateways: make(map[string]*exposureGateway),
+		pods:     make(map[string]map[types.UID]exposurePod),
+		reported: make(map[string]ExposureData),
+	}
+}
+
+func namespacedName(namespace, name string) string {
+	return namespace + "/" + name
+}
+
+func (g *exposureGraph) reset() {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	g.sources = make(map[string]*exposureSource)
+	g.services = make(map[string]*exposureService)
+	g.gateways = make(map[string]*exposureGateway)
+	g.pods = make(map[string]map[types.UID]exposurePod)
+	g.reported = make(map[string]ExposureData)
+}
+
+// observePod updates the labels and the workload of the pod, the entrypoints of its namespace are resolved again when they changed
+func (g *exposureGraph) observePod(pod *core.Pod, od *OwnerDet) []exposureChange {
+	current := exposurePod{labels: pod.Labels, workload: ExposedWorkload{Namespace: pod.Namespace, Kind: od.Kind, Name: od.Name}}
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	if previous, ok := g.pods[pod.Namespace][pod.UID]; ok && reflect.DeepEqual(previous, current) {
+		return nil
+	}
+	if g.pods[pod.Namespace] == nil {
+		g.pods[pod.Namespace] = make(map[types.UID]exposurePod)
+	}
+	g.pods[pod.Namespace][pod.UID] = current
+	return g.refresh(func(source *exposureSource) bool { return source.referencesNamespace(pod.Namespace) })
+}
+
+func (g *exposureGraph) removePod(pod *core.Pod) []exposureChange {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	if _, ok := g.pods[pod.Namespace][pod.UID]; !ok {
+		return nil
+	}
+	delete(g.pods[pod.Namespace], pod.UID)
+	return g.refresh(func(source *exposureSource) bool { return source.referencesNamespace(pod.Namespace) })
+}
+
+// observeService updates the service, it is an entrypoint itself when it is exposed outside the cluster
+func (g *exposureGraph) observeService(service *core.Service) []exposureChange {
+	key := namespacedName(service.Namespace, service.Name)
+	current := &exposureService{selector: service.Spec.Selector}
+	for _, port := range service.Spec.Ports {
+		if port.NodePort != 0 {
+			current.nodePorts = append(current.nodePorts, port.NodePort)
+		}
+	}
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	g.services[key] = current
+	changes := []exposureChange{}
+	if isServiceExposed(service) {
+		g.sources[objectKey(serviceKind, service.Namespace, service.Name)] = serviceSource(service)
+	} else {
+		changes = g.removeSourceLocked(serviceKind, service.Namespace, service.Name)
+	}
+	return append(changes, g.refresh(func(source *exposureSource) bool { return source.referencesService(key) })...)
+}
+
+func (g *exposureGraph) removeService(service *core.Service) []exposureChange {
+	key := namespacedName(service.Namespace, service.Name)
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	delete(g.services, key)
+	changes := g.removeSourceLocked(serviceKind, service.Namespace, service.Name)
+	return append(changes, g.refresh(func(source *exposureSource) bool { return source.referencesService(key) })...)
+}
+
+// observeGateway updates the addresses and the hostnames of a gateway, its routes are resolved again
+func (g *exposureGraph) observeGateway(key string, gateway *exposureGateway) []exposureChange {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	g.gateways[key] = gateway
+	return g.refresh(func(source *exposureSource) bool { return source.hasGateway(key) })
+}
+
+func (g *exposureGraph) removeGateway(key string) []exposureChange {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	delete(g.gateways, key)
+	return g.refresh(func(source *exposureSource) bool { return source.hasGateway(key) })
+}
+
+// observeSource updates an ingress or an HTTP route
+func (g *exposureGraph) observeSource(source *exposureSource) []exposureChange {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	g.sources[objectKey(source.kind, source.namespace, source.name)] = source
+	return g.refresh(func(s *exposureSource) bool { return s == source })
+}
+
+func (g *exposureGraph) removeSource(kind, namespace, name string) []exposureChange {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	return g.removeSourceLocked(kind, namespace, name)
+}
+
+func (g *exposureGraph) removeSourceLocked(kind, namespace, name string) []exposureChange {
+	key := objectKey(kind, namespace, name)
+	delete(g.sources, key)
+	reported, ok := g.reported[key]
+	if !ok {
+		return nil
+	}
+	delete(g.reported, key)
+	return []exposureChange{{data: reported, stype: DELETED}}
+}
+
+// refresh resolves the affected entrypoints and returns those that are new or whose graph changed
+func (g *exposureGraph) refresh(affected func(source *exposureSource) bool) []exposureChange {
+	keys := []string{}
+	for key, source := range g.sources {
+		if affected(source) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	changes := []exposureChange{}
+	for _, key := range keys {
+		current := g.resolve(g.sources[key])
+		previous, reported := g.reported[key]
+		switch {
+		case !reported:
+			changes = append(changes, exposureChange{data: current, stype: CREATED})
+		case !reflect.DeepEqual(previous, current):
+			changes = append(changes, exposureChange{data: current, stype: UPDATED})
+		default:
+			continue
+		}
+		g.reported[key] = current
+	}
+	return changes
+}
+
+// resolve returns the graph of an entrypoint. The routes of an HTTP route without hostnames take the hostnames of its gateways
+func (g *exposureGraph) resolve(source *exposureSource) ExposureData {
+	data := ExposureData{Kind: source.kind, Namespace: source.namespace, Name: source.name, ServiceType: source.serviceType, Gateways: source.gateways}
+	addresses := append([]string{}, source.addresses...)
+	hostnames := []string{}
+	for _, key := range source.gateways {
+		if gateway, ok := g.gateways[key]; ok {
+			addresses = append(addresses, gateway.addresses...)
+			hostnames = append(hostnames, gateway.hostnames...)
+		}
+	}
+	data.Addresses = uniqueSorted(addresses)
+	hostnames = uniqueSorted(hostnames)
+	for _, backend := range source.backends {
+		route := ExposureRoute{Path: backend.path}
+		if backend.service != "" {
+			parts := strings.SplitN(backend.service, "/", 2)
+			route.Service = &ExposedService{Namespace: parts[0], Name: parts[1], Port: backend.port}
+			if service, ok := g.services[backend.service]; ok {
+				route.Service.NodePorts = service.nodePorts
+				route.Workloads = g.workloads(parts[0], service.selector)
+			}
+		}
+		hosts := []string{backend.host}
+		if backend.host == "" && len(hostnames) > 0 {
+			hosts = hostnames
+		}
+		for _, host := range hosts {
+			route.Host = host
+			data.Routes = append(data.Routes, route)
+		}
+	}
+	return data
+}
+
+// workloads returns the workloads of the pods the selector matches, a service without a selector has none
+func (g *exposureGraph) workloads(namespace string, selector map[string]string) []ExposedWorkload {
+	if len(selector) == 0 {
+		return nil
+	}
+	matcher := labels.SelectorFromSet(selector)
+	found := map[ExposedWorkload]bool{}
+	for _, pod := range g.pods[namespace] {
+		if matcher.Matches(labels.Set(pod.labels)) {
+			found[pod.workload] = true
+		}
+	}
+	workloads := make([]ExposedWorkload, 0, len(found))
+	for workload := range found {
+		workloads = append(workloads, workload)
+	}
+	sort.Slice(workloads, func(i, j int) bool {
+		return workloads[i].Kind+"/"+workloads[i].Name < workloads[j].Kind+"/"+workloads[j].Name
+	})
+	return workloads
+}
+
+func (source *exposureSource) referencesNamespace(namespace string) bool {
+	for i := range source.backends {
+		if strings.HasPrefix(source.backends[i].service, namespace+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func (source *exposureSource) referencesService(key string) bool {
+	for i := range source.backends {
+		if source.backends[i].service == key {
+			return true
+		}
+	}
+	return false
+}
+
+func (source *exposureSource) hasGateway(key string) bool {
+	for i := range source.gateways {
+		if source.gateways[i] == key {
+			return true
+		}
+	}
+	return false
+}
+
+// isServiceExposed returns true if the service is reachable from outside the cluster
+func isServiceExposed(service *core.Service) bool {
+	return service.Spec.Type == core.ServiceTypeLoadBalancer || service.Spec.Type == core.ServiceTypeNodePort || len(service.Spec.ExternalIPs) > 0
+}
+
+// serviceSource returns the entrypoint of an exposed service, it routes to the service itself
+func serviceSource(service *core.Service) *exposureSource {
+	source := &exposureSource{kind: serviceKind, namespace: service.Namespace, name: service.Name, serviceType: string(service.Spec.Type),
+		backends: []exposureBackend{{service: namespacedName(service.Namespace, service.Name)}}}
+	for _, lb := range service.Status.LoadBalancer.Ingress {
+		source.addresses = append(source.addresses, lb.IP, lb.Hostname)
+	}
+	source.addresses = append(source.addresses, service.Spec.ExternalIPs...)
+	return source
+}
+
+// uniqueSorted returns the non empty values sorted, without duplicates
+func uniqueSorted(values []string) []string {
+	set := map[string]bool{}
+	for i := range values {
+		if values[i] != "" {
+			set[values[i]] = true
+		}
+	}
+	if len(set) == 0 {
+		return nil
+	}
+	result := make([]string, 0, len(set))
+	for value := range set {
+		result = append(result, value)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// reportExposureChanges adds the changed entrypoints to the report, returns true if any was added
+func (wh *WatchHandler) reportExposureChanges(changes []exposureChange) bool {
+	for i := range changes {
+		wh.jsonReport.AddToJsonFormat(changes[i].data, EXPOSURES, changes[i].stype)
+	}
+	return len(changes) > 0
+}
@@ -0,0 +1,147 @@
+package watch
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/armosec/utils-k8s-go/armometadata"
+	"github.com/kubescape/backend/pkg/utils"
+	"github.com/kubescape/kollector/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	core "k8s.io/api/core/v1"
+	networking "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func exposurePodFixture(uid, app string) *core.Pod {
+	return &core.Pod{ObjectMeta: metav1.ObjectMeta{UID: types.UID(uid), Name: uid, Namespace: "payments", Labels: map[string]string{"app": app}}}
+}
+
+func TestExposureGraph(t *testing.T) {
+	graph := newExposureGraph()
+	api := ExposedWorkload{Namespace: "payments", Kind: "Deployment", Name: "api"}
+	assert.Empty(t, graph.observePod(exposurePodFixture("api-1", "api"), &OwnerDet{Kind: "Deployment", Name: "api"}))
+
+	service := &core.Service{ObjectMeta: metav1.ObjectMeta{Name: "api", Namespace: "payments"},
+		Spec: core.ServiceSpec{Type: core.ServiceTypeClusterIP, Selector: map[string]string{"app": "api"}, Ports: []core.ServicePort{{Port: 80}}}}
+	assert.Empty(t, graph.observeService(service), "a cluster IP service is not an entrypoint")
+
+	pathType := networking.PathTypePrefix
+	ingress := &networking.Ingress{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "payments"},
+		Spec: networking.IngressSpec{Rules: []networking.IngressRule{{Host: "pay.example.com", IngressRuleValue: networking.IngressRuleValue{HTTP: &networking.HTTPIngressRuleValue{
+			Paths: []networking.HTTPIngressPath{{Path: "/api", PathType: &pathType, Backend: networking.IngressBackend{
+				Service: &networking.IngressServiceBackend{Name: "api", Port: networking.ServiceBackendPort{Name: "http"}}}}},
+		}}}}},
+		Status: networking.IngressStatus{LoadBalancer: networking.IngressLoadBalancerStatus{Ingress: []networking.IngressLoadBalancerIngress{{IP: "203.0.113.7"}}}},
+	}
+	changes := graph.observeSource(ingressSource(ingress))
+	require.Len(t, changes, 1)
+	assert.Equal(t, CREATED, changes[0].stype)
+	assert.Equal(t, ExposureData{Kind: "Ingress", Namespace: "payments", Name: "web", Addresses: []string{"203.0.113.7"}, Routes: []ExposureRoute{{
+		Host: "pay.example.com", Path: "/api", Service: &ExposedService{Namespace: "payments", Name: "api", Port: "http"}, Workloads: []ExposedWorkload{api},
+	}}}, changes[0].data)
+	assert.Empty(t, graph.observeSource(ingressSource(ingress)), "the graph did not change")
+
+	// the service is exposed on the nodes, it is an entrypoint as well
+	service.Spec.Type = core.ServiceTypeNodePort
+	service.Spec.Ports[0].NodePort = 30080
+	changes = graph.observeService(service)
+	require.Len(t, changes, 2)
+	assert.Equal(t, "Ingress", changes[0].data.Kind)
+	assert.Equal(t, []int32{30080}, changes[0].data.Routes[0].Service.NodePorts)
+	assert.Equal(t, CREATED, changes[1].stype)
+	assert.Equal(t, "NodePort", changes[1].data.ServiceType)
+
+	// a pod of another workload joins the service, a pod of an unrelated app changes nothing
+	assert.Empty(t, graph.observePod(exposurePodFixture("db-1", "db"), &OwnerDet{Kind: "StatefulSet", Name: "db"}))
+	changes = graph.observePod(exposurePodFixture("canary-1", "api"), &OwnerDet{Kind: "Deployment", Name: "api-canary"})
+	require.Len(t, changes, 2)
+	assert.Equal(t, []ExposedWorkload{api, {Namespace: "payments", Kind: "Deployment", Name: "api-canary"}}, changes[1].data.Routes[0].Workloads)
+
+	service.Spec.Type = core.ServiceTypeClusterIP
+	changes = graph.observeService(service)
+	require.Len(t, changes, 1)
+	assert.Equal(t, DELETED, changes[0].stype)
+	assert.Equal(t, "Service", changes[0].data.Kind)
+
+	changes = graph.removeService(service)
+	require.Len(t, changes, 1)
+	assert.Nil(t, changes[0].data.Routes[0].Workloads, "the service is gone")
+	changes = graph.removeSource(ingressKind, "payments", "web")
+	require.Len(t, changes, 1)
+	assert.Equal(t, DELETED, changes[0].stype)
+}
+
+func TestExposureGatewayAPI(t *testing.T) {
+	wh := &WatchHandler{exposure: newExposureGraph()}
+	wh.exposure.observePod(exposurePodFixture("api-1", "api"), &OwnerDet{Kind: "Deployment", Name: "api"})
+	wh.exposure.observeService(&core.Service{ObjectMeta: metav1.ObjectMeta{Name: "api", Namespace: "payments"},
+		Spec: core.ServiceSpec{Selector: map[string]string{"app": "api"}}})
+
+	route := &unstructured.Unstructured{Object: map[string]interface{}{
+		"metadata": map[string]interface{}{"name": "api", "namespace": "payments"},
+		"spec": map[string]interface{}{
+			"parentRefs": []interface{}{map[string]interface{}{"name": "public", "namespace": "infra"}},
+			"rules": []interface{}{map[string]interface{}{
+				"matches":     []interface{}{map[string]interface{}{"path": map[string]interface{}{"type": "PathPrefix", "value": "/v1"}}},
+				"backendRefs": []interface{}{map[string]interface{}{"name": "api", "port": int64(8080)}},
+			}},
+		},
+	}}
+	changes, err := wh.handleGatewayAPIEvent(config.HTTPRoutesResource, watch.Added, route)
+	require.NoError(t, err)
+	require.Len(t, changes, 1)
+	assert.Equal(t, []string{"infra/public"}, changes[0].data.Gateways)
+	assert.Equal(t, []ExposureRoute{{Path: "/v1", Service: &ExposedService{Namespace: "payments", Name: "api", Port: "8080"},
+		Workloads: []ExposedWorkload{{Namespace: "payments", Kind: "Deployment", Name: "api"}}}}, changes[0].data.Routes)
+
+	gateway := &unstructured.Unstructured{Object: map[string]interface{}{
+		"metadata": map[string]interface{}{"name": "public", "namespace": "infra"},
+		"spec":     map[string]interface{}{"listeners": []interface{}{map[string]interface{}{"hostname": "api.example.com"}, map[string]interface{}{"name": "any"}}},
+		"status":   map[string]interface{}{"addresses": []interface{}{map[string]interface{}{"type": "IPAddress", "value": "198.51.100.4"}}},
+	}}
+	changes, err = wh.handleGatewayAPIEvent(config.GatewaysResource, watch.Added, gateway)
+	require.NoError(t, err)
+	require.Len(t, changes, 1, "the routes of the gateway are resolved again")
+	assert.Equal(t, UPDATED, changes[0].stype)
+	assert.Equal(t, []string{"198.51.100.4"}, changes[0].data.Addresses)
+	assert.Equal(t, "api.example.com", changes[0].data.Routes[0].Host, "the route takes the hostnames of its gateway")
+
+	changes, err = wh.handleGatewayAPIEvent(config.HTTPRoutesResource, watch.Deleted, route)
+	require.NoError(t, err)
+	require.Len(t, changes, 1)
+	assert.Equal(t, DELETED, changes[0].stype)
+}
+
+func TestGatewayWatchRestartsWithoutGatewayAPI(t *testing.T) {
+	wh, err := newWatchHandlerWithClients(config.NewKollectorConfig(&armometadata.ClusterConfig{ClusterName: "test"}, utils.Credentials{}, ""),
+		Clients{KubernetesClient: fake.NewSimpleClientset()})
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go wh.GatewayWatch(ctx)
+	require.Eventually(t, func() bool {
+		wh.newStateReportChansMutex.Lock()
+		defer wh.newStateReportChansMutex.Unlock()
+		return len(wh.newStateReportChans) == 1
+	}, time.Second, 10*time.Millisecond)
+
+	restarted := make(chan struct{})
+	go func() {
+		defer close(restarted)
+		wh.restartWatchers(true)
+		wh.restartWatchers(true)
+		wh.restartWatchers(true)
+	}()
+	select {
+	case <-restarted:
+	case <-time.After(3 * time.Second):
+		assert.Fail(t, "the restarts are not drained while the Gateway API is not installed")
+	}
+}
@@ -0,0 +1,263 @@
+package watch
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"strconv"
+	"time"
+
+	logger "github.com/kubescape/go-logger"
+	"github.com/kubescape/go-logger/helpers"
+	"github.com/kubescape/kollector/config"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+// gatewayAPIDiscoveryInterval is how often kollector checks whether the Gateway API was installed
+const gatewayAPIDiscoveryInterval = 5 * time.Minute
+
+// gatewayAPIGroupVersion is the Gateway API version kollector reads, its resources are read through the dynamic client
+var gatewayAPIGroupVersion = schema.GroupVersion{Group: "gateway.networking.k8s.io", Version: "v1"}
+
+// gatewayObject holds the fields of a Gateway API gateway kollector reads
+type gatewayObject struct {
+	Spec struct {
+		Listeners []struct {
+			Hostname string `json:"hostname,omitempty"`
+		} `json:"listeners,omitempty"`
+	} `json:"spec"`
+	Status struct {
+		Addresses []struct {
+			Value string `json:"value"`
+		} `json:"addresses,omitempty"`
+	} `json:"status,omitempty"`
+}
+
+// httpRouteObject holds the fields of a Gateway API HTTP route kollector reads
+type httpRouteObject struct {
+	Spec struct {
+		ParentRefs []gatewayAPIReference `json:"parentRefs,omitempty"`
+		Hostnames  []string              `json:"hostnames,omitempty"`
+		Rules      []struct {
+			Matches []struct {
+				Path *struct {
+					Value string `json:"value,omitempty"`
+				} `json:"path,omitempty"`
+			} `json:"matches,omitempty"`
+			BackendRefs []gatewayAPIReference `json:"backendRefs,omitempty"`
+		} `json:"rules,omitempty"`
+	} `json:"spec"`
+}
+
+// gatewayAPIReference is a parent or a backend reference of a route, the empty group and kind are the defaults
+type gatewayAPIReference struct {
+	Group     string `json:"group,omitempty"`
+	Kind      string `json:"kind,omitempty"`
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name"`
+	Port      *int32 `json:"port,omitempty"`
+}
+
+// GatewayWatch watches the Gateway API gateways, once the Gateway API is installed
+func (wh *WatchHandler) GatewayWatch(ctx context.Context) {
+	wh.gatewayAPIWatch(ctx, config.GatewaysResource)
+}
+
+// HTTPRouteWatch watches the Gateway API HTTP routes and reports the hosts and paths they expose, once the Gateway API is installed
+func (wh *WatchHandler) HTTPRouteWatch(ctx context.Context) {
+	wh.gatewayAPIWatch(ctx, config.HTTPRoutesResource)
+}
+
+func (wh *WatchHandler) gatewayAPIWatch(ctx context.Context, resource string) {
+	defer func() {
+		if err := recover(); err != nil {
+			logger.L().Ctx(ctx).Error("RECOVER gatewayAPIWatch", helpers.String("resource", resource), helpers.Interface("error", err), helpers.String("stack", string(debug.Stack())))
+		}
+	}()
+	newStateChan, unsubscribe := wh.subscribeNewState()
+	defer unsubscribe()
+	for ctx.Err() == nil {
+		if !wh.isGatewayAPIInstalled(resource) {
+			logger.L().Debug("Gateway API is not installed", helpers.String("resource", resource))
+			// the restarts are drained while waiting, restartWatchers waits for every subscriber
+			select {
+			case <-ctx.Done():
+				return
+			case <-newStateChan:
+			case <-time.After(gatewayAPIDiscoveryInterval):
+			}
+			continue
+		}
+		logger.L().Info("Watching over " + resource + " starting")
+		gatewayAPIWatcher, err := wh.dynamicClient.Resource(gatewayAPIGroupVersion.WithResource(resource)).Namespace(wh.namespaceFilter.watchNamespace()).
+			Watch(ctx, wh.listOptions(resource))
+		if err != nil {
+			logger.L().Ctx(ctx).Warning("Failed watching over "+resource, helpers.Error(err))
+			time.Sleep(1 * time.Second)
+			continue
+		}
+		gatewayAPIWatcher = wh.recorder.watch(resource, gatewayAPIWatcher)
+		wh.handleGatewayAPIWatch(ctx, resource, gatewayAPIWatcher, newStateChan)
+	}
+}
+
+// isGatewayAPIInstalled returns true if the API server serves the resource of the Gateway API
+func (wh *WatchHandler) isGatewayAPIInstalled(resource string) bool {
+	resources, err := wh.RestAPIClient.Discovery().ServerResourcesForGroupVersion(gatewayAPIGroupVersion.String())
+	if err != nil {
+		return false
+	}
+	for i := range resources.APIResources {
+		if resources.APIResources[i].Name == resource {
+			return true
+		}
+	}
+	return false
+}
+
+func (wh *WatchHandler) handleGatewayAPIWatch(ctx context.Context, resource string, gatewayAPIWatcher watch.Interface, newStateChan <-chan bool) {
+	gatewayAPIChan := gatewayAPIWatcher.ResultChan()
+	for {
+		var event watch.Event
+		var chanActive bool
+		select {
+		case event, chanActive = <-gatewayAPIChan:
+			if !chanActive {
+				gatewayAPIWatcher.Stop()
+				return
+			}
+		case <-ctx.Done():
+			gatewayAPIWatcher.Stop()
+			return
+		case <-newStateChan:
+			gatewayAPIWatcher.Stop()
+			return
+		}
+		if event.Type == watch.Error {
+			logger.L().Ctx(ctx).Error(resource+" watch chan loop", helpers.Interface("error", event.Object))
+			gatewayAPIWatcher.Stop()
+			return
+		}
+		if event.Type != watch.Added && event.Type != watch.Modified && event.Type != watch.Deleted {
+			continue
+		}
+		object, ok := event.Object.(*unstructured.Unstructured)
+		if !ok {
+			logger.L().Ctx(ctx).Error("Watch error: cannot convert to unstructured.Unstructured", helpers.Interface("error", event))
+			continue
+		}
+		if !wh.isNamespaceWatched(object.GetNamespace()) {
+			continue
+		}
+		changes, err := wh.handleGatewayAPIEvent(resource, event.Type, object)
+		if err != nil {
+			logger.L().Ctx(ctx).Warning("failed to read "+resource, helpers.String("namespace", object.GetNamespace()), helpers.String("name", object.GetName()), helpers.Error(err))
+			continue
+		}
+		if wh.reportExposureChanges(changes) {
+			informNewDataArrive(wh)
+		}
+	}
+}
+
+func (wh *WatchHandler) handleGatewayAPIEvent(resource string, eventType watch.EventType, object *unstructured.Unstructured) ([]exposureChange, error) {
+	switch resource {
+	case config.GatewaysResource:
+		key := namespacedName(object.GetNamespace(), object.GetName())
+		if eventType == watch.Deleted {
+			return wh.exposure.removeGateway(key), nil
+		}
+		gateway, err := parseGateway(object)
+		if err != nil {
+			return nil, err
+		}
+		return wh.exposure.observeGateway(key, gateway), nil
+	case config.HTTPRoutesResource:
+		if eventType == watch.Deleted {
+			return wh.exposure.removeSource(httpRouteKind, object.GetNamespace(), object.GetName()), nil
+		}
+		source, err := httpRouteSource(object)
+		if err != nil {
+			return nil, err
+		}
+		return wh.exposure.observeSource(source), nil
+	}
+	return nil, fmt.Errorf("unknown Gateway API resource %q", resource)
+}
+
+func parseGateway(object *unstructured.Unstructured) (*exposureGateway, error) {
+	var parsed gatewayObject
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(object.Object, &parsed); err != nil {
+		return nil, fmt.Errorf("invalid gateway: %s", err.Error())
+	}
+	gateway := &exposureGateway{}
+	for _, listener := range parsed.Spec.Listeners {
+		gateway.hostnames = append(gateway.hostnames, listener.Hostname)
+	}
+	for _, address := range parsed.Status.Addresses {
+		gateway.addresses = append(gateway.addresses, address.Value)
+	}
+	return gateway, nil
+}
+
+// httpRouteSource returns the entrypoint of an HTTP route, a route per hostname, path match and service backend.
+// The routes without hostnames take the hostnames of the gateways when the graph is resolved
+func httpRouteSource(object *unstructured.Unstructured) (*exposureSource, error) {
+	var parsed httpRouteObject
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(object.Object, &parsed); err != nil {
+		return nil, fmt.Errorf("invalid HTTP route: %s", err.Error())
+	}
+	namespace := object.GetNamespace()
+	source := &exposureSource{kind: httpRouteKind, namespace: namespace, name: object.GetName()}
+	gateways := []string{}
+	for _, parent := range parsed.Spec.ParentRefs {
+		if (parent.Group == "" || parent.Group == gatewayAPIGroupVersion.Group) && (parent.Kind == "" || parent.Kind == "Gateway") {
+			gateways = append(gateways, namespacedName(defaultString(parent.Namespace, namespace), parent.Name))
+		}
+	}
+	source.gateways = uniqueSorted(gateways)
+
+	hostnames := parsed.Spec.Hostnames
+	if len(hostnames) == 0 {
+		hostnames = []string{""}
+	}
+	for _, rule := range parsed.Spec.Rules {
+		// a rule without matches matches every path
+		paths := []string{}
+		for _, match := range rule.Matches {
+			if match.Path != nil && match.Path.Value != "" {
+				paths = append(paths, match.Path.Value)
+			} else {
+				paths = append(paths, "/")
+			}
+		}
+		if len(paths) == 0 {
+			paths = []string{"/"}
+		}
+		for _, hostname := range hostnames {
+			for _, path := range paths {
+				for _, backendRef := range rule.BackendRefs {
+					backend := exposureBackend{host: hostname, path: path}
+					if backendRef.Group == "" && (backendRef.Kind == "" || backendRef.Kind == serviceKind) {
+						backend.service = namespacedName(defaultString(backendRef.Namespace, namespace), backendRef.Name)
+						if backendRef.Port != nil {
+							backend.port = strconv.Itoa(int(*backendRef.Port))
+						}
+					}
+					source.backends = append(source.backends, backend)
+				}
+			}
+		}
+	}
+	return source, nil
+}
+
+func defaultString(value, defaultValue string) string {
+	if value == "" {
+		return defaultValue
+	}
+	return value
+}
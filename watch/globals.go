@@ -1,10 +0,0 @@
-package watch
-
-import (
-	"context"
-)
-
-var (
-	globalHTTPContext = context.Background()
-	cloudProvider     = ""
-)
@@ -11,16 +11,18 @@ type IDDataBase struct {
 	counter int
 }
 
-var ids IDDataBase = IDDataBase{Ids: list.New(), counter: 0}
+func newIDDataBase() *IDDataBase {
+	return &IDDataBase{Ids: list.New(), counter: 0}
+}
 
-//static function
-func IDCreator() int {
+// IDCreator returns the next id, the caller holds the mutex
+func (ids *IDDataBase) IDCreator() int {
 	id := ids.counter
 	ids.counter++
 	return id
 }
 
-func CreateID() int {
+func (ids *IDDataBase) CreateID() int {
 
 	var id int
 	var flag int = 1
@@ -30,7 +32,7 @@ func CreateID() int {
 
 	for flag == 1 {
 		flag = 0
-		id = IDCreator()
+		id = ids.IDCreator()
 		for e := ids.Ids.Front(); e != nil; e = e.Next() {
 			if e.Value.(int) == id {
 				flag = 1
@@ -43,7 +45,7 @@ func CreateID() int {
 	return id
 }
 
-func DeleteID(id int) {
+func (ids *IDDataBase) DeleteID(id int) {
 	ids.Mutex.Lock()
 	defer ids.Mutex.Unlock()
 
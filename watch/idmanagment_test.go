@@ -7,12 +7,13 @@ import (
 )
 
 func TestCreateID(t *testing.T) {
-	s0 := CreateID()
-	s1 := CreateID()
+	ids := newIDDataBase()
+	s0 := ids.CreateID()
+	s1 := ids.CreateID()
 
 	assert.NotEqual(t, s1, s0, "ids equal")
 
-	s2 := CreateID()
+	s2 := ids.CreateID()
 
 	assert.NotEqual(t, s1, s2, "ids equal")
 	assert.NotEqual(t, s2, s0, "ids equal")
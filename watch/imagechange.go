@@ -0,0 +1,92 @@
+package watch
+
+import (
+	"sort"
+
+	core "k8s.io/api/core/v1"
+)
+
+// ContainerType is the kind of container of a pod spec
+type ContainerType string
+
+const (
+	ContainerTypeContainer ContainerType = "container"
+	ContainerTypeInit      ContainerType = "initContainer"
+	// ContainerTypeSidecar is an init container that keeps running, i.e. with restartPolicy Always
+	ContainerTypeSidecar   ContainerType = "sidecarContainer"
+	ContainerTypeEphemeral ContainerType = "ephemeralContainer"
+)
+
+// ContainerImageChange is a container that runs an image it did not run before
+type ContainerImageChange struct {
+	ContainerName string        `json:"containerName"`
+	ContainerType ContainerType `json:"containerType"`
+	Image         string        `json:"image"`
+	ImageID       string        `json:"imageID"`
+	// PreviousImageID is empty for a container that did not run before, e.g. a new sidecar
+	PreviousImageID string `json:"previousImageID,omitempty"`
+}
+
+type containerKey struct {
+	containerType ContainerType
+	name          string
+}
+
+// getContainerImages returns the statuses of the containers of the pod that pulled their image, by type and name
+func getContainerImages(pod *core.Pod) map[containerKey]core.ContainerStatus {
+	sidecars := map[string]bool{}
+	for i := range pod.Spec.InitContainers {
+		restartPolicy := pod.Spec.InitContainers[i].RestartPolicy
+		sidecars[pod.Spec.InitContainers[i].Name] = restartPolicy != nil && *restartPolicy == core.ContainerRestartPolicyAlways
+	}
+	images := map[containerKey]core.ContainerStatus{}
+	add := func(containerType ContainerType, statuses []core.ContainerStatus) {
+		for i := range statuses {
+			if statuses[i].ImageID == "" {
+				continue
+			}
+			key := containerKey{containerType: containerType, name: statuses[i].Name}
+			if containerType == ContainerTypeInit && sidecars[statuses[i].Name] {
+				key.containerType = ContainerTypeSidecar
+			}
+			images[key] = statuses[i]
+		}
+	}
+	add(ContainerTypeContainer, pod.Status.ContainerStatuses)
+	add(ContainerTypeInit, pod.Status.InitContainerStatuses)
+	add(ContainerTypeEphemeral, pod.Status.EphemeralContainerStatuses)
+	return images
+}
+
+// imageIdentity is the digest of the image id, or the image id when the runtime does not report a digest
+func imageIdentity(imageID string) string {
+	if digest := imageIDDigest(imageID); digest != "" {
+		return digest
+	}
+	return imageID
+}
+
+// getContainerImageChanges compares the images of the containers by type and name, so reordered containers are not a
+// change. A container that did not pull its image yet is not compared
+func getContainerImageChanges(pod, previous *core.Pod) []ContainerImageChange {
+	previousImages := getContainerImages(previous)
+	var changes []ContainerImageChange
+	for key, status := range getContainerImages(pod) {
+		previousStatus, existed := previousImages[key]
+		if existed && imageIdentity(previousStatus.ImageID) == imageIdentity(status.ImageID) {
+			continue
+		}
+		change := ContainerImageChange{ContainerName: key.name, ContainerType: key.containerType, Image: status.Image, ImageID: status.ImageID}
+		if existed {
+			change.PreviousImageID = previousStatus.ImageID
+		}
+		changes = append(changes, change)
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		if changes[i].ContainerType != changes[j].ContainerType {
+			return changes[i].ContainerType < changes[j].ContainerType
+		}
+		return changes[i].ContainerName < changes[j].ContainerName
+	})
+	return changes
+}
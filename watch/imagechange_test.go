@@ -0,0 +1,58 @@
+package watch
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestGetContainerImageChanges(t *testing.T) {
+	always := core.ContainerRestartPolicyAlways
+	status := func(name, imageID string) core.ContainerStatus {
+		return core.ContainerStatus{Name: name, Image: name + ":1", ImageID: imageID}
+	}
+	previous := &core.Pod{
+		Spec: core.PodSpec{InitContainers: []core.Container{{Name: "migrate"}, {Name: "proxy", RestartPolicy: &always}}},
+		Status: core.PodStatus{
+			ContainerStatuses:     []core.ContainerStatus{status("api", "docker-pullable://api@sha256:a"), status("worker", "sha256:w")},
+			InitContainerStatuses: []core.ContainerStatus{status("migrate", "docker-pullable://migrate@sha256:m"), status("proxy", "sha256:p")},
+		},
+	}
+
+	reordered := previous.DeepCopy()
+	reordered.Status.ContainerStatuses = []core.ContainerStatus{status("worker", "sha256:w"), status("api", "api@sha256:a")}
+	assert.Empty(t, getContainerImageChanges(reordered, previous), "the containers are compared by name and digest")
+
+	pulling := previous.DeepCopy()
+	pulling.Status.ContainerStatuses[0].ImageID = ""
+	assert.Empty(t, getContainerImageChanges(pulling, previous), "the image is not pulled yet")
+
+	changed := previous.DeepCopy()
+	changed.Status.InitContainerStatuses[1].ImageID = "sha256:p2"
+	changed.Status.EphemeralContainerStatuses = []core.ContainerStatus{status("debugger", "sha256:d")}
+	assert.Equal(t, []ContainerImageChange{
+		{ContainerName: "debugger", ContainerType: ContainerTypeEphemeral, Image: "debugger:1", ImageID: "sha256:d"},
+		{ContainerName: "proxy", ContainerType: ContainerTypeSidecar, Image: "proxy:1", ImageID: "sha256:p2", PreviousImageID: "sha256:p"},
+	}, getContainerImageChanges(changed, previous))
+}
+
+func TestCheckNotificationCandidateListIgnoresOlderPods(t *testing.T) {
+	created := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	pod := func(created time.Time, imageID string) *core.Pod {
+		return &core.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "api", Namespace: "payments", CreationTimestamp: metav1.NewTime(created)},
+			Status:     core.PodStatus{ContainerStatuses: []core.ContainerStatus{{Name: "api", Image: "api:2", ImageID: imageID}}},
+		}
+	}
+	od := &OwnerDet{Kind: "Deployment", Name: "api"}
+	wh := &WatchHandler{scanNotificationCandidateList: []*ScanNewImageData{{Pod: pod(created, "sha256:new"), Owner: od, PodsNumber: 2}}}
+
+	assert.Empty(t, wh.checkNotificationCandidateList(pod(created.Add(-time.Hour), "sha256:old"), od, "Running"), "the pod of the previous rollout")
+	changes := wh.checkNotificationCandidateList(pod(created.Add(time.Minute), "sha256:newer"), od, "Running")
+	require.Len(t, changes, 1)
+	assert.Equal(t, "sha256:new", changes[0].PreviousImageID)
+}
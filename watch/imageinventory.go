@@ -0,0 +1,303 @@
+package watch
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	defaultRegistry   = "docker.io"
+	defaultTag        = "latest"
+	officialImagesOrg = "library/"
+)
+
+// ImageReference is an image reference normalized like docker does, e.g. "nginx" is docker.io/library/nginx:latest
+type ImageReference struct {
+	Registry   string `json:"registry"`
+	Repository string `json:"repository"`
+	Tag        string `json:"tag,omitempty"`
+	Digest     string `json:"digest,omitempty"`
+}
+
+// String returns the normalized reference, registry/repository[:tag][@digest]
+func (ref ImageReference) String() string {
+	name := ref.Registry + "/" + ref.Repository
+	if ref.Tag != "" {
+		name += ":" + ref.Tag
+	}
+	if ref.Digest != "" {
+		name += "@" + ref.Digest
+	}
+	return name
+}
+
+// parseImageReference normalizes the image of a container spec. The digest is taken from the image id of the
+// container status when it has one, since the spec rarely pins it
+func parseImageReference(image, imageID string) ImageReference {
+	ref := ImageReference{}
+	name := image
+	if i := strings.Index(name, "@"); i >= 0 {
+		ref.Digest = name[i+1:]
+		name = name[:i]
+	}
+	// a colon after the last slash is the tag, before it is the registry port
+	if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+		ref.Tag = name[i+1:]
+		name = name[:i]
+	}
+	if i := strings.Index(name, "/"); i >= 0 && (strings.ContainsAny(name[:i], ".:") || name[:i] == "localhost") {
+		ref.Registry, ref.Repository = name[:i], name[i+1:]
+	} else {
+		ref.Registry, ref.Repository = defaultRegistry, name
+	}
+	if ref.Registry == "index.docker.io" {
+		ref.Registry = defaultRegistry
+	}
+	if ref.Registry == defaultRegistry && !strings.Contains(ref.Repository, "/") {
+		ref.Repository = officialImagesOrg + ref.Repository
+	}
+	if ref.Tag == "" && ref.Digest == "" {
+		ref.Tag = defaultTag
+	}
+	if digest := imageIDDigest(imageID); digest != "" {
+		ref.Digest = digest
+	}
+	return ref
+}
+
+// imageIDDigest returns the digest of an image id, e.g. "docker-pullable://nginx@sha256:..." or "sha256:..."
+func imageIDDigest(imageID string) string {
+	if i := strings.LastIndex(imageID, "@"); i >= 0 {
+		return imageID[i+1:]
+	}
+	if strings.HasPrefix(imageID, "sha256:") {
+		return imageID
+	}
+	return ""
+}
+
+// ImageData is an image of the inventory and where it runs
+type ImageData struct {
+	Image string `json:"image"`
+	ImageReference
+	Workloads []ImageWorkload `json:"workloads,omitempty"`
+	Nodes     []string        `json:"nodes,omitempty"`
+	FirstSeen string          `json:"firstSeen"`
+	LastSeen  string          `json:"lastSeen"`
+}
+
+// ImageWorkload is a workload running an image, and the containers of the workload that run it
+type ImageWorkload struct {
+	Namespace  string   `json:"namespace"`
+	Kind       string   `json:"kind"`
+	Name       string   `json:"name"`
+	Containers []string `json:"containers"`
+}
+
+// imageUsage is a container of a pod running an image
+type imageUsage struct {
+	pod       types.UID
+	container string
+	namespace string
+	kind      string
+	name      string
+	node      string
+}
+
+type inventoryImage struct {
+	ref       ImageReference
+	usages    map[imageUsage]bool
+	firstSeen time.Time
+	lastSeen  time.Time
+}
+
+// imageChange is an image to report
+type imageChange struct {
+	data  ImageData
+	stype StateType
+}
+
+// imageInventory keeps the images running in the cluster, it is fed by the pods watch
+type imageInventory struct {
+	// images is the normalized reference -> image
+	images map[string]*inventoryImage
+	// pods is the pod uid -> the normalized references of its containers
+	pods  map[types.UID][]string
+	mutex sync.Mutex
+}
+
+func newImageInventory() *imageInventory {
+	return &imageInventory{images: make(map[string]*inventoryImage), pods: make(map[types.UID][]string)}
+}
+
+// observePod updates the images of the pod, and returns the images that were added, changed where they run or are no longer used
+func (inv *imageInventory) observePod(pod *core.Pod, od *OwnerDet, now time.Time) []imageChange {
+	usages := map[string][]imageUsage{}
+	refs := map[string]ImageReference{}
+	statuses := append(append([]core.ContainerStatus{}, pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...)
+	for i := range statuses {
+		// the image id is set once the image is pulled
+		if statuses[i].ImageID == "" {
+			continue
+		}
+		ref := parseImageReference(statuses[i].Image, statuses[i].ImageID)
+		key := ref.String()
+		refs[key] = ref
+		usages[key] = append(usages[key], imageUsage{pod: pod.UID, container: statuses[i].Name, namespace: pod.Namespace,
+			kind: od.Kind, name: od.Name, node: pod.Spec.NodeName})
+	}
+
+	inv.mutex.Lock()
+	defer inv.mutex.Unlock()
+	keys := make([]string, 0, len(usages))
+	for key := range usages {
+		keys = append(keys, key)
+	}
+	affected := map[string]ImageData{}
+	for _, key := range append(keys, inv.pods[pod.UID]...) {
+		if image, ok := inv.images[key]; ok {
+			affected[key] = image.data()
+		}
+	}
+	inv.removePodUsages(pod.UID)
+	for _, key := range keys {
+		image, ok := inv.images[key]
+		if !ok {
+			image = &inventoryImage{ref: refs[key], usages: map[imageUsage]bool{}, firstSeen: now}
+			inv.images[key] = image
+		}
+		for _, usage := range usages[key] {
+			image.usages[usage] = true
+		}
+		image.lastSeen = now
+	}
+	inv.pods[pod.UID] = keys
+	return inv.changes(affected, keys)
+}
+
+// removePod drops the images of a deleted pod, and returns the changed images
+func (inv *imageInventory) removePod(uid types.UID, now time.Time) []imageChange {
+	inv.mutex.Lock()
+	defer inv.mutex.Unlock()
+	affected := map[string]ImageData{}
+	for _, key := range inv.pods[uid] {
+		if image, ok := inv.images[key]; ok {
+			affected[key] = image.data()
+			image.lastSeen = now
+		}
+	}
+	inv.removePodUsages(uid)
+	return inv.changes(affected, nil)
+}
+
+func (inv *imageInventory) reset() {
+	inv.mutex.Lock()
+	defer inv.mutex.Unlock()
+	inv.images = make(map[string]*inventoryImage)
+	inv.pods = make(map[types.UID][]string)
+}
+
+func (inv *imageInventory) removePodUsages(uid types.UID) {
+	for _, key := range inv.pods[uid] {
+		image, ok := inv.images[key]
+		if !ok {
+			continue
+		}
+		for usage := range image.usages {
+			if usage.pod == uid {
+				delete(image.usages, usage)
+			}
+		}
+	}
+	delete(inv.pods, uid)
+}
+
+// changes compares the images before the update with their current state, the images without a previous state are new
+// and the unused images are removed
+func (inv *imageInventory) changes(before map[string]ImageData, added []string) []imageChange {
+	keys := map[string]bool{}
+	for key := range before {
+		keys[key] = true
+	}
+	for _, key := range added {
+		keys[key] = true
+	}
+	sortedKeys := make([]string, 0, len(keys))
+	for key := range keys {
+		sortedKeys = append(sortedKeys, key)
+	}
+	sort.Strings(sortedKeys)
+
+	changes := []imageChange{}
+	for _, key := range sortedKeys {
+		image := inv.images[key]
+		previous, existed := before[key]
+		switch {
+		case len(image.usages) == 0:
+			delete(inv.images, key)
+			changes = append(changes, imageChange{data: image.data(), stype: DELETED})
+		case !existed:
+			changes = append(changes, imageChange{data: image.data(), stype: CREATED})
+		default:
+			current := image.data()
+			if !reflect.DeepEqual(previous.Workloads, current.Workloads) || !reflect.DeepEqual(previous.Nodes, current.Nodes) {
+				changes = append(changes, imageChange{data: current, stype: UPDATED})
+			}
+		}
+	}
+	return changes
+}
+
+// data returns the reported image, the workloads and the nodes are sorted
+func (image *inventoryImage) data() ImageData {
+	data := ImageData{
+		Image:          image.ref.String(),
+		ImageReference: image.ref,
+		FirstSeen:      image.firstSeen.UTC().Format(time.RFC3339),
+		LastSeen:       image.lastSeen.UTC().Format(time.RFC3339),
+	}
+	// workloads is the workload key -> the containers running the image
+	workloads := map[string]map[string]bool{}
+	nodes := map[string]bool{}
+	for usage := range image.usages {
+		key := objectKey(usage.kind, usage.namespace, usage.name)
+		if workloads[key] == nil {
+			workloads[key] = map[string]bool{}
+		}
+		workloads[key][usage.container] = true
+		if usage.node != "" {
+			nodes[usage.node] = true
+		}
+	}
+	for key, containers := range workloads {
+		parts := strings.SplitN(key, "/", 3)
+		workload := ImageWorkload{Kind: parts[0], Namespace: parts[1], Name: parts[2]}
+		for container := range containers {
+			workload.Containers = append(workload.Containers, container)
+		}
+		sort.Strings(workload.Containers)
+		data.Workloads = append(data.Workloads, workload)
+	}
+	sort.Slice(data.Workloads, func(i, j int) bool {
+		a, b := data.Workloads[i], data.Workloads[j]
+		return a.Namespace+"/"+a.Kind+"/"+a.Name < b.Namespace+"/"+b.Kind+"/"+b.Name
+	})
+	for node := range nodes {
+		data.Nodes = append(data.Nodes, node)
+	}
+	sort.Strings(data.Nodes)
+	return data
+}
+
+// reportImageChanges adds the changed images to the report
+func (wh *WatchHandler) reportImageChanges(changes []imageChange) {
+	for i := range changes {
+		wh.jsonReport.AddToJsonFormat(changes[i].data, IMAGES, changes[i].stype)
+	}
+}
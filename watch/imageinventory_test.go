@@ -0,0 +1,69 @@
+package watch
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestParseImageReference(t *testing.T) {
+	tests := []struct {
+		image    string
+		imageID  string
+		expected string
+	}{
+		{image: "nginx", expected: "docker.io/library/nginx:latest"},
+		{image: "nginx:1.25", imageID: "docker-pullable://nginx@sha256:abc", expected: "docker.io/library/nginx:1.25@sha256:abc"},
+		{image: "bitnami/redis:7", expected: "docker.io/bitnami/redis:7"},
+		{image: "index.docker.io/library/nginx:1.25", expected: "docker.io/library/nginx:1.25"},
+		{image: "quay.io/kubescape/kollector:v0.1.2", imageID: "quay.io/kubescape/kollector@sha256:def", expected: "quay.io/kubescape/kollector:v0.1.2@sha256:def"},
+		{image: "localhost:5000/app", expected: "localhost:5000/app:latest"},
+		{image: "registry.local:5000/team/app:1.0", imageID: "sha256:123", expected: "registry.local:5000/team/app:1.0@sha256:123"},
+		{image: "nginx@sha256:abc", expected: "docker.io/library/nginx@sha256:abc"},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.expected, parseImageReference(test.image, test.imageID).String(), test.image)
+	}
+	ref := parseImageReference("quay.io/kubescape/kollector:v0.1.2", "")
+	assert.Equal(t, ImageReference{Registry: "quay.io", Repository: "kubescape/kollector", Tag: "v0.1.2"}, ref)
+}
+
+func TestImageInventory(t *testing.T) {
+	pod := func(uid types.UID, node string, images ...string) *core.Pod {
+		p := &core.Pod{ObjectMeta: metav1.ObjectMeta{Name: string(uid), Namespace: "payments", UID: uid}, Spec: core.PodSpec{NodeName: node}}
+		for i, image := range images {
+			p.Status.ContainerStatuses = append(p.Status.ContainerStatuses, core.ContainerStatus{Name: []string{"api", "sidecar"}[i], Image: image, ImageID: image + "@sha256:abc"})
+		}
+		return p
+	}
+	od := &OwnerDet{Kind: "Deployment", Name: "api"}
+	inv := newImageInventory()
+	start := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+
+	changes := inv.observePod(pod("uid-1", "node-1", "nginx:1.25", "envoy"), od, start)
+	require.Len(t, changes, 2)
+	assert.Equal(t, CREATED, changes[0].stype)
+	assert.Equal(t, "docker.io/library/envoy:latest@sha256:abc", changes[0].data.Image)
+	assert.Equal(t, []ImageWorkload{{Namespace: "payments", Kind: "Deployment", Name: "api", Containers: []string{"sidecar"}}}, changes[0].data.Workloads)
+	assert.Equal(t, []string{"node-1"}, changes[1].data.Nodes)
+	assert.Empty(t, inv.observePod(pod("uid-1", "node-1", "nginx:1.25", "envoy"), od, start.Add(time.Minute)), "nothing changed")
+
+	changes = inv.observePod(pod("uid-2", "node-2", "nginx:1.25"), od, start.Add(2*time.Minute))
+	require.Len(t, changes, 1)
+	assert.Equal(t, UPDATED, changes[0].stype)
+	assert.Equal(t, []string{"node-1", "node-2"}, changes[0].data.Nodes)
+	assert.Equal(t, "2024-05-01T10:00:00Z", changes[0].data.FirstSeen)
+	assert.Equal(t, "2024-05-01T10:02:00Z", changes[0].data.LastSeen)
+
+	changes = inv.removePod("uid-1", start.Add(3*time.Minute))
+	require.Len(t, changes, 2)
+	assert.Equal(t, DELETED, changes[0].stype, "envoy is no longer used")
+	assert.Equal(t, UPDATED, changes[1].stype)
+	assert.Equal(t, []string{"node-2"}, changes[1].data.Nodes)
+	assert.Len(t, inv.images, 1)
+}
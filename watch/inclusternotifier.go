@@ -2,71 +2,369 @@ package watch
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"net/url"
-	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/armosec/armoapi-go/apis"
 	"github.com/armosec/cluster-notifier-api-go/notificationserver"
-	"github.com/armosec/utils-go/boolutils"
+	"github.com/armosec/utils-k8s-go/wlid"
 	logger "github.com/kubescape/go-logger"
 	"github.com/kubescape/go-logger/helpers"
 	"github.com/kubescape/kollector/config"
-	"github.com/kubescape/kollector/consts"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
 )
 
-var defaultClientInClusterTrigger = http.DefaultClient
-
-func newInClusterNotifier(config config.IConfig) iClusterNotifier {
-	trigger := os.Getenv(consts.ActivateScanOnNewImageFeatureEnvironmentVariable)
-	if !boolutils.StringToBool(trigger) {
+// newInClusterNotifier returns the event bus of the in-cluster components, the default HTTP client is used when httpClient is nil
+func newInClusterNotifier(kollectorConfig config.IConfig, httpClient *http.Client) iClusterNotifier {
+	settings := kollectorConfig.Settings()
+	triggerCommands := map[string][]apis.NotificationPolicyType{}
+	for _, trigger := range config.Triggers {
+		if !settings.TriggerEnabled(trigger) {
+			continue
+		}
+		for _, command := range settings.TriggerCommands[trigger] {
+			triggerCommands[trigger] = append(triggerCommands[trigger], apis.NotificationPolicyType(command))
+		}
+	}
+	if len(triggerCommands) == 0 {
 		return newSkipInClusterNotifier("", "", "")
 	}
-	return newClusterNotifierImpl(config.AccountID(), config.ClusterName(), config.GatewayRestURL())
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return newClusterNotifierImpl(kollectorConfig.AccountID(), kollectorConfig.ClusterName(), kollectorConfig.GatewayRestURL(), httpClient,
+		func() config.NotifierSettings { return kollectorConfig.Settings().Notifier }, triggerCommands)
+}
+
+// containerToImageIDsArg is the scan command argument of the container type/name -> image id to scan, imageChangesArg carries
+// the type and the previous image of each changed container, nodeNameArg is the name of a new node
+const (
+	containerToImageIDsArg = "containerToImageIDs"
+	imageChangesArg        = "imageChanges"
+	nodeNameArg            = "nodeName"
+)
+
+// publishTrigger notifies the in-cluster components of the event, a failure is logged
+func (wh *WatchHandler) publishTrigger(ctx context.Context, event TriggerEvent) {
+	if err := wh.notifyUpdates.publish(event); err != nil {
+		logger.L().Ctx(ctx).Error("failed to notify the in-cluster components", helpers.String("trigger", event.Trigger), helpers.String("name", event.Name), helpers.Error(err))
+	}
 }
 
+// notifierMaxBackoff caps the retry backoff of a notification
+const notifierMaxBackoff = 5 * time.Minute
+
+// iClusterNotifier is the event bus of the in-cluster components, each trigger is sent as its configured commands
 type iClusterNotifier interface {
-	notifyNewMicroServiceCreatedInTheCluster(namespace string, k8sType string, name string) error
+	// publish queues the notification of the event if its trigger is enabled, it fails when the queue is full
+	publish(event TriggerEvent) error
+	// Run sends the queued notifications until the context is done
+	Run(ctx context.Context)
+}
+
+// TriggerEvent is a cluster event the in-cluster components are notified of
+type TriggerEvent struct {
+	// Trigger is one of the config triggers, e.g. config.NewNamespaceTrigger
+	Trigger   string
+	Namespace string
+	Kind      string
+	Name      string
+	// Images are the changed images of a new image event
+	Images []ContainerImageChange
+}
+
+// wlid returns the workload id the commands apply to, a namespace is a wild wlid and a node the wild wlid of the cluster
+func (event *TriggerEvent) wlid(clusterName string) string {
+	switch event.Trigger {
+	case config.NewNamespaceTrigger:
+		return wlid.GetWLID(clusterName, event.Name, "", "")
+	case config.NewNodeTrigger:
+		return wlid.GetWLID(clusterName, "", "", "")
+	}
+	return wlid.GetWLID(clusterName, event.Namespace, event.Kind, event.Name)
+}
+
+// notification is a notification waiting in the queue
+type notification struct {
+	event    TriggerEvent
+	wlid     string
+	attempts int
+	// notBefore is when the notification can be sent, it is set by the retry backoff
+	notBefore time.Time
+}
+
+// object returns the trigger and the object of the notification, the pending notifications of an object are merged
+func (n *notification) object() string {
+	// the nodes share the wlid of the cluster
+	if n.event.Trigger == config.NewNodeTrigger {
+		return n.event.Trigger + "|" + n.wlid + "|" + n.event.Name
+	}
+	return n.event.Trigger + "|" + n.wlid
+}
+
+// key identifies the notification of a trigger, object and images, for the deduplication
+func (n *notification) key() string {
+	images := make([]string, 0, len(n.event.Images))
+	for i := range n.event.Images {
+		images = append(images, string(n.event.Images[i].ContainerType)+"/"+n.event.Images[i].ContainerName+"="+n.event.Images[i].ImageID)
+	}
+	sort.Strings(images)
+	return n.object() + "|" + strings.Join(images, ",")
+}
+
+// merge adds the images of another notification of the trigger and object, the latest image of a container wins
+func (n *notification) merge(images []ContainerImageChange) {
+	for i := range images {
+		merged := false
+		for j := range n.event.Images {
+			if n.event.Images[j].ContainerName == images[i].ContainerName && n.event.Images[j].ContainerType == images[i].ContainerType {
+				n.event.Images[j] = images[i]
+				merged = true
+				break
+			}
+		}
+		if !merged {
+			n.event.Images = append(n.event.Images, images[i])
+		}
+	}
+}
+
+// notifierMetrics counts the notifications by trigger and result: sent, retried, failed, dropped, deduplicated or merged
+type notifierMetrics struct {
+	notifications metric.Int64Counter
+}
+
+func newNotifierMetrics(meter metric.Meter) notifierMetrics {
+	notifications, err := meter.Int64Counter("kollector.notifier.notifications", metric.WithDescription("in-cluster notifications by trigger and result"))
+	if err != nil {
+		logger.L().Warning("failed to create the notifier metrics", helpers.Error(err))
+	}
+	return notifierMetrics{notifications: notifications}
+}
+
+func (m notifierMetrics) count(ctx context.Context, trigger, result string) {
+	if m.notifications != nil {
+		m.notifications.Add(ctx, 1, metric.WithAttributes(attribute.String("trigger", trigger), attribute.String("result", result)))
+	}
 }
 
 type clusterNotifierImpl struct {
 	clusterName  string
 	customerGuid string
 	notifierURL  *url.URL
+	httpClient   *http.Client
+	// settings returns the current settings, they may be reloaded
+	settings func() config.NotifierSettings
+	metrics  notifierMetrics
+	// triggerCommands are the commands of the enabled triggers
+	triggerCommands map[string][]apis.NotificationPolicyType
+
+	// queue is the pending notifications, at most one per trigger and wlid
+	queue []*notification
+	// sent is the notification key -> when it was sent
+	sent map[string]time.Time
+	// wake is signaled when a notification is queued
+	wake  chan struct{}
+	mutex sync.Mutex
 }
 
-func newClusterNotifierImpl(customerGuid, clusterName, notifierHost string) *clusterNotifierImpl {
+func newClusterNotifierImpl(customerGuid, clusterName, notifierHost string, httpClient *http.Client, settings func() config.NotifierSettings, triggerCommands map[string][]apis.NotificationPolicyType) *clusterNotifierImpl {
 	logger.L().Info("setting up cluster trigger notification")
 	return &clusterNotifierImpl{
-		customerGuid: customerGuid,
-		clusterName:  clusterName,
-		notifierURL:  generateNotifierURL(notifierHost),
+		customerGuid:    customerGuid,
+		clusterName:     clusterName,
+		notifierURL:     generateNotifierURL(notifierHost),
+		httpClient:      httpClient,
+		settings:        settings,
+		metrics:         newNotifierMetrics(otel.Meter("kollector")),
+		triggerCommands: triggerCommands,
+		sent:            make(map[string]time.Time),
+		wake:            make(chan struct{}, 1),
 	}
 }
 
-func (notifier *clusterNotifierImpl) notifyNewMicroServiceCreatedInTheCluster(namespace string, k8sType string, name string) error {
+func (notifier *clusterNotifierImpl) publish(event TriggerEvent) error {
+	if _, enabled := notifier.triggerCommands[event.Trigger]; !enabled {
+		return nil
+	}
+	event.Images = append([]ContainerImageChange{}, event.Images...)
+	n := &notification{event: event, wlid: event.wlid(notifier.clusterName)}
 
-	var body *bytes.Buffer
-	var err error
+	notifier.mutex.Lock()
+	defer notifier.mutex.Unlock()
+	if sent, ok := notifier.sent[n.key()]; ok && time.Since(sent) < time.Duration(notifier.settings().DeduplicationWindow) {
+		notifier.metrics.count(context.Background(), event.Trigger, "deduplicated")
+		return nil
+	}
+	if err := notifier.push(n); err != nil {
+		notifier.metrics.count(context.Background(), event.Trigger, "dropped")
+		return err
+	}
+	select {
+	case notifier.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
 
-	if body, err = notifier.createNotificationPostJson(namespace, k8sType, name); err != nil {
-		return fmt.Errorf("createNotificationPostJson: fail to create notification post json with err %v", err)
+// push queues the notification, or merges it into the pending notification of the trigger and object. The mutex should be held
+func (notifier *clusterNotifierImpl) push(n *notification) error {
+	for _, pending := range notifier.queue {
+		if pending.object() == n.object() {
+			pending.merge(n.event.Images)
+			notifier.metrics.count(context.Background(), n.event.Trigger, "merged")
+			return nil
+		}
+	}
+	if len(notifier.queue) >= notifier.settings().QueueSize {
+		return fmt.Errorf("the notification queue is full, %d notifications are pending", len(notifier.queue))
 	}
+	notifier.queue = append(notifier.queue, n)
+	return nil
+}
 
-	if err := notifier.executeTriggeredNotification(body); err != nil {
-		return fmt.Errorf("executeTriggeredNotification: fail to execute with err %v", err)
+// next removes the first notification that can be sent from the queue. Otherwise returns how long until one can be sent,
+// or a negative duration when the queue is empty
+func (notifier *clusterNotifierImpl) next(now time.Time) (*notification, time.Duration) {
+	notifier.mutex.Lock()
+	defer notifier.mutex.Unlock()
+	wait := time.Duration(-1)
+	for i, n := range notifier.queue {
+		if !n.notBefore.After(now) {
+			notifier.queue = append(notifier.queue[:i], notifier.queue[i+1:]...)
+			return n, 0
+		}
+		if until := n.notBefore.Sub(now); wait < 0 || until < wait {
+			wait = until
+		}
 	}
+	return nil, wait
+}
 
-	return nil
+// Run sends the queued notifications one at a time, at most one per MinInterval. The pending notifications are dropped
+// when the context is done
+func (notifier *clusterNotifierImpl) Run(ctx context.Context) {
+	var lastSent time.Time
+	for {
+		n, wait := notifier.next(time.Now())
+		if n == nil {
+			var retry <-chan time.Time
+			if wait >= 0 {
+				retry = time.After(wait)
+			}
+			select {
+			case <-ctx.Done():
+				notifier.dropPending(ctx)
+				return
+			case <-notifier.wake:
+			case <-retry:
+			}
+			continue
+		}
+		if wait := time.Duration(notifier.settings().MinInterval) - time.Since(lastSent); wait > 0 {
+			select {
+			case <-ctx.Done():
+				notifier.mutex.Lock()
+				notifier.queue = append(notifier.queue, n)
+				notifier.mutex.Unlock()
+				notifier.dropPending(ctx)
+				return
+			case <-time.After(wait):
+			}
+		}
+		lastSent = time.Now()
+		notifier.send(ctx, n)
+	}
 }
 
-func (notifier *clusterNotifierImpl) createNotificationPostJson(namespace string, k8sType string, name string) (*bytes.Buffer, error) {
+func (notifier *clusterNotifierImpl) dropPending(ctx context.Context) {
+	notifier.mutex.Lock()
+	defer notifier.mutex.Unlock()
+	if len(notifier.queue) > 0 {
+		logger.L().Warning("dropping the pending notifications", helpers.Int("count", len(notifier.queue)))
+	}
+	for _, n := range notifier.queue {
+		notifier.metrics.count(ctx, n.event.Trigger, "dropped")
+	}
+	notifier.queue = nil
+}
 
+// send posts the notification, a failure that may be temporary is queued again with a backoff
+func (notifier *clusterNotifierImpl) send(ctx context.Context, n *notification) {
+	n.attempts++
+	body, err := notifier.createNotificationPostJson(n)
+	if err == nil {
+		var retryable bool
+		var retryAfter time.Duration
+		if retryable, retryAfter, err = notifier.executeTriggeredNotification(ctx, body); err != nil && retryable && n.attempts <= notifier.settings().MaxRetries {
+			backoff := min(time.Duration(notifier.settings().RetryBackoff)<<(n.attempts-1), notifierMaxBackoff)
+			n.notBefore = time.Now().Add(max(backoff, retryAfter))
+			logger.L().Ctx(ctx).Warning("failed to send a notification, retrying", helpers.String("trigger", n.event.Trigger), helpers.String("wlid", n.wlid), helpers.Int("attempt", n.attempts),
+				helpers.String("backoff", time.Until(n.notBefore).Round(time.Millisecond).String()), helpers.Error(err))
+			notifier.mutex.Lock()
+			pushErr := notifier.push(n)
+			notifier.mutex.Unlock()
+			if pushErr == nil {
+				notifier.metrics.count(ctx, n.event.Trigger, "retried")
+				return
+			}
+			err = pushErr
+		}
+	}
+	if err != nil {
+		logger.L().Ctx(ctx).Error("failed to send a notification", helpers.String("trigger", n.event.Trigger), helpers.String("wlid", n.wlid), helpers.Int("attempts", n.attempts), helpers.Error(err))
+		notifier.metrics.count(ctx, n.event.Trigger, "failed")
+		return
+	}
+
+	logger.L().Info("notification sent", helpers.String("trigger", n.event.Trigger), helpers.String("wlid", n.wlid), helpers.Int("images", len(n.event.Images)))
+	notifier.metrics.count(ctx, n.event.Trigger, "sent")
+	now := time.Now()
+	notifier.mutex.Lock()
+	defer notifier.mutex.Unlock()
+	for key, sent := range notifier.sent {
+		if now.Sub(sent) >= time.Duration(notifier.settings().DeduplicationWindow) {
+			delete(notifier.sent, key)
+		}
+	}
+	notifier.sent[n.key()] = now
+}
+
+// createNotificationPostJson returns the commands of the trigger, applied to the wlid of the notification
+func (notifier *clusterNotifierImpl) createNotificationPostJson(n *notification) ([]byte, error) {
+
+	var args map[string]interface{}
+	if images := n.event.Images; len(images) > 0 {
+		containerToImageIDs := make(map[string]string, len(images))
+		for i := range images {
+			containerToImageIDs[string(images[i].ContainerType)+"/"+images[i].ContainerName] = images[i].ImageID
+		}
+		args = map[string]interface{}{containerToImageIDsArg: containerToImageIDs, imageChangesArg: images}
+	}
+	if n.event.Trigger == config.NewNodeTrigger {
+		args = map[string]interface{}{nodeNameArg: n.event.Name}
+	}
 	cmds := apis.Commands{}
-	wlid := "wlid://cluster-" + notifier.clusterName + "/namespace-" + namespace + "/" + k8sType + "-" + name // TODO: Use a wlid generator function
-	cmds.Commands = append(cmds.Commands, apis.Command{CommandName: apis.TypeScanImages, Wlid: wlid})
+	for _, commandName := range notifier.triggerCommands[n.event.Trigger] {
+		command := apis.Command{CommandName: commandName, Args: args}
+		if n.event.Trigger == config.NewNamespaceTrigger || n.event.Trigger == config.NewNodeTrigger {
+			command.WildWlid = n.wlid
+		} else {
+			command.Wlid = n.wlid
+		}
+		cmds.Commands = append(cmds.Commands, command)
+	}
 
 	notification := notificationserver.Notification{
 		Target: map[string]string{
@@ -78,29 +376,45 @@ func (notifier *clusterNotifierImpl) createNotificationPostJson(namespace string
 		Notification: cmds,
 	}
 
-	body, err := json.Marshal(notification)
-	if err != nil {
-		return nil, err
-	}
-
-	return bytes.NewBuffer(body), nil
+	return json.Marshal(notification)
 }
 
-func (notifier *clusterNotifierImpl) executeTriggeredNotification(body *bytes.Buffer) error {
-
-	req, err := http.NewRequest(http.MethodPost, notifier.notifierURL.String(), body)
+// executeTriggeredNotification posts the notification. Returns true when the failure may be temporary, i.e. a network
+// error, a 408, a 429 or a 5xx, with the delay of the Retry-After header if any
+func (notifier *clusterNotifierImpl) executeTriggeredNotification(ctx context.Context, body []byte) (bool, time.Duration, error) {
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(notifier.settings().Timeout))
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, notifier.notifierURL.String(), bytes.NewReader(body))
 	if err != nil {
-		return err
+		return false, 0, err
 	}
+	req.Header.Set("Content-Type", "application/json")
 
-	logger.L().Info("send", helpers.String("url", notifier.notifierURL.String()))
-	resp, err := defaultClientInClusterTrigger.Do(req)
+	logger.L().Debug("send", helpers.String("url", notifier.notifierURL.String()))
+	resp, err := notifier.httpClient.Do(req)
 	if err != nil {
-		return err
+		return true, 0, err
 	}
 	defer resp.Body.Close()
+	// the body is drained so the connection is reused
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
 
-	return nil
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return false, 0, nil
+	case resp.StatusCode == http.StatusRequestTimeout || resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return true, parseRetryAfter(resp.Header.Get("Retry-After")), fmt.Errorf("notification server responded %s", resp.Status)
+	}
+	return false, 0, fmt.Errorf("notification server responded %s", resp.Status)
+}
+
+// parseRetryAfter parses a Retry-After header in seconds, the HTTP date form is ignored
+func parseRetryAfter(value string) time.Duration {
+	seconds, err := strconv.Atoi(value)
+	if err != nil || seconds < 0 {
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
 }
 
 // generate notifier URL
@@ -121,6 +435,10 @@ func newSkipInClusterNotifier(customerGuid, clusterName, notifierHost string) *s
 	return &skipInClusterNotifier{}
 }
 
-func (skip *skipInClusterNotifier) notifyNewMicroServiceCreatedInTheCluster(namespace string, k8sType string, name string) error {
+func (skip *skipInClusterNotifier) publish(event TriggerEvent) error {
 	return nil
 }
+
+func (skip *skipInClusterNotifier) Run(ctx context.Context) {
+	<-ctx.Done()
+}
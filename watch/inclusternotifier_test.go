@@ -0,0 +1,224 @@
+package watch
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/armosec/armoapi-go/apis"
+	"github.com/kubescape/kollector/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+// notificationServer is a stand-in of the in-cluster notification server, it answers with the statuses in order then 200
+type notificationServer struct {
+	*httptest.Server
+	statuses []int
+	requests []notificationRequest
+	mutex    sync.Mutex
+}
+
+type notificationRequest struct {
+	Notification struct {
+		Commands []struct {
+			CommandName string                 `json:"commandName"`
+			Wlid        string                 `json:"wlid"`
+			WildWlid    string                 `json:"wildWlid"`
+			Args        map[string]interface{} `json:"args"`
+		} `json:"commands"`
+	} `json:"notification"`
+}
+
+func newNotificationServer(t *testing.T, statuses ...int) *notificationServer {
+	server := &notificationServer{statuses: statuses}
+	server.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var request notificationRequest
+		assert.NoError(t, json.Unmarshal(body, &request))
+		server.mutex.Lock()
+		defer server.mutex.Unlock()
+		server.requests = append(server.requests, request)
+		if len(server.statuses) > 0 {
+			if server.statuses[0] == http.StatusTooManyRequests {
+				w.Header().Set("Retry-After", "0")
+			}
+			w.WriteHeader(server.statuses[0])
+			server.statuses = server.statuses[1:]
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func (s *notificationServer) received() []notificationRequest {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]notificationRequest{}, s.requests...)
+}
+
+func newTestNotifier(t *testing.T, server *notificationServer, settings config.NotifierSettings) (*clusterNotifierImpl, *sdkmetric.ManualReader) {
+	serverURL, err := url.Parse(server.URL)
+	require.NoError(t, err)
+	notifier := newClusterNotifierImpl("customer", "cluster", serverURL.Host, server.Client(), func() config.NotifierSettings { return settings }, testTriggerCommands)
+	reader := sdkmetric.NewManualReader()
+	notifier.metrics = newNotifierMetrics(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)).Meter("test"))
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		notifier.Run(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-stopped
+	})
+	return notifier, reader
+}
+
+// notifierResults returns the notifications counted by result
+func notifierResults(t *testing.T, reader *sdkmetric.ManualReader) map[string]int64 {
+	var metrics metricdata.ResourceMetrics
+	require.NoError(t, reader.Collect(context.Background(), &metrics))
+	results := map[string]int64{}
+	for _, scope := range metrics.ScopeMetrics {
+		for _, m := range scope.Metrics {
+			sum, ok := m.Data.(metricdata.Sum[int64])
+			if !ok {
+				continue
+			}
+			for _, point := range sum.DataPoints {
+				result, _ := point.Attributes.Value("result")
+				results[result.AsString()] += point.Value
+			}
+		}
+	}
+	return results
+}
+
+// testTriggerCommands enable the triggers but the workload spec change
+var testTriggerCommands = map[string][]apis.NotificationPolicyType{
+	config.NewImageTrigger:     {apis.TypeScanImages},
+	config.NewNamespaceTrigger: {apis.TypeRunKubescape},
+	config.NewNodeTrigger:      {apis.TypeRunKubescape, apis.TypeScanImages},
+}
+
+func newImageEvent(name string, images ...ContainerImageChange) TriggerEvent {
+	return TriggerEvent{Trigger: config.NewImageTrigger, Namespace: "payments", Kind: "Deployment", Name: name, Images: images}
+}
+
+func testNotifierSettings() config.NotifierSettings {
+	return config.NotifierSettings{
+		QueueSize:           10,
+		MaxRetries:          3,
+		RetryBackoff:        config.Duration(10 * time.Millisecond),
+		DeduplicationWindow: config.Duration(time.Minute),
+		Timeout:             config.Duration(time.Second),
+	}
+}
+
+func TestNotifierRetriesTemporaryFailures(t *testing.T) {
+	server := newNotificationServer(t, http.StatusServiceUnavailable, http.StatusTooManyRequests)
+	notifier, reader := newTestNotifier(t, server, testNotifierSettings())
+
+	images := []ContainerImageChange{
+		{ContainerName: "api", ContainerType: ContainerTypeContainer, Image: "api:2", ImageID: "sha256:new"},
+		{ContainerName: "api", ContainerType: ContainerTypeInit, Image: "migrate:2", ImageID: "sha256:init"},
+	}
+	require.NoError(t, notifier.publish(newImageEvent("api", images...)))
+	require.Eventually(t, func() bool { return notifierResults(t, reader)["sent"] == 1 }, 5*time.Second, 10*time.Millisecond)
+
+	requests := server.received()
+	require.Len(t, requests, 3)
+	command := requests[2].Notification.Commands[0]
+	assert.Equal(t, "wlid://cluster-cluster/namespace-payments/deployment-api", command.Wlid)
+	assert.Equal(t, map[string]interface{}{"container/api": "sha256:new", "initContainer/api": "sha256:init"}, command.Args[containerToImageIDsArg], "the containers of the same name are kept apart")
+	assert.Len(t, command.Args[imageChangesArg], 2)
+	assert.Equal(t, map[string]int64{"retried": 2, "sent": 1}, notifierResults(t, reader))
+}
+
+func TestNotifierGivesUp(t *testing.T) {
+	server := newNotificationServer(t, http.StatusBadRequest, http.StatusBadGateway, http.StatusBadGateway)
+	settings := testNotifierSettings()
+	settings.MaxRetries = 1
+	notifier, reader := newTestNotifier(t, server, settings)
+
+	require.NoError(t, notifier.publish(newImageEvent("api")))
+	require.Eventually(t, func() bool { return notifierResults(t, reader)["failed"] == 1 }, 5*time.Second, 10*time.Millisecond)
+	assert.Len(t, server.received(), 1, "a client error is not retried")
+
+	require.NoError(t, notifier.publish(newImageEvent("worker")))
+	require.Eventually(t, func() bool { return notifierResults(t, reader)["failed"] == 2 }, 5*time.Second, 10*time.Millisecond)
+	assert.Len(t, server.received(), 3, "a server error is retried up to the max retries")
+}
+
+func TestNotifierDeduplicatesAndMerges(t *testing.T) {
+	server := newNotificationServer(t)
+	settings := testNotifierSettings()
+	settings.QueueSize = 1
+	notifier := newClusterNotifierImpl("customer", "cluster", "127.0.0.1:1", server.Client(), func() config.NotifierSettings { return settings }, testTriggerCommands)
+	api := ContainerImageChange{ContainerName: "api", ContainerType: ContainerTypeContainer, ImageID: "sha256:1"}
+	proxy := ContainerImageChange{ContainerName: "proxy", ContainerType: ContainerTypeSidecar, ImageID: "sha256:p"}
+
+	require.NoError(t, notifier.publish(newImageEvent("api", api)))
+	api.ImageID = "sha256:2"
+	require.NoError(t, notifier.publish(newImageEvent("api", api, proxy)))
+	assert.Error(t, notifier.publish(newImageEvent("worker")), "the queue is full")
+	require.Len(t, notifier.queue, 1)
+	assert.Equal(t, []ContainerImageChange{api, proxy}, notifier.queue[0].event.Images, "the latest image of a container wins")
+
+	n, _ := notifier.next(time.Now())
+	notifier.sent[n.key()] = time.Now()
+	require.NoError(t, notifier.publish(newImageEvent("api", proxy, api)))
+	assert.Empty(t, notifier.queue, "the same images were sent within the window")
+	notifier.sent[n.key()] = time.Now().Add(-time.Hour)
+	require.NoError(t, notifier.publish(newImageEvent("api", proxy, api)))
+	assert.Len(t, notifier.queue, 1)
+
+	settings.QueueSize = 2
+	assert.NoError(t, notifier.publish(newImageEvent("worker")), "the reloaded queue size applies")
+}
+
+func TestNotifierTriggers(t *testing.T) {
+	server := newNotificationServer(t)
+	notifier, reader := newTestNotifier(t, server, testNotifierSettings())
+
+	require.NoError(t, notifier.publish(TriggerEvent{Trigger: config.WorkloadSpecChangeTrigger, Namespace: "payments", Kind: "Deployment", Name: "api"}))
+	require.NoError(t, notifier.publish(TriggerEvent{Trigger: config.NewNamespaceTrigger, Name: "payments"}))
+	require.NoError(t, notifier.publish(TriggerEvent{Trigger: config.NewNodeTrigger, Kind: "Node", Name: "node-1"}))
+	require.NoError(t, notifier.publish(TriggerEvent{Trigger: config.NewNodeTrigger, Kind: "Node", Name: "node-2"}))
+	require.Eventually(t, func() bool { return notifierResults(t, reader)["sent"] == 3 }, 5*time.Second, 10*time.Millisecond)
+
+	requests := server.received()
+	require.Len(t, requests, 3, "the workload spec change trigger is disabled and the nodes are not merged")
+	namespaceCommands := requests[0].Notification.Commands
+	require.Len(t, namespaceCommands, 1)
+	assert.Equal(t, string(apis.TypeRunKubescape), namespaceCommands[0].CommandName)
+	assert.Equal(t, "wlid://cluster-cluster/namespace-payments", namespaceCommands[0].WildWlid)
+	nodeCommands := requests[1].Notification.Commands
+	require.Len(t, nodeCommands, 2)
+	assert.Equal(t, string(apis.TypeScanImages), nodeCommands[1].CommandName)
+	assert.Equal(t, "wlid://cluster-cluster/namespace-", nodeCommands[1].WildWlid, "the wild wlid of the cluster")
+	assert.Equal(t, map[string]interface{}{nodeNameArg: "node-1"}, nodeCommands[1].Args)
+	secondNodeCommands := requests[2].Notification.Commands
+	require.Len(t, secondNodeCommands, 2)
+	assert.Equal(t, map[string]interface{}{nodeNameArg: "node-2"}, secondNodeCommands[1].Args)
+
+	node1 := &notification{event: TriggerEvent{Trigger: config.NewNodeTrigger, Name: "node-1"}, wlid: "wlid://cluster-cluster/namespace-"}
+	node2 := &notification{event: TriggerEvent{Trigger: config.NewNodeTrigger, Name: "node-2"}, wlid: "wlid://cluster-cluster/namespace-"}
+	assert.NotEqual(t, node1.key(), node2.key(), "the nodes are not deduplicated together")
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	assert.Equal(t, 3*time.Second, parseRetryAfter("3"))
+	assert.Equal(t, time.Duration(0), parseRetryAfter(""))
+	assert.Equal(t, time.Duration(0), parseRetryAfter("Wed, 21 Oct 2015 07:28:00 GMT"))
+}
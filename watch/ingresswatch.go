@@ -0,0 +1,116 @@
+package watch
+
+import (
+	"context"
+	"runtime/debug"
+	"strconv"
+	"time"
+
+	logger "github.com/kubescape/go-logger"
+	"github.com/kubescape/go-logger/helpers"
+	"github.com/kubescape/kollector/config"
+	networking "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+// IngressWatch watches the ingresses and reports the hosts and paths they expose
+func (wh *WatchHandler) IngressWatch(ctx context.Context) {
+	defer func() {
+		if err := recover(); err != nil {
+			logger.L().Ctx(ctx).Error("RECOVER IngressWatch", helpers.Interface("error", err), helpers.String("stack", string(debug.Stack())))
+		}
+	}()
+	newStateChan, unsubscribe := wh.subscribeNewState()
+	defer unsubscribe()
+	for ctx.Err() == nil {
+		logger.L().Info("Watching over ingresses starting")
+		ingressWatcher, err := wh.RestAPIClient.NetworkingV1().Ingresses(wh.namespaceFilter.watchNamespace()).Watch(ctx, wh.listOptions(config.IngressesResource))
+		if err != nil {
+			logger.L().Ctx(ctx).Warning("Failed watching over ingresses", helpers.Error(err))
+			time.Sleep(1 * time.Second)
+			continue
+		}
+		ingressWatcher = wh.recorder.watch(config.IngressesResource, ingressWatcher)
+		wh.handleIngressWatch(ctx, ingressWatcher, newStateChan)
+	}
+}
+
+// handleIngressWatch reports the ingresses whose graph changed, the existing ingresses are resolved again on every watch
+// but only the changes are reported
+func (wh *WatchHandler) handleIngressWatch(ctx context.Context, ingressWatcher watch.Interface, newStateChan <-chan bool) {
+	ingressChan := ingressWatcher.ResultChan()
+	for {
+		var event watch.Event
+		var chanActive bool
+		select {
+		case event, chanActive = <-ingressChan:
+			if !chanActive {
+				ingressWatcher.Stop()
+				return
+			}
+		case <-ctx.Done():
+			ingressWatcher.Stop()
+			return
+		case <-newStateChan:
+			ingressWatcher.Stop()
+			return
+		}
+		if event.Type == watch.Error {
+			logger.L().Ctx(ctx).Error("ingresses watch chan loop", helpers.Interface("error", event.Object))
+			ingressWatcher.Stop()
+			return
+		}
+		ingress, ok := event.Object.(*networking.Ingress)
+		if !ok {
+			logger.L().Ctx(ctx).Error("Watch error: cannot convert to networking.Ingress", helpers.Interface("error", event))
+			continue
+		}
+		if !wh.isNamespaceWatched(ingress.Namespace) {
+			continue
+		}
+		var changes []exposureChange
+		switch event.Type {
+		case watch.Added, watch.Modified:
+			changes = wh.exposure.observeSource(ingressSource(ingress))
+		case watch.Deleted:
+			changes = wh.exposure.removeSource(ingressKind, ingress.Namespace, ingress.Name)
+		}
+		if wh.reportExposureChanges(changes) {
+			informNewDataArrive(wh)
+		}
+	}
+}
+
+// ingressSource returns the entrypoint of an ingress, the default backend is routed without a host and a path
+func ingressSource(ingress *networking.Ingress) *exposureSource {
+	source := &exposureSource{kind: ingressKind, namespace: ingress.Namespace, name: ingress.Name}
+	for _, lb := range ingress.Status.LoadBalancer.Ingress {
+		source.addresses = append(source.addresses, lb.IP, lb.Hostname)
+	}
+	if ingress.Spec.DefaultBackend != nil {
+		source.backends = append(source.backends, ingressBackend(ingress.Namespace, "", "", ingress.Spec.DefaultBackend))
+	}
+	for _, rule := range ingress.Spec.Rules {
+		if rule.HTTP == nil {
+			continue
+		}
+		for i := range rule.HTTP.Paths {
+			source.backends = append(source.backends, ingressBackend(ingress.Namespace, rule.Host, rule.HTTP.Paths[i].Path, &rule.HTTP.Paths[i].Backend))
+		}
+	}
+	return source
+}
+
+func ingressBackend(namespace, host, path string, backend *networking.IngressBackend) exposureBackend {
+	result := exposureBackend{host: host, path: path}
+	if backend.Service == nil {
+		return result
+	}
+	result.service = namespacedName(namespace, backend.Service.Name)
+	if backend.Service.Port.Name != "" {
+		result.port = backend.Service.Port.Name
+	} else if backend.Service.Port.Number != 0 {
+		result.port = strconv.Itoa(int(backend.Service.Port.Number))
+	}
+	return result
+}
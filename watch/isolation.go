@@ -0,0 +1,391 @@
+package watch
+
+import (
+	"reflect"
+	"sort"
+	"sync"
+
+	core "k8s.io/api/core/v1"
+	networking "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// NetworkIsolationData is the network isolation of a microservice by the network policies selecting its pods
+type NetworkIsolationData struct {
+	PodSpecId int    `json:"podSpecId"`
+	Namespace string `json:"namespace"`
+	Kind      string `json:"kind"`
+	Name      string `json:"name"`
+	// Policies are the names of the network policies selecting a pod of the microservice
+	Policies []string         `json:"policies,omitempty"`
+	Ingress  NetworkIsolation `json:"ingress"`
+	Egress   NetworkIsolation `json:"egress"`
+}
+
+// NetworkIsolation is the isolation of a direction of the traffic, ingress or egress
+type NetworkIsolation struct {
+	// Isolated is true when a policy of this direction applies, only the traffic its rules allow is accepted
+	Isolated bool `json:"isolated"`
+	// AllowAll is true when a rule allows every peer
+	AllowAll bool `json:"allowAll,omitempty"`
+	// Peers are the workloads, or the whole namespaces, the rules allow
+	Peers    []NetworkPeer `json:"peers,omitempty"`
+	IPBlocks []string      `json:"ipBlocks,omitempty"`
+}
+
+// NetworkPeer is a workload allowed by a rule, a peer without kind and name is every pod of the namespace
+type NetworkPeer struct {
+	Namespace string `json:"namespace"`
+	Kind      string `json:"kind,omitempty"`
+	Name      string `json:"name,omitempty"`
+}
+
+type isolationPod struct {
+	namespace string
+	labels    map[string]string
+	podSpecID int
+	workload  NetworkPeer
+}
+
+// isolationChange is a microservice isolation to report
+type isolationChange struct {
+	data  NetworkIsolationData
+	stype StateType
+}
+
+// isolationTracker evaluates the network policies against the pods and the namespaces. It is fed by the pods and the
+// network policies watches, the namespace labels are read from the namespaces state
+type isolationTracker struct {
+	// policies is the namespace/name -> network policy
+	policies map[string]*networking.NetworkPolicy
+	pods     map[types.UID]isolationPod
+	// reported is the microservice id -> its last reported isolation
+	reported        map[int]NetworkIsolationData
+	namespaceLabels func() map[string]map[string]string
+	mutex           sync.Mutex
+}
+
+func newIsolationTracker(namespaceLabels func() map[string]map[string]string) *isolationTracker {
+	return &isolationTracker{
+		policies:        make(map[string]*networking.NetworkPolicy),
+		pods:            make(map[types.UID]isolationPod),
+		reported:        make(map[int]NetworkIsolationData),
+		namespaceLabels: namespaceLabels,
+	}
+}
+
+func (t *isolationTracker) reset() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.policies = make(map[string]*networking.NetworkPolicy)
+	t.pods = make(map[types.UID]isolationPod)
+	t.reported = make(map[int]NetworkIsolationData)
+}
+
+// observePod updates the pod of a microservice. Its microservice is evaluated again, and the microservices whose
+// policies may allow it as a peer
+func (t *isolationTracker) observePod(pod *core.Pod, od *OwnerDet, podSpecID int) []isolationChange {
+	current := isolationPod{namespace: pod.Namespace, labels: pod.Labels, podSpecID: podSpecID,
+		workload: NetworkPeer{Namespace: pod.Namespace, Kind: od.Kind, Name: od.Name}}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	previous, existed := t.pods[pod.UID]
+	if existed && reflect.DeepEqual(previous, current) {
+		return nil
+	}
+	t.pods[pod.UID] = current
+	ids := t.peerMicroServices(pod.Namespace)
+	ids[podSpecID] = true
+	if existed {
+		ids[previous.podSpecID] = true
+	}
+	return t.refresh(ids)
+}
+
+// removePod removes the pod, the isolation of its microservice is removed with the microservice
+func (t *isolationTracker) removePod(pod *core.Pod, microServiceRemoved bool) []isolationChange {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	previous, existed := t.pods[pod.UID]
+	if !existed {
+		return nil
+	}
+	delete(t.pods, pod.UID)
+	changes := []isolationChange{}
+	if reported, ok := t.reported[previous.podSpecID]; ok && microServiceRemoved {
+		delete(t.reported, previous.podSpecID)
+		changes = append(changes, isolationChange{data: reported, stype: DELETED})
+	}
+	ids := t.peerMicroServices(pod.Namespace)
+	ids[previous.podSpecID] = true
+	return append(changes, t.refresh(ids)...)
+}
+
+// observePolicy updates a network policy, the microservices of its namespace are evaluated again
+func (t *isolationTracker) observePolicy(policy *networking.NetworkPolicy) []isolationChange {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.policies[namespacedName(policy.Namespace, policy.Name)] = policy
+	return t.refresh(t.namespaceMicroServices(policy.Namespace))
+}
+
+func (t *isolationTracker) removePolicy(policy *networking.NetworkPolicy) []isolationChange {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	delete(t.policies, namespacedName(policy.Namespace, policy.Name))
+	return t.refresh(t.namespaceMicroServices(policy.Namespace))
+}
+
+// refreshNamespace evaluates again the microservices whose policies select peers by namespace labels, e.g. when the labels
+// of a namespace changed
+func (t *isolationTracker) refreshNamespace() []isolationChange {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	ids := map[int]bool{}
+	for _, policy := range t.policies {
+		if hasNamespaceSelector(policy) {
+			for id := range t.namespaceMicroServices(policy.Namespace) {
+				ids[id] = true
+			}
+		}
+	}
+	return t.refresh(ids)
+}
+
+// namespaceMicroServices returns the ids of the microservices of the namespace
+func (t *isolationTracker) namespaceMicroServices(namespace string) map[int]bool {
+	ids := map[int]bool{}
+	for _, pod := range t.pods {
+		if pod.namespace == namespace {
+			ids[pod.podSpecID] = true
+		}
+	}
+	return ids
+}
+
+// peerMicroServices returns the ids of the microservices whose policies may allow a pod of the namespace as a peer
+func (t *isolationTracker) peerMicroServices(namespace string) map[int]bool {
+	namespaces := map[string]bool{}
+	for _, policy := range t.policies {
+		if policy.Namespace == namespace || hasNamespaceSelector(policy) {
+			namespaces[policy.Namespace] = true
+		}
+	}
+	ids := map[int]bool{}
+	for _, pod := range t.pods {
+		if namespaces[pod.namespace] {
+			ids[pod.podSpecID] = true
+		}
+	}
+	return ids
+}
+
+// refresh evaluates the microservices and returns those whose isolation is new or changed. A microservice without pods
+// keeps its last isolation
+func (t *isolationTracker) refresh(ids map[int]bool) []isolationChange {
+	microServicePods := map[int][]isolationPod{}
+	for _, pod := range t.pods {
+		if ids[pod.podSpecID] {
+			microServicePods[pod.podSpecID] = append(microServicePods[pod.podSpecID], pod)
+		}
+	}
+	sortedIDs := make([]int, 0, len(ids))
+	for id := range ids {
+		sortedIDs = append(sortedIDs, id)
+	}
+	sort.Ints(sortedIDs)
+
+	var namespaceLabels map[string]map[string]string
+	if t.namespaceLabels != nil && len(microServicePods) > 0 {
+		namespaceLabels = t.namespaceLabels()
+	}
+	changes := []isolationChange{}
+	for _, id := range sortedIDs {
+		pods := microServicePods[id]
+		if len(pods) == 0 {
+			continue
+		}
+		previous, reported := t.reported[id]
+		current := t.evaluate(id, pods, namespaceLabels)
+		switch {
+		case !reported:
+			changes = append(changes, isolationChange{data: current, stype: CREATED})
+		case !reflect.DeepEqual(previous, current):
+			changes = append(changes, isolationChange{data: current, stype: UPDATED})
+		default:
+			continue
+		}
+		t.reported[id] = current
+	}
+	return changes
+}
+
+// evaluate returns the isolation of a microservice, a policy applies to it when it selects any of its pods
+func (t *isolationTracker) evaluate(id int, pods []isolationPod, namespaceLabels map[string]map[string]string) NetworkIsolationData {
+	data := NetworkIsolationData{PodSpecId: id, Namespace: pods[0].namespace, Kind: pods[0].workload.Kind, Name: pods[0].workload.Name}
+	ingress, egress := newPeerSet(), newPeerSet()
+	for _, policy := range t.policies {
+		if policy.Namespace != data.Namespace || !selectsAnyPod(&policy.Spec.PodSelector, pods) {
+			continue
+		}
+		data.Policies = append(data.Policies, policy.Name)
+		ingressPolicy, egressPolicy := policyTypes(policy)
+		if ingressPolicy {
+			data.Ingress.Isolated = true
+			for _, rule := range policy.Spec.Ingress {
+				if len(rule.From) == 0 {
+					data.Ingress.AllowAll = true
+				}
+				t.addPeers(ingress, policy.Namespace, rule.From, namespaceLabels)
+			}
+		}
+		if egressPolicy {
+			data.Egress.Isolated = true
+			for _, rule := range policy.Spec.Egress {
+				if len(rule.To) == 0 {
+					data.Egress.AllowAll = true
+				}
+				t.addPeers(egress, policy.Namespace, rule.To, namespaceLabels)
+			}
+		}
+	}
+	sort.Strings(data.Policies)
+	data.Ingress.Peers, data.Ingress.IPBlocks = ingress.sorted()
+	data.Egress.Peers, data.Egress.IPBlocks = egress.sorted()
+	return data
+}
+
+// addPeers resolves the peers of a rule: the namespace selector is matched against the namespace labels, the pod selector
+// against the pods. Without a namespace selector the peers are in the namespace of the policy
+func (t *isolationTracker) addPeers(peers *peerSet, policyNamespace string, rulePeers []networking.NetworkPolicyPeer, namespaceLabels map[string]map[string]string) {
+	for _, peer := range rulePeers {
+		if peer.IPBlock != nil {
+			peers.ipBlocks[peer.IPBlock.CIDR] = true
+			continue
+		}
+		namespaces := map[string]bool{}
+		if peer.NamespaceSelector == nil {
+			namespaces[policyNamespace] = true
+		} else if selector, err := metav1.LabelSelectorAsSelector(peer.NamespaceSelector); err == nil {
+			for namespace, nsLabels := range namespaceLabels {
+				if selector.Matches(labels.Set(nsLabels)) {
+					namespaces[namespace] = true
+				}
+			}
+		}
+		if peer.PodSelector == nil {
+			for namespace := range namespaces {
+				peers.peers[NetworkPeer{Namespace: namespace}] = true
+			}
+			continue
+		}
+		selector, err := metav1.LabelSelectorAsSelector(peer.PodSelector)
+		if err != nil {
+			continue
+		}
+		for _, pod := range t.pods {
+			if namespaces[pod.namespace] && selector.Matches(labels.Set(pod.labels)) {
+				peers.peers[pod.workload] = true
+			}
+		}
+	}
+}
+
+// policyTypes returns the directions a policy applies to, without policy types it applies to ingress, and to egress
+// when it has egress rules
+func policyTypes(policy *networking.NetworkPolicy) (bool, bool) {
+	if len(policy.Spec.PolicyTypes) == 0 {
+		return true, len(policy.Spec.Egress) > 0
+	}
+	ingress, egress := false, false
+	for _, policyType := range policy.Spec.PolicyTypes {
+		switch policyType {
+		case networking.PolicyTypeIngress:
+			ingress = true
+		case networking.PolicyTypeEgress:
+			egress = true
+		}
+	}
+	return ingress, egress
+}
+
+func selectsAnyPod(podSelector *metav1.LabelSelector, pods []isolationPod) bool {
+	selector, err := metav1.LabelSelectorAsSelector(podSelector)
+	if err != nil {
+		return false
+	}
+	for i := range pods {
+		if selector.Matches(labels.Set(pods[i].labels)) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasNamespaceSelector(policy *networking.NetworkPolicy) bool {
+	for _, rule := range policy.Spec.Ingress {
+		for _, peer := range rule.From {
+			if peer.NamespaceSelector != nil {
+				return true
+			}
+		}
+	}
+	for _, rule := range policy.Spec.Egress {
+		for _, peer := range rule.To {
+			if peer.NamespaceSelector != nil {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+type peerSet struct {
+	peers    map[NetworkPeer]bool
+	ipBlocks map[string]bool
+}
+
+func newPeerSet() *peerSet {
+	return &peerSet{peers: map[NetworkPeer]bool{}, ipBlocks: map[string]bool{}}
+}
+
+func (s *peerSet) sorted() ([]NetworkPeer, []string) {
+	var peers []NetworkPeer
+	for peer := range s.peers {
+		peers = append(peers, peer)
+	}
+	sort.Slice(peers, func(i, j int) bool {
+		return peers[i].Namespace+"/"+peers[i].Kind+"/"+peers[i].Name < peers[j].Namespace+"/"+peers[j].Kind+"/"+peers[j].Name
+	})
+	var ipBlocks []string
+	for ipBlock := range s.ipBlocks {
+		ipBlocks = append(ipBlocks, ipBlock)
+	}
+	sort.Strings(ipBlocks)
+	return peers, ipBlocks
+}
+
+// namespaceLabels returns the labels of the watched namespaces
+func (wh *WatchHandler) namespaceLabels() map[string]map[string]string {
+	result := map[string]map[string]string{}
+	for _, id := range wh.namespacedm.getIDs() {
+		front := wh.namespacedm.front(id)
+		if front == nil {
+			continue
+		}
+		if namespace, ok := front.Value.(*core.Namespace); ok {
+			result[namespace.Name] = namespace.Labels
+		}
+	}
+	return result
+}
+
+// reportIsolationChanges adds the changed microservices isolation to the report, returns true if any was added
+func (wh *WatchHandler) reportIsolationChanges(changes []isolationChange) bool {
+	for i := range changes {
+		wh.jsonReport.AddToJsonFormat(changes[i].data, ISOLATIONS, changes[i].stype)
+	}
+	return len(changes) > 0
+}
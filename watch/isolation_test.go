@@ -0,0 +1,81 @@
+package watch
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	core "k8s.io/api/core/v1"
+	networking "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestIsolationTracker(t *testing.T) {
+	wh := &WatchHandler{namespacedm: newResourceMap(), ids: newIDDataBase()}
+	wh.isolation = newIsolationTracker(wh.namespaceLabels)
+	addNamespace := func(name string, labels map[string]string) {
+		id := wh.ids.CreateID()
+		wh.namespacedm.init(id)
+		wh.namespacedm.pushBack(id, &core.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels}})
+	}
+	addNamespace("payments", nil)
+	addNamespace("monitoring", map[string]string{"team": "sre"})
+	pod := func(namespace, name, app string) *core.Pod {
+		return &core.Pod{ObjectMeta: metav1.ObjectMeta{UID: types.UID(namespace + "/" + name), Name: name, Namespace: namespace, Labels: map[string]string{"app": app}}}
+	}
+
+	changes := wh.isolation.observePod(pod("payments", "api-1", "api"), &OwnerDet{Kind: "Deployment", Name: "api"}, 0)
+	require.Len(t, changes, 1)
+	assert.Equal(t, NetworkIsolationData{PodSpecId: 0, Namespace: "payments", Kind: "Deployment", Name: "api"}, changes[0].data, "no policy applies")
+	wh.isolation.observePod(pod("payments", "web-1", "web"), &OwnerDet{Kind: "Deployment", Name: "web"}, 1)
+	wh.isolation.observePod(pod("monitoring", "prometheus-0", "prometheus"), &OwnerDet{Kind: "StatefulSet", Name: "prometheus"}, 2)
+
+	policy := &networking.NetworkPolicy{ObjectMeta: metav1.ObjectMeta{Name: "api-ingress", Namespace: "payments"},
+		Spec: networking.NetworkPolicySpec{
+			PodSelector: metav1.LabelSelector{MatchLabels: map[string]string{"app": "api"}},
+			Ingress: []networking.NetworkPolicyIngressRule{{From: []networking.NetworkPolicyPeer{
+				{PodSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}}},
+				{NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"team": "sre"}}},
+				{IPBlock: &networking.IPBlock{CIDR: "10.0.0.0/8"}},
+			}}},
+		}}
+	changes = wh.isolation.observePolicy(policy)
+	require.Len(t, changes, 1, "the policy does not select web")
+	assert.Equal(t, UPDATED, changes[0].stype)
+	assert.Equal(t, []string{"api-ingress"}, changes[0].data.Policies)
+	assert.Equal(t, NetworkIsolation{Isolated: true, Peers: []NetworkPeer{{Namespace: "monitoring"}, {Namespace: "payments", Kind: "Deployment", Name: "web"}},
+		IPBlocks: []string{"10.0.0.0/8"}}, changes[0].data.Ingress)
+	assert.False(t, changes[0].data.Egress.Isolated, "a policy without egress rules and policy types applies to ingress")
+
+	// the namespace selector is evaluated against the namespaces state
+	for _, id := range wh.namespacedm.getIDs() {
+		if namespace := wh.namespacedm.front(id).Value.(*core.Namespace); namespace.Name == "monitoring" {
+			wh.namespacedm.updateFront(id, &core.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "monitoring"}})
+		}
+	}
+	changes = wh.isolation.refreshNamespace()
+	require.Len(t, changes, 1)
+	assert.Equal(t, []NetworkPeer{{Namespace: "payments", Kind: "Deployment", Name: "web"}}, changes[0].data.Ingress.Peers)
+
+	// a deny all egress policy of the namespace
+	denyEgress := &networking.NetworkPolicy{ObjectMeta: metav1.ObjectMeta{Name: "deny-egress", Namespace: "payments"},
+		Spec: networking.NetworkPolicySpec{PolicyTypes: []networking.PolicyType{networking.PolicyTypeEgress}}}
+	changes = wh.isolation.observePolicy(denyEgress)
+	require.Len(t, changes, 2)
+	assert.Equal(t, []string{"api-ingress", "deny-egress"}, changes[0].data.Policies)
+	assert.Equal(t, NetworkIsolation{Isolated: true}, changes[1].data.Egress)
+	assert.False(t, changes[1].data.Ingress.Isolated)
+
+	// a peer pod leaving changes the allowed peers, the isolation of a microservice is removed with it
+	changes = wh.isolation.removePod(pod("payments", "web-1", "web"), true)
+	require.Len(t, changes, 2)
+	assert.Equal(t, DELETED, changes[0].stype)
+	assert.Equal(t, "web", changes[0].data.Name)
+	assert.Empty(t, changes[1].data.Ingress.Peers)
+
+	changes = wh.isolation.removePolicy(policy)
+	require.Len(t, changes, 1)
+	assert.Equal(t, []string{"deny-egress"}, changes[0].data.Policies)
+	assert.Empty(t, wh.isolation.removePod(pod("payments", "api-1", "api"), false), "the microservice is kept without pods")
+}
@@ -3,6 +3,7 @@ package watch
 import (
 	"context"
 	"encoding/json"
+	"sync"
 
 	"github.com/armosec/armoapi-go/armotypes"
 	"github.com/armosec/utils-k8s-go/armometadata"
@@ -15,14 +16,38 @@ type JsonType int
 type StateType int
 
 const (
-	NODE          JsonType = 1
-	SERVICES      JsonType = 2
-	MICROSERVICES JsonType = 3
-	PODS          JsonType = 4
-	SECRETS       JsonType = 5
-	NAMESPACES    JsonType = 6
+	NODE            JsonType = 1
+	SERVICES        JsonType = 2
+	MICROSERVICES   JsonType = 3
+	PODS            JsonType = 4
+	SECRETS         JsonType = 5
+	NAMESPACES      JsonType = 6
+	CRASHES         JsonType = 7
+	EVENTS          JsonType = 8
+	IMAGES          JsonType = 9
+	EXPOSURES       JsonType = 10
+	NETWORKPOLICIES JsonType = 11
+	ISOLATIONS      JsonType = 12
+	PERMISSIONS     JsonType = 13
 )
 
+// jsonTypeByName maps the report section names to their JsonType
+var jsonTypeByName = map[string]JsonType{
+	"node":             NODE,
+	"service":          SERVICES,
+	"microservice":     MICROSERVICES,
+	"pod":              PODS,
+	"secret":           SECRETS,
+	"namespace":        NAMESPACES,
+	"crash":            CRASHES,
+	"event":            EVENTS,
+	"image":            IMAGES,
+	"exposure":         EXPOSURES,
+	"networkPolicy":    NETWORKPOLICIES,
+	"networkIsolation": ISOLATIONS,
+	"permission":       PERMISSIONS,
+}
+
 const (
 	CREATED StateType = 1
 	DELETED StateType = 2
@@ -44,13 +69,26 @@ type jsonFormat struct {
 	FirstReport             bool                        `json:"firstReport"`
 	ClusterAPIServerVersion *version.Info               `json:"clusterAPIServerVersion,omitempty"`
 	CloudVendor             string                      `json:"cloudVendor,omitempty"`
+	CloudMetadata           *CloudMetadata              `json:"cloudMetadata,omitempty"`
+	ClusterInfoChange       *ClusterInfoChange          `json:"clusterInfoChange,omitempty"`
 	Nodes                   *ObjectData                 `json:"node,omitempty"`
 	Services                *ObjectData                 `json:"service,omitempty"`
 	MicroServices           *ObjectData                 `json:"microservice,omitempty"`
 	Pods                    *ObjectData                 `json:"pod,omitempty"`
 	Secret                  *ObjectData                 `json:"secret,omitempty"`
 	Namespace               *ObjectData                 `json:"namespace,omitempty"`
+	Crashes                 *ObjectData                 `json:"crash,omitempty"`
+	Events                  *ObjectData                 `json:"event,omitempty"`
+	Images                  *ObjectData                 `json:"image,omitempty"`
+	Exposures               *ObjectData                 `json:"exposure,omitempty"`
+	NetworkPolicies         *ObjectData                 `json:"networkPolicy,omitempty"`
+	NetworkIsolation        *ObjectData                 `json:"networkIsolation,omitempty"`
+	Permissions             *ObjectData                 `json:"permission,omitempty"`
 	InstallationData        *armotypes.InstallationData `json:"installationData,omitempty"`
+	// redactor is applied to every object added to the report
+	redactor *redactor
+	// mutex protects the report, the watchers add objects while the listener sends and clears it
+	mutex *sync.Mutex
 }
 
 func (obj *ObjectData) AddToJsonFormatByState(NewData interface{}, stype StateType) {
@@ -82,6 +120,11 @@ func (obj *ObjectData) Len() int {
 }
 
 func (jsonReport *jsonFormat) AddToJsonFormat(data interface{}, jtype JsonType, stype StateType) {
+	data, ok := jsonReport.redactor.redact(data, jtype)
+	if !ok {
+		return
+	}
+	defer jsonReport.lock()()
 	switch jtype {
 	case NODE:
 		if jsonReport.Nodes == nil {
@@ -113,23 +156,75 @@ func (jsonReport *jsonFormat) AddToJsonFormat(data interface{}, jtype JsonType,
 			jsonReport.Namespace = &ObjectData{}
 		}
 		jsonReport.Namespace.AddToJsonFormatByState(data, stype)
+	case CRASHES:
+		if jsonReport.Crashes == nil {
+			jsonReport.Crashes = &ObjectData{}
+		}
+		jsonReport.Crashes.AddToJsonFormatByState(data, stype)
+	case EVENTS:
+		if jsonReport.Events == nil {
+			jsonReport.Events = &ObjectData{}
+		}
+		jsonReport.Events.AddToJsonFormatByState(data, stype)
+	case IMAGES:
+		if jsonReport.Images == nil {
+			jsonReport.Images = &ObjectData{}
+		}
+		jsonReport.Images.AddToJsonFormatByState(data, stype)
+	case EXPOSURES:
+		if jsonReport.Exposures == nil {
+			jsonReport.Exposures = &ObjectData{}
+		}
+		jsonReport.Exposures.AddToJsonFormatByState(data, stype)
+	case NETWORKPOLICIES:
+		if jsonReport.NetworkPolicies == nil {
+			jsonReport.NetworkPolicies = &ObjectData{}
+		}
+		jsonReport.NetworkPolicies.AddToJsonFormatByState(data, stype)
+	case ISOLATIONS:
+		if jsonReport.NetworkIsolation == nil {
+			jsonReport.NetworkIsolation = &ObjectData{}
+		}
+		jsonReport.NetworkIsolation.AddToJsonFormatByState(data, stype)
+	case PERMISSIONS:
+		if jsonReport.Permissions == nil {
+			jsonReport.Permissions = &ObjectData{}
+		}
+		jsonReport.Permissions.AddToJsonFormatByState(data, stype)
 	}
 
 }
 
+// lock locks the report and returns the unlock function, a report that is not shared has no mutex
+func (jsonReport *jsonFormat) lock() func() {
+	if jsonReport.mutex == nil {
+		return func() {}
+	}
+	jsonReport.mutex.Lock()
+	return jsonReport.mutex.Unlock
+}
+
 func prepareDataToSend(ctx context.Context, wh *WatchHandler) []byte {
+	defer wh.jsonReport.lock()()
 	jsonReport := wh.jsonReport
-	if wh.clusterAPIServerVersion == nil {
+	clusterIdentity, loaded := wh.clusterInfo.Get()
+	if !loaded {
 		return nil
 	}
 	if *wh.getAggregateFirstDataFlag() {
-		setInstallationData(&jsonReport, *wh.config.ClusterConfig())
+		setInstallationData(&jsonReport, *wh.config.ClusterConfig(), clusterIdentity.Distribution)
 
-		jsonReport.ClusterAPIServerVersion = wh.clusterAPIServerVersion
-		jsonReport.CloudVendor = wh.cloudVendor
+		jsonReport.ClusterAPIServerVersion = clusterIdentity.reportedVersion()
+		jsonReport.CloudVendor = clusterIdentity.cloudVendor()
+		jsonReport.CloudMetadata = clusterIdentity.CloudMetadata
+		// the first report has the current identity
+		jsonReport.ClusterInfoChange = nil
+	} else if jsonReport.ClusterInfoChange != nil {
+		jsonReport.ClusterAPIServerVersion = jsonReport.ClusterInfoChange.Version
 	} else {
 		jsonReport.ClusterAPIServerVersion = nil
 		jsonReport.CloudVendor = ""
+		jsonReport.CloudMetadata = nil
 	}
 	if jsonReport.Nodes.Len() == 0 {
 		jsonReport.Nodes = nil
@@ -149,6 +244,27 @@ func prepareDataToSend(ctx context.Context, wh *WatchHandler) []byte {
 	if jsonReport.Namespace.Len() == 0 {
 		jsonReport.Namespace = nil
 	}
+	if jsonReport.Crashes.Len() == 0 {
+		jsonReport.Crashes = nil
+	}
+	if jsonReport.Events.Len() == 0 {
+		jsonReport.Events = nil
+	}
+	if jsonReport.Images.Len() == 0 {
+		jsonReport.Images = nil
+	}
+	if jsonReport.Exposures.Len() == 0 {
+		jsonReport.Exposures = nil
+	}
+	if jsonReport.NetworkPolicies.Len() == 0 {
+		jsonReport.NetworkPolicies = nil
+	}
+	if jsonReport.NetworkIsolation.Len() == 0 {
+		jsonReport.NetworkIsolation = nil
+	}
+	if jsonReport.Permissions.Len() == 0 {
+		jsonReport.Permissions = nil
+	}
 	jsonReportToSend, err := json.Marshal(jsonReport)
 	if nil != err {
 		logger.L().Ctx(ctx).Error("In PrepareDataToSend json.Marshal", helpers.Error(err))
@@ -170,15 +286,33 @@ func isEmptyFirstReport(jsonReportToSend []byte) bool {
 	return false
 }
 
-// WaitTillNewDataArrived -
-func WaitTillNewDataArrived(wh *WatchHandler) bool {
-	<-wh.informNewDataChannel
-	return true
+// WaitTillNewDataArrived returns false if the context is done first
+func WaitTillNewDataArrived(ctx context.Context, wh *WatchHandler) bool {
+	select {
+	case <-wh.informNewDataChannel:
+		return true
+	case change := <-wh.clusterInfoChanges:
+		unlock := wh.jsonReport.lock()
+		wh.jsonReport.ClusterInfoChange = change
+		unlock()
+		return true
+	case <-wh.firstReportRequests:
+		// the installation data and the cluster identity are sent again with the state
+		wh.aggregateFirstDataFlag = true
+		wh.SetFirstReportFlag(true)
+		return true
+	case <-ctx.Done():
+		return false
+	}
 }
 
+// informNewDataArrive waits for the listener, unless it stopped. The data is already in the report, so it is flushed anyway
 func informNewDataArrive(wh *WatchHandler) {
-	if !wh.aggregateFirstDataFlag || wh.clusterAPIServerVersion != nil {
-		wh.informNewDataChannel <- 1
+	if _, loaded := wh.clusterInfo.Get(); !wh.aggregateFirstDataFlag || loaded {
+		select {
+		case wh.informNewDataChannel <- 1:
+		case <-wh.stopped:
+		}
 	}
 }
 
@@ -186,9 +320,11 @@ func deleteObjectData(l *[]interface{}) {
 	*l = []interface{}{}
 }
 
+// deleteJsonData clears the report, the caller holds its mutex
 func deleteJsonData(wh *WatchHandler) {
 	jsonReport := &wh.jsonReport
 	// DO NOT DELETE jsonReport.ClusterAPIServerVersion data. it's not a subject to change
+	jsonReport.ClusterInfoChange = nil
 
 	if jsonReport.Nodes != nil {
 		deleteObjectData(&jsonReport.Nodes.Created)
@@ -225,9 +361,51 @@ func deleteJsonData(wh *WatchHandler) {
 		deleteObjectData(&jsonReport.Namespace.Deleted)
 		deleteObjectData(&jsonReport.Namespace.Updated)
 	}
+
+	if jsonReport.Crashes != nil {
+		deleteObjectData(&jsonReport.Crashes.Created)
+		deleteObjectData(&jsonReport.Crashes.Deleted)
+		deleteObjectData(&jsonReport.Crashes.Updated)
+	}
+
+	if jsonReport.Events != nil {
+		deleteObjectData(&jsonReport.Events.Created)
+		deleteObjectData(&jsonReport.Events.Deleted)
+		deleteObjectData(&jsonReport.Events.Updated)
+	}
+
+	if jsonReport.Images != nil {
+		deleteObjectData(&jsonReport.Images.Created)
+		deleteObjectData(&jsonReport.Images.Deleted)
+		deleteObjectData(&jsonReport.Images.Updated)
+	}
+
+	if jsonReport.Exposures != nil {
+		deleteObjectData(&jsonReport.Exposures.Created)
+		deleteObjectData(&jsonReport.Exposures.Deleted)
+		deleteObjectData(&jsonReport.Exposures.Updated)
+	}
+
+	if jsonReport.NetworkPolicies != nil {
+		deleteObjectData(&jsonReport.NetworkPolicies.Created)
+		deleteObjectData(&jsonReport.NetworkPolicies.Deleted)
+		deleteObjectData(&jsonReport.NetworkPolicies.Updated)
+	}
+
+	if jsonReport.NetworkIsolation != nil {
+		deleteObjectData(&jsonReport.NetworkIsolation.Created)
+		deleteObjectData(&jsonReport.NetworkIsolation.Deleted)
+		deleteObjectData(&jsonReport.NetworkIsolation.Updated)
+	}
+
+	if jsonReport.Permissions != nil {
+		deleteObjectData(&jsonReport.Permissions.Created)
+		deleteObjectData(&jsonReport.Permissions.Deleted)
+		deleteObjectData(&jsonReport.Permissions.Updated)
+	}
 }
 
-func setInstallationData(jsonReport *jsonFormat, config armometadata.ClusterConfig) {
+func setInstallationData(jsonReport *jsonFormat, config armometadata.ClusterConfig, distribution string) {
 	jsonReport.InstallationData = &armotypes.InstallationData{}
 	jsonReport.InstallationData.Namespace = config.Namespace
 	jsonReport.InstallationData.RelevantImageVulnerabilitiesEnabled = config.RelevantImageVulnerabilitiesEnabled
@@ -236,7 +414,7 @@ func setInstallationData(jsonReport *jsonFormat, config armometadata.ClusterConf
 	jsonReport.InstallationData.PostureScanEnabled = config.PostureScanEnabled
 	jsonReport.InstallationData.OtelCollectorEnabled = config.OtelCollectorEnabled
 	jsonReport.InstallationData.ClusterName = config.ClusterName
-	jsonReport.InstallationData.ClusterProvider = cloudProvider
+	jsonReport.InstallationData.ClusterProvider = distribution
 	jsonReport.InstallationData.RelevantImageVulnerabilitiesConfiguration = config.RelevantImageVulnerabilitiesConfiguration
 
 	logger.L().Debug("setting installation data", helpers.Interface("installation data", jsonReport.InstallationData))
@@ -43,8 +43,7 @@ func TestIsEmptyFirstReport(test *testing.T) {
 }
 
 func TestSetInstallationData(t *testing.T) {
-	// setting global provider value since it is taken from global variable instead of config
-	cloudProvider = "test"
+	distribution := "test"
 
 	trueBool := true
 	falseBool := false
@@ -129,7 +128,7 @@ func TestSetInstallationData(t *testing.T) {
 
 	for _, tc := range testCases {
 		jsonReport := &jsonFormat{}
-		setInstallationData(jsonReport, tc.config)
+		setInstallationData(jsonReport, tc.config, distribution)
 
 		if jsonReport.InstallationData.Namespace != tc.config.Namespace {
 			t.Errorf("Namespace is not equal")
@@ -156,7 +155,7 @@ func TestSetInstallationData(t *testing.T) {
 			t.Errorf("RelevantImageVulnerabilitiesConfiguration is not equal")
 		}
 
-		if jsonReport.InstallationData.ClusterProvider != cloudProvider {
+		if jsonReport.InstallationData.ClusterProvider != distribution {
 			t.Errorf("ClusterProvider is not equal")
 		}
 	}
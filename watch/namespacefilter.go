@@ -0,0 +1,222 @@
+package watch
+
+import (
+	"path"
+	"reflect"
+	"strings"
+	"sync"
+
+	logger "github.com/kubescape/go-logger"
+	"github.com/kubescape/go-logger/helpers"
+	"github.com/kubescape/kollector/config"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// namespaceLabelsGetter returns the labels of a namespace, used when the namespace watch did not report it yet
+type namespaceLabelsGetter func(name string) (map[string]string, error)
+
+// namespaceFilter decides which namespaces are watched. The namespace labels are kept up to date by the
+// namespace watch, so a label selector is re-evaluated as soon as the labels of a namespace change
+type namespaceFilter struct {
+	include   []string
+	exclude   []string
+	selector  labels.Selector
+	getLabels namespaceLabelsGetter
+	// namespace name -> namespace labels
+	namespaceLabels map[string]labels.Set
+	// mutex protects the filter settings as well as the namespace labels, since the filter may be reloaded
+	mutex sync.RWMutex
+}
+
+func newNamespaceFilter(filter config.NamespaceFilter, getLabels namespaceLabelsGetter) (*namespaceFilter, error) {
+	selector, err := parseNamespaceFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+	return &namespaceFilter{
+		include:         filter.Include,
+		exclude:         filter.Exclude,
+		selector:        selector,
+		getLabels:       getLabels,
+		namespaceLabels: make(map[string]labels.Set),
+	}, nil
+}
+
+func parseNamespaceFilter(filter config.NamespaceFilter) (labels.Selector, error) {
+	if err := filter.Validate(); err != nil {
+		return nil, err
+	}
+	return labels.Parse(filter.LabelSelector)
+}
+
+// update replaces the include and exclude globs and the label selector, the known namespace labels are kept.
+// Returns true if the filter changed
+func (nf *namespaceFilter) update(filter config.NamespaceFilter) (bool, error) {
+	if nf == nil {
+		return false, nil
+	}
+	selector, err := parseNamespaceFilter(filter)
+	if err != nil {
+		return false, err
+	}
+	nf.mutex.Lock()
+	defer nf.mutex.Unlock()
+	if reflect.DeepEqual(nf.include, filter.Include) && reflect.DeepEqual(nf.exclude, filter.Exclude) && nf.selector.String() == selector.String() {
+		return false, nil
+	}
+	nf.include = filter.Include
+	nf.exclude = filter.Exclude
+	nf.selector = selector
+	return true, nil
+}
+
+// isWatched returns true if objects of the namespace should be reported
+func (nf *namespaceFilter) isWatched(namespace string) bool {
+	if nf == nil {
+		return true
+	}
+	nf.mutex.RLock()
+	nameWatched := nf.isNameWatched(namespace)
+	selector := nf.selector
+	nf.mutex.RUnlock()
+	if !nameWatched {
+		return false
+	}
+	if selector.Empty() {
+		return true
+	}
+	namespaceLabels, ok := nf.labels(namespace)
+	if !ok {
+		return false
+	}
+	return selector.Matches(namespaceLabels)
+}
+
+// isNameWatched matches the namespace name against the include and exclude globs
+func (nf *namespaceFilter) isNameWatched(namespace string) bool {
+	for _, pattern := range nf.exclude {
+		if matched, _ := path.Match(pattern, namespace); matched {
+			return false
+		}
+	}
+	if len(nf.include) == 0 {
+		return true
+	}
+	for _, pattern := range nf.include {
+		if matched, _ := path.Match(pattern, namespace); matched {
+			return true
+		}
+	}
+	return false
+}
+
+func (nf *namespaceFilter) labels(namespace string) (labels.Set, bool) {
+	nf.mutex.RLock()
+	namespaceLabels, ok := nf.namespaceLabels[namespace]
+	nf.mutex.RUnlock()
+	if ok {
+		return namespaceLabels, true
+	}
+	if nf.getLabels == nil {
+		return nil, false
+	}
+	fetched, err := nf.getLabels(namespace)
+	if err != nil {
+		logger.L().Debug("failed to get namespace labels", helpers.String("namespace", namespace), helpers.Error(err))
+		return nil, false
+	}
+	nf.setLabels(namespace, fetched)
+	return labels.Set(fetched), true
+}
+
+// setLabels updates the labels of a namespace. Returns true if the namespace is watched, and true if its labels moved it
+// in or out of the label selector
+func (nf *namespaceFilter) setLabels(namespace string, namespaceLabels map[string]string) (bool, bool) {
+	if nf == nil {
+		return true, false
+	}
+	nf.mutex.Lock()
+	previous, known := nf.namespaceLabels[namespace]
+	nf.namespaceLabels[namespace] = labels.Set(namespaceLabels)
+	nameWatched := nf.isNameWatched(namespace)
+	selector := nf.selector
+	nf.mutex.Unlock()
+	if !nameWatched || selector.Empty() {
+		return nameWatched, false
+	}
+	watched := selector.Matches(labels.Set(namespaceLabels))
+	return watched, known && watched != selector.Matches(previous)
+}
+
+// removeLabels forgets the labels of a deleted namespace
+func (nf *namespaceFilter) removeLabels(namespace string) {
+	if nf == nil {
+		return
+	}
+	nf.mutex.Lock()
+	defer nf.mutex.Unlock()
+	delete(nf.namespaceLabels, namespace)
+}
+
+// watchNamespace returns the namespace to watch when a single namespace is included, otherwise all namespaces are watched
+func (nf *namespaceFilter) watchNamespace() string {
+	if nf == nil {
+		return ""
+	}
+	nf.mutex.RLock()
+	defer nf.mutex.RUnlock()
+	return nf.singleNamespace()
+}
+
+func (nf *namespaceFilter) singleNamespace() string {
+	if len(nf.include) != 1 || isGlob(nf.include[0]) {
+		return ""
+	}
+	return nf.include[0]
+}
+
+// listOptions returns the watch options of namespaced objects, the excluded namespaces are filtered by the API server
+func (nf *namespaceFilter) listOptions() metav1.ListOptions {
+	options := metav1.ListOptions{Watch: true}
+	if nf == nil {
+		return options
+	}
+	nf.mutex.RLock()
+	defer nf.mutex.RUnlock()
+	options.FieldSelector = fields.AndSelectors(nf.excludeSelectors("metadata.namespace")...).String()
+	return options
+}
+
+// namespaceListOptions returns the watch options of the namespaces watch. The label selector is matched client side, so
+// the label changes moving a namespace in or out of it are watched, rather than reported as added or deleted namespaces
+func (nf *namespaceFilter) namespaceListOptions() metav1.ListOptions {
+	options := metav1.ListOptions{Watch: true}
+	if nf == nil {
+		return options
+	}
+	nf.mutex.RLock()
+	defer nf.mutex.RUnlock()
+	selectors := nf.excludeSelectors("metadata.name")
+	if namespace := nf.singleNamespace(); namespace != "" {
+		selectors = append(selectors, fields.OneTermEqualSelector("metadata.name", namespace))
+	}
+	options.FieldSelector = fields.AndSelectors(selectors...).String()
+	return options
+}
+
+// excludeSelectors returns a field selector per excluded namespace, globs can only be matched client side
+func (nf *namespaceFilter) excludeSelectors(field string) []fields.Selector {
+	selectors := []fields.Selector{}
+	for _, pattern := range nf.exclude {
+		if !isGlob(pattern) {
+			selectors = append(selectors, fields.OneTermNotEqualSelector(field, pattern))
+		}
+	}
+	return selectors
+}
+
+func isGlob(pattern string) bool {
+	return strings.ContainsAny(pattern, "*?[\\")
+}
@@ -0,0 +1,142 @@
+package watch
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/kubescape/kollector/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNamespaceFilterIsWatched(t *testing.T) {
+	namespaces := map[string]map[string]string{
+		"default":     {"kubernetes.io/metadata.name": "default"},
+		"kube-system": {"kubernetes.io/metadata.name": "kube-system"},
+		"payments":    {"kubernetes.io/metadata.name": "payments", "team": "payments"},
+		"payments-qa": {"kubernetes.io/metadata.name": "payments-qa", "team": "payments"},
+		"kubescape":   {"kubernetes.io/metadata.name": "kubescape"},
+	}
+	getLabels := func(name string) (map[string]string, error) {
+		if l, ok := namespaces[name]; ok {
+			return l, nil
+		}
+		return nil, fmt.Errorf("namespace %s not found", name)
+	}
+
+	testCases := []struct {
+		name     string
+		filter   config.NamespaceFilter
+		expected []string
+	}{
+		{
+			name:     "no filter",
+			filter:   config.NamespaceFilter{},
+			expected: []string{"default", "kube-system", "payments", "payments-qa", "kubescape"},
+		},
+		{
+			name:     "exclude component namespace",
+			filter:   config.NamespaceFilter{Exclude: []string{"kubescape"}},
+			expected: []string{"default", "kube-system", "payments", "payments-qa"},
+		},
+		{
+			name:     "include globs",
+			filter:   config.NamespaceFilter{Include: []string{"payments*", "default"}},
+			expected: []string{"default", "payments", "payments-qa"},
+		},
+		{
+			name:     "exclude takes precedence",
+			filter:   config.NamespaceFilter{Include: []string{"payments*"}, Exclude: []string{"*-qa"}},
+			expected: []string{"payments"},
+		},
+		{
+			name:     "label selector",
+			filter:   config.NamespaceFilter{LabelSelector: "team=payments"},
+			expected: []string{"payments", "payments-qa"},
+		},
+		{
+			name:     "skip kube-system by label",
+			filter:   config.NamespaceFilter{LabelSelector: "kubernetes.io/metadata.name!=kube-system", Exclude: []string{"kubescape"}},
+			expected: []string{"default", "payments", "payments-qa"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			nf, err := newNamespaceFilter(tc.filter, getLabels)
+			assert.NoError(t, err)
+			watched := []string{}
+			for _, ns := range []string{"default", "kube-system", "payments", "payments-qa", "kubescape"} {
+				if nf.isWatched(ns) {
+					watched = append(watched, ns)
+				}
+			}
+			assert.Equal(t, tc.expected, watched)
+		})
+	}
+}
+
+func TestNamespaceFilterLabelsChange(t *testing.T) {
+	nf, err := newNamespaceFilter(config.NamespaceFilter{LabelSelector: "team=payments"}, nil)
+	assert.NoError(t, err)
+
+	assert.False(t, nf.isWatched("billing"), "unknown namespace should not be watched")
+
+	watched, changed := nf.setLabels("billing", map[string]string{"team": "payments"})
+	assert.True(t, watched)
+	assert.False(t, changed, "a new namespace is not a transition")
+	assert.True(t, nf.isWatched("billing"))
+
+	watched, changed = nf.setLabels("billing", map[string]string{"team": "finance"})
+	assert.False(t, watched)
+	assert.True(t, changed, "the labels moved the namespace out of the selector")
+	assert.False(t, nf.isWatched("billing"))
+	_, changed = nf.setLabels("billing", map[string]string{"team": "finance", "tier": "1"})
+	assert.False(t, changed)
+
+	nf.setLabels("billing", map[string]string{"team": "payments"})
+	nf.removeLabels("billing")
+	assert.False(t, nf.isWatched("billing"))
+}
+
+func TestNamespaceFilterListOptions(t *testing.T) {
+	nf, err := newNamespaceFilter(config.NamespaceFilter{Exclude: []string{"kube-system", "kube-*"}, LabelSelector: "team=payments"}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "", nf.watchNamespace())
+	assert.Equal(t, "metadata.namespace!=kube-system", nf.listOptions().FieldSelector)
+	assert.Equal(t, "metadata.name!=kube-system", nf.namespaceListOptions().FieldSelector)
+	assert.Empty(t, nf.namespaceListOptions().LabelSelector, "the label selector is matched client side")
+
+	nf, err = newNamespaceFilter(config.NamespaceFilter{Include: []string{"payments"}}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "payments", nf.watchNamespace())
+	assert.Equal(t, "metadata.name=payments", nf.namespaceListOptions().FieldSelector)
+
+	var nilFilter *namespaceFilter
+	assert.True(t, nilFilter.isWatched("default"))
+	assert.Equal(t, "", nilFilter.listOptions().FieldSelector)
+
+	_, err = newNamespaceFilter(config.NamespaceFilter{LabelSelector: "team in ("}, nil)
+	assert.Error(t, err)
+	_, err = newNamespaceFilter(config.NamespaceFilter{Include: []string{"[payments"}}, nil)
+	assert.Error(t, err)
+}
+
+func TestNamespaceFilterUpdate(t *testing.T) {
+	nf, err := newNamespaceFilter(config.NamespaceFilter{Exclude: []string{"kube-system"}}, nil)
+	assert.NoError(t, err)
+	nf.setLabels("payments", map[string]string{"team": "payments"})
+
+	changed, err := nf.update(config.NamespaceFilter{Exclude: []string{"kube-system"}})
+	assert.NoError(t, err)
+	assert.False(t, changed)
+
+	changed, err = nf.update(config.NamespaceFilter{LabelSelector: "team=payments"})
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	assert.True(t, nf.isWatched("payments"), "known namespace labels should be kept")
+	assert.Equal(t, "", nf.listOptions().FieldSelector)
+
+	changed, err = nf.update(config.NamespaceFilter{LabelSelector: "team in ("})
+	assert.Error(t, err)
+	assert.False(t, changed)
+	assert.Equal(t, "team=payments", nf.selector.String(), "an invalid filter should not replace the current one")
+}
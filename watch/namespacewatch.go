@@ -8,6 +8,7 @@ import (
 
 	logger "github.com/kubescape/go-logger"
 	"github.com/kubescape/go-logger/helpers"
+	"github.com/kubescape/kollector/config"
 	"golang.org/x/net/context"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -22,17 +23,18 @@ func (wh *WatchHandler) NamespaceWatch(ctx context.Context) {
 		}
 	}()
 	var lastWatchEventCreationTime time.Time
-	newStateChan := make(chan bool)
-	wh.newStateReportChans = append(wh.newStateReportChans, newStateChan)
+	newStateChan, unsubscribe := wh.subscribeNewState()
+	defer unsubscribe()
 WatchLoop:
-	for {
+	for ctx.Err() == nil {
 		logger.L().Info("Watching over namespaces starting")
-		namespacesWatcher, err := wh.RestAPIClient.CoreV1().Namespaces().Watch(globalHTTPContext, metav1.ListOptions{Watch: true})
+		namespacesWatcher, err := wh.RestAPIClient.CoreV1().Namespaces().Watch(ctx, wh.listOptions(config.NamespacesResource))
 		if err != nil {
 			logger.L().Ctx(ctx).Error("Failed watching over namespaces", helpers.Error(err))
 			time.Sleep(1 * time.Second)
 			continue
 		}
+		namespacesWatcher = wh.recorder.watch(config.NamespacesResource, namespacesWatcher)
 		namespacesChan := namespacesWatcher.ResultChan()
 		logger.L().Info("Watching over namespaces started")
 	ChanLoop:
@@ -40,8 +42,14 @@ WatchLoop:
 			var event watch.Event
 			select {
 			case event = <-namespacesChan:
-			case <-newStateChan:
+			case <-ctx.Done():
 				namespacesWatcher.Stop()
+				return
+			case newState := <-newStateChan:
+				namespacesWatcher.Stop()
+				if !newState {
+					lastWatchEventCreationTime = time.Now()
+				}
 				continue WatchLoop
 			}
 
@@ -63,23 +71,61 @@ func (wh *WatchHandler) NamespaceEventHandler(ctx context.Context, event *watch.
 		namespace.ManagedFields = []metav1.ManagedFieldsEntry{}
 		switch event.Type {
 		case watch.Added:
+			wh.namespaceFilter.setLabels(namespace.Name, namespace.Labels)
+			if !wh.isNamespaceWatched(namespace.Name) {
+				return nil
+			}
+			wh.objects.set("Namespace", "", namespace.Name, noPodSpecID)
 			if namespace.CreationTimestamp.Time.Before(lastWatchEventCreationTime) {
 				logger.L().Debug("namespace already exist, will not be reported", helpers.String("name", namespace.ObjectMeta.Name))
 				return nil
 			}
-			id := CreateID()
+			id := wh.ids.CreateID()
 			wh.namespacedm.init(id)
 			wh.namespacedm.pushBack(id, namespace)
-			informNewDataArrive(wh)
 			wh.jsonReport.AddToJsonFormat(namespace, NAMESPACES, CREATED)
+			wh.reportIsolationChanges(wh.isolation.refreshNamespace())
+			informNewDataArrive(wh)
+			if namespace.CreationTimestamp.Time.After(wh.startTime) {
+				wh.publishTrigger(ctx, TriggerEvent{Trigger: config.NewNamespaceTrigger, Name: namespace.Name})
+			}
 		case watch.Modified:
-			wh.UpdateNamespace(namespace)
+			watched, changed := wh.namespaceFilter.setLabels(namespace.Name, namespace.Labels)
+			switch {
+			case changed && watched:
+				// the labels moved the namespace into the label selector, it is reported with its objects
+				wh.objects.set("Namespace", "", namespace.Name, noPodSpecID)
+				id := wh.ids.CreateID()
+				wh.namespacedm.init(id)
+				wh.namespacedm.pushBack(id, namespace)
+				wh.jsonReport.AddToJsonFormat(namespace, NAMESPACES, CREATED)
+				wh.publishNamespaceResync(namespaceResync{namespace: namespace.Name, watched: true})
+			case changed:
+				// the labels moved the namespace out of the label selector, it is removed with its objects
+				wh.objects.remove("Namespace", "", namespace.Name, noPodSpecID)
+				wh.RemoveNamespace(namespace)
+				wh.jsonReport.AddToJsonFormat(namespace, NAMESPACES, DELETED)
+				wh.publishNamespaceResync(namespaceResync{namespace: namespace.Name, watched: false})
+			case watched:
+				wh.UpdateNamespace(namespace)
+				wh.jsonReport.AddToJsonFormat(namespace, NAMESPACES, UPDATED)
+			default:
+				return nil
+			}
+			wh.reportIsolationChanges(wh.isolation.refreshNamespace())
 			informNewDataArrive(wh)
-			wh.jsonReport.AddToJsonFormat(namespace, NAMESPACES, UPDATED)
 		case watch.Deleted:
+			// evaluated with the labels the namespace had before it was deleted
+			watched := wh.isNamespaceWatched(namespace.Name)
+			wh.namespaceFilter.removeLabels(namespace.Name)
+			wh.objects.remove("Namespace", "", namespace.Name, noPodSpecID)
+			if !watched {
+				return nil
+			}
 			wh.RemoveNamespace(namespace)
-			informNewDataArrive(wh)
 			wh.jsonReport.AddToJsonFormat(namespace, NAMESPACES, DELETED)
+			wh.reportIsolationChanges(wh.isolation.refreshNamespace())
+			informNewDataArrive(wh)
 		case watch.Bookmark: //only the resource version is changed but it's the same object
 			return nil
 		case watch.Error:
@@ -92,7 +138,7 @@ func (wh *WatchHandler) NamespaceEventHandler(ctx context.Context, event *watch.
 	return nil
 }
 
-// UpdateNamespace update websocket when namespace is updated
+// UpdateNamespace replaces the namespace in the namespaces state, e.g. with its new labels
 func (wh *WatchHandler) UpdateNamespace(namespace *corev1.Namespace) {
 	for _, id := range wh.namespacedm.getIDs() {
 		front := wh.namespacedm.front(id)
@@ -103,10 +149,11 @@ func (wh *WatchHandler) UpdateNamespace(namespace *corev1.Namespace) {
 		if !ok {
 			continue
 		}
-		if strings.Compare(namespaceData.Name, namespaceData.Name) != 0 {
+		if strings.Compare(namespaceData.Name, namespace.Name) != 0 {
 			continue
 		}
-
+		wh.namespacedm.updateFront(id, namespace)
+		return
 	}
 }
 
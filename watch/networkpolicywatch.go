@@ -0,0 +1,101 @@
+package watch
+
+import (
+	"context"
+	"runtime/debug"
+	"time"
+
+	logger "github.com/kubescape/go-logger"
+	"github.com/kubescape/go-logger/helpers"
+	"github.com/kubescape/kollector/config"
+	networking "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+// NetworkPolicyWatch watches the network policies, reports them and the isolation of the microservices they select
+func (wh *WatchHandler) NetworkPolicyWatch(ctx context.Context) {
+	defer func() {
+		if err := recover(); err != nil {
+			logger.L().Ctx(ctx).Error("RECOVER NetworkPolicyWatch", helpers.Interface("error", err), helpers.String("stack", string(debug.Stack())))
+		}
+	}()
+	var lastWatchEventCreationTime time.Time
+	newStateChan, unsubscribe := wh.subscribeNewState()
+	defer unsubscribe()
+	for ctx.Err() == nil {
+		logger.L().Info("Watching over network policies starting")
+		policyWatcher, err := wh.RestAPIClient.NetworkingV1().NetworkPolicies(wh.namespaceFilter.watchNamespace()).Watch(ctx, wh.listOptions(config.NetworkPoliciesResource))
+		if err != nil {
+			logger.L().Ctx(ctx).Warning("Failed watching over network policies", helpers.Error(err))
+			time.Sleep(1 * time.Second)
+			lastWatchEventCreationTime = time.Now()
+			continue
+		}
+		policyWatcher = wh.recorder.watch(config.NetworkPoliciesResource, policyWatcher)
+		wh.handleNetworkPolicyWatch(ctx, policyWatcher, newStateChan, &lastWatchEventCreationTime)
+	}
+}
+
+// handleNetworkPolicyWatch reports the network policies created since the last watch, every policy is evaluated
+// but only the isolation changes are reported
+func (wh *WatchHandler) handleNetworkPolicyWatch(ctx context.Context, policyWatcher watch.Interface, newStateChan <-chan bool, lastWatchEventCreationTime *time.Time) {
+	policyChan := policyWatcher.ResultChan()
+	for {
+		var event watch.Event
+		var chanActive bool
+		select {
+		case event, chanActive = <-policyChan:
+			if !chanActive {
+				policyWatcher.Stop()
+				*lastWatchEventCreationTime = time.Now()
+				return
+			}
+		case <-ctx.Done():
+			policyWatcher.Stop()
+			return
+		case newState := <-newStateChan:
+			policyWatcher.Stop()
+			if !newState {
+				*lastWatchEventCreationTime = time.Now()
+			}
+			return
+		}
+		if event.Type == watch.Error {
+			logger.L().Ctx(ctx).Error("network policies watch chan loop", helpers.Interface("error", event.Object))
+			policyWatcher.Stop()
+			*lastWatchEventCreationTime = time.Now()
+			return
+		}
+		policy, ok := event.Object.(*networking.NetworkPolicy)
+		if !ok {
+			logger.L().Ctx(ctx).Error("Watch error: cannot convert to networking.NetworkPolicy", helpers.Interface("error", event))
+			continue
+		}
+		if !wh.isNamespaceWatched(policy.Namespace) {
+			continue
+		}
+		policy.ManagedFields = []metav1.ManagedFieldsEntry{}
+		reported := false
+		var changes []isolationChange
+		switch event.Type {
+		case watch.Added:
+			changes = wh.isolation.observePolicy(policy)
+			if !policy.CreationTimestamp.Time.Before(*lastWatchEventCreationTime) {
+				wh.jsonReport.AddToJsonFormat(policy, NETWORKPOLICIES, CREATED)
+				reported = true
+			}
+		case watch.Modified:
+			changes = wh.isolation.observePolicy(policy)
+			wh.jsonReport.AddToJsonFormat(policy, NETWORKPOLICIES, UPDATED)
+			reported = true
+		case watch.Deleted:
+			changes = wh.isolation.removePolicy(policy)
+			wh.jsonReport.AddToJsonFormat(policy, NETWORKPOLICIES, DELETED)
+			reported = true
+		}
+		if wh.reportIsolationChanges(changes) || reported {
+			informNewDataArrive(wh)
+		}
+	}
+}
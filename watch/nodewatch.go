@@ -8,10 +8,10 @@ import (
 
 	logger "github.com/kubescape/go-logger"
 	"github.com/kubescape/go-logger/helpers"
+	"github.com/kubescape/kollector/config"
 	"golang.org/x/net/context"
 	core "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/version"
 	"k8s.io/apimachinery/pkg/watch"
 )
 
@@ -80,31 +80,29 @@ func (wh *WatchHandler) NodeWatch(ctx context.Context) {
 		}
 	}()
 	var lastWatchEventCreationTime time.Time
-	newStateChan := make(chan bool)
-	wh.newStateReportChans = append(wh.newStateReportChans, newStateChan)
-	for {
-		wh.clusterAPIServerVersion = wh.getClusterVersion()
-		wh.cloudVendor = wh.checkInstanceMetadataAPIVendor()
-		if wh.cloudVendor != "" {
-			wh.clusterAPIServerVersion.GitVersion += ";" + wh.cloudVendor
-		}
-		logger.L().Info("K8s Cloud Vendor", helpers.String("cloudVendor", wh.cloudVendor))
+	newStateChan, unsubscribe := wh.subscribeNewState()
+	defer unsubscribe()
+	for ctx.Err() == nil {
 		logger.L().Info("Watching over nodes starting")
-		nodesWatcher, err := wh.RestAPIClient.CoreV1().Nodes().Watch(globalHTTPContext, metav1.ListOptions{Watch: true})
+		nodesWatcher, err := wh.RestAPIClient.CoreV1().Nodes().Watch(ctx, wh.listOptions(config.NodesResource))
 		if err != nil {
 			time.Sleep(1 * time.Second)
 			continue
 		}
-		wh.handleNodeWatch(nodesWatcher, newStateChan, &lastWatchEventCreationTime)
+		nodesWatcher = wh.recorder.watch(config.NodesResource, nodesWatcher)
+		wh.handleNodeWatch(ctx, nodesWatcher, newStateChan, &lastWatchEventCreationTime)
 
 	}
 }
-func (wh *WatchHandler) handleNodeWatch(nodesWatcher watch.Interface, newStateChan <-chan bool, lastWatchEventCreationTime *time.Time) {
+func (wh *WatchHandler) handleNodeWatch(ctx context.Context, nodesWatcher watch.Interface, newStateChan <-chan bool, lastWatchEventCreationTime *time.Time) {
 	nodesChan := nodesWatcher.ResultChan()
 	for {
 		var event watch.Event
 		select {
 		case event = <-nodesChan:
+		case <-ctx.Done():
+			nodesWatcher.Stop()
+			return
 		case <-newStateChan:
 			nodesWatcher.Stop()
 			*lastWatchEventCreationTime = time.Now()
@@ -119,10 +117,11 @@ func (wh *WatchHandler) handleNodeWatch(nodesWatcher watch.Interface, newStateCh
 			node.ManagedFields = []metav1.ManagedFieldsEntry{}
 			switch event.Type {
 			case watch.Added:
+				wh.objects.set("Node", "", node.Name, noPodSpecID)
 				if node.CreationTimestamp.Time.Before(*lastWatchEventCreationTime) {
 					continue
 				}
-				id := CreateID()
+				id := wh.ids.CreateID()
 				if wh.ndm[id] == nil {
 					wh.ndm[id] = list.New()
 				}
@@ -130,16 +129,20 @@ func (wh *WatchHandler) handleNodeWatch(nodesWatcher watch.Interface, newStateCh
 					NodeStatus: node.Status,
 				}
 				wh.ndm[id].PushBack(nd)
-				informNewDataArrive(wh)
 				wh.jsonReport.AddToJsonFormat(nd, NODE, CREATED)
+				informNewDataArrive(wh)
+				if node.CreationTimestamp.Time.After(wh.startTime) {
+					wh.publishTrigger(ctx, TriggerEvent{Trigger: config.NewNodeTrigger, Kind: "Node", Name: node.Name})
+				}
 			case watch.Modified:
 				updateNode := UpdateNode(node, wh.ndm)
-				informNewDataArrive(wh)
 				wh.jsonReport.AddToJsonFormat(updateNode, NODE, UPDATED)
+				informNewDataArrive(wh)
 			case watch.Deleted:
+				wh.objects.remove("Node", "", node.Name, noPodSpecID)
 				name := RemoveNode(node, wh.ndm)
-				informNewDataArrive(wh)
 				wh.jsonReport.AddToJsonFormat(name, NODE, DELETED)
+				informNewDataArrive(wh)
 			case watch.Bookmark: //only the resource version is changed but it's the same workload
 				continue
 			case watch.Error:
@@ -152,17 +155,3 @@ func (wh *WatchHandler) handleNodeWatch(nodesWatcher watch.Interface, newStateCh
 		}
 	}
 }
-
-func (wh *WatchHandler) checkInstanceMetadataAPIVendor() string {
-	res, _ := getInstanceMetadata()
-	return res
-}
-
-func (wh *WatchHandler) getClusterVersion() *version.Info {
-	serverVersion, err := wh.RestAPIClient.Discovery().ServerVersion()
-	if err != nil {
-		serverVersion = &version.Info{GitVersion: "Unknown"}
-	}
-	logger.L().Info("K8s API version", helpers.Interface("version", serverVersion))
-	return serverVersion
-}
@@ -0,0 +1,42 @@
+package watch
+
+import "net/http"
+
+// Option configures the WatchHandler created by CreateWatchHandler
+type Option func(*options)
+
+type options struct {
+	clients          Clients
+	httpClient       *http.Client
+	instanceMetadata func(vendor string) (*CloudMetadata, error)
+}
+
+func newOptions(opts ...Option) *options {
+	result := &options{}
+	for i := range opts {
+		opts[i](result)
+	}
+	return result
+}
+
+// WithClients sets the clients used to reach the API server, the clients that are not set are created from the kubeconfig
+func WithClients(clients Clients) Option {
+	return func(o *options) {
+		o.clients = clients
+	}
+}
+
+// WithHTTPClient sets the HTTP client used to notify the in-cluster components about new images
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(o *options) {
+		o.httpClient = httpClient
+	}
+}
+
+// WithInstanceMetadata sets how the node metadata is read, by default the instance metadata API of each vendor is queried.
+// The vendor is the one of the node providerIDs, empty when unknown
+func WithInstanceMetadata(instanceMetadata func(vendor string) (*CloudMetadata, error)) Option {
+	return func(o *options) {
+		o.instanceMetadata = instanceMetadata
+	}
+}
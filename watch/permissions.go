@@ -0,0 +1,424 @@
+package watch
+
+import (
+	"reflect"
+	"sort"
+	"sync"
+
+	core "k8s.io/api/core/v1"
+	rbac "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// dangerous grants of a rule
+const (
+	// DangerousWildcardVerbs is a rule granting every verb
+	DangerousWildcardVerbs = "wildcardVerbs"
+	// DangerousSecretsRead is a rule reading the secrets
+	DangerousSecretsRead = "secretsRead"
+	// DangerousPodsExec is a rule running commands in the containers
+	DangerousPodsExec = "podsExec"
+	// DangerousPrivilegeEscalation is a rule escalating, binding or impersonating
+	DangerousPrivilegeEscalation = "privilegeEscalation"
+)
+
+const defaultServiceAccount = "default"
+
+// WorkloadPermissionsData is the service account the pods of a microservice run as, and the rules it is granted
+type WorkloadPermissionsData struct {
+	PodSpecId      int    `json:"podSpecId"`
+	Namespace      string `json:"namespace"`
+	Kind           string `json:"kind"`
+	Name           string `json:"name"`
+	ServiceAccount string `json:"serviceAccount"`
+	// AutomountToken is false when the token of the service account is not mounted, by the pod spec or the service account
+	AutomountToken bool             `json:"automountToken"`
+	Rules          []PermissionRule `json:"rules,omitempty"`
+	// Dangerous are the dangerous grants of the rules
+	Dangerous []string `json:"dangerous,omitempty"`
+}
+
+// PermissionRule is a rule granted to a service account, and the role and the binding granting it
+type PermissionRule struct {
+	// Namespace is where the rule applies, it is empty for the cluster wide rules
+	Namespace       string   `json:"namespace,omitempty"`
+	Role            string   `json:"role"`
+	Binding         string   `json:"binding"`
+	APIGroups       []string `json:"apiGroups,omitempty"`
+	Resources       []string `json:"resources,omitempty"`
+	ResourceNames   []string `json:"resourceNames,omitempty"`
+	NonResourceURLs []string `json:"nonResourceURLs,omitempty"`
+	Verbs           []string `json:"verbs"`
+	Dangerous       []string `json:"dangerous,omitempty"`
+}
+
+type permissionsMicroService struct {
+	namespace      string
+	kind           string
+	name           string
+	serviceAccount string
+	// automount is the automountServiceAccountToken of the pod spec
+	automount *bool
+	pods      map[types.UID]bool
+}
+
+// permissionsChange is a microservice permissions to report
+type permissionsChange struct {
+	data  WorkloadPermissionsData
+	stype StateType
+}
+
+// permissionsTracker maps the microservices to the rules granted to their service account. It is fed by the pods watch
+// and the RBAC and service accounts watches
+type permissionsTracker struct {
+	// roles, role bindings and service accounts are keyed by namespace/name, the cluster roles and bindings by name
+	roles               map[string]*rbac.Role
+	clusterRoles        map[string]*rbac.ClusterRole
+	roleBindings        map[string]*rbac.RoleBinding
+	clusterRoleBindings map[string]*rbac.ClusterRoleBinding
+	serviceAccounts     map[string]*core.ServiceAccount
+	// pods is the pod uid -> the id of its microservice
+	pods          map[types.UID]int
+	microServices map[int]*permissionsMicroService
+	// reported is the microservice id -> its last reported permissions
+	reported map[int]WorkloadPermissionsData
+	mutex    sync.Mutex
+}
+
+func newPermissionsTracker() *permissionsTracker {
+	return &permissionsTracker{
+		roles:               make(map[string]*rbac.Role),
+		clusterRoles:        make(map[string]*rbac.ClusterRole),
+		roleBindings:        make(map[string]*rbac.RoleBinding),
+		clusterRoleBindings: make(map[string]*rbac.ClusterRoleBinding),
+		serviceAccounts:     make(map[string]*core.ServiceAccount),
+		pods:                make(map[types.UID]int),
+		microServices:       make(map[int]*permissionsMicroService),
+		reported:            make(map[int]WorkloadPermissionsData),
+	}
+}
+
+func (t *permissionsTracker) reset() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.roles = make(map[string]*rbac.Role)
+	t.clusterRoles = make(map[string]*rbac.ClusterRole)
+	t.roleBindings = make(map[string]*rbac.RoleBinding)
+	t.clusterRoleBindings = make(map[string]*rbac.ClusterRoleBinding)
+	t.serviceAccounts = make(map[string]*core.ServiceAccount)
+	t.pods = make(map[types.UID]int)
+	t.microServices = make(map[int]*permissionsMicroService)
+	t.reported = make(map[int]WorkloadPermissionsData)
+}
+
+// observePod updates the service account of the microservice of the pod
+func (t *permissionsTracker) observePod(pod *core.Pod, od *OwnerDet, podSpecID int) []permissionsChange {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if previousID, ok := t.pods[pod.UID]; ok && previousID != podSpecID {
+		if previous, ok := t.microServices[previousID]; ok {
+			delete(previous.pods, pod.UID)
+		}
+	}
+	t.pods[pod.UID] = podSpecID
+	ms, ok := t.microServices[podSpecID]
+	if !ok {
+		ms = &permissionsMicroService{pods: map[types.UID]bool{}}
+		t.microServices[podSpecID] = ms
+	}
+	ms.pods[pod.UID] = true
+	ms.namespace, ms.kind, ms.name = pod.Namespace, od.Kind, od.Name
+	ms.serviceAccount = defaultString(pod.Spec.ServiceAccountName, defaultServiceAccount)
+	ms.automount = pod.Spec.AutomountServiceAccountToken
+	return t.refresh(func(id int, _ *permissionsMicroService) bool { return id == podSpecID })
+}
+
+// removePod removes the pod, the permissions of its microservice are removed with the microservice
+func (t *permissionsTracker) removePod(pod *core.Pod, microServiceRemoved bool) []permissionsChange {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	podSpecID, ok := t.pods[pod.UID]
+	if !ok {
+		return nil
+	}
+	delete(t.pods, pod.UID)
+	if ms, ok := t.microServices[podSpecID]; ok {
+		delete(ms.pods, pod.UID)
+	}
+	if !microServiceRemoved {
+		return nil
+	}
+	delete(t.microServices, podSpecID)
+	reported, ok := t.reported[podSpecID]
+	if !ok {
+		return nil
+	}
+	delete(t.reported, podSpecID)
+	return []permissionsChange{{data: reported, stype: DELETED}}
+}
+
+func (t *permissionsTracker) observeServiceAccount(serviceAccount *core.ServiceAccount, deleted bool) []permissionsChange {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	key := namespacedName(serviceAccount.Namespace, serviceAccount.Name)
+	if deleted {
+		delete(t.serviceAccounts, key)
+	} else {
+		t.serviceAccounts[key] = serviceAccount
+	}
+	return t.refresh(func(_ int, ms *permissionsMicroService) bool {
+		return ms.namespace == serviceAccount.Namespace && ms.serviceAccount == serviceAccount.Name
+	})
+}
+
+// observeRole updates a role, the microservices bound to it are evaluated again
+func (t *permissionsTracker) observeRole(role *rbac.Role, deleted bool) []permissionsChange {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	key := namespacedName(role.Namespace, role.Name)
+	if deleted {
+		delete(t.roles, key)
+	} else {
+		t.roles[key] = role
+	}
+	return t.refresh(func(_ int, ms *permissionsMicroService) bool {
+		for _, binding := range t.roleBindings {
+			if binding.Namespace == role.Namespace && binding.RoleRef.Kind == "Role" && binding.RoleRef.Name == role.Name &&
+				subjectsMatch(binding.Subjects, binding.Namespace, ms) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+func (t *permissionsTracker) observeClusterRole(role *rbac.ClusterRole, deleted bool) []permissionsChange {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if deleted {
+		delete(t.clusterRoles, role.Name)
+	} else {
+		t.clusterRoles[role.Name] = role
+	}
+	return t.refresh(func(_ int, ms *permissionsMicroService) bool {
+		for _, binding := range t.clusterRoleBindings {
+			if binding.RoleRef.Name == role.Name && subjectsMatch(binding.Subjects, "", ms) {
+				return true
+			}
+		}
+		for _, binding := range t.roleBindings {
+			if binding.RoleRef.Kind == "ClusterRole" && binding.RoleRef.Name == role.Name && subjectsMatch(binding.Subjects, binding.Namespace, ms) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// observeRoleBinding updates a role binding, the microservices of its previous and current subjects are evaluated again
+func (t *permissionsTracker) observeRoleBinding(binding *rbac.RoleBinding, deleted bool) []permissionsChange {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	key := namespacedName(binding.Namespace, binding.Name)
+	subjects := append([]rbac.Subject{}, binding.Subjects...)
+	if previous, ok := t.roleBindings[key]; ok {
+		subjects = append(subjects, previous.Subjects...)
+	}
+	if deleted {
+		delete(t.roleBindings, key)
+	} else {
+		t.roleBindings[key] = binding
+	}
+	return t.refresh(func(_ int, ms *permissionsMicroService) bool { return subjectsMatch(subjects, binding.Namespace, ms) })
+}
+
+func (t *permissionsTracker) observeClusterRoleBinding(binding *rbac.ClusterRoleBinding, deleted bool) []permissionsChange {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	subjects := append([]rbac.Subject{}, binding.Subjects...)
+	if previous, ok := t.clusterRoleBindings[binding.Name]; ok {
+		subjects = append(subjects, previous.Subjects...)
+	}
+	if deleted {
+		delete(t.clusterRoleBindings, binding.Name)
+	} else {
+		t.clusterRoleBindings[binding.Name] = binding
+	}
+	return t.refresh(func(_ int, ms *permissionsMicroService) bool { return subjectsMatch(subjects, "", ms) })
+}
+
+// refresh evaluates the affected microservices and returns those whose permissions are new or changed
+func (t *permissionsTracker) refresh(affected func(id int, ms *permissionsMicroService) bool) []permissionsChange {
+	ids := []int{}
+	for id, ms := range t.microServices {
+		if affected(id, ms) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Ints(ids)
+	changes := []permissionsChange{}
+	for _, id := range ids {
+		current := t.evaluate(id, t.microServices[id])
+		previous, reported := t.reported[id]
+		switch {
+		case !reported:
+			changes = append(changes, permissionsChange{data: current, stype: CREATED})
+		case !reflect.DeepEqual(previous, current):
+			changes = append(changes, permissionsChange{data: current, stype: UPDATED})
+		default:
+			continue
+		}
+		t.reported[id] = current
+	}
+	return changes
+}
+
+// evaluate returns the rules granted to the service account of the microservice, by the cluster role bindings and by
+// the role bindings of every namespace
+func (t *permissionsTracker) evaluate(id int, ms *permissionsMicroService) WorkloadPermissionsData {
+	data := WorkloadPermissionsData{PodSpecId: id, Namespace: ms.namespace, Kind: ms.kind, Name: ms.name, ServiceAccount: ms.serviceAccount, AutomountToken: true}
+	if ms.automount != nil {
+		data.AutomountToken = *ms.automount
+	} else if serviceAccount, ok := t.serviceAccounts[namespacedName(ms.namespace, ms.serviceAccount)]; ok && serviceAccount.AutomountServiceAccountToken != nil {
+		data.AutomountToken = *serviceAccount.AutomountServiceAccountToken
+	}
+
+	for _, binding := range t.clusterRoleBindings {
+		if subjectsMatch(binding.Subjects, "", ms) {
+			data.Rules = append(data.Rules, t.grantedRules(binding.RoleRef, "", "ClusterRoleBinding/"+binding.Name)...)
+		}
+	}
+	for _, binding := range t.roleBindings {
+		if subjectsMatch(binding.Subjects, binding.Namespace, ms) {
+			data.Rules = append(data.Rules, t.grantedRules(binding.RoleRef, binding.Namespace, "RoleBinding/"+namespacedName(binding.Namespace, binding.Name))...)
+		}
+	}
+	sort.SliceStable(data.Rules, func(i, j int) bool {
+		return data.Rules[i].Namespace+"/"+data.Rules[i].Binding < data.Rules[j].Namespace+"/"+data.Rules[j].Binding
+	})
+	dangerous := []string{}
+	for i := range data.Rules {
+		dangerous = append(dangerous, data.Rules[i].Dangerous...)
+	}
+	data.Dangerous = uniqueSorted(dangerous)
+	return data
+}
+
+// grantedRules returns the rules of the role a binding refers to, a role that is not known yet grants nothing
+func (t *permissionsTracker) grantedRules(roleRef rbac.RoleRef, namespace, binding string) []PermissionRule {
+	var rules []rbac.PolicyRule
+	var role string
+	switch roleRef.Kind {
+	case "Role":
+		if namespacedRole, ok := t.roles[namespacedName(namespace, roleRef.Name)]; ok {
+			rules = namespacedRole.Rules
+		}
+		role = "Role/" + namespacedName(namespace, roleRef.Name)
+	case "ClusterRole":
+		if clusterRole, ok := t.clusterRoles[roleRef.Name]; ok {
+			rules = clusterRole.Rules
+		}
+		role = "ClusterRole/" + roleRef.Name
+	}
+	result := make([]PermissionRule, 0, len(rules))
+	for _, rule := range rules {
+		result = append(result, PermissionRule{
+			Namespace:       namespace,
+			Role:            role,
+			Binding:         binding,
+			APIGroups:       rule.APIGroups,
+			Resources:       rule.Resources,
+			ResourceNames:   rule.ResourceNames,
+			NonResourceURLs: rule.NonResourceURLs,
+			Verbs:           rule.Verbs,
+			Dangerous:       dangerousGrants(&rule),
+		})
+	}
+	return result
+}
+
+// subjectsMatch returns true if a subject is the service account of the microservice, its user or one of its groups.
+// The namespace of a service account subject defaults to the namespace of the binding
+func subjectsMatch(subjects []rbac.Subject, bindingNamespace string, ms *permissionsMicroService) bool {
+	for _, subject := range subjects {
+		switch subject.Kind {
+		case rbac.ServiceAccountKind:
+			if defaultString(subject.Namespace, bindingNamespace) == ms.namespace && subject.Name == ms.serviceAccount {
+				return true
+			}
+		case rbac.UserKind:
+			if subject.Name == "system:serviceaccount:"+ms.namespace+":"+ms.serviceAccount {
+				return true
+			}
+		case rbac.GroupKind:
+			switch subject.Name {
+			case "system:serviceaccounts", "system:serviceaccounts:" + ms.namespace, "system:authenticated":
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// dangerousGrants returns the dangerous grants of a rule
+func dangerousGrants(rule *rbac.PolicyRule) []string {
+	grants := []string{}
+	if contains(rule.Verbs, rbac.VerbAll) {
+		grants = append(grants, DangerousWildcardVerbs)
+	}
+	coreGroup := contains(rule.APIGroups, "") || contains(rule.APIGroups, rbac.APIGroupAll)
+	if coreGroup && matchesResource(rule.Resources, "secrets") && matchesVerb(rule.Verbs, "get", "list", "watch") {
+		grants = append(grants, DangerousSecretsRead)
+	}
+	if coreGroup && matchesResource(rule.Resources, "pods/exec") && matchesVerb(rule.Verbs, "create", "get") {
+		grants = append(grants, DangerousPodsExec)
+	}
+	if matchesVerb(rule.Verbs, "escalate", "bind", "impersonate") {
+		grants = append(grants, DangerousPrivilegeEscalation)
+	}
+	if len(grants) == 0 {
+		return nil
+	}
+	return grants
+}
+
+// matchesResource returns true if the resources include the resource, e.g. "pods/exec" is matched by "pods/*" or "*"
+func matchesResource(resources []string, resource string) bool {
+	for _, r := range resources {
+		if r == resource || r == rbac.ResourceAll {
+			return true
+		}
+		for i := range resource {
+			if resource[i] == '/' && r == resource[:i]+"/*" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func matchesVerb(verbs []string, wanted ...string) bool {
+	for _, verb := range wanted {
+		if contains(verbs, verb) {
+			return true
+		}
+	}
+	return contains(verbs, rbac.VerbAll)
+}
+
+func contains(values []string, value string) bool {
+	for i := range values {
+		if values[i] == value {
+			return true
+		}
+	}
+	return false
+}
+
+// reportPermissionsChanges adds the changed microservices permissions to the report, returns true if any was added
+func (wh *WatchHandler) reportPermissionsChanges(changes []permissionsChange) bool {
+	for i := range changes {
+		wh.jsonReport.AddToJsonFormat(changes[i].data, PERMISSIONS, changes[i].stype)
+	}
+	return len(changes) > 0
+}
@@ -0,0 +1,134 @@
+package watch
+
+import (
+	"context"
+	"testing"
+
+	"github.com/armosec/utils-k8s-go/armometadata"
+	"github.com/kubescape/backend/pkg/utils"
+	"github.com/kubescape/kollector/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	core "k8s.io/api/core/v1"
+	rbac "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestPermissionsTracker(t *testing.T) {
+	tracker := newPermissionsTracker()
+	pod := &core.Pod{ObjectMeta: metav1.ObjectMeta{UID: types.UID("api-1"), Name: "api-1", Namespace: "payments"},
+		Spec: core.PodSpec{ServiceAccountName: "api"}}
+	changes := tracker.observePod(pod, &OwnerDet{Kind: "Deployment", Name: "api"}, 0)
+	require.Len(t, changes, 1)
+	assert.Equal(t, WorkloadPermissionsData{PodSpecId: 0, Namespace: "payments", Kind: "Deployment", Name: "api", ServiceAccount: "api", AutomountToken: true},
+		changes[0].data, "no binding applies")
+
+	// a binding of a role that is not known yet grants nothing
+	binding := &rbac.RoleBinding{ObjectMeta: metav1.ObjectMeta{Name: "api", Namespace: "payments"},
+		Subjects: []rbac.Subject{{Kind: rbac.ServiceAccountKind, Name: "api"}},
+		RoleRef:  rbac.RoleRef{Kind: "Role", Name: "secrets-reader"}}
+	assert.Empty(t, tracker.observeRoleBinding(binding, false))
+	changes = tracker.observeRole(&rbac.Role{ObjectMeta: metav1.ObjectMeta{Name: "secrets-reader", Namespace: "payments"},
+		Rules: []rbac.PolicyRule{{APIGroups: []string{""}, Resources: []string{"secrets"}, Verbs: []string{"get", "list"}}}}, false)
+	require.Len(t, changes, 1)
+	assert.Equal(t, UPDATED, changes[0].stype)
+	assert.Equal(t, []PermissionRule{{Namespace: "payments", Role: "Role/payments/secrets-reader", Binding: "RoleBinding/payments/api",
+		APIGroups: []string{""}, Resources: []string{"secrets"}, Verbs: []string{"get", "list"}, Dangerous: []string{DangerousSecretsRead}}}, changes[0].data.Rules)
+	assert.Equal(t, []string{DangerousSecretsRead}, changes[0].data.Dangerous)
+
+	// a cluster role bound to every service account applies cluster wide, another service account is not affected
+	assert.Empty(t, tracker.observeClusterRoleBinding(&rbac.ClusterRoleBinding{ObjectMeta: metav1.ObjectMeta{Name: "monitoring"},
+		Subjects: []rbac.Subject{{Kind: rbac.ServiceAccountKind, Name: "prometheus", Namespace: "monitoring"}},
+		RoleRef:  rbac.RoleRef{Kind: "ClusterRole", Name: "admin"}}, false))
+	assert.Empty(t, tracker.observeClusterRole(&rbac.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: "admin"},
+		Rules: []rbac.PolicyRule{{APIGroups: []string{"*"}, Resources: []string{"*"}, Verbs: []string{"*"}}}}, false))
+	debug := &rbac.ClusterRoleBinding{ObjectMeta: metav1.ObjectMeta{Name: "debug"},
+		Subjects: []rbac.Subject{{Kind: rbac.GroupKind, Name: "system:serviceaccounts:payments"}},
+		RoleRef:  rbac.RoleRef{Kind: "ClusterRole", Name: "admin"}}
+	changes = tracker.observeClusterRoleBinding(debug, false)
+	require.Len(t, changes, 1)
+	require.Len(t, changes[0].data.Rules, 2)
+	assert.Equal(t, "", changes[0].data.Rules[0].Namespace)
+	assert.Equal(t, "ClusterRoleBinding/debug", changes[0].data.Rules[0].Binding)
+	assert.Equal(t, []string{DangerousPodsExec, DangerousPrivilegeEscalation, DangerousSecretsRead, DangerousWildcardVerbs}, changes[0].data.Dangerous)
+
+	changes = tracker.observeClusterRoleBinding(debug, true)
+	require.Len(t, changes, 1)
+	assert.Len(t, changes[0].data.Rules, 1)
+
+	// the service account disables the token mount, the permissions are removed with the microservice
+	automount := false
+	changes = tracker.observeServiceAccount(&core.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "api", Namespace: "payments"},
+		AutomountServiceAccountToken: &automount}, false)
+	require.Len(t, changes, 1)
+	assert.False(t, changes[0].data.AutomountToken)
+	assert.Empty(t, tracker.removePod(pod, false), "the microservice is kept without pods")
+	tracker.observePod(pod, &OwnerDet{Kind: "Deployment", Name: "api"}, 0)
+	changes = tracker.removePod(pod, true)
+	require.Len(t, changes, 1)
+	assert.Equal(t, DELETED, changes[0].stype)
+}
+
+func TestDangerousGrants(t *testing.T) {
+	assert.Nil(t, dangerousGrants(&rbac.PolicyRule{APIGroups: []string{""}, Resources: []string{"pods"}, Verbs: []string{"get", "list"}}))
+	assert.Nil(t, dangerousGrants(&rbac.PolicyRule{APIGroups: []string{"apps"}, Resources: []string{"secrets"}, Verbs: []string{"get"}}),
+		"secrets are in the core group")
+	assert.Equal(t, []string{DangerousPodsExec}, dangerousGrants(&rbac.PolicyRule{APIGroups: []string{""}, Resources: []string{"pods/*"}, Verbs: []string{"create"}}))
+	assert.Equal(t, []string{DangerousPrivilegeEscalation}, dangerousGrants(&rbac.PolicyRule{APIGroups: []string{"rbac.authorization.k8s.io"},
+		Resources: []string{"clusterroles"}, Verbs: []string{"bind"}}))
+}
+
+func TestHandleRBACEventNamespaces(t *testing.T) {
+	settings := config.DefaultSettings()
+	settings.NamespaceFilter = config.NamespaceFilter{Include: []string{"payments"}}
+	kollectorConfig := config.NewKollectorConfig(&armometadata.ClusterConfig{ClusterName: "test"}, utils.Credentials{}, "").SetSettings(settings)
+	wh, err := newWatchHandlerWithClients(kollectorConfig, Clients{KubernetesClient: fake.NewSimpleClientset()})
+	require.NoError(t, err)
+	ctx := context.Background()
+	pod := &core.Pod{ObjectMeta: metav1.ObjectMeta{UID: types.UID("api-1"), Name: "api-1", Namespace: "payments"},
+		Spec: core.PodSpec{ServiceAccountName: "api"}}
+	wh.permissions.observePod(pod, &OwnerDet{Kind: "Deployment", Name: "api"}, 0)
+
+	// a binding of a namespace that is not watched grants the rules of its role to a watched service account
+	assert.Empty(t, wh.handleRBACEvent(ctx, watch.Event{Type: watch.Added, Object: &rbac.Role{ObjectMeta: metav1.ObjectMeta{Name: "reader", Namespace: "ops"},
+		Rules: []rbac.PolicyRule{{APIGroups: []string{""}, Resources: []string{"configmaps"}, Verbs: []string{"get"}}}}}))
+	binding := &rbac.RoleBinding{ObjectMeta: metav1.ObjectMeta{Name: "api-reader", Namespace: "ops"},
+		Subjects: []rbac.Subject{{Kind: rbac.ServiceAccountKind, Name: "api", Namespace: "payments"}},
+		RoleRef:  rbac.RoleRef{Kind: "Role", Name: "reader"}}
+	changes := wh.handleRBACEvent(ctx, watch.Event{Type: watch.Added, Object: binding})
+	require.Len(t, changes, 1)
+	require.Len(t, changes[0].data.Rules, 1)
+	assert.Equal(t, "ops", changes[0].data.Rules[0].Namespace)
+	assert.Equal(t, "Role/ops/reader", changes[0].data.Rules[0].Role)
+
+	// the bindings of the unwatched service accounts and the unwatched service accounts are ignored
+	assert.Empty(t, wh.handleRBACEvent(ctx, watch.Event{Type: watch.Added, Object: &rbac.RoleBinding{ObjectMeta: metav1.ObjectMeta{Name: "ops", Namespace: "ops"},
+		Subjects: []rbac.Subject{{Kind: rbac.ServiceAccountKind, Name: "ops"}}, RoleRef: rbac.RoleRef{Kind: "Role", Name: "reader"}}}))
+	assert.Empty(t, wh.handleRBACEvent(ctx, watch.Event{Type: watch.Added, Object: &core.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "ops", Namespace: "ops"}}}))
+	assert.NotContains(t, wh.permissions.roleBindings, namespacedName("ops", "ops"))
+	assert.NotContains(t, wh.permissions.serviceAccounts, namespacedName("ops", "ops"))
+
+	// a binding whose subjects are no longer watched is forgotten
+	modified := binding.DeepCopy()
+	modified.Subjects = []rbac.Subject{{Kind: rbac.ServiceAccountKind, Name: "ops"}}
+	changes = wh.handleRBACEvent(ctx, watch.Event{Type: watch.Modified, Object: modified})
+	require.Len(t, changes, 1)
+	assert.Empty(t, changes[0].data.Rules)
+	assert.NotContains(t, wh.permissions.roleBindings, namespacedName("ops", "api-reader"))
+}
+
+func TestSubjectsWatched(t *testing.T) {
+	nf, err := newNamespaceFilter(config.NamespaceFilter{Include: []string{"payments"}}, nil)
+	require.NoError(t, err)
+	wh := &WatchHandler{namespaceFilter: nf}
+	assert.True(t, wh.subjectsWatched([]rbac.Subject{{Kind: rbac.ServiceAccountKind, Name: "api"}}, "payments"))
+	assert.False(t, wh.subjectsWatched([]rbac.Subject{{Kind: rbac.ServiceAccountKind, Name: "api"}}, "ops"))
+	assert.True(t, wh.subjectsWatched([]rbac.Subject{{Kind: rbac.UserKind, Name: "system:serviceaccount:payments:api"}}, "ops"))
+	assert.False(t, wh.subjectsWatched([]rbac.Subject{{Kind: rbac.UserKind, Name: "alice"}}, "ops"))
+	assert.True(t, wh.subjectsWatched([]rbac.Subject{{Kind: rbac.GroupKind, Name: "system:serviceaccounts:payments"}}, "ops"))
+	assert.False(t, wh.subjectsWatched([]rbac.Subject{{Kind: rbac.GroupKind, Name: "system:serviceaccounts:ops"}}, "ops"))
+	assert.True(t, wh.subjectsWatched([]rbac.Subject{{Kind: rbac.GroupKind, Name: "system:authenticated"}}, "ops"))
+}
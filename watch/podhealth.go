@@ -0,0 +1,190 @@
+package watch
+
+import (
+	"container/list"
+	"reflect"
+
+	core "k8s.io/api/core/v1"
+)
+
+// HealthReason classifies why a pod or a container is not healthy
+type HealthReason string
+
+const (
+	HealthReasonOOMKilled                  HealthReason = "OOMKilled"
+	HealthReasonError                      HealthReason = "Error"
+	HealthReasonCrashLoopBackOff           HealthReason = "CrashLoopBackOff"
+	HealthReasonImagePullBackOff           HealthReason = "ImagePullBackOff"
+	HealthReasonCreateContainerConfigError HealthReason = "CreateContainerConfigError"
+	HealthReasonProbeFailure               HealthReason = "ProbeFailure"
+	HealthReasonEvicted                    HealthReason = "Evicted"
+	HealthReasonPreempted                  HealthReason = "Preempted"
+	HealthReasonUnschedulable              HealthReason = "Unschedulable"
+)
+
+// ContainerHealth is the health of a container, Reason is empty when the container is healthy or starting
+type ContainerHealth struct {
+	Name          string       `json:"name"`
+	InitContainer bool         `json:"initContainer,omitempty"`
+	Ready         bool         `json:"ready"`
+	RestartCount  int32        `json:"restartCount"`
+	Reason        HealthReason `json:"reason,omitempty"`
+	Message       string       `json:"message,omitempty"`
+	// LastTerminationReason is the reason of the previous termination, e.g. OOMKilled for a container in CrashLoopBackOff
+	LastTerminationReason string `json:"lastTerminationReason,omitempty"`
+}
+
+// PodHealth is the health of a pod and of its containers. Reason is the pod level failure, e.g. Unschedulable
+type PodHealth struct {
+	Healthy    bool              `json:"healthy"`
+	Reason     HealthReason      `json:"reason,omitempty"`
+	Message    string            `json:"message,omitempty"`
+	Containers []ContainerHealth `json:"containers,omitempty"`
+}
+
+// MicroServiceHealth aggregates the health of the pods of a microservice
+type MicroServiceHealth struct {
+	Pods        int `json:"pods"`
+	HealthyPods int `json:"healthyPods"`
+	// Reasons counts the pods by failure, a pod is counted once for each of its reasons
+	Reasons map[HealthReason]int `json:"reasons,omitempty"`
+}
+
+// getPodHealth classifies the failures of the pod and of each of its containers
+func getPodHealth(pod *core.Pod) PodHealth {
+	health := PodHealth{Healthy: true}
+	health.Reason, health.Message = getPodFailure(pod)
+
+	probes := map[string]bool{}
+	for i := range pod.Spec.Containers {
+		probes[pod.Spec.Containers[i].Name] = pod.Spec.Containers[i].ReadinessProbe != nil
+	}
+	for i := range pod.Status.InitContainerStatuses {
+		containerHealth := getContainerHealth(&pod.Status.InitContainerStatuses[i], false)
+		containerHealth.InitContainer = true
+		health.Containers = append(health.Containers, containerHealth)
+	}
+	for i := range pod.Status.ContainerStatuses {
+		status := &pod.Status.ContainerStatuses[i]
+		health.Containers = append(health.Containers, getContainerHealth(status, probes[status.Name]))
+	}
+
+	if health.Reason != "" {
+		health.Healthy = false
+	}
+	for i := range health.Containers {
+		if health.Containers[i].Reason != "" {
+			health.Healthy = false
+		}
+	}
+	return health
+}
+
+// getPodFailure returns the failures that are not specific to a container: eviction, preemption and scheduling
+func getPodFailure(pod *core.Pod) (HealthReason, string) {
+	switch pod.Status.Reason {
+	case "Evicted":
+		return HealthReasonEvicted, pod.Status.Message
+	case "Preempting":
+		return HealthReasonPreempted, pod.Status.Message
+	}
+	for i := range pod.Status.Conditions {
+		condition := &pod.Status.Conditions[i]
+		switch {
+		case condition.Type == core.DisruptionTarget && condition.Status == core.ConditionTrue && condition.Reason == "PreemptionByScheduler":
+			return HealthReasonPreempted, condition.Message
+		case condition.Type == core.PodScheduled && condition.Status == core.ConditionFalse && condition.Reason == core.PodReasonUnschedulable:
+			return HealthReasonUnschedulable, condition.Message
+		}
+	}
+	return "", ""
+}
+
+func getContainerHealth(status *core.ContainerStatus, hasReadinessProbe bool) ContainerHealth {
+	health := ContainerHealth{Name: status.Name, Ready: status.Ready, RestartCount: status.RestartCount}
+	if terminated := status.LastTerminationState.Terminated; terminated != nil {
+		health.LastTerminationReason = terminated.Reason
+	}
+	switch {
+	case status.State.Waiting != nil:
+		health.Reason = classifyWaitingReason(status.State.Waiting.Reason)
+		health.Message = status.State.Waiting.Message
+	case status.State.Terminated != nil:
+		terminated := status.State.Terminated
+		if terminated.Reason == "Completed" || (terminated.Reason == "" && terminated.ExitCode == 0) {
+			break
+		}
+		health.Reason = HealthReasonError
+		if terminated.Reason == string(HealthReasonOOMKilled) {
+			health.Reason = HealthReasonOOMKilled
+		}
+		health.Message = terminated.Message
+	case status.State.Running != nil:
+		// a started container that is not ready fails its readiness probe
+		if !status.Ready && hasReadinessProbe && (status.Started == nil || *status.Started) {
+			health.Reason = HealthReasonProbeFailure
+		}
+	}
+	return health
+}
+
+// classifyWaitingReason returns the failure of a waiting container, or an empty reason when it is starting
+func classifyWaitingReason(reason string) HealthReason {
+	switch reason {
+	case "", "ContainerCreating", "PodInitializing":
+		return ""
+	case "ImagePullBackOff", "ErrImagePull", "InvalidImageName", "ErrImageNeverPull":
+		return HealthReasonImagePullBackOff
+	case "CreateContainerConfigError":
+		return HealthReasonCreateContainerConfigError
+	case "CrashLoopBackOff":
+		return HealthReasonCrashLoopBackOff
+	}
+	// e.g. CreateContainerError or RunContainerError
+	return HealthReason(reason)
+}
+
+// getMicroServiceHealth aggregates the health of the pods of the microservice list
+func getMicroServiceHealth(pods *list.List) *MicroServiceHealth {
+	health := &MicroServiceHealth{}
+	for element := pods.Front(); element != nil; element = element.Next() {
+		podData, ok := element.Value.(PodDataForExistMicroService)
+		if !ok {
+			continue
+		}
+		health.Pods++
+		if podData.Health.Healthy {
+			health.HealthyPods++
+			continue
+		}
+		reasons := map[HealthReason]bool{podData.Health.Reason: true}
+		for i := range podData.Health.Containers {
+			reasons[podData.Health.Containers[i].Reason] = true
+		}
+		delete(reasons, "")
+		for reason := range reasons {
+			if health.Reasons == nil {
+				health.Reasons = map[HealthReason]int{}
+			}
+			health.Reasons[reason]++
+		}
+	}
+	return health
+}
+
+// refreshMicroServiceHealth updates the aggregated health of the microservice. Returns true if the failures of its pods changed,
+// scaling healthy pods is not a change worth a report
+func (wh *WatchHandler) refreshMicroServiceHealth(id int) bool {
+	pods := wh.pdm[id]
+	if pods == nil || pods.Front() == nil {
+		return false
+	}
+	microService, ok := pods.Front().Value.(MicroServiceData)
+	if !ok {
+		return false
+	}
+	previous := microService.Health
+	microService.Health = getMicroServiceHealth(pods)
+	pods.Front().Value = microService
+	return previous != nil && !reflect.DeepEqual(previous.Reasons, microService.Health.Reasons)
+}
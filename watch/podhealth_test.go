@@ -0,0 +1,114 @@
+package watch
+
+import (
+	"container/list"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	core "k8s.io/api/core/v1"
+)
+
+func TestGetPodHealth(t *testing.T) {
+	running := core.ContainerState{Running: &core.ContainerStateRunning{}}
+	waiting := func(reason string) core.ContainerState {
+		return core.ContainerState{Waiting: &core.ContainerStateWaiting{Reason: reason, Message: reason + " message"}}
+	}
+	started := true
+	tests := []struct {
+		name     string
+		pod      core.Pod
+		expected PodHealth
+	}{
+		{
+			name: "running",
+			pod: core.Pod{Status: core.PodStatus{Phase: core.PodRunning,
+				ContainerStatuses: []core.ContainerStatus{{Name: "api", Ready: true, State: running}}}},
+			expected: PodHealth{Healthy: true, Containers: []ContainerHealth{{Name: "api", Ready: true}}},
+		},
+		{
+			name: "crashing sidecar",
+			pod: core.Pod{Status: core.PodStatus{Phase: core.PodRunning, ContainerStatuses: []core.ContainerStatus{
+				{Name: "api", Ready: true, State: running},
+				{Name: "proxy", RestartCount: 4, State: waiting("CrashLoopBackOff"),
+					LastTerminationState: core.ContainerState{Terminated: &core.ContainerStateTerminated{ExitCode: 137, Reason: "OOMKilled"}}},
+			}}},
+			expected: PodHealth{Containers: []ContainerHealth{{Name: "api", Ready: true},
+				{Name: "proxy", RestartCount: 4, Reason: HealthReasonCrashLoopBackOff, Message: "CrashLoopBackOff message", LastTerminationReason: "OOMKilled"}}},
+		},
+		{
+			name: "terminated",
+			pod: core.Pod{Status: core.PodStatus{ContainerStatuses: []core.ContainerStatus{
+				{Name: "oom", State: core.ContainerState{Terminated: &core.ContainerStateTerminated{ExitCode: 137, Reason: "OOMKilled"}}},
+				{Name: "error", State: core.ContainerState{Terminated: &core.ContainerStateTerminated{ExitCode: 1, Reason: "Error"}}},
+				{Name: "done", State: core.ContainerState{Terminated: &core.ContainerStateTerminated{Reason: "Completed"}}},
+			}}},
+			expected: PodHealth{Containers: []ContainerHealth{{Name: "oom", Reason: HealthReasonOOMKilled}, {Name: "error", Reason: HealthReasonError}, {Name: "done"}}},
+		},
+		{
+			name: "waiting",
+			pod: core.Pod{Status: core.PodStatus{
+				InitContainerStatuses: []core.ContainerStatus{{Name: "init", State: waiting("ErrImagePull")}},
+				ContainerStatuses: []core.ContainerStatus{
+					{Name: "config", State: waiting("CreateContainerConfigError")},
+					{Name: "creating", State: waiting("ContainerCreating")},
+				}}},
+			expected: PodHealth{Containers: []ContainerHealth{
+				{Name: "init", InitContainer: true, Reason: HealthReasonImagePullBackOff, Message: "ErrImagePull message"},
+				{Name: "config", Reason: HealthReasonCreateContainerConfigError, Message: "CreateContainerConfigError message"},
+				{Name: "creating", Message: "ContainerCreating message"},
+			}},
+		},
+		{
+			name: "readiness probe failure",
+			pod: core.Pod{
+				Spec: core.PodSpec{Containers: []core.Container{{Name: "api", ReadinessProbe: &core.Probe{}}, {Name: "worker"}}},
+				Status: core.PodStatus{ContainerStatuses: []core.ContainerStatus{
+					{Name: "api", Started: &started, State: running},
+					{Name: "worker", Started: &started, State: running},
+				}}},
+			expected: PodHealth{Containers: []ContainerHealth{{Name: "api", Reason: HealthReasonProbeFailure}, {Name: "worker"}}},
+		},
+		{
+			name:     "evicted",
+			pod:      core.Pod{Status: core.PodStatus{Phase: core.PodFailed, Reason: "Evicted", Message: "The node was low on resource: memory."}},
+			expected: PodHealth{Reason: HealthReasonEvicted, Message: "The node was low on resource: memory."},
+		},
+		{
+			name: "preempted",
+			pod: core.Pod{Status: core.PodStatus{Conditions: []core.PodCondition{
+				{Type: core.DisruptionTarget, Status: core.ConditionTrue, Reason: "PreemptionByScheduler", Message: "preempted by critical/pod"}}}},
+			expected: PodHealth{Reason: HealthReasonPreempted, Message: "preempted by critical/pod"},
+		},
+		{
+			name: "unschedulable",
+			pod: core.Pod{Status: core.PodStatus{Phase: core.PodPending, Conditions: []core.PodCondition{{Type: core.PodScheduled, Status: core.ConditionFalse,
+				Reason: core.PodReasonUnschedulable, Message: "0/3 nodes are available: 3 Insufficient cpu."}}}},
+			expected: PodHealth{Reason: HealthReasonUnschedulable, Message: "0/3 nodes are available: 3 Insufficient cpu."},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, getPodHealth(&tt.pod))
+		})
+	}
+}
+
+func TestRefreshMicroServiceHealth(t *testing.T) {
+	healthy := PodHealth{Healthy: true}
+	crashing := PodHealth{Containers: []ContainerHealth{{Name: "api", Reason: HealthReasonCrashLoopBackOff}, {Name: "proxy", Reason: HealthReasonCrashLoopBackOff}}}
+	wh := &WatchHandler{pdm: map[int]*list.List{1: list.New()}}
+	pods := wh.pdm[1]
+	pods.PushBack(MicroServiceData{PodSpecId: 1})
+	pods.PushBack(PodDataForExistMicroService{PodName: "api-1", Health: healthy})
+	assert.False(t, wh.refreshMicroServiceHealth(1), "the first health is reported with the microservice")
+
+	pods.PushBack(PodDataForExistMicroService{PodName: "api-2", Health: healthy})
+	assert.False(t, wh.refreshMicroServiceHealth(1), "scaling is not a health change")
+	assert.Equal(t, &MicroServiceHealth{Pods: 2, HealthyPods: 2}, pods.Front().Value.(MicroServiceData).Health)
+
+	pods.Back().Value = PodDataForExistMicroService{PodName: "api-2", Health: crashing}
+	assert.True(t, wh.refreshMicroServiceHealth(1))
+	assert.Equal(t, &MicroServiceHealth{Pods: 2, HealthyPods: 1, Reasons: map[HealthReason]int{HealthReasonCrashLoopBackOff: 1}},
+		pods.Front().Value.(MicroServiceData).Health)
+	assert.False(t, wh.refreshMicroServiceHealth(2), "unknown microservice")
+}
@@ -5,7 +5,6 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"io"
 	"reflect"
 	"runtime/debug"
 	"strings"
@@ -13,9 +12,7 @@ import (
 
 	logger "github.com/kubescape/go-logger"
 	"github.com/kubescape/go-logger/helpers"
-	"go.opentelemetry.io/otel"
-	"go.opentelemetry.io/otel/attribute"
-	"go.opentelemetry.io/otel/trace"
+	"github.com/kubescape/kollector/config"
 	appsv1 "k8s.io/api/apps/v1"
 	batchv1 "k8s.io/api/batch/v1"
 	"k8s.io/api/batch/v1beta1"
@@ -23,6 +20,7 @@ import (
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/watch"
 )
 
@@ -41,8 +39,9 @@ type OwnerDetNameAndKindOnly struct {
 
 type MicroServiceData struct {
 	*core.Pod `json:",inline"`
-	Owner     OwnerDet `json:"uptreeOwner"`
-	PodSpecId int      `json:"podSpecId"`
+	Owner     OwnerDet            `json:"uptreeOwner"`
+	PodSpecId int                 `json:"podSpecId"`
+	Health    *MicroServiceHealth `json:"health,omitempty"`
 }
 
 type PodDataForExistMicroService struct {
@@ -52,6 +51,7 @@ type PodDataForExistMicroService struct {
 	Namespace         string                  `json:"namespace,omitempty"`
 	Owner             OwnerDetNameAndKindOnly `json:"uptreeOwner"`
 	PodStatus         string                  `json:"podStatus"`
+	Health            PodHealth               `json:"health"`
 	CreationTimestamp string                  `json:"startedAt"`
 	DeletionTimestamp string                  `json:"terminatedAt,omitempty"`
 }
@@ -62,12 +62,6 @@ type ScanNewImageData struct {
 	PodsNumber int
 }
 
-var (
-	collectorCreationTime         time.Time
-	scanNotificationCandidateList []*ScanNewImageData
-	maxTailLines                  int64 = 50 // Max number of lines to return from the end of the log of a crashed container
-)
-
 // PodWatch - an infinite loop which will observe changes in pods and acts accordingly
 func (wh *WatchHandler) PodWatch(ctx context.Context) {
 	defer func() {
@@ -76,21 +70,24 @@ func (wh *WatchHandler) PodWatch(ctx context.Context) {
 		}
 	}()
 	var lastWatchEventCreationTime time.Time
-	collectorCreationTime = time.Now()
-	newStateChan := make(chan bool)
-	wh.newStateReportChans = append(wh.newStateReportChans, newStateChan)
-	for {
+	wh.collectorCreationTime = time.Now()
+	newStateChan, unsubscribe := wh.subscribeNewState()
+	defer unsubscribe()
+	resyncChan, unsubscribeResync := wh.subscribeNamespaceResync()
+	defer unsubscribeResync()
+	for ctx.Err() == nil {
 		logger.L().Ctx(ctx).Info("Watching over pods starting")
-		podsWatcher, err := wh.RestAPIClient.CoreV1().Pods("").Watch(globalHTTPContext, metav1.ListOptions{Watch: true})
+		podsWatcher, err := wh.RestAPIClient.CoreV1().Pods(wh.namespaceFilter.watchNamespace()).Watch(ctx, wh.listOptions(config.PodsResource))
 		if err != nil {
 			time.Sleep(1 * time.Second)
 			continue
 		}
-		wh.handlePodWatch(ctx, podsWatcher, newStateChan, &lastWatchEventCreationTime)
+		podsWatcher = wh.recorder.watch(config.PodsResource, podsWatcher)
+		wh.handlePodWatch(ctx, podsWatcher, newStateChan, resyncChan, &lastWatchEventCreationTime)
 	}
 }
-func isPodAlreadyExistInScanCandidateList(ctx context.Context, od *OwnerDet, pod *core.Pod) (bool, int) {
-	for i, data := range scanNotificationCandidateList {
+func (wh *WatchHandler) isPodAlreadyExistInScanCandidateList(ctx context.Context, od *OwnerDet, pod *core.Pod) (bool, int) {
+	for i, data := range wh.scanNotificationCandidateList {
 		if pod.GetNamespace() == data.Pod.GetNamespace() && data.Owner.Name == od.Name && data.Owner.Kind == od.Kind {
 			logger.L().Ctx(ctx).Debug("pod already exist", helpers.String("name", pod.Name))
 			return true, i
@@ -99,76 +96,95 @@ func isPodAlreadyExistInScanCandidateList(ctx context.Context, od *OwnerDet, pod
 	return false, -1
 }
 
-func addPodScanNotificationCandidateList(ctx context.Context, od *OwnerDet, pod *core.Pod) {
-	if exist, index := isPodAlreadyExistInScanCandidateList(ctx, od, pod); !exist {
+func (wh *WatchHandler) addPodScanNotificationCandidateList(ctx context.Context, od *OwnerDet, pod *core.Pod) {
+	if exist, index := wh.isPodAlreadyExistInScanCandidateList(ctx, od, pod); !exist {
 		logger.L().Debug("pod added to scan list candidate", helpers.String("name", pod.Name))
 		nms := &ScanNewImageData{Pod: pod, Owner: od, PodsNumber: 1}
-		scanNotificationCandidateList = append(scanNotificationCandidateList, nms)
+		wh.scanNotificationCandidateList = append(wh.scanNotificationCandidateList, nms)
 	} else {
-		scanNotificationCandidateList[index].PodsNumber++
+		wh.scanNotificationCandidateList[index].PodsNumber++
 	}
 }
 
-func removePodScanNotificationCandidateList(od *OwnerDet, pod *core.Pod) {
-	for i := range scanNotificationCandidateList {
-		data := scanNotificationCandidateList[i]
+func (wh *WatchHandler) removePodScanNotificationCandidateList(od *OwnerDet, pod *core.Pod) {
+	for i := range wh.scanNotificationCandidateList {
+		data := wh.scanNotificationCandidateList[i]
 		if pod.GetNamespace() == data.Pod.GetNamespace() && data.Owner.Name == od.Name && data.Owner.Kind == od.Kind {
-			scanNotificationCandidateList[i].PodsNumber--
-			if scanNotificationCandidateList[i].PodsNumber == 0 {
+			wh.scanNotificationCandidateList[i].PodsNumber--
+			if wh.scanNotificationCandidateList[i].PodsNumber == 0 {
 				logger.L().Debug("pod removed from scan list candidate", helpers.String("name", pod.Name))
-				scanNotificationCandidateList = append(scanNotificationCandidateList[:i], scanNotificationCandidateList[i+1:]...)
+				wh.scanNotificationCandidateList = append(wh.scanNotificationCandidateList[:i], wh.scanNotificationCandidateList[i+1:]...)
 				return
 			}
 		}
 	}
 }
 
-func isContainersIDSChanged(podWithNewState []core.ContainerStatus, oldPod []core.ContainerStatus) bool {
-	if len(podWithNewState) > len(oldPod) {
-		return true
+// checkNotificationCandidateList returns the images that changed since the candidate pod of the workload, the pod
+// becomes the candidate when it has changes. The pods older than the candidate, e.g. of the previous rollout, are ignored
+func (wh *WatchHandler) checkNotificationCandidateList(pod *core.Pod, od *OwnerDet, podStatus string) []ContainerImageChange {
+	if podStatus != "Running" {
+		return nil
 	}
-
-	length := len(podWithNewState)
-	for i := 0; i < length; i++ {
-		if podWithNewState[i].ImageID != oldPod[i].ImageID {
-			return true
+	for i, data := range wh.scanNotificationCandidateList {
+		if pod.GetNamespace() == data.Pod.GetNamespace() && data.Owner.Name == od.Name && data.Owner.Kind == od.Kind {
+			if pod.CreationTimestamp.Before(&data.Pod.CreationTimestamp) {
+				return nil
+			}
+			changes := getContainerImageChanges(pod, data.Pod)
+			if len(changes) > 0 {
+				wh.scanNotificationCandidateList[i].Pod = pod
+			}
+			return changes
 		}
 	}
-	return false
-}
-
-func isPodIsTheNewOne(pod *core.Pod) bool {
-	return pod.CreationTimestamp.Time.Equal(pod.CreationTimestamp.Time) || pod.CreationTimestamp.After(pod.CreationTimestamp.Time)
+	return nil
 }
 
-func checkNotificationCandidateList(pod *core.Pod, od *OwnerDet, podStatus string) bool {
-	if podStatus != "Running" {
-		return false
+// resyncNamespacePods reports the pods of a namespace that moved in or out of the label selector as created or deleted
+func (wh *WatchHandler) resyncNamespacePods(ctx context.Context, resync namespaceResync) {
+	pods, err := wh.RestAPIClient.CoreV1().Pods(resync.namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		logger.L().Ctx(ctx).Warning("failed listing the pods of a namespace to resync", helpers.String("namespace", resync.namespace), helpers.Error(err))
+		return
 	}
-	for i, data := range scanNotificationCandidateList {
-		if pod.GetNamespace() == data.Pod.GetNamespace() && data.Owner.Name == od.Name && data.Owner.Kind == od.Kind {
-			if isPodIsTheNewOne(data.Pod) && isContainersIDSChanged(pod.Status.ContainerStatuses, data.Pod.Status.ContainerStatuses) {
-				scanNotificationCandidateList[i].Pod = pod
-				return true
-			} else {
-				return false
+	if !resync.watched {
+		for i := range pods.Items {
+			pod := &pods.Items[i]
+			podName := pod.ObjectMeta.Name
+			if podName == "" {
+				podName = pod.ObjectMeta.GenerateName
 			}
+			wh.DeletePod(ctx, pod, podName)
 		}
+		return
 	}
-	return false
+	objects := make([]runtime.Object, 0, len(pods.Items))
+	for i := range pods.Items {
+		objects = append(objects, &pods.Items[i])
+	}
+	// the pods existed before the namespace was watched, they are all reported
+	var lastWatchEventCreationTime time.Time
+	wh.handlePodWatch(ctx, newListWatcher(objects), nil, nil, &lastWatchEventCreationTime)
 }
 
-func (wh *WatchHandler) handlePodWatch(ctx context.Context, podsWatcher watch.Interface, newStateChan <-chan bool, lastWatchEventCreationTime *time.Time) {
+func (wh *WatchHandler) handlePodWatch(ctx context.Context, podsWatcher watch.Interface, newStateChan <-chan bool, resyncChan <-chan namespaceResync, lastWatchEventCreationTime *time.Time) {
 	for {
 		var event watch.Event
 		var chanActive bool
 		select {
+		case resync := <-resyncChan:
+			wh.resyncNamespacePods(ctx, resync)
+			continue
 		case event, chanActive = <-podsWatcher.ResultChan():
 			if !chanActive {
 				podsWatcher.Stop()
 				*lastWatchEventCreationTime = time.Now()
 				return
 			}
+		case <-ctx.Done():
+			podsWatcher.Stop()
+			return
 		case <-newStateChan:
 			podsWatcher.Stop()
 			*lastWatchEventCreationTime = time.Now()
@@ -206,17 +222,14 @@ func (wh *WatchHandler) handlePodWatch(ctx context.Context, podsWatcher watch.In
 				continue
 			}
 			first := true
-			id, runningPodNum := isPodSpecAlreadyExist(&od, pod.Namespace, wh.pdm)
-			if runningPodNum <= 1 {
+			id, runningPodNum := wh.isPodSpecAlreadyExist(&od, pod.Namespace, wh.pdm)
+			newMicroService := runningPodNum <= 1
+			if newMicroService {
 				// when a new pod microservice (a new pod that is running first in the cluster) is found
 				// we want to scan its vulnerabilities so we will use the trigger mechanism to do it
 				wh.pdm[id] = list.New()
 				nms := MicroServiceData{Pod: pod, Owner: od, PodSpecId: id}
 				wh.pdm[id].PushBack(nms)
-				if wh.isNamespaceWatched(pod.Namespace) {
-					wh.jsonReport.AddToJsonFormat(nms, MICROSERVICES, CREATED)
-				}
-
 			} else { // Check if pod is already reported
 				if wh.pdm[id].Front() != nil {
 					element := wh.pdm[id].Front().Next()
@@ -244,21 +257,36 @@ func (wh *WatchHandler) handlePodWatch(ctx context.Context, podsWatcher watch.In
 					Kind: od.Kind,
 				},
 				PodStatus:         podStatus,
+				Health:            getPodHealth(pod),
 				CreationTimestamp: pod.CreationTimestamp.Time.UTC().Format(time.RFC3339),
 			}
 			wh.pdm[id].PushBack(newPod)
+			wh.indexPod(pod, podName, &od, id)
+			// the microservice is reported with the health of its pods
+			healthChanged := wh.refreshMicroServiceHealth(id)
 			if wh.isNamespaceWatched(pod.Namespace) {
+				if newMicroService {
+					wh.jsonReport.AddToJsonFormat(wh.pdm[id].Front().Value.(MicroServiceData), MICROSERVICES, CREATED)
+				} else if healthChanged {
+					wh.jsonReport.AddToJsonFormat(wh.pdm[id].Front().Value.(MicroServiceData), MICROSERVICES, UPDATED)
+				}
 				wh.jsonReport.AddToJsonFormat(newPod, PODS, CREATED)
+				wh.reportImageChanges(wh.images.observePod(pod, &od, time.Now()))
+				wh.reportExposureChanges(wh.exposure.observePod(pod, &od))
+				wh.reportIsolationChanges(wh.isolation.observePod(pod, &od, id))
+				wh.reportPermissionsChanges(wh.permissions.observePod(pod, &od, id))
 				informNewDataArrive(wh)
 			}
-			if pod.CreationTimestamp.Time.After(collectorCreationTime) {
-				addPodScanNotificationCandidateList(ctx, &od, pod)
+			if pod.CreationTimestamp.Time.After(wh.collectorCreationTime) {
+				wh.addPodScanNotificationCandidateList(ctx, &od, pod)
+				// a new microservice is a new pod spec of the workload
+				if newMicroService {
+					wh.publishTrigger(ctx, TriggerEvent{Trigger: config.WorkloadSpecChangeTrigger, Namespace: pod.Namespace, Kind: od.Kind, Name: od.Name})
+				}
 			}
 		case watch.Modified:
-			if checkNotificationCandidateList(pod, &od, podStatus) {
-				if err := wh.notifyUpdates.notifyNewMicroServiceCreatedInTheCluster(pod.Namespace, od.Kind, od.Name); err != nil {
-					logger.L().Ctx(ctx).Error("failed to notify updates", helpers.Error(err))
-				}
+			if changes := wh.checkNotificationCandidateList(pod, &od, podStatus); len(changes) > 0 {
+				wh.publishTrigger(ctx, TriggerEvent{Trigger: config.NewImageTrigger, Namespace: pod.Namespace, Kind: od.Kind, Name: od.Name, Images: changes})
 			}
 			if !wh.isNamespaceWatched(pod.Namespace) {
 				continue
@@ -271,9 +299,15 @@ func (wh *WatchHandler) handlePodWatch(ctx context.Context, podsWatcher watch.In
 			if podSpecID > -2 {
 				logger.L().Ctx(ctx).Debug("Pod Modified", helpers.String("name", podName), helpers.String("status", podStatus), helpers.String("namespace", pod.Namespace), helpers.String("node", pod.Spec.NodeName))
 				if strings.Contains(strings.ToLower(podStatus), "crashloop") {
-					wh.logPodInCrashLoop(ctx, pod)
+					wh.reportCrashes(ctx, pod, &od)
 				}
 				wh.jsonReport.AddToJsonFormat(newPodData, PODS, UPDATED)
+				wh.reportImageChanges(wh.images.observePod(pod, &od, time.Now()))
+				wh.reportExposureChanges(wh.exposure.observePod(pod, &od))
+				if id, ok := wh.objects.get("Pod", pod.Namespace, podName); ok {
+					wh.reportIsolationChanges(wh.isolation.observePod(pod, &od, id))
+					wh.reportPermissionsChanges(wh.permissions.observePod(pod, &od, id))
+				}
 			}
 			if podSpecID > -1 {
 				wh.jsonReport.AddToJsonFormat(wh.pdm[podSpecID].Front().Value.(MicroServiceData), MICROSERVICES, UPDATED)
@@ -282,7 +316,7 @@ func (wh *WatchHandler) handlePodWatch(ctx context.Context, podsWatcher watch.In
 				informNewDataArrive(wh)
 			}
 		case watch.Deleted:
-			removePodScanNotificationCandidateList(&od, pod)
+			wh.removePodScanNotificationCandidateList(&od, pod)
 			if !wh.isNamespaceWatched(pod.Namespace) {
 				continue
 			}
@@ -290,7 +324,7 @@ func (wh *WatchHandler) handlePodWatch(ctx context.Context, podsWatcher watch.In
 		case watch.Bookmark:
 			logger.L().Ctx(ctx).Debug("Pod Bookmark", helpers.String("name", podName), helpers.String("status", podStatus), helpers.String("namespace", pod.Namespace), helpers.String("node", pod.Spec.NodeName))
 		case watch.Error:
-			removePodScanNotificationCandidateList(&od, pod)
+			wh.removePodScanNotificationCandidateList(&od, pod)
 			logger.L().Ctx(ctx).Debug("Pod Error", helpers.String("name", podName), helpers.String("status", podStatus), helpers.String("namespace", pod.Namespace), helpers.String("node", pod.Spec.NodeName))
 			*lastWatchEventCreationTime = time.Now()
 			return
@@ -298,96 +332,36 @@ func (wh *WatchHandler) handlePodWatch(ctx context.Context, podsWatcher watch.In
 	}
 }
 
-// logs all container logs of a pod in crash loop. In case the RestartCount of one of the containers is greater than 2, skipping it.
-func (wh *WatchHandler) logPodInCrashLoop(ctx context.Context, pod *core.Pod) {
-	ctx, span := otel.Tracer("").Start(ctx, "logPodInCrashLoop", trace.WithAttributes(attribute.String("pod", pod.Name)))
-	defer span.End()
-
-	containerSlice := make([]core.ContainerStatus, 0, len(pod.Status.ContainerStatuses)+len(pod.Status.InitContainerStatuses))
-	containerSlice = append(containerSlice, pod.Status.ContainerStatuses...)
-	containerSlice = append(containerSlice, pod.Status.InitContainerStatuses...)
-
-	for contIdx := range containerSlice {
-		contName := containerSlice[contIdx].Name
-
-		if containerSlice[contIdx].RestartCount > 2 {
-			logger.L().Info(fmt.Sprintf("skipping container %s with RestartCount > 2", contName))
-			continue
-		}
-
-		// container details for logging
-		containerDetails := []helpers.IDetails{
-			helpers.String("containerName", contName),
-			helpers.Int("restartCount", int(containerSlice[contIdx].RestartCount)),
-		}
-		if state, err := containerSlice[contIdx].State.Marshal(); err != nil {
-			logger.L().Ctx(ctx).Error("failed to marshal container State", helpers.String("containerName", contName), helpers.Error(err))
-		} else {
-			containerDetails = append(containerDetails, helpers.String("state", string(state)))
-		}
-
-		if lastState, err := containerSlice[contIdx].LastTerminationState.Marshal(); err != nil {
-			logger.L().Ctx(ctx).Error("failed to marshal container LastTerminationState", helpers.String("containerName", contName), helpers.Error(err))
-		} else {
-			containerDetails = append(containerDetails, helpers.String("lastState", string(lastState)))
-		}
-
-		// previous container logs
-		podLogOpts := core.PodLogOptions{Previous: true, Timestamps: true, Container: contName, TailLines: &maxTailLines}
-		logsObj := wh.K8sApi.KubernetesClient.CoreV1().Pods(pod.Namespace).GetLogs(pod.Name, &podLogOpts)
-		readerObj, err := logsObj.Stream(wh.K8sApi.Context)
-
-		span.AddEvent("getting previous container logs", trace.WithAttributes(attribute.String("containerName", contName)))
-
-		if err != nil {
-			logger.L().Ctx(ctx).Error("failed to get previous logs stream of a crashed pod container", helpers.String("containerName", contName), helpers.Error(err))
-		} else {
-			if logs, err := io.ReadAll(readerObj); err != nil {
-				logger.L().Ctx(ctx).Error("failed to read previous logs stream of a crashed pod container", helpers.String("containerName", contName), helpers.Error(err))
-			} else {
-				logger.L().Ctx(ctx).Error(fmt.Sprintf("previous logs of a crashed pod container:\n %s", string(logs)), containerDetails...)
-			}
-		}
-
-		// current container logs
-		span.AddEvent("getting current container logs", trace.WithAttributes(attribute.String("containerName", contName)))
-		podLogOpts.Previous = false
-		logsObj = wh.K8sApi.KubernetesClient.CoreV1().Pods(pod.Namespace).GetLogs(pod.Name, &podLogOpts)
-		readerObj, err = logsObj.Stream(wh.K8sApi.Context)
-		if err != nil {
-			logger.L().Ctx(ctx).Error("failed to get logs stream of a crashed pod container", helpers.String("containerName", contName), helpers.Error(err))
-		} else {
-			if logs, err := io.ReadAll(readerObj); err != nil {
-				logger.L().Ctx(ctx).Error("failed to read logs stream of a crashed pod container", helpers.String("containerName", contName), helpers.Error(err))
-			} else {
-				logger.L().Ctx(ctx).Error(fmt.Sprintf("logs of a crashed pod container:\n %s", string(logs)), containerDetails...)
-			}
-		}
-	}
-}
-
 // DeletePod delete a pod
 func (wh *WatchHandler) DeletePod(ctx context.Context, pod *core.Pod, podName string) {
 	podStatus := "Terminating"
-	podSpecID, removeMicroServiceAsWell, owner := wh.RemovePod(pod, wh.pdm)
+	wh.crashes.forget(pod.UID)
+	podSpecID, removeMicroServiceAsWell, owner := wh.RemovePod(ctx, pod, wh.pdm)
 	if podSpecID == -1 {
 		return
 	}
+	wh.unindexPod(pod, podName, &owner, podSpecID, removeMicroServiceAsWell)
 	logger.L().Ctx(ctx).Debug("Pod Deleted", helpers.String("name", podName), helpers.String("status", podStatus), helpers.String("namespace", pod.Namespace), helpers.String("node", pod.Spec.NodeName))
 	np := PodDataForExistMicroService{PodName: pod.ObjectMeta.Name, NodeName: pod.Spec.NodeName, PodIP: pod.Status.PodIP, Namespace: pod.ObjectMeta.Namespace, Owner: OwnerDetNameAndKindOnly{Name: owner.Name, Kind: owner.Kind}, PodStatus: podStatus, CreationTimestamp: pod.CreationTimestamp.Time.UTC().Format(time.RFC3339)}
 	if pod.DeletionTimestamp != nil {
 		np.DeletionTimestamp = pod.DeletionTimestamp.Time.UTC().Format(time.RFC3339)
 	}
 	wh.jsonReport.AddToJsonFormat(np, PODS, DELETED)
+	wh.reportImageChanges(wh.images.removePod(pod.UID, time.Now()))
+	wh.reportExposureChanges(wh.exposure.removePod(pod))
+	wh.reportIsolationChanges(wh.isolation.removePod(pod, removeMicroServiceAsWell))
+	wh.reportPermissionsChanges(wh.permissions.removePod(pod, removeMicroServiceAsWell))
 	if removeMicroServiceAsWell {
 		nms := MicroServiceData{Pod: pod, Owner: owner, PodSpecId: podSpecID}
 		wh.jsonReport.AddToJsonFormat(nms, MICROSERVICES, DELETED)
+	} else if wh.refreshMicroServiceHealth(podSpecID) {
+		wh.jsonReport.AddToJsonFormat(wh.pdm[podSpecID].Front().Value.(MicroServiceData), MICROSERVICES, UPDATED)
 	}
 	informNewDataArrive(wh)
 }
 
 // IsPodExist check
-func IsPodExist(pod *core.Pod, pdm map[int]*list.List) bool {
+func (wh *WatchHandler) IsPodExist(pod *core.Pod, pdm map[int]*list.List) bool {
 	for _, v := range pdm {
 		if v == nil || v.Len() == 0 {
 			continue
@@ -398,7 +372,7 @@ func IsPodExist(pod *core.Pod, pdm map[int]*list.List) bool {
 		if v.Front().Value.(MicroServiceData).Pod.ObjectMeta.GenerateName == pod.ObjectMeta.Name {
 			return true
 		}
-		for e := ids.Ids.Front().Next(); e != nil; e = e.Next() {
+		for e := wh.ids.Ids.Front().Next(); e != nil; e = e.Next() {
 			if e.Value.(PodDataForExistMicroService).PodName == pod.ObjectMeta.Name {
 				return true
 			}
@@ -425,7 +399,7 @@ func extractPodSpecFromOwner(ownerData interface{}) interface{} {
 	return ownerData
 }
 
-func isPodSpecAlreadyExist(podOwner *OwnerDet, namespace string, pdm map[int]*list.List) (int, int) {
+func (wh *WatchHandler) isPodSpecAlreadyExist(podOwner *OwnerDet, namespace string, pdm map[int]*list.List) (int, int) {
 	newSpec := extractPodSpecFromOwner(podOwner.OwnerData)
 	for _, v := range pdm {
 		if v == nil || v.Len() <= 1 {
@@ -439,7 +413,7 @@ func isPodSpecAlreadyExist(podOwner *OwnerDet, namespace string, pdm map[int]*li
 			return v.Front().Value.(MicroServiceData).PodSpecId, v.Len()
 		}
 	}
-	return CreateID(), 0
+	return wh.ids.CreateID(), 0
 }
 
 // GetOwnerData - get the data of pod owner
@@ -447,7 +421,7 @@ func GetOwnerData(ctx context.Context, name string, kind string, apiVersion stri
 	switch kind {
 	case "Deployment":
 		options := metav1.GetOptions{}
-		depDet, err := wh.RestAPIClient.AppsV1().Deployments(namespace).Get(globalHTTPContext, name, options)
+		depDet, err := wh.RestAPIClient.AppsV1().Deployments(namespace).Get(ctx, name, options)
 		if err != nil {
 			logger.L().Ctx(ctx).Error("GetOwnerData Deployments", helpers.Error(err))
 			return nil
@@ -458,7 +432,7 @@ func GetOwnerData(ctx context.Context, name string, kind string, apiVersion stri
 		return depDet
 	case "DaemonSet":
 		options := metav1.GetOptions{}
-		daemSetDet, err := wh.RestAPIClient.AppsV1().DaemonSets(namespace).Get(globalHTTPContext, name, options)
+		daemSetDet, err := wh.RestAPIClient.AppsV1().DaemonSets(namespace).Get(ctx, name, options)
 		if err != nil {
 			logger.L().Ctx(ctx).Error("GetOwnerData DaemonSet", helpers.Error(err))
 			return nil
@@ -469,7 +443,7 @@ func GetOwnerData(ctx context.Context, name string, kind string, apiVersion stri
 		return daemSetDet
 	case "StatefulSet":
 		options := metav1.GetOptions{}
-		statSetDet, err := wh.RestAPIClient.AppsV1().StatefulSets(namespace).Get(globalHTTPContext, name, options)
+		statSetDet, err := wh.RestAPIClient.AppsV1().StatefulSets(namespace).Get(ctx, name, options)
 		if err != nil {
 			logger.L().Ctx(ctx).Error("GetOwnerData StatefulSet", helpers.Error(err))
 			return nil
@@ -480,7 +454,7 @@ func GetOwnerData(ctx context.Context, name string, kind string, apiVersion stri
 		return statSetDet
 	case "Job":
 		options := metav1.GetOptions{}
-		jobDet, err := wh.RestAPIClient.BatchV1().Jobs(namespace).Get(globalHTTPContext, name, options)
+		jobDet, err := wh.RestAPIClient.BatchV1().Jobs(namespace).Get(ctx, name, options)
 		if err != nil {
 			logger.L().Ctx(ctx).Error("GetOwnerData Job", helpers.Error(err))
 			return nil
@@ -491,7 +465,7 @@ func GetOwnerData(ctx context.Context, name string, kind string, apiVersion stri
 		return jobDet
 	case "CronJob":
 		options := metav1.GetOptions{}
-		cronJobDet, err := wh.RestAPIClient.BatchV1().CronJobs(namespace).Get(globalHTTPContext, name, options)
+		cronJobDet, err := wh.RestAPIClient.BatchV1().CronJobs(namespace).Get(ctx, name, options)
 		if err != nil {
 			logger.L().Ctx(ctx).Error("GetOwnerData CronJob", helpers.Error(err))
 			return nil
@@ -502,7 +476,7 @@ func GetOwnerData(ctx context.Context, name string, kind string, apiVersion stri
 		return cronJobDet
 	case "Pod":
 		options := metav1.GetOptions{}
-		podDet, err := wh.RestAPIClient.CoreV1().Pods(namespace).Get(globalHTTPContext, name, options)
+		podDet, err := wh.RestAPIClient.CoreV1().Pods(namespace).Get(ctx, name, options)
 		if err != nil {
 			logger.L().Ctx(ctx).Error("GetOwnerData Pod", helpers.Error(err))
 			return nil
@@ -565,7 +539,7 @@ func GetAncestorOfPod(ctx context.Context, pod *core.Pod, wh *WatchHandler) (Own
 				od.Kind = crd.Kind
 			}
 		case "ReplicaSet":
-			repItem, err := wh.RestAPIClient.AppsV1().ReplicaSets(pod.ObjectMeta.Namespace).Get(globalHTTPContext, pod.OwnerReferences[0].Name, metav1.GetOptions{})
+			repItem, err := wh.RestAPIClient.AppsV1().ReplicaSets(pod.ObjectMeta.Namespace).Get(ctx, pod.OwnerReferences[0].Name, metav1.GetOptions{})
 			if err != nil {
 				if localOD, inner_err := GetAncestorFromLocalPodsList(pod, wh); inner_err == nil {
 					return *localOD, nil
@@ -585,7 +559,7 @@ func GetAncestorOfPod(ctx context.Context, pod *core.Pod, wh *WatchHandler) (Own
 				}
 
 				options := metav1.ListOptions{}
-				depList, _ := depInt.List(globalHTTPContext, options)
+				depList, _ := depInt.List(ctx, options)
 				for _, item := range depList.Items {
 					if selector.Empty() || !selector.Matches(labels.Set(pod.Labels)) {
 						continue
@@ -602,7 +576,7 @@ func GetAncestorOfPod(ctx context.Context, pod *core.Pod, wh *WatchHandler) (Own
 			od.Kind = pod.OwnerReferences[0].Kind
 			//meanwhile owner reference must be in the same namespace, so owner reference doesn't have the namespace field(may be changed in the future)
 			od.OwnerData = GetOwnerData(ctx, pod.OwnerReferences[0].Name, pod.OwnerReferences[0].Kind, pod.OwnerReferences[0].APIVersion, pod.ObjectMeta.Namespace, wh)
-			jobItem, err := wh.RestAPIClient.BatchV1().Jobs(pod.ObjectMeta.Namespace).Get(globalHTTPContext, pod.OwnerReferences[0].Name, metav1.GetOptions{})
+			jobItem, err := wh.RestAPIClient.BatchV1().Jobs(pod.ObjectMeta.Namespace).Get(ctx, pod.OwnerReferences[0].Name, metav1.GetOptions{})
 			if err != nil {
 				if localOD, inner_err := GetAncestorFromLocalPodsList(pod, wh); inner_err == nil {
 					return *localOD, nil
@@ -618,7 +592,7 @@ func GetAncestorOfPod(ctx context.Context, pod *core.Pod, wh *WatchHandler) (Own
 				break
 			}
 
-			depList, _ := wh.RestAPIClient.BatchV1().CronJobs(pod.ObjectMeta.Namespace).List(globalHTTPContext, metav1.ListOptions{})
+			depList, _ := wh.RestAPIClient.BatchV1().CronJobs(pod.ObjectMeta.Namespace).List(ctx, metav1.ListOptions{})
 			selector, err := metav1.LabelSelectorAsSelector(jobItem.Spec.Selector)
 			if err != nil {
 				return od, fmt.Errorf("error getting owner reference")
@@ -651,6 +625,8 @@ func GetAncestorOfPod(ctx context.Context, pod *core.Pod, wh *WatchHandler) (Own
 	return od, nil
 }
 
+// updatePod updates the pod in its microservice list. Returns -2 if the pod is unknown, -1 if the microservice is not updated,
+// otherwise the id of the microservice to report, e.g. when the health of its pods changed
 func (wh *WatchHandler) updatePod(pod *core.Pod, pdm map[int]*list.List, podStatus string) (int, PodDataForExistMicroService) {
 	id := -2
 	podDataForExistMicroService := PodDataForExistMicroService{}
@@ -672,10 +648,14 @@ func (wh *WatchHandler) updatePod(pod *core.Pod, pdm map[int]*list.List, podStat
 				} else {
 					id = -1
 				}
-				podDataForExistMicroService = PodDataForExistMicroService{PodName: pod.ObjectMeta.Name, NodeName: pod.Spec.NodeName, PodIP: pod.Status.PodIP, Namespace: pod.ObjectMeta.Namespace, PodStatus: podStatus, CreationTimestamp: pod.CreationTimestamp.Time.UTC().Format(time.RFC3339)}
+				podDataForExistMicroService = PodDataForExistMicroService{PodName: pod.ObjectMeta.Name, NodeName: pod.Spec.NodeName, PodIP: pod.Status.PodIP, Namespace: pod.ObjectMeta.Namespace, PodStatus: podStatus, Health: getPodHealth(pod), CreationTimestamp: pod.CreationTimestamp.Time.UTC().Format(time.RFC3339)}
 
 				DeepCopy(element.Value.(PodDataForExistMicroService).Owner, &podDataForExistMicroService.Owner)
-				DeepCopyObj(podDataForExistMicroService, element.Value.(PodDataForExistMicroService))
+				element.Value = podDataForExistMicroService
+				microServiceID := v.Front().Value.(MicroServiceData).PodSpecId
+				if wh.refreshMicroServiceHealth(microServiceID) {
+					id = microServiceID
+				}
 				break
 			}
 			element = element.Next()
@@ -684,12 +664,16 @@ func (wh *WatchHandler) updatePod(pod *core.Pod, pdm map[int]*list.List, podStat
 	return id, podDataForExistMicroService
 }
 
-func (wh *WatchHandler) isMicroServiceNeedToBeRemoved(ownerData interface{}, kind, namespace string) bool {
+func (wh *WatchHandler) isMicroServiceNeedToBeRemoved(ctx context.Context, ownerData interface{}, kind, namespace string) bool {
+	// the microservices of a namespace that is no longer watched are removed with their pods
+	if !wh.isNamespaceWatched(namespace) {
+		return true
+	}
 	switch kind {
 	case "Deployment":
 		options := metav1.GetOptions{}
 		name := ownerData.(*appsv1.Deployment).ObjectMeta.Name
-		_, err := wh.RestAPIClient.AppsV1().Deployments(namespace).Get(globalHTTPContext, name, options)
+		_, err := wh.RestAPIClient.AppsV1().Deployments(namespace).Get(ctx, name, options)
 		if errors.IsNotFound(err) {
 			return true
 		}
@@ -697,7 +681,7 @@ func (wh *WatchHandler) isMicroServiceNeedToBeRemoved(ownerData interface{}, kin
 	case "DeamonSet", "DaemonSet":
 		options := metav1.GetOptions{}
 		name := ownerData.(*appsv1.DaemonSet).ObjectMeta.Name
-		_, err := wh.RestAPIClient.AppsV1().DaemonSets(namespace).Get(globalHTTPContext, name, options)
+		_, err := wh.RestAPIClient.AppsV1().DaemonSets(namespace).Get(ctx, name, options)
 		if errors.IsNotFound(err) {
 			return true
 		}
@@ -705,14 +689,14 @@ func (wh *WatchHandler) isMicroServiceNeedToBeRemoved(ownerData interface{}, kin
 	case "StatefulSets":
 		options := metav1.GetOptions{}
 		name := ownerData.(*appsv1.StatefulSet).ObjectMeta.Name
-		_, err := wh.RestAPIClient.AppsV1().StatefulSets(namespace).Get(globalHTTPContext, name, options)
+		_, err := wh.RestAPIClient.AppsV1().StatefulSets(namespace).Get(ctx, name, options)
 		if errors.IsNotFound(err) {
 			return true
 		}
 	case "Job":
 		options := metav1.GetOptions{}
 		name := ownerData.(*batchv1.Job).ObjectMeta.Name
-		_, err := wh.RestAPIClient.BatchV1().Jobs(namespace).Get(globalHTTPContext, name, options)
+		_, err := wh.RestAPIClient.BatchV1().Jobs(namespace).Get(ctx, name, options)
 		if errors.IsNotFound(err) {
 			return true
 		}
@@ -722,14 +706,14 @@ func (wh *WatchHandler) isMicroServiceNeedToBeRemoved(ownerData interface{}, kin
 		if !ok {
 			return true
 		}
-		_, err := wh.RestAPIClient.BatchV1().CronJobs(namespace).Get(globalHTTPContext, cronJob.ObjectMeta.Name, options)
+		_, err := wh.RestAPIClient.BatchV1().CronJobs(namespace).Get(ctx, cronJob.ObjectMeta.Name, options)
 		if errors.IsNotFound(err) {
 			return true
 		}
 	case "Pod":
 		options := metav1.GetOptions{}
 		name := ownerData.(*core.Pod).ObjectMeta.Name
-		_, err := wh.RestAPIClient.CoreV1().Pods(namespace).Get(globalHTTPContext, name, options)
+		_, err := wh.RestAPIClient.CoreV1().Pods(namespace).Get(ctx, name, options)
 		if errors.IsNotFound(err) {
 			return true
 		}
@@ -739,7 +723,7 @@ func (wh *WatchHandler) isMicroServiceNeedToBeRemoved(ownerData interface{}, kin
 }
 
 // RemovePod remove pod and check if has parents. Returns 3 elements: 1. pod spec ID, 2. is owner removed, 3. owner
-func (wh *WatchHandler) RemovePod(pod *core.Pod, pdm map[int]*list.List) (int, bool, OwnerDet) {
+func (wh *WatchHandler) RemovePod(ctx context.Context, pod *core.Pod, pdm map[int]*list.List) (int, bool, OwnerDet) {
 	var owner OwnerDet
 	removed := false
 	podSpecID := -1
@@ -755,7 +739,7 @@ func (wh *WatchHandler) RemovePod(pod *core.Pod, pdm map[int]*list.List) (int, b
 				podSpecID = id
 				if v.Len() <= 1 {
 					msd := v.Front().Value.(MicroServiceData)
-					removed = wh.isMicroServiceNeedToBeRemoved(msd.Owner.OwnerData, msd.Owner.Kind, msd.ObjectMeta.Namespace)
+					removed = wh.isMicroServiceNeedToBeRemoved(ctx, msd.Owner.OwnerData, msd.Owner.Kind, msd.ObjectMeta.Namespace)
 					if removed {
 						v.Remove(v.Front())
 						delete(pdm, id)
@@ -767,7 +751,7 @@ func (wh *WatchHandler) RemovePod(pod *core.Pod, pdm map[int]*list.List) (int, b
 				v.Remove(element)
 				if v.Len() <= 1 {
 					msd := v.Front().Value.(MicroServiceData)
-					removed := wh.isMicroServiceNeedToBeRemoved(msd.Owner.OwnerData, msd.Owner.Kind, msd.ObjectMeta.Namespace)
+					removed := wh.isMicroServiceNeedToBeRemoved(ctx, msd.Owner.OwnerData, msd.Owner.Kind, msd.ObjectMeta.Namespace)
 					if removed {
 						v.Remove(v.Front())
 						delete(pdm, id)
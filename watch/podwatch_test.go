@@ -25,7 +25,7 @@ var runningPodOD string
 
 func TestAddPodScanNotificationCandidateList(t *testing.T) {
 
-	scanNotificationCandidateList = []*ScanNewImageData{}
+	wh := &WatchHandler{}
 	od := OwnerDet{}
 	pod := core.Pod{}
 
@@ -35,14 +35,14 @@ func TestAddPodScanNotificationCandidateList(t *testing.T) {
 	err = json.Unmarshal([]byte(podOD), &od)
 	assert.NoErrorf(t, err, "failed convert od to json: %v", err)
 	ctx := context.Background()
-	addPodScanNotificationCandidateList(ctx, &od, &pod)
-	exist, _ := isPodAlreadyExistInScanCandidateList(ctx, &od, &pod)
+	wh.addPodScanNotificationCandidateList(ctx, &od, &pod)
+	exist, _ := wh.isPodAlreadyExistInScanCandidateList(ctx, &od, &pod)
 	assert.True(t, exist, "pod should exist")
 }
 
 func TestRemovePodScanNotificationCandidateList(t *testing.T) {
 
-	scanNotificationCandidateList = []*ScanNewImageData{}
+	wh := &WatchHandler{}
 	od := OwnerDet{}
 	pod := core.Pod{}
 
@@ -53,17 +53,17 @@ func TestRemovePodScanNotificationCandidateList(t *testing.T) {
 	assert.NoErrorf(t, err, "failed convert od to json: %v", err)
 
 	ctx := context.Background()
-	addPodScanNotificationCandidateList(ctx, &od, &pod)
-	exist, _ := isPodAlreadyExistInScanCandidateList(ctx, &od, &pod)
+	wh.addPodScanNotificationCandidateList(ctx, &od, &pod)
+	exist, _ := wh.isPodAlreadyExistInScanCandidateList(ctx, &od, &pod)
 	assert.True(t, exist, "pod should exist")
 
-	removePodScanNotificationCandidateList(&od, &pod)
-	exist, _ = isPodAlreadyExistInScanCandidateList(ctx, &od, &pod)
+	wh.removePodScanNotificationCandidateList(&od, &pod)
+	exist, _ = wh.isPodAlreadyExistInScanCandidateList(ctx, &od, &pod)
 	assert.False(t, exist, "pod should not exist")
 }
 
 func TestCheckNotificationCandidateList(t *testing.T) {
-	scanNotificationCandidateList = []*ScanNewImageData{}
+	wh := &WatchHandler{}
 	od := OwnerDet{}
 	pod := core.Pod{}
 
@@ -74,8 +74,8 @@ func TestCheckNotificationCandidateList(t *testing.T) {
 	assert.NoErrorf(t, err, "failed convert od to json: %v", err)
 
 	ctx := context.Background()
-	addPodScanNotificationCandidateList(ctx, &od, &pod)
-	exist, _ := isPodAlreadyExistInScanCandidateList(ctx, &od, &pod)
+	wh.addPodScanNotificationCandidateList(ctx, &od, &pod)
+	exist, _ := wh.isPodAlreadyExistInScanCandidateList(ctx, &od, &pod)
 	assert.True(t, exist, "pod should exist")
 
 	runningOd := OwnerDet{}
@@ -87,7 +87,7 @@ func TestCheckNotificationCandidateList(t *testing.T) {
 	err = json.Unmarshal([]byte(runningPodOD), &runningOd)
 	assert.NoErrorf(t, err, "failed convert od to json: %v", err)
 
-	assert.True(t, checkNotificationCandidateList(&runningPod, &runningOd, "Running"), "pod should be reported")
+	assert.NotEmpty(t, wh.checkNotificationCandidateList(&runningPod, &runningOd, "Running"), "pod should be reported")
 }
 
 /*
@@ -98,7 +98,7 @@ use case:
 */
 func TestNewMicroserviceCreated(t *testing.T) {
 
-	scanNotificationCandidateList = []*ScanNewImageData{}
+	wh := &WatchHandler{}
 	od := OwnerDet{}
 	pod := core.Pod{}
 
@@ -109,8 +109,8 @@ func TestNewMicroserviceCreated(t *testing.T) {
 	assert.NoErrorf(t, err, "failed convert od to json: %v", err)
 
 	ctx := context.Background()
-	addPodScanNotificationCandidateList(ctx, &od, &pod)
-	exist, _ := isPodAlreadyExistInScanCandidateList(ctx, &od, &pod)
+	wh.addPodScanNotificationCandidateList(ctx, &od, &pod)
+	exist, _ := wh.isPodAlreadyExistInScanCandidateList(ctx, &od, &pod)
 	assert.True(t, exist, "pod should exist")
 
 	runningOd := OwnerDet{}
@@ -122,7 +122,7 @@ func TestNewMicroserviceCreated(t *testing.T) {
 	err = json.Unmarshal([]byte(runningPodOD), &runningOd)
 	assert.NoErrorf(t, err, "failed convert od to json: %v", err)
 
-	assert.True(t, checkNotificationCandidateList(&runningPod, &runningOd, "Running"), "pod should be reported")
+	assert.NotEmpty(t, wh.checkNotificationCandidateList(&runningPod, &runningOd, "Running"), "pod should be reported")
 }
 
 /*
@@ -133,7 +133,7 @@ use case:
 */
 func TestNewMicroserviceCreatedWithBadConfiguration(t *testing.T) {
 
-	scanNotificationCandidateList = []*ScanNewImageData{}
+	wh := &WatchHandler{}
 	od := OwnerDet{}
 	pod := core.Pod{}
 
@@ -144,8 +144,8 @@ func TestNewMicroserviceCreatedWithBadConfiguration(t *testing.T) {
 	assert.NoErrorf(t, err, "failed convert od to json: %v", err)
 
 	ctx := context.Background()
-	addPodScanNotificationCandidateList(ctx, &od, &pod)
-	exist, _ := isPodAlreadyExistInScanCandidateList(ctx, &od, &pod)
+	wh.addPodScanNotificationCandidateList(ctx, &od, &pod)
+	exist, _ := wh.isPodAlreadyExistInScanCandidateList(ctx, &od, &pod)
 	assert.True(t, exist, "pod should exist")
 
 	runningOd := OwnerDet{}
@@ -157,10 +157,10 @@ func TestNewMicroserviceCreatedWithBadConfiguration(t *testing.T) {
 	err = json.Unmarshal([]byte(runningPodOD), &runningOd)
 	assert.NoErrorf(t, err, "failed convert od to json: %v", err)
 
-	assert.False(t, checkNotificationCandidateList(&runningPod, &runningOd, "Failed"), "pod should not be reported")
+	assert.Empty(t, wh.checkNotificationCandidateList(&runningPod, &runningOd, "Failed"), "pod should not be reported")
 
-	removePodScanNotificationCandidateList(&runningOd, &runningPod)
-	exist, _ = isPodAlreadyExistInScanCandidateList(ctx, &od, &pod)
+	wh.removePodScanNotificationCandidateList(&runningOd, &runningPod)
+	exist, _ = wh.isPodAlreadyExistInScanCandidateList(ctx, &od, &pod)
 	assert.False(t, exist, "pod should not exist")
 }
 
@@ -172,7 +172,7 @@ use case:
 */
 func TestMicroserviceChangedItsImage(t *testing.T) {
 
-	scanNotificationCandidateList = []*ScanNewImageData{}
+	wh := &WatchHandler{}
 	od := OwnerDet{}
 	pod := core.Pod{}
 
@@ -183,8 +183,8 @@ func TestMicroserviceChangedItsImage(t *testing.T) {
 	assert.NoErrorf(t, err, "failed convert od to json: %v", err)
 
 	ctx := context.Background()
-	addPodScanNotificationCandidateList(ctx, &od, &pod)
-	if exist, _ := isPodAlreadyExistInScanCandidateList(ctx, &od, &pod); !exist {
+	wh.addPodScanNotificationCandidateList(ctx, &od, &pod)
+	if exist, _ := wh.isPodAlreadyExistInScanCandidateList(ctx, &od, &pod); !exist {
 		t.Fatalf("pod should exist")
 	}
 
@@ -197,10 +197,10 @@ func TestMicroserviceChangedItsImage(t *testing.T) {
 	err = json.Unmarshal([]byte(runningPodOD), &runningOd)
 	assert.NoErrorf(t, err, "failed convert od to json: %v", err)
 
-	assert.True(t, checkNotificationCandidateList(&runningPod, &runningOd, "Running"), "pod should be reported")
+	assert.NotEmpty(t, wh.checkNotificationCandidateList(&runningPod, &runningOd, "Running"), "pod should be reported")
 
-	addPodScanNotificationCandidateList(ctx, &od, &pod)
-	exist, _ := isPodAlreadyExistInScanCandidateList(ctx, &od, &pod)
+	wh.addPodScanNotificationCandidateList(ctx, &od, &pod)
+	exist, _ := wh.isPodAlreadyExistInScanCandidateList(ctx, &od, &pod)
 	assert.True(t, exist, "pod should exist")
 
 	runningNewOd := OwnerDet{}
@@ -214,10 +214,10 @@ func TestMicroserviceChangedItsImage(t *testing.T) {
 
 	runningNewPod.Status.ContainerStatuses[0].Image = "nginx:perl"
 	runningNewPod.Status.ContainerStatuses[0].ImageID = "nginx:perlImageID"
-	assert.True(t, checkNotificationCandidateList(&runningNewPod, &runningNewOd, "Running"), "pod should be reported")
+	assert.NotEmpty(t, wh.checkNotificationCandidateList(&runningNewPod, &runningNewOd, "Running"), "pod should be reported")
 
-	removePodScanNotificationCandidateList(&od, &pod)
-	exist, _ = isPodAlreadyExistInScanCandidateList(ctx, &od, &pod)
+	wh.removePodScanNotificationCandidateList(&od, &pod)
+	exist, _ = wh.isPodAlreadyExistInScanCandidateList(ctx, &od, &pod)
 	assert.True(t, exist, "pod should exist")
 }
 
@@ -229,7 +229,7 @@ use case:
 */
 func TestMicroserviceChangedItsImageWithBadConfig(t *testing.T) {
 
-	scanNotificationCandidateList = []*ScanNewImageData{}
+	wh := &WatchHandler{}
 	od := OwnerDet{}
 	pod := core.Pod{}
 
@@ -240,8 +240,8 @@ func TestMicroserviceChangedItsImageWithBadConfig(t *testing.T) {
 	assert.NoErrorf(t, err, "failed convert od to json: %v", err)
 
 	ctx := context.Background()
-	addPodScanNotificationCandidateList(ctx, &od, &pod)
-	exist, _ := isPodAlreadyExistInScanCandidateList(ctx, &od, &pod)
+	wh.addPodScanNotificationCandidateList(ctx, &od, &pod)
+	exist, _ := wh.isPodAlreadyExistInScanCandidateList(ctx, &od, &pod)
 	assert.True(t, exist, "pod should exist")
 
 	runningOd := OwnerDet{}
@@ -253,10 +253,10 @@ func TestMicroserviceChangedItsImageWithBadConfig(t *testing.T) {
 	err = json.Unmarshal([]byte(runningPodOD), &runningOd)
 	assert.NoErrorf(t, err, "failed convert od to json: %v", err)
 
-	assert.True(t, checkNotificationCandidateList(&runningPod, &runningOd, "Running"), "pod should be reported")
+	assert.NotEmpty(t, wh.checkNotificationCandidateList(&runningPod, &runningOd, "Running"), "pod should be reported")
 
-	addPodScanNotificationCandidateList(ctx, &od, &pod)
-	exist, _ = isPodAlreadyExistInScanCandidateList(ctx, &od, &pod)
+	wh.addPodScanNotificationCandidateList(ctx, &od, &pod)
+	exist, _ = wh.isPodAlreadyExistInScanCandidateList(ctx, &od, &pod)
 	assert.True(t, exist, "pod should exist")
 
 	runningNewOd := OwnerDet{}
@@ -270,10 +270,10 @@ func TestMicroserviceChangedItsImageWithBadConfig(t *testing.T) {
 
 	runningNewPod.Status.ContainerStatuses[0].Image = "nginx:perl"
 	runningNewPod.Status.ContainerStatuses[0].ImageID = "nginx:perlImageID"
-	assert.False(t, checkNotificationCandidateList(&runningNewPod, &runningNewOd, "Failed"), "pod should not be reported")
+	assert.Empty(t, wh.checkNotificationCandidateList(&runningNewPod, &runningNewOd, "Failed"), "pod should not be reported")
 
-	removePodScanNotificationCandidateList(&od, &pod)
-	exist, _ = isPodAlreadyExistInScanCandidateList(ctx, &od, &pod)
+	wh.removePodScanNotificationCandidateList(&od, &pod)
+	exist, _ = wh.isPodAlreadyExistInScanCandidateList(ctx, &od, &pod)
 	assert.True(t, exist, "pod should exist")
 }
 
@@ -285,7 +285,7 @@ use case:
 */
 func TestMicroserviceChangedSomethingButItsImage(t *testing.T) {
 
-	scanNotificationCandidateList = []*ScanNewImageData{}
+	wh := &WatchHandler{}
 	od := OwnerDet{}
 	pod := core.Pod{}
 
@@ -296,8 +296,8 @@ func TestMicroserviceChangedSomethingButItsImage(t *testing.T) {
 	assert.NoErrorf(t, err, "failed convert od to json: %v", err)
 
 	ctx := context.Background()
-	addPodScanNotificationCandidateList(ctx, &od, &pod)
-	exist, _ := isPodAlreadyExistInScanCandidateList(ctx, &od, &pod)
+	wh.addPodScanNotificationCandidateList(ctx, &od, &pod)
+	exist, _ := wh.isPodAlreadyExistInScanCandidateList(ctx, &od, &pod)
 	assert.True(t, exist, "pod should exist")
 
 	runningOd := OwnerDet{}
@@ -309,10 +309,10 @@ func TestMicroserviceChangedSomethingButItsImage(t *testing.T) {
 	err = json.Unmarshal([]byte(runningPodOD), &runningOd)
 	assert.NoErrorf(t, err, "failed convert od to json: %v", err)
 
-	assert.True(t, checkNotificationCandidateList(&runningPod, &runningOd, "Running"), "pod should be reported")
+	assert.NotEmpty(t, wh.checkNotificationCandidateList(&runningPod, &runningOd, "Running"), "pod should be reported")
 
-	addPodScanNotificationCandidateList(ctx, &od, &pod)
-	exist, _ = isPodAlreadyExistInScanCandidateList(ctx, &od, &pod)
+	wh.addPodScanNotificationCandidateList(ctx, &od, &pod)
+	exist, _ = wh.isPodAlreadyExistInScanCandidateList(ctx, &od, &pod)
 	assert.True(t, exist, "pod should exist")
 
 	runningNewOd := OwnerDet{}
@@ -325,9 +325,9 @@ func TestMicroserviceChangedSomethingButItsImage(t *testing.T) {
 	assert.NoErrorf(t, err, "failed convert od to json: %v", err)
 
 	runningNewPod.Spec.Containers[0].ImagePullPolicy = "IfNotPresent"
-	assert.False(t, checkNotificationCandidateList(&runningNewPod, &runningNewOd, "Running"), "pod should not be reported")
+	assert.Empty(t, wh.checkNotificationCandidateList(&runningNewPod, &runningNewOd, "Running"), "pod should not be reported")
 
-	removePodScanNotificationCandidateList(&od, &pod)
-	exist, _ = isPodAlreadyExistInScanCandidateList(ctx, &od, &pod)
+	wh.removePodScanNotificationCandidateList(&od, &pod)
+	exist, _ = wh.isPodAlreadyExistInScanCandidateList(ctx, &od, &pod)
 	assert.True(t, exist, "pod should exist")
 }
@@ -0,0 +1,221 @@
+package watch
+
+import (
+	"context"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	logger "github.com/kubescape/go-logger"
+	"github.com/kubescape/go-logger/helpers"
+	"github.com/kubescape/kollector/config"
+	core "k8s.io/api/core/v1"
+	rbac "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+// rbacResources are the resources the permissions of the workloads are evaluated from
+var rbacResources = []string{config.ClusterRolesResource, config.ClusterRoleBindingsResource, config.RolesResource,
+	config.RoleBindingsResource, config.ServiceAccountsResource}
+
+// RoleWatch watches the roles, the workloads bound to them are evaluated again
+func (wh *WatchHandler) RoleWatch(ctx context.Context) {
+	wh.rbacWatch(ctx, config.RolesResource)
+}
+
+// ClusterRoleWatch watches the cluster roles, the workloads bound to them are evaluated again
+func (wh *WatchHandler) ClusterRoleWatch(ctx context.Context) {
+	wh.rbacWatch(ctx, config.ClusterRolesResource)
+}
+
+// RoleBindingWatch watches the role bindings, the workloads of their subjects are evaluated again
+func (wh *WatchHandler) RoleBindingWatch(ctx context.Context) {
+	wh.rbacWatch(ctx, config.RoleBindingsResource)
+}
+
+// ClusterRoleBindingWatch watches the cluster role bindings, the workloads of their subjects are evaluated again
+func (wh *WatchHandler) ClusterRoleBindingWatch(ctx context.Context) {
+	wh.rbacWatch(ctx, config.ClusterRoleBindingsResource)
+}
+
+// ServiceAccountWatch watches the service accounts, the workloads running as them are evaluated again
+func (wh *WatchHandler) ServiceAccountWatch(ctx context.Context) {
+	wh.rbacWatch(ctx, config.ServiceAccountsResource)
+}
+
+func (wh *WatchHandler) rbacWatch(ctx context.Context, resource string) {
+	defer func() {
+		if err := recover(); err != nil {
+			logger.L().Ctx(ctx).Error("RECOVER rbacWatch", helpers.String("resource", resource), helpers.Interface("error", err), helpers.String("stack", string(debug.Stack())))
+		}
+	}()
+	newStateChan, unsubscribe := wh.subscribeNewState()
+	defer unsubscribe()
+	for ctx.Err() == nil {
+		logger.L().Info("Watching over " + resource + " starting")
+		rbacWatcher, err := wh.watchRBAC(ctx, resource, wh.listOptions(resource))
+		if err != nil {
+			logger.L().Ctx(ctx).Warning("Failed watching over "+resource, helpers.Error(err))
+			time.Sleep(1 * time.Second)
+			continue
+		}
+		rbacWatcher = wh.recorder.watch(resource, rbacWatcher)
+		wh.handleRBACWatch(ctx, resource, rbacWatcher, newStateChan)
+	}
+}
+
+// watchRBAC watches an RBAC resource or the service accounts. The roles and role bindings are watched in every namespace,
+// since a binding may grant the service accounts of another namespace
+func (wh *WatchHandler) watchRBAC(ctx context.Context, resource string, options metav1.ListOptions) (watch.Interface, error) {
+	namespace := wh.namespaceFilter.watchNamespace()
+	switch resource {
+	case config.RolesResource:
+		return wh.RestAPIClient.RbacV1().Roles("").Watch(ctx, options)
+	case config.ClusterRolesResource:
+		return wh.RestAPIClient.RbacV1().ClusterRoles().Watch(ctx, options)
+	case config.RoleBindingsResource:
+		return wh.RestAPIClient.RbacV1().RoleBindings("").Watch(ctx, options)
+	case config.ClusterRoleBindingsResource:
+		return wh.RestAPIClient.RbacV1().ClusterRoleBindings().Watch(ctx, options)
+	default:
+		return wh.RestAPIClient.CoreV1().ServiceAccounts(namespace).Watch(ctx, options)
+	}
+}
+
+// listRBAC lists the objects of an RBAC resource or the service accounts
+func (wh *WatchHandler) listRBAC(ctx context.Context, resource string, options metav1.ListOptions) ([]runtime.Object, error) {
+	namespace := wh.namespaceFilter.watchNamespace()
+	var objects []runtime.Object
+	switch resource {
+	case config.RolesResource:
+		list, err := wh.RestAPIClient.RbacV1().Roles("").List(ctx, options)
+		if err != nil {
+			return nil, err
+		}
+		for i := range list.Items {
+			objects = append(objects, &list.Items[i])
+		}
+	case config.ClusterRolesResource:
+		list, err := wh.RestAPIClient.RbacV1().ClusterRoles().List(ctx, options)
+		if err != nil {
+			return nil, err
+		}
+		for i := range list.Items {
+			objects = append(objects, &list.Items[i])
+		}
+	case config.RoleBindingsResource:
+		list, err := wh.RestAPIClient.RbacV1().RoleBindings("").List(ctx, options)
+		if err != nil {
+			return nil, err
+		}
+		for i := range list.Items {
+			objects = append(objects, &list.Items[i])
+		}
+	case config.ClusterRoleBindingsResource:
+		list, err := wh.RestAPIClient.RbacV1().ClusterRoleBindings().List(ctx, options)
+		if err != nil {
+			return nil, err
+		}
+		for i := range list.Items {
+			objects = append(objects, &list.Items[i])
+		}
+	default:
+		list, err := wh.RestAPIClient.CoreV1().ServiceAccounts(namespace).List(ctx, options)
+		if err != nil {
+			return nil, err
+		}
+		for i := range list.Items {
+			objects = append(objects, &list.Items[i])
+		}
+	}
+	return objects, nil
+}
+
+// handleRBACWatch evaluates again the permissions of the workloads affected by an event, only the changes are reported
+func (wh *WatchHandler) handleRBACWatch(ctx context.Context, resource string, rbacWatcher watch.Interface, newStateChan <-chan bool) {
+	rbacChan := rbacWatcher.ResultChan()
+	for {
+		var event watch.Event
+		var chanActive bool
+		select {
+		case event, chanActive = <-rbacChan:
+			if !chanActive {
+				rbacWatcher.Stop()
+				return
+			}
+		case <-ctx.Done():
+			rbacWatcher.Stop()
+			return
+		case <-newStateChan:
+			rbacWatcher.Stop()
+			return
+		}
+		if event.Type == watch.Error {
+			logger.L().Ctx(ctx).Error(resource+" watch chan loop", helpers.Interface("error", event.Object))
+			rbacWatcher.Stop()
+			return
+		}
+		if event.Type != watch.Added && event.Type != watch.Modified && event.Type != watch.Deleted {
+			continue
+		}
+		if wh.reportPermissionsChanges(wh.handleRBACEvent(ctx, event)) {
+			informNewDataArrive(wh)
+		}
+	}
+}
+
+// handleRBACEvent updates the permissions tracker. The service accounts of the namespaces that are not watched are
+// ignored, the role bindings are kept when one of their subjects can be a watched service account, and the roles since
+// such a binding may refer to a role of its namespace
+func (wh *WatchHandler) handleRBACEvent(ctx context.Context, event watch.Event) []permissionsChange {
+	deleted := event.Type == watch.Deleted
+	switch object := event.Object.(type) {
+	case *rbac.Role:
+		return wh.permissions.observeRole(object, deleted)
+	case *rbac.ClusterRole:
+		return wh.permissions.observeClusterRole(object, deleted)
+	case *rbac.RoleBinding:
+		// a binding whose subjects changed to unwatched service accounts is forgotten
+		if !wh.isNamespaceWatched(object.Namespace) && !wh.subjectsWatched(object.Subjects, object.Namespace) {
+			deleted = true
+		}
+		return wh.permissions.observeRoleBinding(object, deleted)
+	case *rbac.ClusterRoleBinding:
+		return wh.permissions.observeClusterRoleBinding(object, deleted)
+	case *core.ServiceAccount:
+		if wh.isNamespaceWatched(object.Namespace) {
+			return wh.permissions.observeServiceAccount(object, deleted)
+		}
+	default:
+		logger.L().Ctx(ctx).Error("Watch error: cannot convert to an RBAC object", helpers.Interface("error", event))
+	}
+	return nil
+}
+
+// subjectsWatched returns true if one of the subjects can be a service account of a watched namespace
+func (wh *WatchHandler) subjectsWatched(subjects []rbac.Subject, bindingNamespace string) bool {
+	for _, subject := range subjects {
+		switch subject.Kind {
+		case rbac.ServiceAccountKind:
+			if wh.isNamespaceWatched(defaultString(subject.Namespace, bindingNamespace)) {
+				return true
+			}
+		case rbac.UserKind:
+			// system:serviceaccount:<namespace>:<name>
+			if parts := strings.Split(subject.Name, ":"); len(parts) == 4 && parts[0] == "system" && parts[1] == "serviceaccount" &&
+				wh.isNamespaceWatched(parts[2]) {
+				return true
+			}
+		case rbac.GroupKind:
+			switch {
+			case subject.Name == "system:serviceaccounts", subject.Name == "system:authenticated":
+				return true
+			case strings.HasPrefix(subject.Name, "system:serviceaccounts:") && wh.isNamespaceWatched(strings.TrimPrefix(subject.Name, "system:serviceaccounts:")):
+				return true
+			}
+		}
+	}
+	return false
+}
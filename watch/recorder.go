@@ -0,0 +1,107 @@
+package watch
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	logger "github.com/kubescape/go-logger"
+	"github.com/kubescape/go-logger/helpers"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+	restclient "k8s.io/client-go/rest"
+)
+
+// recordedObjectType is the type of the records of the objects read from the API server by the handlers, e.g. the owners of a pod
+const recordedObjectType watch.EventType = "OBJECT"
+
+// recordedEvent is a line of an events recording
+type recordedEvent struct {
+	Time time.Time `json:"time"`
+	// Resource is the watched resource, it is empty for the objects read from the API server
+	Resource string          `json:"resource,omitempty"`
+	Type     watch.EventType `json:"type"`
+	Object   json.RawMessage `json:"object"`
+}
+
+// eventRecorder writes the watch events reaching the handlers, and the objects the handlers read, as NDJSON. The objects
+// are recorded raw, the redaction rules do not apply to them
+type eventRecorder struct {
+	encoder *json.Encoder
+	// stopped is set once the recording is stopped, e.g. when a redaction policy is loaded
+	stopped bool
+	mutex   sync.Mutex
+}
+
+func newEventRecorder(w io.Writer) *eventRecorder {
+	return &eventRecorder{encoder: json.NewEncoder(w)}
+}
+
+func (r *eventRecorder) record(resource string, eventType watch.EventType, object json.RawMessage) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.stopped {
+		return
+	}
+	if err := r.encoder.Encode(recordedEvent{Time: time.Now().UTC(), Resource: resource, Type: eventType, Object: object}); err != nil {
+		logger.L().Error("failed to record event", helpers.String("resource", resource), helpers.Error(err))
+	}
+}
+
+// stop stops the recording, the events and objects are no longer written
+func (r *eventRecorder) stop() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.stopped = true
+}
+
+// watch records the events of the watcher. A nil recorder returns the watcher as is
+func (r *eventRecorder) watch(resource string, watcher watch.Interface) watch.Interface {
+	if r == nil {
+		return watcher
+	}
+	return watch.Filter(watcher, func(event watch.Event) (watch.Event, bool) {
+		object, err := json.Marshal(event.Object)
+		if err != nil {
+			logger.L().Error("failed to marshal event object", helpers.String("resource", resource), helpers.Error(err))
+			return event, true
+		}
+		r.record(resource, event.Type, object)
+		return event, true
+	})
+}
+
+// kubernetesClient returns a client recording the objects it reads, so they can be served by a fake clientset on replay
+func (r *eventRecorder) kubernetesClient(restConfig *restclient.Config) (kubernetes.Interface, error) {
+	restConfig = restclient.CopyConfig(restConfig)
+	restConfig.Wrap(func(rt http.RoundTripper) http.RoundTripper {
+		return &recordingTransport{recorder: r, roundTripper: rt}
+	})
+	return kubernetes.NewForConfig(restConfig)
+}
+
+// recordingTransport records the JSON responses of get and list requests, watches and logs are not recorded
+type recordingTransport struct {
+	recorder     *eventRecorder
+	roundTripper http.RoundTripper
+}
+
+func (t *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.roundTripper.RoundTrip(req)
+	if err != nil || req.Method != http.MethodGet || resp.StatusCode != http.StatusOK ||
+		req.URL.Query().Get("watch") == "true" || !strings.HasPrefix(resp.Header.Get("Content-Type"), "application/json") {
+		return resp, err
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	t.recorder.record("", recordedObjectType, body)
+	return resp, nil
+}
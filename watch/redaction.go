@@ -0,0 +1,242 @@
+package watch
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	logger "github.com/kubescape/go-logger"
+	"github.com/kubescape/go-logger/helpers"
+	"github.com/kubescape/kollector/config"
+)
+
+// redactor applies the redaction rules to the objects before they are added to the report
+type redactor struct {
+	rules map[JsonType][]redactionRule
+	mutex sync.RWMutex
+	// randomKey keys the hashes when no salt is configured
+	randomKey []byte
+}
+
+type redactionRule struct {
+	path   []pathSegment
+	action string
+	match  *regexp.Regexp
+	// key is the HMAC key of the hash action
+	key []byte
+}
+
+// pathSegment is a single step of a rule path: a map key, an array index or a wildcard
+type pathSegment struct {
+	key      string
+	index    int
+	isIndex  bool
+	wildcard bool
+}
+
+func newRedactor(rules []config.RedactionRule, salt string) (*redactor, error) {
+	randomKey := make([]byte, 32)
+	if _, err := rand.Read(randomKey); err != nil {
+		return nil, fmt.Errorf("failed to generate the redaction salt: %s", err.Error())
+	}
+	r := &redactor{randomKey: randomKey}
+	parsed, err := parseRedactionRules(rules, r.key(salt))
+	if err != nil {
+		return nil, err
+	}
+	r.rules = parsed
+	return r, nil
+}
+
+// key returns the HMAC key of the salt, the random key if the salt is not configured
+func (r *redactor) key(salt string) []byte {
+	if salt == "" {
+		return r.randomKey
+	}
+	return []byte(salt)
+}
+
+// update replaces the redaction rules, the current rules are kept if the new ones are invalid
+func (r *redactor) update(rules []config.RedactionRule, salt string) error {
+	parsed, err := parseRedactionRules(rules, r.key(salt))
+	if err != nil {
+		return err
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.rules = parsed
+	return nil
+}
+
+func parseRedactionRules(rules []config.RedactionRule, key []byte) (map[JsonType][]redactionRule, error) {
+	parsed := make(map[JsonType][]redactionRule)
+	for i := range rules {
+		jtype, ok := jsonTypeByName[rules[i].Kind]
+		if !ok {
+			return nil, fmt.Errorf("redaction rule %d: unknown kind %q", i, rules[i].Kind)
+		}
+		if rules[i].Action != config.RedactionActionDrop && rules[i].Action != config.RedactionActionHash {
+			return nil, fmt.Errorf("redaction rule %d: unknown action %q", i, rules[i].Action)
+		}
+		path, err := parseRedactionPath(rules[i].Path)
+		if err != nil {
+			return nil, fmt.Errorf("redaction rule %d: %s", i, err.Error())
+		}
+		rule := redactionRule{path: path, action: rules[i].Action, key: key}
+		if rules[i].Match != "" {
+			if rule.match, err = regexp.Compile(rules[i].Match); err != nil {
+				return nil, fmt.Errorf("redaction rule %d: invalid match %q: %s", i, rules[i].Match, err.Error())
+			}
+		}
+		parsed[jtype] = append(parsed[jtype], rule)
+	}
+	return parsed, nil
+}
+
+// redact returns a redacted copy of the object, objects without rules are returned as they are. It returns false if the
+// object cannot be redacted, it must be dropped then
+func (r *redactor) redact(data interface{}, jtype JsonType) (interface{}, bool) {
+	if r == nil {
+		return data, true
+	}
+	r.mutex.RLock()
+	rules := r.rules[jtype]
+	r.mutex.RUnlock()
+	if len(rules) == 0 {
+		return data, true
+	}
+	dataBytes, err := json.Marshal(data)
+	if err != nil {
+		logger.L().Error("failed to marshal object for redaction, dropping it", helpers.Error(err))
+		return nil, false
+	}
+	var redacted interface{}
+	if err := json.Unmarshal(dataBytes, &redacted); err != nil {
+		logger.L().Error("failed to unmarshal object for redaction, dropping it", helpers.Error(err))
+		return nil, false
+	}
+	for i := range rules {
+		redacted, _ = rules[i].apply(redacted, rules[i].path)
+	}
+	return redacted, true
+}
+
+// apply walks the path and returns the redacted value, and false if the value itself should be dropped
+func (rule *redactionRule) apply(value interface{}, path []pathSegment) (interface{}, bool) {
+	if len(path) == 0 {
+		return rule.redactValue(value)
+	}
+	segment := path[0]
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			if !segment.wildcard && (segment.isIndex || segment.key != key) {
+				continue
+			}
+			if redacted, keep := rule.apply(child, path[1:]); keep {
+				v[key] = redacted
+			} else {
+				delete(v, key)
+			}
+		}
+	case []interface{}:
+		kept := make([]interface{}, 0, len(v))
+		for i, child := range v {
+			if !segment.wildcard && (!segment.isIndex || segment.index != i) {
+				kept = append(kept, child)
+				continue
+			}
+			if redacted, keep := rule.apply(child, path[1:]); keep {
+				kept = append(kept, redacted)
+			}
+		}
+		return kept, true
+	}
+	return value, true
+}
+
+func (rule *redactionRule) redactValue(value interface{}) (interface{}, bool) {
+	if rule.match != nil {
+		s, ok := value.(string)
+		if !ok || !rule.match.MatchString(s) {
+			return value, true
+		}
+	}
+	if rule.action == config.RedactionActionDrop {
+		return nil, false
+	}
+	return hashValue(rule.key, value), true
+}
+
+// hashValue returns the HMAC-SHA256 of the value, a salted hash resists the dictionary attacks on the low entropy values
+func hashValue(key []byte, value interface{}) string {
+	var valueBytes []byte
+	if s, ok := value.(string); ok {
+		valueBytes = []byte(s)
+	} else {
+		valueBytes, _ = json.Marshal(value)
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write(valueBytes)
+	return "hmac-sha256:" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// parseRedactionPath parses paths like "$.spec.containers[*].env[0].value" or "metadata.annotations['example.com/token']"
+func parseRedactionPath(path string) ([]pathSegment, error) {
+	rest := strings.TrimPrefix(strings.TrimPrefix(path, "$"), ".")
+	if rest == "" {
+		return nil, fmt.Errorf("empty path")
+	}
+	segments := []pathSegment{}
+	for rest != "" {
+		switch rest[0] {
+		case '.':
+			rest = rest[1:]
+		case '[':
+			end := strings.Index(rest, "]")
+			if end < 0 {
+				return nil, fmt.Errorf("invalid path %q: missing ']'", path)
+			}
+			inner := rest[1:end]
+			if len(inner) > 0 && (inner[0] == '\'' || inner[0] == '"') {
+				closing := strings.IndexByte(rest[2:], inner[0])
+				if closing < 0 || len(rest) < closing+4 || rest[closing+3] != ']' {
+					return nil, fmt.Errorf("invalid path %q: unterminated key", path)
+				}
+				segments = append(segments, pathSegment{key: rest[2 : closing+2]})
+				rest = rest[closing+4:]
+				continue
+			}
+			switch {
+			case inner == "*":
+				segments = append(segments, pathSegment{wildcard: true})
+			default:
+				index, err := strconv.Atoi(inner)
+				if err != nil {
+					return nil, fmt.Errorf("invalid path %q: invalid index %q", path, inner)
+				}
+				segments = append(segments, pathSegment{index: index, isIndex: true})
+			}
+			rest = rest[end+1:]
+		default:
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			if key := rest[:end]; key == "*" {
+				segments = append(segments, pathSegment{wildcard: true})
+			} else {
+				segments = append(segments, pathSegment{key: key})
+			}
+			rest = rest[end:]
+		}
+	}
+	return segments, nil
+}
@@ -0,0 +1,130 @@
+package watch
+
+import (
+	"testing"
+
+	"github.com/kubescape/kollector/config"
+	"github.com/stretchr/testify/assert"
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestParseRedactionPath(t *testing.T) {
+	path, err := parseRedactionPath("$.spec.containers[*].env[0].value")
+	assert.NoError(t, err)
+	assert.Equal(t, []pathSegment{{key: "spec"}, {key: "containers"}, {wildcard: true}, {key: "env"}, {index: 0, isIndex: true}, {key: "value"}}, path)
+
+	path, err = parseRedactionPath("metadata.annotations['kubectl.kubernetes.io/last-applied-configuration']")
+	assert.NoError(t, err)
+	assert.Equal(t, []pathSegment{{key: "metadata"}, {key: "annotations"}, {key: "kubectl.kubernetes.io/last-applied-configuration"}}, path)
+
+	path, err = parseRedactionPath(`metadata.labels["team"]`)
+	assert.NoError(t, err)
+	assert.Equal(t, []pathSegment{{key: "metadata"}, {key: "labels"}, {key: "team"}}, path)
+
+	for _, invalid := range []string{"", "$", "spec.containers[*", "spec.containers[a]", "metadata.annotations['key]"} {
+		_, err = parseRedactionPath(invalid)
+		assert.Errorf(t, err, "path %q should be invalid", invalid)
+	}
+}
+
+func TestRedact(t *testing.T) {
+	r, err := newRedactor([]config.RedactionRule{
+		{Kind: "microservice", Path: "spec.containers[*].env[*].value", Action: config.RedactionActionHash},
+		{Kind: "microservice", Path: "metadata.annotations['example.com/token']", Action: config.RedactionActionDrop},
+		{Kind: "microservice", Path: "spec.containers[*].args[*]", Action: config.RedactionActionDrop, Match: "^--password="},
+	}, "salt")
+	assert.NoError(t, err)
+
+	pod := &core.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "payments",
+			Annotations: map[string]string{"example.com/token": "abc", "owner": "payments"},
+		},
+		Spec: core.PodSpec{
+			Containers: []core.Container{{
+				Name: "server",
+				Args: []string{"--port=8080", "--password=hunter2"},
+				Env:  []core.EnvVar{{Name: "DB_PASSWORD", Value: "hunter2"}, {Name: "FROM_SECRET", ValueFrom: &core.EnvVarSource{}}},
+			}},
+		},
+	}
+	data := MicroServiceData{Pod: pod, Owner: OwnerDet{Name: "payments", Kind: "Deployment"}, PodSpecId: 1}
+
+	var jsonReport jsonFormat
+	jsonReport.redactor = r
+	jsonReport.AddToJsonFormat(data, MICROSERVICES, CREATED)
+	jsonReport.AddToJsonFormat(data, PODS, CREATED)
+
+	redacted := jsonReport.MicroServices.Created[0].(map[string]interface{})
+	metadata := redacted["metadata"].(map[string]interface{})
+	assert.Equal(t, map[string]interface{}{"owner": "payments"}, metadata["annotations"])
+
+	container := redacted["spec"].(map[string]interface{})["containers"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, []interface{}{"--port=8080"}, container["args"])
+	env := container["env"].([]interface{})
+	assert.Equal(t, hashValue([]byte("salt"), "hunter2"), env[0].(map[string]interface{})["value"])
+	assert.NotContains(t, env[1], "value")
+	assert.Equal(t, 1.0, redacted["podSpecId"])
+
+	// the original object is left untouched and kinds without rules are not converted
+	assert.Equal(t, "hunter2", pod.Spec.Containers[0].Env[0].Value)
+	assert.IsType(t, MicroServiceData{}, jsonReport.Pods.Created[0])
+}
+
+func TestNewRedactorErrors(t *testing.T) {
+	r, err := newRedactor(nil, "")
+	assert.NoError(t, err)
+	data := MicroServiceData{PodSpecId: 1}
+	redacted, ok := r.redact(data, MICROSERVICES)
+	assert.True(t, ok)
+	assert.Equal(t, data, redacted)
+
+	assert.NoError(t, r.update([]config.RedactionRule{{Kind: "microservice", Path: "podSpecId", Action: config.RedactionActionDrop}}, ""))
+	redacted, _ = r.redact(data, MICROSERVICES)
+	assert.NotContains(t, redacted, "podSpecId")
+	assert.Error(t, r.update([]config.RedactionRule{{Kind: "microservice", Path: "", Action: config.RedactionActionDrop}}, ""))
+	redacted, _ = r.redact(data, MICROSERVICES)
+	assert.NotContains(t, redacted, "podSpecId", "invalid rules should not replace the current ones")
+
+	_, err = newRedactor([]config.RedactionRule{{Kind: "deployment", Path: "spec", Action: config.RedactionActionDrop}}, "")
+	assert.Error(t, err)
+	_, err = newRedactor([]config.RedactionRule{{Kind: "pod", Path: "spec", Action: "mask"}}, "")
+	assert.Error(t, err)
+	_, err = newRedactor([]config.RedactionRule{{Kind: "pod", Path: "spec", Action: config.RedactionActionDrop, Match: "("}}, "")
+	assert.Error(t, err)
+}
+
+func TestRedactHashSalt(t *testing.T) {
+	rules := []config.RedactionRule{{Kind: "node", Path: "name", Action: config.RedactionActionHash}}
+	hash := func(r *redactor) interface{} {
+		redacted, ok := r.redact(NodeData{Name: "node-1"}, NODE)
+		assert.True(t, ok)
+		return redacted.(map[string]interface{})["name"]
+	}
+	salted, err := newRedactor(rules, "salt")
+	assert.NoError(t, err)
+	otherSalt, err := newRedactor(rules, "other")
+	assert.NoError(t, err)
+	assert.Equal(t, hashValue([]byte("salt"), "node-1"), hash(salted))
+	assert.NotEqual(t, hash(salted), hash(otherSalt))
+
+	unsalted, err := newRedactor(rules, "")
+	assert.NoError(t, err)
+	otherUnsalted, err := newRedactor(rules, "")
+	assert.NoError(t, err)
+	assert.NotEqual(t, hash(unsalted), hash(otherUnsalted), "a random salt is used without a configured one")
+	assert.Equal(t, hash(unsalted), hash(unsalted))
+}
+
+func TestRedactDropsUnmarshalableObjects(t *testing.T) {
+	r, err := newRedactor([]config.RedactionRule{{Kind: "node", Path: "name", Action: config.RedactionActionDrop}}, "")
+	assert.NoError(t, err)
+	_, ok := r.redact(map[string]interface{}{"name": make(chan int)}, NODE)
+	assert.False(t, ok)
+
+	var jsonReport jsonFormat
+	jsonReport.redactor = r
+	jsonReport.AddToJsonFormat(map[string]interface{}{"name": make(chan int)}, NODE, CREATED)
+	assert.Nil(t, jsonReport.Nodes, "the object is dropped")
+}
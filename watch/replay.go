@@ -0,0 +1,272 @@
+package watch
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	logger "github.com/kubescape/go-logger"
+	"github.com/kubescape/go-logger/helpers"
+	"github.com/kubescape/kollector/config"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	eventsv1 "k8s.io/api/events/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/kubernetes/scheme"
+	metadatafake "k8s.io/client-go/metadata/fake"
+	"k8s.io/client-go/testing"
+)
+
+// Replay pushes a recorded events stream through the watch handlers against a fake clientset and returns the reports.
+// The objects the handlers read while recording are served by the fake clientset. The first report aggregates the
+// leading added events, then a report is produced for every event that changed the reported state
+func Replay(ctx context.Context, config config.IConfig, recording io.Reader) ([][]byte, error) {
+	events, err := readRecording(recording)
+	if err != nil {
+		return nil, err
+	}
+
+	clientset := fake.NewSimpleClientset()
+	for i := range events {
+		if events[i].Type == recordedObjectType {
+			addRecordedObjects(clientset.Tracker(), events[i].Object)
+		}
+	}
+	wh, err := newWatchHandlerWithClients(config, Clients{
+		KubernetesClient: clientset,
+		MetadataClient:   metadatafake.NewSimpleMetadataClient(metadatafake.NewTestScheme()),
+	})
+	if err != nil {
+		return nil, err
+	}
+	// the recorded cluster is not the one kollector runs in
+	wh.clusterInfo = newClusterInfo(clientset, nil)
+
+	// the handlers inform about new data once the first report was sent
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case <-wh.informNewDataChannel:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	reports := [][]byte{}
+	addReport := func() {
+		if _, loaded := wh.clusterInfo.Get(); !loaded {
+			wh.clusterInfo.Refresh(ctx)
+		}
+		if !wh.hasReportData() {
+			return
+		}
+		if report := prepareDataToSend(ctx, wh); report != nil {
+			reports = append(reports, report)
+		}
+		wh.SetFirstReportFlag(false)
+	}
+	for i := range events {
+		if events[i].Type == recordedObjectType {
+			continue
+		}
+		if wh.getFirstReportFlag() && events[i].Type != watch.Added {
+			addReport()
+		}
+		if err := wh.replayEvent(ctx, clientset.Tracker(), &events[i]); err != nil {
+			return nil, fmt.Errorf("event %d: %s", i, err.Error())
+		}
+		if !wh.getFirstReportFlag() {
+			addReport()
+		}
+	}
+	if wh.getFirstReportFlag() {
+		addReport()
+	}
+	return reports, nil
+}
+
+func readRecording(recording io.Reader) ([]recordedEvent, error) {
+	events := []recordedEvent{}
+	scanner := bufio.NewScanner(recording)
+	scanner.Buffer(make([]byte, 0, 1024*1024), 64*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		event := recordedEvent{}
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			return nil, fmt.Errorf("invalid recording line %d: %s", line, err.Error())
+		}
+		events = append(events, event)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read recording: %s", err.Error())
+	}
+	return events, nil
+}
+
+// addRecordedObjects adds an object, or the items of a list, read from the API server to the fake clientset
+func addRecordedObjects(tracker testing.ObjectTracker, data []byte) {
+	object, _, err := scheme.Codecs.UniversalDeserializer().Decode(data, nil, nil)
+	if err != nil {
+		// e.g. the server version
+		logger.L().Debug("skipping recorded object", helpers.Error(err))
+		return
+	}
+	objects := []runtime.Object{object}
+	if meta.IsListType(object) {
+		if objects, err = meta.ExtractList(object); err != nil {
+			logger.L().Debug("skipping recorded list", helpers.Error(err))
+			return
+		}
+	}
+	for i := range objects {
+		if err := upsertObject(tracker, objects[i]); err != nil {
+			logger.L().Debug("skipping recorded object", helpers.Error(err))
+		}
+	}
+}
+
+func upsertObject(tracker testing.ObjectTracker, object runtime.Object) error {
+	gvks, _, err := scheme.Scheme.ObjectKinds(object)
+	if err != nil {
+		return err
+	}
+	accessor, err := meta.Accessor(object)
+	if err != nil {
+		return err
+	}
+	gvr, _ := meta.UnsafeGuessKindToResource(gvks[0])
+	if err := tracker.Add(object); apierrors.IsAlreadyExists(err) {
+		return tracker.Update(gvr, object, accessor.GetNamespace())
+	} else {
+		return err
+	}
+}
+
+// replayEvent keeps the fake clientset up to date and pushes the event through the handler of its resource
+func (wh *WatchHandler) replayEvent(ctx context.Context, tracker testing.ObjectTracker, recorded *recordedEvent) error {
+	var object runtime.Object
+	switch recorded.Resource {
+	case config.PodsResource:
+		object = &corev1.Pod{}
+	case config.NodesResource:
+		object = &corev1.Node{}
+	case config.ServicesResource:
+		object = &corev1.Service{}
+	case config.NamespacesResource:
+		object = &corev1.Namespace{}
+	case config.CronJobsResource:
+		object = &batchv1.CronJob{}
+	case config.SecretsResource:
+		object = &metav1.PartialObjectMetadata{}
+	case config.EventsResource:
+		object = &eventsv1.Event{}
+	case config.IngressesResource:
+		object = &networkingv1.Ingress{}
+	case config.NetworkPoliciesResource:
+		object = &networkingv1.NetworkPolicy{}
+	case config.GatewaysResource, config.HTTPRoutesResource:
+		object = &unstructured.Unstructured{}
+	case config.RolesResource:
+		object = &rbacv1.Role{}
+	case config.ClusterRolesResource:
+		object = &rbacv1.ClusterRole{}
+	case config.RoleBindingsResource:
+		object = &rbacv1.RoleBinding{}
+	case config.ClusterRoleBindingsResource:
+		object = &rbacv1.ClusterRoleBinding{}
+	case config.ServiceAccountsResource:
+		object = &corev1.ServiceAccount{}
+	default:
+		return fmt.Errorf("unknown resource %q", recorded.Resource)
+	}
+	if err := json.Unmarshal(recorded.Object, object); err != nil {
+		return fmt.Errorf("invalid %s object: %s", recorded.Resource, err.Error())
+	}
+
+	// the secrets are metadata only and the Gateway API resources are not known to the fake clientset
+	if recorded.Resource != config.SecretsResource && recorded.Resource != config.GatewaysResource && recorded.Resource != config.HTTPRoutesResource {
+		switch recorded.Type {
+		case watch.Added, watch.Modified:
+			if err := upsertObject(tracker, object.DeepCopyObject()); err != nil {
+				return err
+			}
+		case watch.Deleted:
+			if accessor, err := meta.Accessor(object); err == nil {
+				gvr := corev1.SchemeGroupVersion.WithResource(recorded.Resource)
+				switch recorded.Resource {
+				case config.CronJobsResource:
+					gvr = batchv1.SchemeGroupVersion.WithResource(recorded.Resource)
+				case config.EventsResource:
+					gvr = eventsv1.SchemeGroupVersion.WithResource(recorded.Resource)
+				case config.IngressesResource, config.NetworkPoliciesResource:
+					gvr = networkingv1.SchemeGroupVersion.WithResource(recorded.Resource)
+				case config.RolesResource, config.ClusterRolesResource, config.RoleBindingsResource, config.ClusterRoleBindingsResource:
+					gvr = rbacv1.SchemeGroupVersion.WithResource(recorded.Resource)
+				}
+				tracker.Delete(gvr, accessor.GetNamespace(), accessor.GetName())
+			}
+		}
+	}
+
+	// every event is handled as if it was the first of its watch, so none is skipped as already reported
+	var lastWatchEventCreationTime time.Time
+	noNewState := make(chan bool)
+	event := watch.Event{Type: recorded.Type, Object: object}
+	switch recorded.Resource {
+	case config.PodsResource:
+		wh.handlePodWatch(ctx, newEventsWatcher(event), noNewState, nil, &lastWatchEventCreationTime)
+	case config.NodesResource:
+		wh.handleNodeWatch(ctx, newEventsWatcher(event), noNewState, &lastWatchEventCreationTime)
+	case config.ServicesResource:
+		wh.handleServiceWatch(ctx, newEventsWatcher(event), noNewState, nil, &lastWatchEventCreationTime)
+	case config.CronJobsResource:
+		wh.handleCronJobWatch(ctx, newEventsWatcher(event), noNewState, &lastWatchEventCreationTime)
+	case config.NamespacesResource:
+		if err := wh.NamespaceEventHandler(ctx, &event, lastWatchEventCreationTime); err != nil {
+			logger.L().Ctx(ctx).Warning("failed to replay namespace event", helpers.Error(err))
+		}
+	case config.SecretsResource:
+		if err := wh.secretEventHandler(&event, lastWatchEventCreationTime); err != nil {
+			logger.L().Ctx(ctx).Warning("failed to replay secret event", helpers.Error(err))
+		}
+	case config.EventsResource:
+		wh.handleEventWatch(ctx, newEventsWatcher(event), noNewState)
+	case config.IngressesResource:
+		wh.handleIngressWatch(ctx, newEventsWatcher(event), noNewState)
+	case config.NetworkPoliciesResource:
+		wh.handleNetworkPolicyWatch(ctx, newEventsWatcher(event), noNewState, &lastWatchEventCreationTime)
+	case config.GatewaysResource, config.HTTPRoutesResource:
+		wh.handleGatewayAPIWatch(ctx, recorded.Resource, newEventsWatcher(event), noNewState)
+	default:
+		wh.handleRBACWatch(ctx, recorded.Resource, newEventsWatcher(event), noNewState)
+	}
+	return nil
+}
+
+// hasReportData returns true if objects were added to the report since it was last sent
+func (wh *WatchHandler) hasReportData() bool {
+	jsonReport := &wh.jsonReport
+	defer jsonReport.lock()()
+	if jsonReport.ClusterInfoChange != nil {
+		return true
+	}
+	return jsonReport.Nodes.Len()+jsonReport.Services.Len()+jsonReport.MicroServices.Len()+
+		jsonReport.Pods.Len()+jsonReport.Secret.Len()+jsonReport.Namespace.Len()+jsonReport.Crashes.Len()+jsonReport.Events.Len()+jsonReport.Images.Len()+
+		jsonReport.Exposures.Len()+jsonReport.NetworkPolicies.Len()+jsonReport.NetworkIsolation.Len()+jsonReport.Permissions.Len() > 0
+}
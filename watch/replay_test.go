@@ -0,0 +1,97 @@
+package watch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/armosec/utils-k8s-go/armometadata"
+	"github.com/kubescape/backend/pkg/utils"
+	"github.com/kubescape/kollector/config"
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+func TestReplay(t *testing.T) {
+	var recording bytes.Buffer
+	recorder := newEventRecorder(&recording)
+
+	// the owners of the pod, as read by the pod handler while recording
+	replicaSets, err := json.Marshal(&appsv1.ReplicaSetList{
+		TypeMeta: metav1.TypeMeta{Kind: "ReplicaSetList", APIVersion: "apps/v1"},
+		Items: []appsv1.ReplicaSet{{
+			TypeMeta: metav1.TypeMeta{Kind: "ReplicaSet", APIVersion: "apps/v1"},
+			ObjectMeta: metav1.ObjectMeta{Name: "api-5d8f", Namespace: "payments",
+				OwnerReferences: []metav1.OwnerReference{{Kind: "Deployment", Name: "api", APIVersion: "apps/v1"}}},
+		}},
+	})
+	assert.NoError(t, err)
+	recorder.record("", recordedObjectType, replicaSets)
+	deployment, err := json.Marshal(&appsv1.Deployment{
+		TypeMeta:   metav1.TypeMeta{Kind: "Deployment", APIVersion: "apps/v1"},
+		ObjectMeta: metav1.ObjectMeta{Name: "api", Namespace: "payments"},
+	})
+	assert.NoError(t, err)
+	recorder.record("", recordedObjectType, deployment)
+	// e.g. the server version, which is not an object
+	recorder.record("", recordedObjectType, json.RawMessage(`{"gitVersion":"v1.30.2"}`))
+
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "api-5d8f-x2k", Namespace: "payments", UID: "1",
+		OwnerReferences: []metav1.OwnerReference{{Kind: "ReplicaSet", Name: "api-5d8f", APIVersion: "apps/v1"}}}}
+	runningPod := pod.DeepCopy()
+	runningPod.Status.Phase = corev1.PodRunning
+	consume := func(resource string, events ...watch.Event) {
+		watcher := recorder.watch(resource, newEventsWatcher(events...))
+		for range watcher.ResultChan() {
+		}
+	}
+	consume(config.NamespacesResource, watch.Event{Type: watch.Added, Object: &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "payments"}}})
+	consume(config.PodsResource,
+		watch.Event{Type: watch.Added, Object: pod},
+		watch.Event{Type: watch.Modified, Object: runningPod},
+		watch.Event{Type: watch.Deleted, Object: runningPod})
+
+	kollectorConfig := config.NewKollectorConfig(&armometadata.ClusterConfig{ClusterName: "payments-cluster"}, utils.Credentials{}, "")
+	reports, err := Replay(context.Background(), kollectorConfig, &recording)
+	assert.NoError(t, err)
+	if !assert.Len(t, reports, 3, "the first report, the pod update and the pod removal") {
+		return
+	}
+
+	var first map[string]interface{}
+	assert.NoError(t, json.Unmarshal(reports[0], &first))
+	assert.Equal(t, true, first["firstReport"])
+	assert.NotNil(t, first["clusterAPIServerVersion"])
+	assert.Contains(t, first, "namespace")
+	assert.Contains(t, first, "pod")
+	assert.Contains(t, string(reports[0]), `"uptreeOwner":{"name":"api","kind":"Deployment"}`)
+
+	assert.Contains(t, string(reports[1]), `"update"`)
+	assert.Contains(t, string(reports[2]), `"delete"`)
+}
+
+func TestReplayInvalidRecording(t *testing.T) {
+	kollectorConfig := config.NewKollectorConfig(&armometadata.ClusterConfig{}, utils.Credentials{}, "")
+	_, err := Replay(context.Background(), kollectorConfig, bytes.NewBufferString("{\n"))
+	assert.Error(t, err)
+}
+
+func TestRecordingRedactionPolicy(t *testing.T) {
+	settings := config.DefaultSettings()
+	settings.RecordEventsFile = t.TempDir() + "/events.ndjson"
+	kollectorConfig := config.NewKollectorConfig(&armometadata.ClusterConfig{ClusterName: "test"}, utils.Credentials{}, "").SetSettings(settings).
+		SetRedactionRules([]config.RedactionRule{{Kind: "microservice", Path: "spec.containers[*].env[*].value", Action: config.RedactionActionDrop}})
+	_, err := newWatchHandler(kollectorConfig, newOptions())
+	assert.ErrorContains(t, err, "redaction policy", "the recording would hold the objects unredacted")
+
+	var recording bytes.Buffer
+	recorder := newEventRecorder(&recording)
+	recorder.record(config.PodsResource, watch.Added, json.RawMessage(`{}`))
+	recorder.stop()
+	recorder.record(config.PodsResource, watch.Added, json.RawMessage(`{}`))
+	assert.Equal(t, 1, bytes.Count(recording.Bytes(), []byte("\n")), "nothing is recorded once stopped")
+}
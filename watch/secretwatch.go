@@ -8,17 +8,20 @@ import (
 
 	logger "github.com/kubescape/go-logger"
 	"github.com/kubescape/go-logger/helpers"
+	"github.com/kubescape/kollector/config"
 	"golang.org/x/net/context"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/watch"
 )
 
-// secretData -
+// secretData - only the metadata of the secrets is watched, the secret payload never reaches kollector
 type secretData struct {
-	Secret *corev1.Secret `json:",inline"`
+	Secret *metav1.PartialObjectMetadata `json:",inline"`
 }
 
+var secretsResource = corev1.SchemeGroupVersion.WithResource(config.SecretsResource)
+
 // SecretWatch watch over secrets
 func (wh *WatchHandler) SecretWatch(ctx context.Context) {
 	defer func() {
@@ -27,16 +30,17 @@ func (wh *WatchHandler) SecretWatch(ctx context.Context) {
 		}
 	}()
 	var lastWatchEventCreationTime time.Time
-	newStateChan := make(chan bool)
-	wh.newStateReportChans = append(wh.newStateReportChans, newStateChan)
+	newStateChan, unsubscribe := wh.subscribeNewState()
+	defer unsubscribe()
 WatchLoop:
-	for {
+	for ctx.Err() == nil {
 		logger.L().Info("Watching over secrets starting")
-		secretsWatcher, err := wh.RestAPIClient.CoreV1().Secrets("").Watch(globalHTTPContext, metav1.ListOptions{Watch: true})
+		secretsWatcher, err := wh.metadataClient.Resource(secretsResource).Namespace(wh.namespaceFilter.watchNamespace()).Watch(ctx, wh.listOptions(config.SecretsResource))
 		if err != nil {
 			time.Sleep(1 * time.Second)
 			continue
 		}
+		secretsWatcher = wh.recorder.watch(config.SecretsResource, secretsWatcher)
 		secretsChan := secretsWatcher.ResultChan()
 		logger.L().Info("Watching over secrets started")
 	ChanLoop:
@@ -44,8 +48,14 @@ WatchLoop:
 			var event watch.Event
 			select {
 			case event = <-secretsChan:
-			case <-newStateChan:
+			case <-ctx.Done():
+				secretsWatcher.Stop()
+				return
+			case newState := <-newStateChan:
 				secretsWatcher.Stop()
+				if !newState {
+					lastWatchEventCreationTime = time.Now()
+				}
 				continue WatchLoop
 			}
 
@@ -61,11 +71,12 @@ WatchLoop:
 	}
 }
 func (wh *WatchHandler) secretEventHandler(event *watch.Event, lastWatchEventCreationTime time.Time) error {
-	if secret, ok := event.Object.(*corev1.Secret); ok {
+	if secret, ok := event.Object.(*metav1.PartialObjectMetadata); ok {
 		if !wh.isNamespaceWatched(secret.Namespace) {
 			return nil
 		}
 		secret.ManagedFields = []metav1.ManagedFieldsEntry{}
+		secret.TypeMeta = metav1.TypeMeta{Kind: "Secret", APIVersion: corev1.SchemeGroupVersion.String()}
 		removeSecretData(secret)
 		switch event.Type {
 		case watch.Added:
@@ -73,19 +84,19 @@ func (wh *WatchHandler) secretEventHandler(event *watch.Event, lastWatchEventCre
 				return nil
 			}
 			secretdm := secretData{Secret: secret}
-			id := CreateID()
+			id := wh.ids.CreateID()
 			wh.secretdm.init(id)
 			wh.secretdm.pushBack(id, secretdm)
-			informNewDataArrive(wh)
 			wh.jsonReport.AddToJsonFormat(secret, SECRETS, CREATED)
+			informNewDataArrive(wh)
 		case watch.Modified:
 			wh.updateSecret(secret)
-			informNewDataArrive(wh)
 			wh.jsonReport.AddToJsonFormat(secret, SECRETS, UPDATED)
+			informNewDataArrive(wh)
 		case watch.Deleted:
 			wh.removeSecret(secret)
-			informNewDataArrive(wh)
 			wh.jsonReport.AddToJsonFormat(secret, SECRETS, DELETED)
+			informNewDataArrive(wh)
 		case watch.Bookmark: //only the resource version is changed but it's the same workload
 			return nil
 		case watch.Error:
@@ -98,7 +109,7 @@ func (wh *WatchHandler) secretEventHandler(event *watch.Event, lastWatchEventCre
 }
 
 // UpdateSecret update websocket when secret is updated
-func (wh *WatchHandler) updateSecret(secret *corev1.Secret) {
+func (wh *WatchHandler) updateSecret(secret *metav1.PartialObjectMetadata) {
 	for _, id := range wh.secretdm.getIDs() {
 		front := wh.secretdm.front(id)
 		if front == nil || front.Value == nil {
@@ -123,7 +134,7 @@ func (wh *WatchHandler) updateSecret(secret *corev1.Secret) {
 }
 
 // RemoveSecret update websocket when secret is removed
-func (wh *WatchHandler) removeSecret(secret *corev1.Secret) string {
+func (wh *WatchHandler) removeSecret(secret *metav1.PartialObjectMetadata) string {
 	for _, id := range wh.secretdm.getIDs() {
 		front := wh.secretdm.front(id)
 		if front == nil || front.Value == nil {
@@ -149,8 +160,9 @@ func (wh *WatchHandler) removeSecret(secret *corev1.Secret) string {
 	}
 	return ""
 }
-func removeSecretData(secret *corev1.Secret) {
-	secret.Data = nil
+
+// removeSecretData removes the annotations that may hold a copy of the secret payload
+func removeSecretData(secret *metav1.PartialObjectMetadata) {
 	if secret.Annotations != nil {
 		delete(secret.Annotations, "data")
 		delete(secret.Annotations, "kubectl.kubernetes.io/last-applied-configuration")
@@ -0,0 +1,74 @@
+package watch
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/armosec/utils-k8s-go/armometadata"
+	"github.com/kubescape/backend/pkg/utils"
+	"github.com/kubescape/kollector/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes/fake"
+	metadatafake "k8s.io/client-go/metadata/fake"
+)
+
+func TestSecretWatchReportsMetadataOnly(t *testing.T) {
+	metadataClient := metadatafake.NewSimpleMetadataClient(metadatafake.NewTestScheme())
+	kollectorConfig := config.NewKollectorConfig(&armometadata.ClusterConfig{ClusterName: "test"}, utils.Credentials{}, "")
+	wh, err := newWatchHandlerWithClients(kollectorConfig, Clients{KubernetesClient: fake.NewSimpleClientset(), MetadataClient: metadataClient})
+	require.NoError(t, err)
+
+	secretsWatcher, err := wh.metadataClient.Resource(secretsResource).Namespace("").Watch(context.Background(), wh.listOptions("secrets"))
+	assert.NoError(t, err)
+	defer secretsWatcher.Stop()
+
+	secret := &metav1.PartialObjectMetadata{
+		TypeMeta: metav1.TypeMeta{Kind: "Secret", APIVersion: "v1"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "db-credentials",
+			Namespace: "payments",
+			Annotations: map[string]string{
+				"kubectl.kubernetes.io/last-applied-configuration": `{"apiVersion":"v1","data":{"password":"c2VjcmV0"},"kind":"Secret"}`,
+				"owner": "payments",
+			},
+		},
+	}
+	_, err = metadataClient.Resource(secretsResource).Namespace("payments").(metadatafake.MetadataClient).CreateFake(secret, metav1.CreateOptions{})
+	assert.NoError(t, err)
+
+	event := <-secretsWatcher.ResultChan()
+	assert.Equal(t, watch.Added, event.Type)
+	assert.NoError(t, wh.secretEventHandler(&event, time.Time{}))
+
+	// a full secret object is never accepted
+	fullSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "leaked", Namespace: "payments"},
+		Data:       map[string][]byte{"password": []byte("secret")},
+		StringData: map[string]string{"token": "secret"},
+	}
+	assert.Error(t, wh.secretEventHandler(&watch.Event{Type: watch.Added, Object: fullSecret}, time.Time{}))
+
+	assert.Equal(t, 1, wh.jsonReport.Secret.Len())
+	report, err := json.Marshal(wh.jsonReport)
+	assert.NoError(t, err)
+
+	reported := struct {
+		Secret struct {
+			Created []map[string]interface{} `json:"create"`
+		} `json:"secret"`
+	}{}
+	assert.NoError(t, json.Unmarshal(report, &reported))
+	assert.Len(t, reported.Secret.Created, 1)
+	assert.NotContains(t, reported.Secret.Created[0], "data")
+	assert.NotContains(t, reported.Secret.Created[0], "stringData")
+	assert.Equal(t, "Secret", reported.Secret.Created[0]["kind"])
+	assert.NotContains(t, string(report), "c2VjcmV0")
+	assert.NotContains(t, string(report), "last-applied-configuration")
+	assert.Contains(t, string(report), "db-credentials")
+}
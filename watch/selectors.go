@@ -0,0 +1,62 @@
+package watch
+
+import (
+	"reflect"
+	"strings"
+
+	"github.com/kubescape/kollector/config"
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// setResourceSelectors replaces the resource selectors, returns true if they changed
+func (wh *WatchHandler) setResourceSelectors(selectors map[string]config.ResourceSelector) (bool, error) {
+	if err := config.ValidateResourceSelectors(selectors); err != nil {
+		return false, err
+	}
+	wh.resourceSelectorsMutex.Lock()
+	defer wh.resourceSelectorsMutex.Unlock()
+	if reflect.DeepEqual(wh.resourceSelectors, selectors) {
+		return false, nil
+	}
+	wh.resourceSelectors = selectors
+	return true, nil
+}
+
+// listOptions returns the watch options of a resource, combining the namespace filter with the resource selectors
+func (wh *WatchHandler) listOptions(resource string) metav1.ListOptions {
+	var options metav1.ListOptions
+	switch resource {
+	case config.NamespacesResource:
+		options = wh.namespaceFilter.namespaceListOptions()
+	case config.NodesResource, config.ClusterRolesResource, config.ClusterRoleBindingsResource:
+		options = metav1.ListOptions{Watch: true}
+	case config.RolesResource, config.RoleBindingsResource:
+		// a binding of an excluded namespace may grant the service accounts of a watched one
+		options = metav1.ListOptions{Watch: true}
+	case config.EventsResource:
+		options = wh.namespaceFilter.listOptions()
+		options.FieldSelector = joinSelectors(options.FieldSelector, "type="+core.EventTypeWarning)
+	default:
+		options = wh.namespaceFilter.listOptions()
+	}
+	wh.resourceSelectorsMutex.RLock()
+	selector, ok := wh.resourceSelectors[resource]
+	wh.resourceSelectorsMutex.RUnlock()
+	if ok {
+		options.LabelSelector = joinSelectors(options.LabelSelector, selector.LabelSelector)
+		options.FieldSelector = joinSelectors(options.FieldSelector, selector.FieldSelector)
+	}
+	return options
+}
+
+// joinSelectors ANDs label or field selectors
+func joinSelectors(selectors ...string) string {
+	nonEmpty := []string{}
+	for i := range selectors {
+		if selectors[i] != "" {
+			nonEmpty = append(nonEmpty, selectors[i])
+		}
+	}
+	return strings.Join(nonEmpty, ",")
+}
@@ -0,0 +1,61 @@
+package watch
+
+import (
+	"testing"
+
+	"github.com/kubescape/kollector/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListOptions(t *testing.T) {
+	nf, err := newNamespaceFilter(config.NamespaceFilter{Exclude: []string{"kubescape"}, LabelSelector: "team=payments"}, nil)
+	assert.NoError(t, err)
+	selectors := map[string]config.ResourceSelector{
+		config.PodsResource:     {FieldSelector: "status.phase!=Succeeded"},
+		config.SecretsResource:  {FieldSelector: "type!=helm.sh/release.v1"},
+		config.ServicesResource: {LabelSelector: "app.kubernetes.io/part-of=payments"},
+		config.NodesResource:    {LabelSelector: "node-role.kubernetes.io/worker"},
+	}
+	wh := &WatchHandler{namespaceFilter: nf}
+	_, err = wh.setResourceSelectors(selectors)
+	assert.NoError(t, err)
+
+	options := wh.listOptions(config.PodsResource)
+	assert.True(t, options.Watch)
+	assert.Equal(t, "metadata.namespace!=kubescape,status.phase!=Succeeded", options.FieldSelector)
+	assert.Equal(t, "", options.LabelSelector)
+
+	options = wh.listOptions(config.SecretsResource)
+	assert.Equal(t, "metadata.namespace!=kubescape,type!=helm.sh/release.v1", options.FieldSelector)
+
+	options = wh.listOptions(config.ServicesResource)
+	assert.Equal(t, "app.kubernetes.io/part-of=payments", options.LabelSelector)
+
+	options = wh.listOptions(config.NamespacesResource)
+	assert.Equal(t, "metadata.name!=kubescape", options.FieldSelector)
+	assert.Equal(t, "", options.LabelSelector, "the namespace label selector is matched client side")
+
+	options = wh.listOptions(config.NodesResource)
+	assert.Equal(t, "", options.FieldSelector)
+	assert.Equal(t, "node-role.kubernetes.io/worker", options.LabelSelector)
+
+	options = wh.listOptions(config.RoleBindingsResource)
+	assert.Equal(t, "", options.FieldSelector, "the bindings of the excluded namespaces may grant the watched service accounts")
+}
+
+func TestSetResourceSelectors(t *testing.T) {
+	wh := &WatchHandler{}
+	changed, err := wh.setResourceSelectors(map[string]config.ResourceSelector{config.PodsResource: {FieldSelector: "status.phase!=Succeeded"}})
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	assert.Equal(t, "status.phase!=Succeeded", wh.listOptions(config.PodsResource).FieldSelector)
+
+	changed, err = wh.setResourceSelectors(map[string]config.ResourceSelector{config.PodsResource: {FieldSelector: "status.phase!=Succeeded"}})
+	assert.NoError(t, err)
+	assert.False(t, changed)
+
+	changed, err = wh.setResourceSelectors(map[string]config.ResourceSelector{config.PodsResource: {FieldSelector: "status.phase"}})
+	assert.Error(t, err)
+	assert.False(t, changed)
+	assert.Equal(t, "status.phase!=Succeeded", wh.listOptions(config.PodsResource).FieldSelector)
+}
@@ -8,9 +8,11 @@ import (
 
 	logger "github.com/kubescape/go-logger"
 	"github.com/kubescape/go-logger/helpers"
+	"github.com/kubescape/kollector/config"
 	"golang.org/x/net/context"
 	core "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/watch"
 )
 
@@ -26,17 +28,20 @@ func (wh *WatchHandler) ServiceWatch(ctx context.Context) {
 		}
 	}()
 	var lastWatchEventCreationTime time.Time
-	newStateChan := make(chan bool)
-	wh.newStateReportChans = append(wh.newStateReportChans, newStateChan)
-	for {
+	newStateChan, unsubscribe := wh.subscribeNewState()
+	defer unsubscribe()
+	resyncChan, unsubscribeResync := wh.subscribeNamespaceResync()
+	defer unsubscribeResync()
+	for ctx.Err() == nil {
 		logger.L().Info("Watching over services starting")
-		serviceWatcher, err := wh.RestAPIClient.CoreV1().Services("").Watch(globalHTTPContext, metav1.ListOptions{Watch: true})
+		serviceWatcher, err := wh.RestAPIClient.CoreV1().Services(wh.namespaceFilter.watchNamespace()).Watch(ctx, wh.listOptions(config.ServicesResource))
 		if err != nil {
 			time.Sleep(1 * time.Second)
 			lastWatchEventCreationTime = time.Now()
 			continue
 		}
-		wh.handleServiceWatch(serviceWatcher, newStateChan, &lastWatchEventCreationTime)
+		serviceWatcher = wh.recorder.watch(config.ServicesResource, serviceWatcher)
+		wh.handleServiceWatch(ctx, serviceWatcher, newStateChan, resyncChan, &lastWatchEventCreationTime)
 	}
 }
 func updateService(service *core.Service, sdm map[int]*list.List) string {
@@ -76,13 +81,74 @@ func removeService(service *core.Service, sdm map[int]*list.List) string {
 	return ""
 }
 
-func (wh *WatchHandler) handleServiceWatch(serviceWatcher watch.Interface, newStateChan <-chan bool, lastWatchEventCreationTime *time.Time) {
+// resyncNamespaceServices reports the services of a namespace that moved in or out of the label selector as created
+// or deleted
+func (wh *WatchHandler) resyncNamespaceServices(ctx context.Context, resync namespaceResync) {
+	if !resync.watched {
+		for id, v := range wh.sdm {
+			if v == nil || v.Len() == 0 {
+				continue
+			}
+			service := v.Front().Value.(serviceData).Service
+			if service.Namespace != resync.namespace {
+				continue
+			}
+			delete(wh.sdm, id)
+			wh.jsonReport.AddToJsonFormat(service, SERVICES, DELETED)
+			wh.reportExposureChanges(wh.exposure.removeService(service))
+		}
+		informNewDataArrive(wh)
+		return
+	}
+	services, err := wh.RestAPIClient.CoreV1().Services(resync.namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		logger.L().Ctx(ctx).Warning("failed listing the services of a namespace to resync", helpers.String("namespace", resync.namespace), helpers.Error(err))
+		return
+	}
+	objects := make([]runtime.Object, 0, len(services.Items))
+	for i := range services.Items {
+		if !isServiceExist(&services.Items[i], wh.sdm) {
+			objects = append(objects, &services.Items[i])
+		}
+	}
+	// the services existed before the namespace was watched, they are all reported
+	var lastWatchEventCreationTime time.Time
+	wh.handleServiceWatch(ctx, newListWatcher(objects), nil, nil, &lastWatchEventCreationTime)
+}
+
+// isServiceExist returns true if the service is in the services state
+func isServiceExist(service *core.Service, sdm map[int]*list.List) bool {
+	for _, v := range sdm {
+		if v == nil || v.Len() == 0 {
+			continue
+		}
+		current := v.Front().Value.(serviceData).Service
+		if current.Namespace == service.Namespace && current.Name == service.Name {
+			return true
+		}
+	}
+	return false
+}
+
+func (wh *WatchHandler) handleServiceWatch(ctx context.Context, serviceWatcher watch.Interface, newStateChan <-chan bool, resyncChan <-chan namespaceResync, lastWatchEventCreationTime *time.Time) {
 	serviceChan := serviceWatcher.ResultChan()
 	logger.L().Info("Watching over services started")
 	for {
 		var event watch.Event
+		var chanActive bool
 		select {
-		case event = <-serviceChan:
+		case resync := <-resyncChan:
+			wh.resyncNamespaceServices(ctx, resync)
+			continue
+		case event, chanActive = <-serviceChan:
+			if !chanActive {
+				serviceWatcher.Stop()
+				*lastWatchEventCreationTime = time.Now()
+				return
+			}
+		case <-ctx.Done():
+			serviceWatcher.Stop()
+			return
 		case <-newStateChan:
 			serviceWatcher.Stop()
 			*lastWatchEventCreationTime = time.Now()
@@ -102,22 +168,25 @@ func (wh *WatchHandler) handleServiceWatch(serviceWatcher watch.Interface, newSt
 				if service.CreationTimestamp.Time.Before(*lastWatchEventCreationTime) {
 					continue
 				}
-				id := CreateID()
+				id := wh.ids.CreateID()
 				if wh.sdm[id] == nil {
 					wh.sdm[id] = list.New()
 				}
 				sd := serviceData{Service: service}
 				wh.sdm[id].PushBack(sd)
-				informNewDataArrive(wh)
 				wh.jsonReport.AddToJsonFormat(service, SERVICES, CREATED)
+				wh.reportExposureChanges(wh.exposure.observeService(service))
+				informNewDataArrive(wh)
 			case watch.Modified:
 				updateService(service, wh.sdm)
-				informNewDataArrive(wh)
 				wh.jsonReport.AddToJsonFormat(service, SERVICES, UPDATED)
+				wh.reportExposureChanges(wh.exposure.observeService(service))
+				informNewDataArrive(wh)
 			case watch.Deleted:
 				removeService(service, wh.sdm)
-				informNewDataArrive(wh)
 				wh.jsonReport.AddToJsonFormat(service, SERVICES, DELETED)
+				wh.reportExposureChanges(wh.exposure.removeService(service))
+				informNewDataArrive(wh)
 			case watch.Bookmark: //only the resource version is changed but it's the same workload
 				continue
 			case watch.Error:
@@ -0,0 +1,199 @@
+package watch
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	logger "github.com/kubescape/go-logger"
+	"github.com/kubescape/go-logger/helpers"
+	"github.com/kubescape/kollector/config"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	restclient "k8s.io/client-go/rest"
+)
+
+// Snapshot lists the watched resources once and returns them as a first report. It does not connect to the
+// event receiver, so it works outside the cluster with a kubeconfig
+func Snapshot(ctx context.Context, config config.IConfig) ([]byte, error) {
+	wh, err := newWatchHandler(config, newOptions())
+	if err != nil {
+		return nil, err
+	}
+	// the cloud vendor is detected from the instance metadata API, which is only meaningful from a cluster node
+	if _, err := restclient.InClusterConfig(); err != nil {
+		wh.clusterInfo.instanceMetadata = nil
+	}
+	return wh.snapshot(ctx)
+}
+
+// snapshot replays the listed objects through the watch handlers as added events
+func (wh *WatchHandler) snapshot(ctx context.Context) ([]byte, error) {
+	wh.jsonReport.FirstReport = true
+	noNewState := make(chan bool)
+
+	// namespaces are listed first, so the namespace label selector matches the listed labels
+	namespaces, err := wh.RestAPIClient.CoreV1().Namespaces().List(ctx, wh.snapshotListOptions(config.NamespacesResource))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list namespaces: %s", err.Error())
+	}
+	for i := range namespaces.Items {
+		event := watch.Event{Type: watch.Added, Object: &namespaces.Items[i]}
+		if err := wh.NamespaceEventHandler(ctx, &event, time.Time{}); err != nil {
+			return nil, err
+		}
+	}
+
+	nodes, err := wh.RestAPIClient.CoreV1().Nodes().List(ctx, wh.snapshotListOptions(config.NodesResource))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list nodes: %s", err.Error())
+	}
+	objects := make([]runtime.Object, 0, len(nodes.Items))
+	for i := range nodes.Items {
+		objects = append(objects, &nodes.Items[i])
+	}
+	var lastWatchEventCreationTime time.Time
+	wh.handleNodeWatch(ctx, newListWatcher(objects), noNewState, &lastWatchEventCreationTime)
+
+	pods, err := wh.RestAPIClient.CoreV1().Pods(wh.namespaceFilter.watchNamespace()).List(ctx, wh.snapshotListOptions(config.PodsResource))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pods: %s", err.Error())
+	}
+	objects = make([]runtime.Object, 0, len(pods.Items))
+	for i := range pods.Items {
+		objects = append(objects, &pods.Items[i])
+	}
+	lastWatchEventCreationTime = time.Time{}
+	wh.handlePodWatch(ctx, newListWatcher(objects), noNewState, nil, &lastWatchEventCreationTime)
+
+	services, err := wh.RestAPIClient.CoreV1().Services(wh.namespaceFilter.watchNamespace()).List(ctx, wh.snapshotListOptions(config.ServicesResource))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list services: %s", err.Error())
+	}
+	objects = make([]runtime.Object, 0, len(services.Items))
+	for i := range services.Items {
+		objects = append(objects, &services.Items[i])
+	}
+	lastWatchEventCreationTime = time.Time{}
+	wh.handleServiceWatch(ctx, newListWatcher(objects), noNewState, nil, &lastWatchEventCreationTime)
+
+	secrets, err := wh.metadataClient.Resource(secretsResource).Namespace(wh.namespaceFilter.watchNamespace()).List(ctx, wh.snapshotListOptions(config.SecretsResource))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list secrets: %s", err.Error())
+	}
+	for i := range secrets.Items {
+		event := watch.Event{Type: watch.Added, Object: &secrets.Items[i]}
+		if err := wh.secretEventHandler(&event, time.Time{}); err != nil {
+			return nil, err
+		}
+	}
+
+	cronjobs, err := wh.RestAPIClient.BatchV1().CronJobs(wh.namespaceFilter.watchNamespace()).List(ctx, wh.snapshotListOptions(config.CronJobsResource))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list cronjobs: %s", err.Error())
+	}
+	objects = make([]runtime.Object, 0, len(cronjobs.Items))
+	for i := range cronjobs.Items {
+		objects = append(objects, &cronjobs.Items[i])
+	}
+	lastWatchEventCreationTime = time.Time{}
+	wh.handleCronJobWatch(ctx, newListWatcher(objects), noNewState, &lastWatchEventCreationTime)
+
+	ingresses, err := wh.RestAPIClient.NetworkingV1().Ingresses(wh.namespaceFilter.watchNamespace()).List(ctx, wh.snapshotListOptions(config.IngressesResource))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list ingresses: %s", err.Error())
+	}
+	objects = make([]runtime.Object, 0, len(ingresses.Items))
+	for i := range ingresses.Items {
+		objects = append(objects, &ingresses.Items[i])
+	}
+	wh.handleIngressWatch(ctx, newListWatcher(objects), noNewState)
+
+	policies, err := wh.RestAPIClient.NetworkingV1().NetworkPolicies(wh.namespaceFilter.watchNamespace()).List(ctx, wh.snapshotListOptions(config.NetworkPoliciesResource))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list network policies: %s", err.Error())
+	}
+	objects = make([]runtime.Object, 0, len(policies.Items))
+	for i := range policies.Items {
+		objects = append(objects, &policies.Items[i])
+	}
+	lastWatchEventCreationTime = time.Time{}
+	wh.handleNetworkPolicyWatch(ctx, newListWatcher(objects), noNewState, &lastWatchEventCreationTime)
+
+	// the gateways are listed before their routes
+	routes := 0
+	for _, resource := range []string{config.GatewaysResource, config.HTTPRoutesResource} {
+		if wh.dynamicClient == nil || !wh.isGatewayAPIInstalled(resource) {
+			continue
+		}
+		list, err := wh.dynamicClient.Resource(gatewayAPIGroupVersion.WithResource(resource)).Namespace(wh.namespaceFilter.watchNamespace()).
+			List(ctx, wh.snapshotListOptions(resource))
+		if err != nil {
+			return nil, fmt.Errorf("failed to list %s: %s", resource, err.Error())
+		}
+		objects = make([]runtime.Object, 0, len(list.Items))
+		for i := range list.Items {
+			objects = append(objects, &list.Items[i])
+		}
+		wh.handleGatewayAPIWatch(ctx, resource, newListWatcher(objects), noNewState)
+		if resource == config.HTTPRoutesResource {
+			routes = len(list.Items)
+		}
+	}
+
+	rbacObjects := 0
+	for _, resource := range rbacResources {
+		objects, err = wh.listRBAC(ctx, resource, wh.snapshotListOptions(resource))
+		if err != nil {
+			return nil, fmt.Errorf("failed to list %s: %s", resource, err.Error())
+		}
+		wh.handleRBACWatch(ctx, resource, newListWatcher(objects), noNewState)
+		rbacObjects += len(objects)
+	}
+
+	// the cluster info is loaded last, since informNewDataArrive blocks once it is loaded
+	wh.clusterInfo.Refresh(ctx)
+	report := prepareDataToSend(ctx, wh)
+	if report == nil {
+		return nil, fmt.Errorf("failed to prepare the report")
+	}
+	logger.L().Info("snapshot collected",
+		helpers.Int("nodes", len(nodes.Items)),
+		helpers.Int("pods", len(pods.Items)),
+		helpers.Int("services", len(services.Items)),
+		helpers.Int("secrets", len(secrets.Items)),
+		helpers.Int("namespaces", len(namespaces.Items)),
+		helpers.Int("cronjobs", len(cronjobs.Items)),
+		helpers.Int("ingresses", len(ingresses.Items)),
+		helpers.Int("networkpolicies", len(policies.Items)),
+		helpers.Int("httproutes", routes),
+		helpers.Int("rbac", rbacObjects))
+	return report, nil
+}
+
+// snapshotListOptions returns the list options of a resource, with the same filters as its watch
+func (wh *WatchHandler) snapshotListOptions(resource string) metav1.ListOptions {
+	options := wh.listOptions(resource)
+	options.Watch = false
+	return options
+}
+
+// newListWatcher returns a watcher that emits the listed objects as added events and then ends
+func newListWatcher(objects []runtime.Object) watch.Interface {
+	events := make([]watch.Event, 0, len(objects))
+	for i := range objects {
+		events = append(events, watch.Event{Type: watch.Added, Object: objects[i]})
+	}
+	return newEventsWatcher(events...)
+}
+
+// newEventsWatcher returns a watcher that emits the events and then ends
+func newEventsWatcher(events ...watch.Event) watch.Interface {
+	result := make(chan watch.Event, len(events))
+	for i := range events {
+		result <- events[i]
+	}
+	close(result)
+	return watch.NewProxyWatcher(result)
+}
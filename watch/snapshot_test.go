@@ -0,0 +1,72 @@
+package watch
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/armosec/utils-k8s-go/armometadata"
+	"github.com/kubescape/backend/pkg/utils"
+	"github.com/kubescape/kollector/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	metadatafake "k8s.io/client-go/metadata/fake"
+)
+
+func TestSnapshot(t *testing.T) {
+	clientset := fake.NewSimpleClientset(
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "payments"}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "kube-system"}},
+		&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-1"}},
+		&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "api", Namespace: "payments"}},
+		&appsv1.ReplicaSet{ObjectMeta: metav1.ObjectMeta{Name: "api-5d8f", Namespace: "payments",
+			OwnerReferences: []metav1.OwnerReference{{Kind: "Deployment", Name: "api", APIVersion: "apps/v1"}}}},
+		&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "api-5d8f-x2k", Namespace: "payments",
+			OwnerReferences: []metav1.OwnerReference{{Kind: "ReplicaSet", Name: "api-5d8f"}}}},
+		&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "coredns", Namespace: "kube-system"}},
+		&corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: "api", Namespace: "payments"}},
+		&batchv1.CronJob{ObjectMeta: metav1.ObjectMeta{Name: "cleanup", Namespace: "payments"}},
+	)
+	metadataClient := metadatafake.NewSimpleMetadataClient(metadatafake.NewTestScheme())
+	_, err := metadataClient.Resource(secretsResource).Namespace("payments").(metadatafake.MetadataClient).CreateFake(&metav1.PartialObjectMetadata{
+		TypeMeta:   metav1.TypeMeta{Kind: "Secret", APIVersion: "v1"},
+		ObjectMeta: metav1.ObjectMeta{Name: "db-credentials", Namespace: "payments"},
+	}, metav1.CreateOptions{})
+	assert.NoError(t, err)
+	settings := config.DefaultSettings()
+	settings.NamespaceFilter = config.NamespaceFilter{Exclude: []string{"kube-system"}}
+	kollectorConfig := config.NewKollectorConfig(&armometadata.ClusterConfig{ClusterName: "payments-cluster"}, utils.Credentials{}, "").SetSettings(settings)
+	wh, err := newWatchHandlerWithClients(kollectorConfig, Clients{KubernetesClient: clientset, MetadataClient: metadataClient})
+	require.NoError(t, err)
+
+	report, err := wh.snapshot(context.Background())
+	assert.NoError(t, err)
+
+	var snapshot map[string]interface{}
+	assert.NoError(t, json.Unmarshal(report, &snapshot))
+	assert.Equal(t, true, snapshot["firstReport"])
+	assert.NotNil(t, snapshot["clusterAPIServerVersion"])
+	assert.Equal(t, "payments-cluster", snapshot["installationData"].(map[string]interface{})["clusterName"])
+
+	created := func(section string) []interface{} {
+		data, ok := snapshot[section].(map[string]interface{})
+		if !assert.Truef(t, ok, "missing %s section", section) {
+			return nil
+		}
+		return data["create"].([]interface{})
+	}
+	assert.Len(t, created("node"), 1)
+	assert.Len(t, created("service"), 1)
+	assert.Len(t, created("secret"), 1)
+	assert.Len(t, created("namespace"), 1, "excluded namespaces are not reported")
+	// the pod of the excluded namespace is not reported, the owner of the other one is resolved
+	assert.Len(t, created("pod"), 1)
+	microservices := created("microservice")
+	assert.Len(t, microservices, 2, "the deployment and the cronjob")
+	assert.Contains(t, string(report), `"kind":"Deployment"`)
+}
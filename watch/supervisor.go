@@ -0,0 +1,76 @@
+package watch
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	logger "github.com/kubescape/go-logger"
+	"github.com/kubescape/go-logger/helpers"
+)
+
+const (
+	supervisorInitialBackoff = time.Second
+	supervisorMaxBackoff     = time.Minute
+)
+
+// Supervisor runs components like an errgroup, but a component that returns before its context is done,
+// with or without an error, is restarted with an exponential backoff
+type Supervisor struct {
+	wg             sync.WaitGroup
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+}
+
+func NewSupervisor() *Supervisor {
+	return &Supervisor{initialBackoff: supervisorInitialBackoff, maxBackoff: supervisorMaxBackoff}
+}
+
+// Go runs the component until the context is done
+func (s *Supervisor) Go(ctx context.Context, name string, run func(ctx context.Context) error) {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		backoff := s.initialBackoff
+		for ctx.Err() == nil {
+			started := time.Now()
+			err := runComponent(ctx, name, run)
+			if ctx.Err() != nil {
+				return
+			}
+			// a component that ran for a while is restarted after the initial backoff again
+			if time.Since(started) > s.maxBackoff {
+				backoff = s.initialBackoff
+			}
+			if err != nil {
+				logger.L().Ctx(ctx).Error("component failed, restarting", helpers.String("component", name), helpers.String("backoff", backoff.String()), helpers.Error(err))
+			} else {
+				logger.L().Ctx(ctx).Warning("component stopped, restarting", helpers.String("component", name), helpers.String("backoff", backoff.String()))
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(backoff):
+			}
+			backoff = min(2*backoff, s.maxBackoff)
+		}
+	}()
+}
+
+// Wait waits for all the components to stop, i.e. for their contexts to be done
+func (s *Supervisor) Wait() {
+	s.wg.Wait()
+}
+
+// runComponent runs the component once, a panic is returned as an error
+func runComponent(ctx context.Context, name string, run func(ctx context.Context) error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.L().Ctx(ctx).Error("RECOVER "+name, helpers.Interface("error", r), helpers.String("stack", string(debug.Stack())))
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return run(ctx)
+}
@@ -0,0 +1,40 @@
+package watch
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSupervisor(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	supervisor := &Supervisor{initialBackoff: time.Millisecond, maxBackoff: 4 * time.Millisecond}
+
+	var failures, panics, blocked atomic.Int32
+	supervisor.Go(ctx, "failing", func(ctx context.Context) error {
+		failures.Add(1)
+		return fmt.Errorf("failed")
+	})
+	supervisor.Go(ctx, "panicking", func(ctx context.Context) error {
+		if panics.Add(1) < 3 {
+			panic("panicked")
+		}
+		<-ctx.Done()
+		return nil
+	})
+	supervisor.Go(ctx, "blocking", func(ctx context.Context) error {
+		blocked.Add(1)
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	assert.Eventually(t, func() bool { return failures.Load() > 3 && panics.Load() == 3 }, time.Second, time.Millisecond, "the components are restarted")
+	cancel()
+	supervisor.Wait()
+	assert.Equal(t, int32(1), blocked.Load(), "a component stopped by the context is not restarted")
+	assert.Equal(t, int32(3), panics.Load())
+}
@@ -2,22 +2,24 @@ package watch
 
 import (
 	"container/list"
-	"flag"
+	"context"
 	"fmt"
 	"os"
 	"sync"
+	"time"
 
 	logger "github.com/kubescape/go-logger"
 	"github.com/kubescape/go-logger/helpers"
 	"github.com/kubescape/k8s-interface/k8sinterface"
 	"github.com/kubescape/kollector/config"
-	"github.com/kubescape/kollector/consts"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	restclient "k8s.io/client-go/rest"
 
 	beClientV1 "github.com/kubescape/backend/pkg/client/v1"
 	apixv1beta1client "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset/typed/apiextensions/v1beta1"
-	"k8s.io/apimachinery/pkg/version"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/metadata"
 )
 
 type resourceMap struct {
@@ -93,11 +95,13 @@ func (rm *resourceMap) indexLen(index int) int {
 type WatchHandler struct {
 	extensionsClient apixv1beta1client.ApiextensionsV1beta1Interface
 	RestAPIClient    kubernetes.Interface
+	metadataClient   metadata.Interface
+	dynamicClient    dynamic.Interface
 	K8sApi           *k8sinterface.KubernetesApi
-	WebSocketHandle  *WebSocketHandler
-	// cluster info
-	clusterAPIServerVersion *version.Info
-	cloudVendor             string
+	// Sender is the websocket to the event receiver, or the dry run sink
+	Sender ReportSender
+	// clusterInfo is the cluster identity, the first report waits for it
+	clusterInfo *ClusterInfo
 	// pods list
 	pdm map[int]*list.List
 	// node list
@@ -106,82 +110,235 @@ type WatchHandler struct {
 	sdm map[int]*list.List
 	// pods list
 	cjm map[int]*list.List
+	// cronjob uid -> id of the cronjob in pdm
+	cronJobIDs map[string]int
 	// secrets list
 	secretdm *resourceMap
 	// namespaces list
 	namespacedm *resourceMap
+	// ids are the ids of the lists above
+	ids *IDDataBase
+	// scanNotificationCandidateList are the workloads waiting to run, to notify the in-cluster components about their new images
+	scanNotificationCandidateList []*ScanNewImageData
+	// collectorCreationTime is when the pods watch started, the older pods are not scan candidates
+	collectorCreationTime time.Time
+	// startTime is when the handler was created, the older namespaces and nodes are not new to the triggers
+	startTime time.Time
+	// crashes are the reported restarts of the containers in a crash loop
+	crashes *crashTracker
+	// objects are the tracked objects the warning events are reported for, events are the reported events
+	objects *objectIndex
+	events  *eventDeduplicator
+	// images is the inventory of the images running in the cluster
+	images *imageInventory
+	// exposure is the graph of the entrypoints of the cluster and what they expose
+	exposure *exposureGraph
+	// isolation is the network isolation of the microservices by the network policies
+	isolation *isolationTracker
+	// permissions are the API permissions of the service accounts of the microservices
+	permissions *permissionsTracker
 
-	jsonReport             jsonFormat
-	informNewDataChannel   chan int
+	jsonReport           jsonFormat
+	informNewDataChannel chan int
+	// firstReportRequests makes the listener reset the state and send a first report
+	firstReportRequests chan struct{}
+	// clusterInfoChanges are added to the report by the listener
+	clusterInfoChanges     chan *ClusterInfoChange
 	aggregateFirstDataFlag bool
+	// unsentReport is the report that was prepared but not sent when the listener stopped, it is sent by Flush
+	unsentReport []byte
+	// stopped is closed when the listener stops, the watchers no longer wait for it
+	stopped  chan struct{}
+	stopOnce sync.Once
 	// newStateReportChans is calling in a loop whenever new connection to BE is initialized
-	newStateReportChans []chan bool
-	includeNamespaces   []string
+	newStateReportChans      []chan bool
+	newStateReportChansMutex sync.Mutex
+	// namespaceResyncChans get the namespaces whose labels moved them in or out of the label selector
+	namespaceResyncChans      []chan namespaceResync
+	namespaceResyncChansMutex sync.Mutex
+	namespaceFilter           *namespaceFilter
+	resourceSelectors         map[string]config.ResourceSelector
+	// resourceSelectorsMutex protects the resource selectors, since they may be reloaded
+	resourceSelectorsMutex sync.RWMutex
 
 	config config.IConfig
+	// recorder records the watch events when set
+	recorder *eventRecorder
 
 	notifyUpdates iClusterNotifier // notify other (in-cluster) components about new data
 }
 
-func CreateWatchHandler(config config.IConfig) (*WatchHandler, error) {
+// CreateWatchHandler creates a WatchHandler reporting to the event receiver. The clients that are not set with WithClients
+// are created from the kubeconfig
+func CreateWatchHandler(config config.IConfig, opts ...Option) (*WatchHandler, error) {
+	options := newOptions(opts...)
+	settings := config.Settings()
+	if settings.DryRun {
+		wh, err := newWatchHandler(config, options)
+		if err != nil {
+			return nil, err
+		}
+		// nothing is sent, the in-cluster components are not notified either
+		if wh.Sender, err = newDryRunSender(settings.DryRunOutput); err != nil {
+			return nil, err
+		}
+		return wh, nil
+	}
 
-	componentNamespace := os.Getenv(consts.NamespaceEnvironmentVariable)
+	erURL, err := beClientV1.GetReporterClusterReportsWebsocketUrl(config.EventReceiverWebsocketURL(), config.AccountID(), config.ClusterName())
+	if err != nil {
+		return nil, fmt.Errorf("failed to set event receiver url: %s", err.Error())
+	}
 
-	if err := parseArgument(); err != nil {
-		return nil, fmt.Errorf("failed to parse args: %s", err.Error())
+	wh, err := newWatchHandler(config, options)
+	if err != nil {
+		return nil, err
 	}
+	wh.Sender = createWebSocketHandler(erURL, config.AccessKey(), wh.webSocketSettings)
+	wh.notifyUpdates = newInClusterNotifier(config, options.httpClient)
+	return wh, nil
+}
 
-	// create the clientset
-	k8sAPiObj := k8sinterface.NewKubernetesApi()
+// webSocketSettings returns the current WebSocket settings, they are read on use since they may be reloaded
+func (wh *WatchHandler) webSocketSettings() config.WebSocketSettings {
+	return wh.config.Settings().WebSocket
+}
+
+// Clients are the clients the WatchHandler uses to reach the API server
+type Clients struct {
+	KubernetesClient kubernetes.Interface
+	MetadataClient   metadata.Interface
+	// ExtensionsClient is optional, it is used to resolve custom resource owners
+	ExtensionsClient apixv1beta1client.ApiextensionsV1beta1Interface
+	// DynamicClient is used to watch the Gateway API gateways and routes
+	DynamicClient dynamic.Interface
+}
 
+// newWatchHandler creates a WatchHandler without a connection to the event receiver, the in-cluster components are not notified.
+// The clients that are not set are created from the kubeconfig
+func newWatchHandler(config config.IConfig, options *options) (*WatchHandler, error) {
 	restclient.SetDefaultWarningHandler(restclient.NoWarnings{})
-	extensionsClientSet, err := apixv1beta1client.NewForConfig(k8sinterface.GetK8sConfig())
+
+	var recorder *eventRecorder
+	if recordFile := config.Settings().RecordEventsFile; recordFile != "" {
+		// the recording holds the raw objects, which would bypass the redaction
+		if len(config.RedactionRules()) > 0 {
+			return nil, fmt.Errorf("events recording is not supported with a redaction policy, the recording holds the raw objects")
+		}
+		f, err := os.OpenFile(recordFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open events recording: %s", err.Error())
+		}
+		recorder = newEventRecorder(f)
+		logger.L().Info("recording watch events", helpers.String("file", recordFile))
+	}
+
+	clients := options.clients
+	if clients.KubernetesClient == nil {
+		if recorder != nil {
+			// the objects read by the handlers are recorded as well
+			client, err := recorder.kubernetesClient(k8sinterface.GetK8sConfig())
+			if err != nil {
+				return nil, fmt.Errorf("failed to create recording client: %s", err.Error())
+			}
+			clients.KubernetesClient = client
+		} else {
+			clients.KubernetesClient = k8sinterface.NewKubernetesApi().KubernetesClient
+		}
+	}
+	if clients.MetadataClient == nil {
+		metadataClient, err := metadata.NewForConfig(k8sinterface.GetK8sConfig())
+		if err != nil {
+			return nil, fmt.Errorf("metadata.NewForConfig failed: %s", err.Error())
+		}
+		clients.MetadataClient = metadataClient
+	}
+	if clients.ExtensionsClient == nil {
+		extensionsClientSet, err := apixv1beta1client.NewForConfig(k8sinterface.GetK8sConfig())
+		if err != nil {
+			return nil, fmt.Errorf("apiV1beta1client.NewForConfig failed: %s", err.Error())
+		}
+		clients.ExtensionsClient = extensionsClientSet
+	}
+	if clients.DynamicClient == nil {
+		dynamicClient, err := dynamic.NewForConfig(k8sinterface.GetK8sConfig())
+		if err != nil {
+			return nil, fmt.Errorf("dynamic.NewForConfig failed: %s", err.Error())
+		}
+		clients.DynamicClient = dynamicClient
+	}
+
+	wh, err := newWatchHandlerWithClients(config, clients)
 	if err != nil {
-		return nil, fmt.Errorf("apiV1beta1client.NewForConfig failed: %s", err.Error())
+		return nil, err
+	}
+	wh.recorder = recorder
+	if options.instanceMetadata != nil {
+		wh.clusterInfo.instanceMetadata = options.instanceMetadata
 	}
+	return wh, nil
+}
 
-	erURL, err := beClientV1.GetReporterClusterReportsWebsocketUrl(config.EventReceiverWebsocketURL(), config.AccountID(), config.ClusterName())
+func newWatchHandlerWithClients(config config.IConfig, clients Clients) (*WatchHandler, error) {
+	nsFilter, err := newNamespaceFilter(config.NamespaceFilter(), func(name string) (map[string]string, error) {
+		namespace, err := clients.KubernetesClient.CoreV1().Namespaces().Get(context.Background(), name, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		return namespace.Labels, nil
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to set event receiver url: %s", err.Error())
+		return nil, fmt.Errorf("failed to set namespace filter: %s", err.Error())
 	}
 
-	if err = setCloudProvider(k8sAPiObj); err != nil {
-		logger.L().Error("failed to set cloud provider", helpers.Error(err))
-	} else {
-		logger.L().Info("setting cloud provider", helpers.String("cloudProvider", cloudProvider))
+	redactor, err := newRedactor(config.RedactionRules(), config.RedactionSalt())
+	if err != nil {
+		return nil, fmt.Errorf("failed to set redaction rules: %s", err.Error())
 	}
 
-	result := WatchHandler{RestAPIClient: k8sAPiObj.KubernetesClient,
-		WebSocketHandle:  createWebSocketHandler(erURL, config.AccessKey()),
-		extensionsClient: extensionsClientSet,
-		K8sApi:           k8sinterface.NewKubernetesApi(),
+	result := WatchHandler{RestAPIClient: clients.KubernetesClient,
+		metadataClient:   clients.MetadataClient,
+		extensionsClient: clients.ExtensionsClient,
+		dynamicClient:    clients.DynamicClient,
+		K8sApi:           &k8sinterface.KubernetesApi{KubernetesClient: clients.KubernetesClient, Context: context.Background()},
 		pdm:              make(map[int]*list.List),
 		ndm:              make(map[int]*list.List),
 		sdm:              make(map[int]*list.List),
 		cjm:              make(map[int]*list.List),
+		cronJobIDs:       make(map[string]int),
 		config:           config,
 		secretdm:         newResourceMap(),
 		namespacedm:      newResourceMap(),
 		jsonReport: jsonFormat{
 			FirstReport: true,
+			redactor:    redactor,
+			mutex:       &sync.Mutex{},
 		},
 		informNewDataChannel:   make(chan int),
+		clusterInfoChanges:     make(chan *ClusterInfoChange),
+		firstReportRequests:    make(chan struct{}, 1),
+		stopped:                make(chan struct{}),
 		aggregateFirstDataFlag: true,
-		includeNamespaces:      []string{componentNamespace}, // ignore only the component namespace
-		notifyUpdates:          newInClusterNotifier(config),
+		namespaceFilter:        nsFilter,
+		notifyUpdates:          &skipInClusterNotifier{},
+		startTime:              time.Now(),
+		clusterInfo:            newClusterInfo(clients.KubernetesClient, defaultInstanceMetadata),
+		ids:                    newIDDataBase(),
+		crashes:                newCrashTracker(),
+		objects:                newObjectIndex(),
+		events:                 newEventDeduplicator(),
+		images:                 newImageInventory(),
+		exposure:               newExposureGraph(),
+		permissions:            newPermissionsTracker(),
+	}
+	result.isolation = newIsolationTracker(result.namespaceLabels)
+	if _, err := result.setResourceSelectors(config.ResourceSelectors()); err != nil {
+		return nil, fmt.Errorf("failed to set resource selectors: %s", err.Error())
 	}
+	result.clusterInfo.Subscribe(result.reportClusterInfoChange)
 	return &result, nil
 }
 
-func parseArgument() error {
-
-	threFlag := flag.Lookup("stderrthreshold")
-	threFlag.DefValue = "WARNING"
-	flag.Parse()
-
-	return nil
-}
-
 // SetFirstReportFlag set first report flag
 func (wh *WatchHandler) SetFirstReportFlag(first bool) {
 	if wh.jsonReport.FirstReport == first {
@@ -193,11 +350,242 @@ func (wh *WatchHandler) SetFirstReportFlag(first bool) {
 		wh.pdm = make(map[int]*list.List)
 		wh.sdm = make(map[int]*list.List)
 		wh.cjm = make(map[int]*list.List)
+		wh.cronJobIDs = make(map[string]int)
 		wh.secretdm = newResourceMap()
 		wh.namespacedm = newResourceMap()
-		for chanIdx := range wh.newStateReportChans {
-			wh.newStateReportChans[chanIdx] <- true
+		wh.objects.reset()
+		wh.images.reset()
+		wh.exposure.reset()
+		wh.isolation.reset()
+		wh.permissions.reset()
+		wh.restartWatchers(true)
+	}
+}
+
+// requestFirstReport makes the listener reset the state and send a first report, e.g. after reconnecting to another
+// event receiver. It does not block, so it can be called from the sender and the config reloads
+func (wh *WatchHandler) requestFirstReport(first bool) {
+	if !first {
+		return
+	}
+	select {
+	case wh.firstReportRequests <- struct{}{}:
+	default: // a first report is already pending
+	}
+}
+
+// restartWatchers makes all the watchers re-watch their resources. When newState is false the
+// collected state is kept and only objects created from now on are reported as new
+func (wh *WatchHandler) restartWatchers(newState bool) {
+	wh.newStateReportChansMutex.Lock()
+	newStateReportChans := append([]chan bool{}, wh.newStateReportChans...)
+	wh.newStateReportChansMutex.Unlock()
+	for chanIdx := range newStateReportChans {
+		select {
+		case newStateReportChans[chanIdx] <- newState:
+		case <-wh.stopped:
+			return
+		}
+	}
+}
+
+// subscribeNewState returns the channel a watcher gets the restarts from, and a function to unsubscribe when the watcher stops.
+// The channel is buffered, so a watcher that stopped since the restart began does not block it.
+// Invariant: until it unsubscribes, a subscriber must always select on the channel, e.g. while it waits for an API to be
+// installed, only the short retry sleeps may skip it. restartWatchers blocks on every subscriber whose buffer is full
+func (wh *WatchHandler) subscribeNewState() (<-chan bool, func()) {
+	newStateChan := make(chan bool, 1)
+	wh.newStateReportChansMutex.Lock()
+	wh.newStateReportChans = append(wh.newStateReportChans, newStateChan)
+	wh.newStateReportChansMutex.Unlock()
+	return newStateChan, func() {
+		wh.newStateReportChansMutex.Lock()
+		defer wh.newStateReportChansMutex.Unlock()
+		for i := range wh.newStateReportChans {
+			if wh.newStateReportChans[i] == newStateChan {
+				wh.newStateReportChans = append(wh.newStateReportChans[:i], wh.newStateReportChans[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// namespaceResync is a namespace whose labels moved it in or out of the label selector, its objects are reported
+// again as created or deleted
+type namespaceResync struct {
+	namespace string
+	watched   bool
+}
+
+// publishNamespaceResync sends a namespace that moved in or out of the label selector to the watchers of its objects
+func (wh *WatchHandler) publishNamespaceResync(resync namespaceResync) {
+	wh.namespaceResyncChansMutex.Lock()
+	namespaceResyncChans := append([]chan namespaceResync{}, wh.namespaceResyncChans...)
+	wh.namespaceResyncChansMutex.Unlock()
+	for chanIdx := range namespaceResyncChans {
+		select {
+		case namespaceResyncChans[chanIdx] <- resync:
+		case <-wh.stopped:
+			return
+		}
+	}
+}
+
+// subscribeNamespaceResync returns the channel a watcher gets the namespaces to resync from, and a function to
+// unsubscribe when the watcher stops
+func (wh *WatchHandler) subscribeNamespaceResync() (<-chan namespaceResync, func()) {
+	resyncChan := make(chan namespaceResync, 16)
+	wh.namespaceResyncChansMutex.Lock()
+	wh.namespaceResyncChans = append(wh.namespaceResyncChans, resyncChan)
+	wh.namespaceResyncChansMutex.Unlock()
+	return resyncChan, func() {
+		wh.namespaceResyncChansMutex.Lock()
+		defer wh.namespaceResyncChansMutex.Unlock()
+		for i := range wh.namespaceResyncChans {
+			if wh.namespaceResyncChans[i] == resyncChan {
+				wh.namespaceResyncChans = append(wh.namespaceResyncChans[:i], wh.namespaceResyncChans[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// stop releases the watchers waiting for the listener, it is called when the listener stops for good
+func (wh *WatchHandler) stop() {
+	wh.stopOnce.Do(func() {
+		if wh.stopped != nil {
+			close(wh.stopped)
 		}
+	})
+}
+
+// Run runs the listener, the watchers and the sender until the context is done, a component that stops before is restarted
+// with a backoff. Then the pending data is flushed and the connection to the event receiver is closed
+func (wh *WatchHandler) Run(ctx context.Context, isServerReady *bool) {
+	// the sender outlives the watchers to send the last reports
+	senderCtx, stopSender := context.WithCancel(context.WithoutCancel(ctx))
+	defer stopSender()
+	sender := NewSupervisor()
+	sender.Go(senderCtx, "sender", func(ctx context.Context) error {
+		return wh.Sender.SendReportRoutine(ctx, isServerReady, wh.requestFirstReport)
+	})
+
+	components := NewSupervisor()
+	components.Go(ctx, "listener", func(ctx context.Context) error {
+		wh.ListenerAndSender(ctx)
+		return nil
+	})
+	components.Go(ctx, "notifier", func(ctx context.Context) error {
+		wh.notifyUpdates.Run(ctx)
+		return nil
+	})
+	components.Go(ctx, "cluster info", func(ctx context.Context) error {
+		wh.clusterInfo.Run(ctx, time.Duration(wh.config.Settings().ClusterInfoRefreshInterval))
+		return nil
+	})
+	watchers := map[string]func(context.Context){
+		config.NodesResource:               wh.NodeWatch,
+		config.PodsResource:                wh.PodWatch,
+		config.ServicesResource:            wh.ServiceWatch,
+		config.SecretsResource:             wh.SecretWatch,
+		config.NamespacesResource:          wh.NamespaceWatch,
+		config.CronJobsResource:            wh.CronJobWatch,
+		config.EventsResource:              wh.EventWatch,
+		config.IngressesResource:           wh.IngressWatch,
+		config.NetworkPoliciesResource:     wh.NetworkPolicyWatch,
+		config.RolesResource:               wh.RoleWatch,
+		config.ClusterRolesResource:        wh.ClusterRoleWatch,
+		config.RoleBindingsResource:        wh.RoleBindingWatch,
+		config.ClusterRoleBindingsResource: wh.ClusterRoleBindingWatch,
+		config.ServiceAccountsResource:     wh.ServiceAccountWatch,
+	}
+	if wh.dynamicClient != nil {
+		watchers[config.GatewaysResource] = wh.GatewayWatch
+		watchers[config.HTTPRoutesResource] = wh.HTTPRouteWatch
+	}
+	for name, watcher := range watchers {
+		components.Go(ctx, name+" watcher", func(ctx context.Context) error {
+			watcher(ctx)
+			return nil
+		})
+	}
+	components.Wait()
+	logger.L().Info("watchers stopped, flushing the pending reports")
+
+	flushCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), time.Duration(wh.config.Settings().ShutdownTimeout))
+	defer cancel()
+	if err := wh.Flush(flushCtx); err != nil {
+		logger.L().Ctx(ctx).Error("failed to flush the pending reports", helpers.Error(err))
+	}
+	stopSender()
+	sender.Wait()
+	logger.L().Info("shutdown completed")
+}
+
+// Flush sends the report the listener did not send and the data collected since, the watchers should be stopped
+func (wh *WatchHandler) Flush(ctx context.Context) error {
+	reports := [][]byte{}
+	if wh.unsentReport != nil {
+		reports = append(reports, wh.unsentReport)
+		wh.unsentReport = nil
+	}
+	if wh.hasReportData() {
+		if jsonData := prepareDataToSend(ctx, wh); jsonData != nil && !isEmptyFirstReport(jsonData) {
+			reports = append(reports, jsonData)
+		}
+	}
+	for i := range reports {
+		if err := wh.SendMessageToWebSocket(ctx, reports[i]); err != nil {
+			return fmt.Errorf("failed to send %d pending reports: %s", len(reports)-i, err.Error())
+		}
+	}
+	logger.L().Info("pending reports flushed", helpers.Int("reports", len(reports)))
+	return nil
+}
+
+// Reconfigure applies a reloaded configuration: the event receiver url and access key, the namespace filter,
+// the resource selectors and the redaction rules. Invalid values are logged and the current ones are kept. A changed
+// filter or selector resyncs the full state
+func (wh *WatchHandler) Reconfigure(ctx context.Context) {
+	if !wh.config.Settings().DryRun {
+		erURL, err := beClientV1.GetReporterClusterReportsWebsocketUrl(wh.config.EventReceiverWebsocketURL(), wh.config.AccountID(), wh.config.ClusterName())
+		if err != nil {
+			logger.L().Ctx(ctx).Error("failed to reload event receiver url", helpers.Error(err))
+		} else if wh.Sender.reconfigure(erURL, wh.config.AccessKey()) {
+			logger.L().Info("event receiver url or access key changed, reconnecting")
+		}
+	}
+
+	if err := wh.jsonReport.redactor.update(wh.config.RedactionRules(), wh.config.RedactionSalt()); err != nil {
+		logger.L().Ctx(ctx).Error("failed to reload redaction rules", helpers.Error(err))
+	} else if wh.recorder != nil && len(wh.config.RedactionRules()) > 0 {
+		logger.L().Ctx(ctx).Warning("redaction policy loaded, stopping the events recording since it holds the raw objects")
+		wh.recorder.stop()
+	}
+
+	resync := false
+	if changed, err := wh.namespaceFilter.update(wh.config.NamespaceFilter()); err != nil {
+		logger.L().Ctx(ctx).Error("failed to reload namespace filter", helpers.Error(err))
+	} else if changed {
+		resync = true
+	}
+	if changed, err := wh.setResourceSelectors(wh.config.ResourceSelectors()); err != nil {
+		logger.L().Ctx(ctx).Error("failed to reload resource selectors", helpers.Error(err))
+	} else if changed {
+		resync = true
+	}
+	// the objects that are no longer watched are dropped and those newly watched are listed, with a first report
+	if resync {
+		logger.L().Info("watch filters changed, resyncing the state")
+		wh.requestFirstReport(true)
+	}
+}
+
+// reportClusterInfoChange sends the changed cluster identity to the listener, which adds it to the next report
+func (wh *WatchHandler) reportClusterInfoChange(previous, current ClusterIdentity) {
+	select {
+	case wh.clusterInfoChanges <- &ClusterInfoChange{PreviousVersion: previous.reportedVersion(), Version: current.reportedVersion()}:
+	case <-wh.stopped:
 	}
 }
 
@@ -207,12 +595,7 @@ func (wh *WatchHandler) getFirstReportFlag() bool {
 }
 
 func (wh *WatchHandler) isNamespaceWatched(namespace string) bool {
-	for nsIdx := range wh.includeNamespaces {
-		if wh.includeNamespaces[nsIdx] == "" || wh.includeNamespaces[nsIdx] == namespace {
-			return true
-		}
-	}
-	return false
+	return wh.namespaceFilter.isWatched(namespace)
 }
 
 // getAggregateFirstDataFlag return pointer
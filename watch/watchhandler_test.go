@@ -0,0 +1,108 @@
+package watch
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/armosec/utils-k8s-go/armometadata"
+	"github.com/kubescape/backend/pkg/utils"
+	"github.com/kubescape/kollector/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	apixfake "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset/fake"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/version"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+	metadatafake "k8s.io/client-go/metadata/fake"
+)
+
+func TestCreateWatchHandlersAreIndependent(t *testing.T) {
+	t.Parallel()
+	create := func(providerID string) *WatchHandler {
+		clientset := fake.NewSimpleClientset(&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node"}, Spec: corev1.NodeSpec{ProviderID: providerID}})
+		kollectorConfig := config.NewKollectorConfig(&armometadata.ClusterConfig{ClusterName: providerID}, utils.Credentials{}, "ws://127.0.0.1:1")
+		wh, err := CreateWatchHandler(kollectorConfig,
+			WithClients(Clients{
+				KubernetesClient: clientset,
+				MetadataClient:   metadatafake.NewSimpleMetadataClient(metadatafake.NewTestScheme()),
+				ExtensionsClient: apixfake.NewSimpleClientset().ApiextensionsV1beta1(),
+				DynamicClient:    dynamicfake.NewSimpleDynamicClient(runtime.NewScheme()),
+			}),
+			WithInstanceMetadata(func(string) (*CloudMetadata, error) { return nil, nil }))
+		require.NoError(t, err)
+		return wh
+	}
+	aws := create("aws:///us-east-1a/i-1")
+	gce := create("gce://project/us-central1-a/node")
+
+	for _, wh := range []*WatchHandler{aws, gce} {
+		_, err := wh.clusterInfo.Refresh(context.Background())
+		require.NoError(t, err)
+	}
+	awsIdentity, _ := aws.clusterInfo.Get()
+	gceIdentity, _ := gce.clusterInfo.Get()
+	assert.Equal(t, "eks", awsIdentity.Distribution)
+	assert.Equal(t, "gke", gceIdentity.Distribution)
+	assert.Equal(t, &CloudMetadata{Vendor: awsVendorName}, awsIdentity.CloudMetadata, "the vendor of the providerID is kept when its instance metadata API does not answer")
+	assert.Equal(t, 0, aws.ids.CreateID())
+	assert.Equal(t, 0, gce.ids.CreateID(), "the ids are not shared")
+}
+
+func TestFlush(t *testing.T) {
+	kollectorConfig := config.NewKollectorConfig(&armometadata.ClusterConfig{ClusterName: "test"}, utils.Credentials{}, "")
+	wh, err := newWatchHandlerWithClients(kollectorConfig, Clients{KubernetesClient: fake.NewSimpleClientset()})
+	require.NoError(t, err)
+	var output bytes.Buffer
+	wh.Sender = &dryRunSender{reports: make(chan []byte), output: &output}
+	wh.clusterInfo.identity = &ClusterIdentity{Version: &version.Info{GitVersion: "v1.30.0"}}
+	wh.aggregateFirstDataFlag = false
+	wh.jsonReport.FirstReport = false
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	ready := false
+	go func() {
+		defer close(stopped)
+		wh.Sender.SendReportRoutine(ctx, &ready, nil)
+	}()
+
+	assert.NoError(t, wh.Flush(ctx), "nothing to flush")
+	wh.unsentReport = []byte(`{"unsent":true}`)
+	wh.jsonReport.AddToJsonFormat(&NodeData{Name: "node"}, NODE, CREATED)
+	assert.NoError(t, wh.Flush(ctx))
+	assert.False(t, wh.hasReportData())
+	cancel()
+	<-stopped
+
+	reports := strings.Split(strings.TrimSpace(output.String()), "\n")
+	require.Len(t, reports, 2)
+	assert.Equal(t, `{"unsent":true}`, reports[0])
+	assert.Contains(t, reports[1], `"name":"node"`)
+
+	wh.unsentReport = []byte(`{"unsent":true}`)
+	assert.Error(t, wh.Flush(ctx), "the sender stopped")
+}
+
+func TestReconfigureResyncsOnFilterChange(t *testing.T) {
+	settings := config.DefaultSettings()
+	settings.DryRun = true
+	kollectorConfig := config.NewKollectorConfig(&armometadata.ClusterConfig{ClusterName: "test"}, utils.Credentials{}, "").SetSettings(settings)
+	wh, err := newWatchHandlerWithClients(kollectorConfig, Clients{KubernetesClient: fake.NewSimpleClientset()})
+	require.NoError(t, err)
+	wh.jsonReport.FirstReport = false
+
+	wh.Reconfigure(context.Background())
+	assert.Empty(t, wh.firstReportRequests, "nothing changed")
+
+	settings.NamespaceFilter.Include = []string{"payments"}
+	kollectorConfig.SetSettings(settings)
+	wh.Reconfigure(context.Background())
+	assert.Len(t, wh.firstReportRequests, 1, "the namespaces newly watched and no longer watched are resynced")
+	assert.True(t, WaitTillNewDataArrived(context.Background(), wh))
+	assert.True(t, wh.getFirstReportFlag())
+}
@@ -7,14 +7,15 @@ import (
 	"net/url"
 	"os"
 	"runtime/debug"
-	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
 	v1 "github.com/kubescape/backend/pkg/server/v1"
 	logger "github.com/kubescape/go-logger"
 	"github.com/kubescape/go-logger/helpers"
+	"github.com/kubescape/kollector/config"
 )
 
 type ReqType int
@@ -25,21 +26,31 @@ const (
 	EXIT    ReqType = 2
 )
 
-const (
-	WaitBeforeReportEnv = "WAIT_BEFORE_REPORT"
-)
-
 type DataSocket struct {
 	message string
 	RType   ReqType
 }
 
+// ReportSender sends the reports prepared by ListenerAndSender
+type ReportSender interface {
+	// SendReportRoutine sends the reports until it fails or the context is done. reconnectCallback(true) is called after
+	// reconnecting to a changed event receiver or account
+	SendReportRoutine(ctx context.Context, isServerReady *bool, reconnectCallback func(bool)) error
+	// send hands the report to SendReportRoutine, it fails if the context is done first
+	send(ctx context.Context, report []byte) error
+	// reconfigure updates the event receiver URL and the access key, returns true if the sender reconnects
+	reconfigure(u *url.URL, accessKey string) bool
+}
+
 type WebSocketHandler struct {
-	data       chan DataSocket
-	u          url.URL
-	mutex      *sync.Mutex
-	SignalChan chan os.Signal
-	headers    http.Header
+	data    chan DataSocket
+	u       url.URL
+	mutex   *sync.Mutex
+	headers http.Header
+	// reconnect is signaled when the URL or the headers changed
+	reconnect chan bool
+	// settings returns the current settings, they may be reloaded
+	settings func() config.WebSocketSettings
 }
 
 func getRequestHeaders(accessKey string) http.Header {
@@ -48,61 +59,121 @@ func getRequestHeaders(accessKey string) http.Header {
 	return headers
 }
 
-func createWebSocketHandler(u *url.URL, accessKey string) *WebSocketHandler {
+func createWebSocketHandler(u *url.URL, accessKey string, settings func() config.WebSocketSettings) *WebSocketHandler {
 	logger.L().Info("connecting websocket", helpers.String("URL", u.String()))
 	wsh := WebSocketHandler{
-		u:          *u,
-		data:       make(chan DataSocket),
-		mutex:      &sync.Mutex{},
-		SignalChan: make(chan os.Signal),
-		headers:    getRequestHeaders(accessKey),
+		u:         *u,
+		data:      make(chan DataSocket),
+		mutex:     &sync.Mutex{},
+		headers:   getRequestHeaders(accessKey),
+		reconnect: make(chan bool, 1),
+		settings:  settings,
 	}
 	return &wsh
 }
 
-func (wsh *WebSocketHandler) connectToWebSocket(ctx context.Context, sleepBeforeConnection time.Duration) (*websocket.Conn, error) {
+// reconfigure updates the URL and the access key, and re-dials if they changed. Returns true if a re-dial was triggered
+func (wsh *WebSocketHandler) reconfigure(u *url.URL, accessKey string) bool {
+	wsh.mutex.Lock()
+	changed := wsh.u.String() != u.String() || wsh.headers.Get(v1.AccessKeyHeader) != accessKey
+	if changed {
+		wsh.u = *u
+		wsh.headers = getRequestHeaders(accessKey)
+	}
+	wsh.mutex.Unlock()
+	if changed {
+		select {
+		case wsh.reconnect <- true:
+		default: // a re-dial is already pending
+		}
+	}
+	return changed
+}
+
+// connectToWebSocket dials the event receiver after sleepBeforeConnection, the failed dials are retried every second
+func (wsh *WebSocketHandler) connectToWebSocket(ctx context.Context, sleepBeforeConnection time.Duration) (*websocket.Conn, func(), error) {
 
 	var err error
 	var conn *websocket.Conn
 
-	tries := 60
+	tries := wsh.settings().ConnectRetries
 	for reconnectionCounter := 0; reconnectionCounter < tries; reconnectionCounter++ {
-		time.Sleep(time.Second * 1)
-		if conn, _, err = websocket.DefaultDialer.Dial(wsh.u.String(), wsh.headers); err == nil {
-			logger.L().Ctx(ctx).Info("connected successfully", helpers.String("URL", wsh.u.String()))
-			wsh.setPingPongHandler(ctx, conn)
-			return conn, nil
+		wait := time.Second
+		if reconnectionCounter == 0 {
+			wait = sleepBeforeConnection
+		}
+		select {
+		case <-ctx.Done():
+			return nil, nil, ctx.Err()
+		case <-time.After(wait):
+		}
+		wsh.mutex.Lock()
+		u := wsh.u
+		headers := wsh.headers.Clone()
+		wsh.mutex.Unlock()
+		if conn, _, err = websocket.DefaultDialer.Dial(u.String(), headers); err == nil {
+			logger.L().Ctx(ctx).Info("connected successfully", helpers.String("URL", u.String()))
+			stopPingPong := wsh.setPingPongHandler(ctx, conn)
+			return conn, stopPingPong, nil
 		}
 	}
 
-	return nil, fmt.Errorf("cant connect to websocket after %d tries", tries)
+	return nil, nil, fmt.Errorf("cant connect to websocket after %d tries", tries)
 
 }
 
-// SendReportRoutine function sending updates
+// SendReportRoutine function sending updates, the connection is closed with a close frame when the context is done
 func (wsh *WebSocketHandler) SendReportRoutine(ctx context.Context, isServerReady *bool, reconnectCallback func(bool)) error {
 	defer func() {
 		if err := recover(); err != nil {
 			logger.L().Ctx(ctx).Error("RECOVER sendReportRoutine", helpers.Interface("error", err), helpers.String("stack", string(debug.Stack())))
 		}
 	}()
+	reconnected := false
 	for {
-		t := getNumericValueFromEnvVar(WaitBeforeReportEnv, 30)
-		conn, err := wsh.connectToWebSocket(ctx, time.Duration(t)*time.Second)
+		conn, stopPingPong, err := wsh.connectToWebSocket(ctx, time.Duration(wsh.settings().WaitBeforeReport))
 		if err != nil {
 			return err
 		}
 		*isServerReady = true
+		// the event receiver or the account changed, the new one gets the full state
+		if reconnected && reconnectCallback != nil {
+			reconnectCallback(true)
+		}
 
-		wsh.handleSendReportRoutine(ctx, conn, reconnectCallback)
+		wsh.handleSendReportRoutine(ctx, conn, stopPingPong)
+		if ctx.Err() != nil {
+			return nil
+		}
+		reconnected = true
 	}
 
 	// use mutex for writing message that way if write failed only the failed writing will reconnect
 }
 
-func (wsh *WebSocketHandler) handleSendReportRoutine(ctx context.Context, conn *websocket.Conn, reconnectCallback func(bool)) error {
+func (wsh *WebSocketHandler) handleSendReportRoutine(ctx context.Context, conn *websocket.Conn, stopPingPong func()) error {
 	for {
-		data := <-wsh.data
+		var data DataSocket
+		select {
+		case data = <-wsh.data:
+		case <-ctx.Done():
+			logger.L().Info("closing the event receiver connection")
+			stopPingPong()
+			wsh.mutex.Lock()
+			conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, "shutting down"))
+			conn.Close()
+			wsh.mutex.Unlock()
+			return nil
+		case <-wsh.reconnect:
+			// the pending reports stay in the data channel and are sent over the new connection
+			logger.L().Ctx(ctx).Info("event receiver configuration changed, reconnecting")
+			stopPingPong()
+			wsh.mutex.Lock()
+			conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, "reconnecting"))
+			conn.Close()
+			wsh.mutex.Unlock()
+			return nil
+		}
 		wsh.mutex.Lock()
 
 		switch data.RType {
@@ -125,87 +196,102 @@ func (wsh *WebSocketHandler) handleSendReportRoutine(ctx context.Context, conn *
 	}
 }
 
-func (wh *WatchHandler) SendMessageToWebSocket(jsonData []byte) {
-	data := DataSocket{message: string(jsonData), RType: MESSAGE}
+func (wsh *WebSocketHandler) send(ctx context.Context, report []byte) error {
+	select {
+	case wsh.data <- DataSocket{message: string(report), RType: MESSAGE}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
 
-	wh.WebSocketHandle.data <- data
+func (wh *WatchHandler) SendMessageToWebSocket(ctx context.Context, jsonData []byte) error {
+	return wh.Sender.send(ctx, jsonData)
 }
 
-// ListenerAndSender listen for changes in cluster and send reports to websocket
+// ListenerAndSender listen for changes in cluster and send reports to websocket, until the context is done
 func (wh *WatchHandler) ListenerAndSender(ctx context.Context) {
 	defer func() {
 		if err := recover(); err != nil {
 			logger.L().Ctx(ctx).Error("RECOVER ListenerAndSender", helpers.Interface("error", err), helpers.String("stack", string(debug.Stack())))
 		}
 	}()
+	defer func() {
+		if ctx.Err() != nil {
+			wh.stop()
+		}
+	}()
 	wh.SetFirstReportFlag(true)
-	for {
+	for ctx.Err() == nil {
 		jsonData := prepareDataToSend(ctx, wh)
 		if jsonData == nil || isEmptyFirstReport(jsonData) {
 			continue // skip (ususally first) report in case it is empty
 		}
-		if jsonData != nil {
-			logger.L().Ctx(ctx).Debug("sending report to websocket", helpers.String("report", string(jsonData)))
-			wh.SendMessageToWebSocket(jsonData)
+		logger.L().Ctx(ctx).Debug("sending report to websocket", helpers.String("report", string(jsonData)))
+		if err := wh.SendMessageToWebSocket(ctx, jsonData); err != nil {
+			wh.unsentReport = jsonData
+			return
 		}
 		if wh.getFirstReportFlag() {
 			wh.SetFirstReportFlag(false)
 		}
-		if WaitTillNewDataArrived(wh) {
-			continue
+		if !WaitTillNewDataArrived(ctx, wh) {
+			return
 		}
 	}
 }
 
-func (wsh *WebSocketHandler) setPingPongHandler(ctx context.Context, conn *websocket.Conn) {
-	end := false
-	timeout := 10 * time.Second
+// setPingPongHandler watches the connection health, the returned function stops it before an intentional close
+func (wsh *WebSocketHandler) setPingPongHandler(ctx context.Context, conn *websocket.Conn) func() {
+	end := &atomic.Bool{}
+	timeout := time.Duration(wsh.settings().PingInterval)
 	go func() {
-		counter := 0
+		// counter is reset by the handlers running on the reading goroutine
+		counter := &atomic.Int32{}
 		defaultPING := conn.PingHandler()
 		conn.SetPingHandler(func(message string) error {
-			counter = 0
+			counter.Store(0)
 			return defaultPING(message)
 		})
 
 		defaultPONG := conn.PongHandler()
 		conn.SetPongHandler(func(message string) error {
-			counter = 0
+			counter.Store(0)
 			return defaultPONG(message)
 		})
 
 		// test ping-pong
 		for {
-			if end {
+			if end.Load() {
 				break
 			}
 			err := conn.WriteControl(websocket.PingMessage, []byte("ping"), time.Now().Add(timeout))
 			if err != nil {
 				logger.L().Ctx(ctx).Error(err.Error())
 			}
-			if counter > 2 {
-				if end {
+			if counter.Load() > 2 {
+				if end.Load() {
 					return
 				}
 				logger.L().Ctx(ctx).Error("ping closed connection")
 				wsh.closeConnection(conn, "ping error")
-				end = true
+				end.Store(true)
 				return
 			}
 			time.Sleep(timeout)
-			counter++
+			counter.Add(1)
 		}
 	}()
 	go func() {
 		for {
-			if end {
+			if end.Load() {
 				break
 			}
 			if _, _, err := conn.ReadMessage(); err != nil {
-				if end {
+				if end.Load() {
 					break
 				}
-				end = true
+				end.Store(true)
 				logger.L().Ctx(ctx).Error("read message closed connection", helpers.Error(err))
 				wsh.closeConnection(conn, "read message error")
 				break
@@ -213,6 +299,7 @@ func (wsh *WebSocketHandler) setPingPongHandler(ctx context.Context, conn *webso
 			time.Sleep(timeout)
 		}
 	}()
+	return func() { end.Store(true) }
 }
 
 func (wsh *WebSocketHandler) closeConnection(conn *websocket.Conn, message string) {
@@ -221,12 +308,3 @@ func (wsh *WebSocketHandler) closeConnection(conn *websocket.Conn, message strin
 	wsh.mutex.Unlock()
 	wsh.data <- DataSocket{RType: EXIT, message: message}
 }
-
-func getNumericValueFromEnvVar(envVar string, defaultValue int) int {
-	if value := os.Getenv(envVar); value != "" {
-		if value, err := strconv.Atoi(value); err == nil {
-			return value
-		}
-	}
-	return defaultValue
-}
@@ -0,0 +1,70 @@
+package watch
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/kubescape/kollector/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestWebSocketHandler starts an event receiver that accepts the connections, the dial times are sent to dials
+func newTestWebSocketHandler(t *testing.T, settings config.WebSocketSettings) (*WebSocketHandler, chan time.Time) {
+	dials := make(chan time.Time, 10)
+	upgrader := websocket.Upgrader{}
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		dials <- time.Now()
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}))
+	t.Cleanup(receiver.Close)
+	u, err := url.Parse("ws://" + receiver.Listener.Addr().String())
+	require.NoError(t, err)
+	return createWebSocketHandler(u, "key", func() config.WebSocketSettings { return settings }), dials
+}
+
+func TestConnectToWebSocketWaitsBeforeConnection(t *testing.T) {
+	wsh, dials := newTestWebSocketHandler(t, config.WebSocketSettings{ConnectRetries: 1, PingInterval: config.Duration(time.Minute)})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	start := time.Now()
+	conn, stopPingPong, err := wsh.connectToWebSocket(ctx, 300*time.Millisecond)
+	require.NoError(t, err)
+	defer conn.Close()
+	defer stopPingPong()
+	assert.GreaterOrEqual(t, (<-dials).Sub(start), 300*time.Millisecond)
+
+	start = time.Now()
+	conn2, stopPingPong2, err := wsh.connectToWebSocket(ctx, 0)
+	require.NoError(t, err)
+	defer conn2.Close()
+	defer stopPingPong2()
+	assert.Less(t, (<-dials).Sub(start), 300*time.Millisecond, "the first dial is not delayed without a wait")
+}
+
+func TestConnectToWebSocketWaitIsCancelled(t *testing.T) {
+	wsh, dials := newTestWebSocketHandler(t, config.WebSocketSettings{ConnectRetries: 1, PingInterval: config.Duration(time.Minute)})
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, _, err := wsh.connectToWebSocket(ctx, time.Minute)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), 5*time.Second)
+	assert.Empty(t, dials)
+}